@@ -26,6 +26,8 @@ import (
 
 const (
 	Kind = "RedisSentinel"
+	// ClusterKind is the kind of the sharded redis clusters
+	ClusterKind = "RedisCluster"
 )
 
 var (
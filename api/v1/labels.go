@@ -4,4 +4,7 @@ const (
 	OperatorName      = "redis-operator"
 	LabelManagedByKey = "app.kubernetes.io/managed-by"
 	LabelNameKey      = "redis.xuan.io/v1"
+
+	// Finalizer holds the deletion of a cluster until the operator tore it down
+	Finalizer = "redis.xuan.io/finalizer"
 )
\ No newline at end of file
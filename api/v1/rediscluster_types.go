@@ -0,0 +1,166 @@
+/*
+
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package v1
+
+import (
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+// RedisClusterSpec defines the desired state of a sharded RedisCluster
+type RedisClusterSpec struct {
+	// Shards is the number of masters the 16384 slots are split between
+	Shards int32 `json:"shards,omitempty"`
+	// ReplicasPerShard is the number of replicas following every master
+	ReplicasPerShard int32                         `json:"replicasPerShard,omitempty"`
+	Resources        corev1.ResourceRequirements   `json:"resources,omitempty"`
+	Image            string                        `json:"image,omitempty"`
+	ImagePullPolicy  corev1.PullPolicy             `json:"imagePullPolicy,omitempty"`
+	ImagePullSecrets []corev1.LocalObjectReference `json:"imagePullSecrets,omitempty"`
+	Storage          RedisStorage                  `json:"storage,omitempty"`
+	Password         string                        `json:"password,omitempty"`
+	Affinity         *corev1.Affinity              `json:"affinity,omitempty"`
+	SecurityContext  *corev1.PodSecurityContext    `json:"securityContext,omitempty"`
+	ToleRations      []corev1.Toleration           `json:"toleRations,omitempty"`
+	NodeSelector     map[string]string             `json:"nodeSelector,omitempty"`
+	Config           map[string]string             `json:"config,omitempty"`
+	Annotations      map[string]string             `json:"annotations,omitempty"`
+	// HardAntiAffinity forbids two redis of the same shard on the same node instead of only avoiding it.
+	// It is not used with an explicit affinity
+	HardAntiAffinity bool `json:"hardAntiAffinity,omitempty"`
+	// Rebalance sets how the slots are moved when the number of shards changes
+	// +optional
+	Rebalance *RebalanceSettings `json:"rebalance,omitempty"`
+	// PDB is the pod disruption budget of every shard, by default one of its pods can be evicted
+	// at a time
+	// +optional
+	PDB *PDBComponentSettings `json:"pdb,omitempty"`
+}
+
+// RebalanceStrategy is what the slots are balanced on when resharding
+type RebalanceStrategy string
+
+const (
+	// RebalanceSlots gives the same number of slots to every shard
+	RebalanceSlots RebalanceStrategy = "slots"
+	// RebalanceKeys balances the number of keys of the shards
+	RebalanceKeys RebalanceStrategy = "keys"
+	// RebalanceMemory balances the memory used by the shards
+	RebalanceMemory RebalanceStrategy = "memory"
+)
+
+// RebalanceSettings are the settings of the slot migrations
+type RebalanceSettings struct {
+	// Strategy is one of slots, keys or memory. Defaults to slots
+	// +kubebuilder:validation:Enum=slots;keys;memory
+	// +optional
+	Strategy RebalanceStrategy `json:"strategy,omitempty"`
+	// SlotsPerReconcile is the number of slots migrated before the progress is saved. Defaults to 128
+	// +optional
+	SlotsPerReconcile int32 `json:"slotsPerReconcile,omitempty"`
+	// KeysPerMigrate is the number of keys moved by every MIGRATE. Defaults to 100
+	// +optional
+	KeysPerMigrate int32 `json:"keysPerMigrate,omitempty"`
+}
+
+// RedisClusterStatus defines the observed state of RedisCluster
+type RedisClusterStatus struct {
+	// ObservedGeneration is the last generation of the cluster handled by the operator
+	// +optional
+	ObservedGeneration int64 `json:"observedGeneration,omitempty"`
+	// Phase is a summary of the state of the cluster
+	// +optional
+	Phase Phase `json:"phase,omitempty"`
+	// Conditions are the latest observations of the state of the cluster
+	// +optional
+	Conditions []Condition `json:"conditions,omitempty"`
+	// Shards is the state of every shard, by index
+	// +optional
+	Shards []ShardStatus `json:"shards,omitempty"`
+	// CurrentShards is the number of shards running, higher than the spec while the removed
+	// shards are drained
+	// +optional
+	CurrentShards int32 `json:"currentShards,omitempty"`
+	// Resharding is the progress of the slot migrations, nil when there is none
+	// +optional
+	Resharding *ReshardingStatus `json:"resharding,omitempty"`
+}
+
+// ReshardingStatus is the plan of the slot migrations moving the cluster to its number of shards
+type ReshardingStatus struct {
+	// Shards is the number of shards serving the slots once the migrations are done
+	Shards int32 `json:"shards"`
+	// Migrations are run in order
+	Migrations []SlotMigration `json:"migrations,omitempty"`
+}
+
+// SlotMigration is a range of slots moved from a shard to another
+type SlotMigration struct {
+	Source int32 `json:"source"`
+	Target int32 `json:"target"`
+	// Slots are the slot ranges moved, like 0-1364
+	Slots string `json:"slots"`
+	// Migrated is the number of slots of the ranges already moved
+	Migrated int32 `json:"migrated"`
+	Total    int32 `json:"total"`
+}
+
+// Done returns true when all the slots of the migration have been moved
+func (m *SlotMigration) Done() bool {
+	return m.Migrated >= m.Total
+}
+
+// ShardStatus is the state of a shard of the RedisCluster
+type ShardStatus struct {
+	Index int32 `json:"index"`
+	// Master is the pod serving the slots of the shard
+	Master string `json:"master,omitempty"`
+	// Slots are the slot ranges served by the master, like 0-5460
+	Slots string `json:"slots,omitempty"`
+	// Replicas is the number of replicas following the master
+	Replicas int32 `json:"replicas"`
+}
+
+// +kubebuilder:object:root=true
+// +kubebuilder:subresource:status
+// +kubebuilder:printcolumn:name="Shards",type="integer",JSONPath=".spec.shards"
+// +kubebuilder:printcolumn:name="Replicas",type="integer",JSONPath=".spec.replicasPerShard"
+// +kubebuilder:printcolumn:name="Phase",type="string",JSONPath=".status.phase"
+// +kubebuilder:printcolumn:name="Ready",type="string",JSONPath=".status.conditions[?(@.type==\"Ready\")].status"
+// +kubebuilder:printcolumn:name="Age",type="date",JSONPath=".metadata.creationTimestamp"
+
+// RedisCluster is the Schema for the sharded redisclusters API
+type RedisCluster struct {
+	metav1.TypeMeta   `json:",inline"`
+	metav1.ObjectMeta `json:"metadata,omitempty"`
+
+	Spec   RedisClusterSpec   `json:"spec,omitempty"`
+	Status RedisClusterStatus `json:"status,omitempty"`
+}
+
+// +kubebuilder:object:root=true
+
+// RedisClusterList contains a list of RedisCluster
+type RedisClusterList struct {
+	metav1.TypeMeta `json:",inline"`
+	metav1.ListMeta `json:"metadata,omitempty"`
+	Items           []RedisCluster `json:"items"`
+}
+
+func init() {
+	SchemeBuilder.Register(&RedisCluster{}, &RedisClusterList{})
+}
@@ -19,6 +19,7 @@ package v1
 import (
 	corev1 "k8s.io/api/core/v1"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/util/intstr"
 )
 
 // EDIT THIS FILE!  THIS IS SCAFFOLDING FOR YOU TO OWN!
@@ -43,6 +44,36 @@ type RedisSentinelSpec struct {
 	Config             map[string]string             `json:"config,omitempty"`
 	Annotations        map[string]string             `json:"annotations,omitempty"`
 	DisablePersistence bool                          `json:"disablePersistence,omitempty"`
+	// UseHostnames makes replication and monitoring use the stable DNS names of the pods
+	// instead of their IPs. Requires redis and sentinel 6.2 or newer
+	UseHostnames bool `json:"useHostnames,omitempty"`
+	// Expose makes every redis and sentinel pod reachable from outside the cluster. Requires
+	// redis and sentinel 6.2 or newer
+	Expose *ExposeSettings `json:"expose,omitempty"`
+	// Monitoring defines the prometheus alerts created for the cluster
+	Monitoring *MonitoringSettings `json:"monitoring,omitempty"`
+	// Memory defines how the memory of redis is derived from its resources
+	Memory *MemorySettings `json:"memory,omitempty"`
+	// Placement defines how the redis and sentinel pods are spread across nodes and zones
+	Placement *PlacementSettings `json:"placement,omitempty"`
+	// PDB defines the pod disruption budgets of the redis and the sentinel pods
+	PDB *PDBSettings `json:"pdb,omitempty"`
+	// ReplicaOf makes the cluster a read-only standby of another RedisSentinel or an external
+	// redis. Removing it promotes the standby
+	ReplicaOf *ReplicaOfSettings `json:"replicaOf,omitempty"`
+	// Migration moves the data of an unmanaged redis into the cluster, the cluster replicates it
+	// until the cutover
+	Migration *MigrationSettings `json:"migration,omitempty"`
+	// Paused stops the operator from changing the cluster while it is repaired by hand, only
+	// its status is updated
+	Paused bool `json:"paused,omitempty"`
+	// EmergencyHealing makes the operator promote a redis when there is no master, even while
+	// the cluster is paused. Defaults to true
+	EmergencyHealing *bool `json:"emergencyHealing,omitempty"`
+	// MaintenanceWindow restricts the disruptive changes, the rolling restarts of the
+	// statefulsets and the resize of the volumes, to the time it is open. The healing of the
+	// cluster still runs outside of it
+	MaintenanceWindow *MaintenanceWindow `json:"maintenanceWindow,omitempty"`
 
 	// Sentinel defines its cluster settings
 	Sentinel SentinelSettings `json:"sentinel,omitempty"`
@@ -50,6 +81,12 @@ type RedisSentinelSpec struct {
 
 
 // +kubebuilder:object:root=true
+// +kubebuilder:subresource:status
+// +kubebuilder:printcolumn:name="Phase",type="string",JSONPath=".status.phase"
+// +kubebuilder:printcolumn:name="Ready",type="string",JSONPath=".status.conditions[?(@.type==\"Ready\")].status"
+// +kubebuilder:printcolumn:name="Version",type="string",JSONPath=".status.version"
+// +kubebuilder:printcolumn:name="Master",type="string",JSONPath=".status.masterIP"
+// +kubebuilder:printcolumn:name="Age",type="date",JSONPath=".metadata.creationTimestamp"
 
 // RedisSentinel is the Schema for the redissentinels API
 type RedisSentinel struct {
@@ -78,6 +115,38 @@ type RedisExporter struct {
 	Enabled         bool              `json:"enabled,omitempty"`
 	Image           string            `json:"image,omitempty"`
 	ImagePullPolicy corev1.PullPolicy `json:"imagePullPolicy,omitempty"`
+	// Resources of the exporter containers, small defaults are used when empty
+	Resources corev1.ResourceRequirements `json:"resources,omitempty"`
+	// Args are passed to the exporter containers
+	Args []string `json:"args,omitempty"`
+	// Sentinel adds an exporter container to the sentinel pods too
+	Sentinel bool `json:"sentinel,omitempty"`
+	// ServiceMonitor creates a prometheus-operator ServiceMonitor scraping the exporters
+	ServiceMonitor *ServiceMonitorSettings `json:"serviceMonitor,omitempty"`
+}
+
+// ServiceMonitorSettings defines the monitoring.coreos.com/v1 ServiceMonitor created for the exporters.
+// Nothing is created when the prometheus-operator CRDs are not installed.
+type ServiceMonitorSettings struct {
+	// Labels are added to the ServiceMonitor so it is selected by the prometheus instance
+	Labels map[string]string `json:"labels,omitempty"`
+	// Interval between scrapes, prometheus default when empty
+	Interval string `json:"interval,omitempty"`
+	// ScrapeTimeout of each scrape, prometheus default when empty
+	ScrapeTimeout string `json:"scrapeTimeout,omitempty"`
+	// Relabelings applied to the targets before scraping
+	Relabelings []RelabelConfig `json:"relabelings,omitempty"`
+}
+
+// RelabelConfig is a prometheus relabeling rule
+type RelabelConfig struct {
+	SourceLabels []string `json:"sourceLabels,omitempty"`
+	Separator    string   `json:"separator,omitempty"`
+	TargetLabel  string   `json:"targetLabel,omitempty"`
+	Regex        string   `json:"regex,omitempty"`
+	Modulus      uint64   `json:"modulus,omitempty"`
+	Replacement  string   `json:"replacement,omitempty"`
+	Action       string   `json:"action,omitempty"`
 }
 
 // SentinelSettings defines the specification of the sentinel cluster
@@ -96,9 +165,130 @@ type SentinelSettings struct {
 	Annotations      map[string]string             `json:"annotations,omitempty"`
 }
 
+// ExposeSettings defines how the redis and sentinel pods are published outside the cluster.
+// A service of the given type is created per pod, and its address is announced by redis
+// and sentinel instead of the pod IP. Sentinels need 6.2 or newer to change their announce
+// address at runtime.
+type ExposeSettings struct {
+	// Type of the per pod services, LoadBalancer or NodePort. Defaults to LoadBalancer
+	Type                     corev1.ServiceType `json:"type,omitempty"`
+	Annotations              map[string]string  `json:"annotations,omitempty"`
+	LoadBalancerSourceRanges []string           `json:"loadBalancerSourceRanges,omitempty"`
+}
+
+// MonitoringSettings defines the prometheus-operator objects created to watch the cluster
+type MonitoringSettings struct {
+	// Alerts creates a monitoring.coreos.com/v1 PrometheusRule with the default alerts of the cluster
+	Alerts *AlertSettings `json:"alerts,omitempty"`
+}
+
+// AlertSettings tunes the alerts of the PrometheusRule. The rules are based on the metrics of the
+// exporters and of the operator, so the exporter must be enabled and the operator scraped with
+// honorLabels. Nothing is created when the prometheus-operator CRDs are not installed.
+type AlertSettings struct {
+	// Labels are added to the PrometheusRule so it is selected by the prometheus instance
+	Labels map[string]string `json:"labels,omitempty"`
+	// AlertLabels are added to every alert, after the default severity label
+	AlertLabels map[string]string `json:"alertLabels,omitempty"`
+	// For is how long a condition must hold before its alert fires. Defaults to 5m
+	For string `json:"for,omitempty"`
+	// ReplicaLagBytes is the replication lag firing the replica lag alert. Defaults to 10Mi
+	ReplicaLagBytes int64 `json:"replicaLagBytes,omitempty"`
+	// MemoryUsagePercent is the percentage of maxmemory firing the memory alert. Defaults to 90
+	MemoryUsagePercent int32 `json:"memoryUsagePercent,omitempty"`
+	// Disabled lists the names of the default alerts not to create
+	Disabled []string `json:"disabled,omitempty"`
+}
+
+// MemorySettings defines how the memory of redis is derived from its resources
+type MemorySettings struct {
+	// AutoMaxmemory is the percentage of resources.limits.memory set as maxmemory when the
+	// config doesn't set it. The rest of the limit is left for the replication buffers, the
+	// AOF rewrite and the process overhead, so it can't be higher than 90. 0 disables it
+	// +kubebuilder:validation:Minimum=0
+	// +kubebuilder:validation:Maximum=90
+	AutoMaxmemory int32 `json:"autoMaxmemory,omitempty"`
+}
+
+// PlacementSettings defines how the redis and sentinel pods are spread. It is not used
+// for the pods with an explicit affinity.
+type PlacementSettings struct {
+	// HardAntiAffinity forbids two redis, or two sentinels, on the same node instead of only avoiding it
+	HardAntiAffinity bool `json:"hardAntiAffinity,omitempty"`
+	// ZoneSpread spreads the redis and the sentinel pods across the zones of the nodes
+	ZoneSpread bool `json:"zoneSpread,omitempty"`
+	// MaxSkew is the maximum difference of pods between two zones. Defaults to 1
+	MaxSkew int32 `json:"maxSkew,omitempty"`
+	// WhenUnsatisfiable is DoNotSchedule or ScheduleAnyway. Defaults to ScheduleAnyway
+	WhenUnsatisfiable corev1.UnsatisfiableConstraintAction `json:"whenUnsatisfiable,omitempty"`
+	// PreferredMasterZone is the zone the master is chosen from when possible. The replicas
+	// of the other zones get a lower priority, so the sentinels promote the ones in this zone
+	PreferredMasterZone string `json:"preferredMasterZone,omitempty"`
+}
+
+// PDBSettings defines the pod disruption budgets of the cluster. When a component isn't
+// set the redis budget allows one unavailable pod and the sentinel one keeps the quorum.
+type PDBSettings struct {
+	Redis    *PDBComponentSettings `json:"redis,omitempty"`
+	Sentinel *PDBComponentSettings `json:"sentinel,omitempty"`
+}
+
+// PDBComponentSettings defines the pod disruption budget of a component, only one of
+// MinAvailable and MaxUnavailable can be set
+type PDBComponentSettings struct {
+	MinAvailable   *intstr.IntOrString `json:"minAvailable,omitempty"`
+	MaxUnavailable *intstr.IntOrString `json:"maxUnavailable,omitempty"`
+}
+
+// ReplicaOfSettings is the source replicated by a standby cluster, either a RedisSentinel or a
+// host and port
+type ReplicaOfSettings struct {
+	// Name of the source RedisSentinel
+	Name string `json:"name,omitempty"`
+	// Namespace of the source RedisSentinel, defaults to the namespace of the cluster
+	Namespace string `json:"namespace,omitempty"`
+	// Host and Port are the address of an external source master, used when Name is empty
+	Host string `json:"host,omitempty"`
+	Port int32  `json:"port,omitempty"`
+	// Password of the source, defaults to the password of the source RedisSentinel or, for
+	// an external source, to the password of the cluster
+	Password string `json:"password,omitempty"`
+}
+
+// MaintenanceWindow opens every time its schedule fires and stays open for its duration
+type MaintenanceWindow struct {
+	// Schedule is a cron expression of 5 fields in UTC, like "0 2 * * 6"
+	Schedule string `json:"schedule"`
+	// Duration is how long the window stays open, like 2h
+	Duration metav1.Duration `json:"duration"`
+}
+
+// MigrationSettings is the live migration of an unmanaged redis into the cluster
+type MigrationSettings struct {
+	// Source is the redis master the data is migrated from
+	Source MigrationSource `json:"source"`
+	// Cutover makes the source read-only and, once the cluster caught up with it, promotes the
+	// master of the cluster. The migration can't be resumed after it completed
+	Cutover bool `json:"cutover,omitempty"`
+}
+
+// MigrationSource is the address and the password of the redis migrated
+type MigrationSource struct {
+	Host string `json:"host"`
+	Port int32  `json:"port,omitempty"`
+	// PasswordSecret is the key of a Secret of the namespace of the cluster holding the password
+	// of the source, the source has no password when it is not set
+	PasswordSecret *corev1.SecretKeySelector `json:"passwordSecret,omitempty"`
+}
+
 // RedisStorage defines the structure used to store the Redis Data
 type RedisStorage struct {
-	KeepAfterDeletion     bool                          `json:"keepAfterDeletion,omitempty"`
+	// KeepAfterDeletion retains the persistent volume claims when the cluster is deleted
+	KeepAfterDeletion bool `json:"keepAfterDeletion,omitempty"`
+	// BackupOnDeletion saves a last RDB snapshot on the master before the cluster is deleted,
+	// the deletion waits until it succeeded. Use it with KeepAfterDeletion to keep the data.
+	// Setting it back to false gives up the snapshot of a deletion blocked by it
+	BackupOnDeletion      bool                          `json:"backupOnDeletion,omitempty"`
 	EmptyDir              *corev1.EmptyDirVolumeSource  `json:"emptyDir,omitempty"`
 	PersistentVolumeClaim *corev1.PersistentVolumeClaim `json:"persistentVolumeClaim,omitempty"`
 }
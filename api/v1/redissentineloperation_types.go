@@ -0,0 +1,126 @@
+/*
+
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package v1
+
+import (
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+// OperationAction is the manual operation run on a RedisSentinel
+type OperationAction string
+
+// Actions of a RedisSentinelOperation
+const (
+	// ActionRestartPod deletes a redis or sentinel pod, a master is failed over first
+	ActionRestartPod OperationAction = "RestartPod"
+	// ActionFailover asks the sentinels to promote a replica
+	ActionFailover OperationAction = "Failover"
+	// ActionResetSentinels makes every sentinel forget the replicas and sentinels it knows
+	ActionResetSentinels OperationAction = "ResetSentinels"
+	// ActionRewriteAOF runs BGREWRITEAOF on every redis
+	ActionRewriteAOF OperationAction = "RewriteAOF"
+	// ActionResyncReplica flushes a replica and makes it load a full copy of the master
+	ActionResyncReplica OperationAction = "ResyncReplica"
+	// ActionRotatePassword changes the password of every redis and sentinel and the spec
+	ActionRotatePassword OperationAction = "RotatePassword"
+)
+
+// OperationPhase is the state of an operation or of one of its targets
+type OperationPhase string
+
+// Phases of an operation
+const (
+	OperationPending   OperationPhase = "Pending"
+	OperationRunning   OperationPhase = "Running"
+	OperationSucceeded OperationPhase = "Succeeded"
+	OperationFailed    OperationPhase = "Failed"
+)
+
+// RedisSentinelOperationSpec defines the operation to run, it is read once when the operation
+// starts
+type RedisSentinelOperationSpec struct {
+	// ClusterName is the RedisSentinel of the namespace of the operation it runs on
+	ClusterName string `json:"clusterName"`
+	// +kubebuilder:validation:Enum=RestartPod;Failover;ResetSentinels;RewriteAOF;ResyncReplica;RotatePassword
+	Action OperationAction `json:"action"`
+	// Pod is the pod restarted by RestartPod or the replica resynced by ResyncReplica
+	// +optional
+	Pod string `json:"pod,omitempty"`
+	// PasswordSecret is the key of a Secret of the namespace of the operation holding the new
+	// password set by RotatePassword
+	// +optional
+	PasswordSecret *corev1.SecretKeySelector `json:"passwordSecret,omitempty"`
+}
+
+// OperationTarget is the progress of the operation on a pod, or on the spec of the cluster
+type OperationTarget struct {
+	Name  string         `json:"name"`
+	Phase OperationPhase `json:"phase"`
+	// +optional
+	Message string `json:"message,omitempty"`
+}
+
+// RedisSentinelOperationStatus is the progress and the result of the operation
+type RedisSentinelOperationStatus struct {
+	// +optional
+	Phase OperationPhase `json:"phase,omitempty"`
+	// Message explains the phase, the reason of a failure or what the operation waits for
+	// +optional
+	Message string `json:"message,omitempty"`
+	// Targets are the pods the operation runs on, in the order it runs on them
+	// +optional
+	Targets []OperationTarget `json:"targets,omitempty"`
+	// +optional
+	StartTime *metav1.Time `json:"startTime,omitempty"`
+	// +optional
+	CompletionTime *metav1.Time `json:"completionTime,omitempty"`
+}
+
+// Finished is true once the operation succeeded or failed, it never runs again
+func (s *RedisSentinelOperationStatus) Finished() bool {
+	return s.Phase == OperationSucceeded || s.Phase == OperationFailed
+}
+
+// +kubebuilder:object:root=true
+// +kubebuilder:subresource:status
+// +kubebuilder:printcolumn:name="Cluster",type="string",JSONPath=".spec.clusterName"
+// +kubebuilder:printcolumn:name="Action",type="string",JSONPath=".spec.action"
+// +kubebuilder:printcolumn:name="Phase",type="string",JSONPath=".status.phase"
+// +kubebuilder:printcolumn:name="Age",type="date",JSONPath=".metadata.creationTimestamp"
+
+// RedisSentinelOperation is the Schema for the manual operations run on a RedisSentinel
+type RedisSentinelOperation struct {
+	metav1.TypeMeta   `json:",inline"`
+	metav1.ObjectMeta `json:"metadata,omitempty"`
+
+	Spec   RedisSentinelOperationSpec   `json:"spec,omitempty"`
+	Status RedisSentinelOperationStatus `json:"status,omitempty"`
+}
+
+// +kubebuilder:object:root=true
+
+// RedisSentinelOperationList contains a list of RedisSentinelOperation
+type RedisSentinelOperationList struct {
+	metav1.TypeMeta `json:",inline"`
+	metav1.ListMeta `json:"metadata,omitempty"`
+	Items           []RedisSentinelOperation `json:"items"`
+}
+
+func init() {
+	SchemeBuilder.Register(&RedisSentinelOperation{}, &RedisSentinelOperationList{})
+}
@@ -1,28 +1,46 @@
 package v1
-import (
-	"sort"
-	"time"
 
+import (
 	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 )
 
-// Phase of the RF status
+// Phase is a summary of the state of the cluster, the conditions hold the details
 type Phase string
 
-// Condition saves the state information of the redis cluster
+const (
+	PhaseCreating    Phase = "Creating"
+	PhaseScaling     Phase = "Scaling"
+	PhaseScalingDown Phase = "ScalingDown"
+	PhaseUpgrading   Phase = "Upgrading"
+	PhaseUpdating    Phase = "Updating"
+	PhaseRecovering  Phase = "Recovering"
+	PhaseRunning     Phase = "Running"
+	PhaseFailed      Phase = "Failed"
+	PhaseResizing    Phase = "Resizing"
+	PhaseTerminating Phase = "Terminating"
+	PhaseFailingOver Phase = "FailingOver"
+	PhaseResharding  Phase = "Resharding"
+	PhaseCuttingOver Phase = "CuttingOver"
+	PhasePaused      Phase = "Paused"
+)
+
+// Condition saves the state information of the redis cluster, it follows the
+// metav1.Condition conventions so tools like kubectl wait can use it
 type Condition struct {
-	// Status of cluster condition.
+	// Type of the condition, in CamelCase.
 	Type ConditionType `json:"type"`
 	// Status of the condition, one of True, False, Unknown.
 	Status corev1.ConditionStatus `json:"status"`
-	// The last time this condition was updated.
-	LastUpdateTime string    `json:"lastUpdateTime,omitempty"`
-	LastUpdateAt   time.Time `json:"-"`
+	// ObservedGeneration is the generation of the cluster the condition was set from.
+	// +optional
+	ObservedGeneration int64 `json:"observedGeneration,omitempty"`
 	// Last time the condition transitioned from one status to another.
-	LastTransitionTime string `json:"lastTransitionTime,omitempty"`
-	// The reason for the condition's last transition.
-	Reason string `json:"reason,omitempty"`
+	LastTransitionTime metav1.Time `json:"lastTransitionTime"`
+	// The reason for the condition's last transition, in CamelCase.
+	Reason string `json:"reason"`
 	// A human readable message indicating details about the transition.
+	// +optional
 	Message string `json:"message,omitempty"`
 }
 
@@ -30,118 +48,344 @@ type Condition struct {
 type ConditionType string
 
 const (
-	ClusterConditionAvailable   ConditionType = "Available"
-	ClusterConditionHealthy     ConditionType = "Healthy"
-	ClusterConditionRunning                   = "Running"
-	ClusterConditionCreating                  = "Creating"
-	ClusterConditionRecovering                = "Recovering"
-	ClusterConditionScaling                   = "Scaling"
-	ClusterConditionScalingDown               = "ScalingDown"
-	ClusterConditionUpgrading                 = "Upgrading"
-	ClusterConditionUpdating                  = "Updating"
-	ClusterConditionFailed                    = "Failed"
+	// ConditionReady is true when the cluster matches its spec and all the checks passed
+	ConditionReady ConditionType = "Ready"
+	// ConditionAvailable is true when there is a single master accepting writes
+	ConditionAvailable ConditionType = "Available"
+	// ConditionProgressing is true while the operator applies a change of the spec
+	ConditionProgressing ConditionType = "Progressing"
+	// ConditionDegraded is true when the last reconcile failed
+	ConditionDegraded ConditionType = "Degraded"
+	// ConditionReplicationHealthy is true when all the replicas are running and follow the master
+	ConditionReplicationHealthy ConditionType = "ReplicationHealthy"
+	// ConditionSentinelQuorum is true when enough sentinels monitor the master to reach the quorum
+	ConditionSentinelQuorum ConditionType = "SentinelQuorum"
+	// ConditionSourceLinkUp is true when the master of a standby cluster is connected to its source
+	ConditionSourceLinkUp ConditionType = "SourceLinkUp"
+	// ConditionPaused is true while the operator leaves the cluster alone, spec.paused is set
+	ConditionPaused ConditionType = "Paused"
+	// ConditionMaintenancePending is true when disruptive changes wait for the maintenance window
+	ConditionMaintenancePending ConditionType = "MaintenancePending"
+	// ConditionMaxmemoryExceedsLimit is true when maxmemory is above the memory limit of the redis
+	ConditionMaxmemoryExceedsLimit ConditionType = "MaxmemoryExceedsLimit"
+	// ConditionSourceReadOnly is true while the cutover of a migration keeps its source read-only
+	ConditionSourceReadOnly ConditionType = "SourceReadOnly"
+	// ConditionFinalSnapshot is true once the snapshot taken before the deletion was saved, it
+	// is false while the deletion waits for it
+	ConditionFinalSnapshot ConditionType = "FinalSnapshot"
+)
+
+// Reasons of the conditions set by the operator
+const (
+	ReasonReconciled    = "Reconciled"
+	ReasonEnsureFailed  = "EnsureFailed"
+	ReasonCheckFailed   = "CheckAndHealFailed"
+	ReasonPodsNotReady  = "PodsNotReady"
+	ReasonMasterFound   = "MasterFound"
+	ReasonNoMaster      = "NoMaster"
+	ReasonManyMasters   = "MultipleMasters"
+	ReasonReplicasOK    = "ReplicasFollowMaster"
+	ReasonReplicasDown  = "ReplicasNotRunning"
+	ReasonReplicasWrong = "ReplicasMisconfigured"
+	ReasonQuorumReached = "QuorumReached"
+	ReasonQuorumLost    = "QuorumLost"
+	ReasonNodeDraining  = "MasterNodeDraining"
+	ReasonBadVersion    = "UnsupportedVersion"
+	ReasonClusterOK     = "ClusterStateOK"
+	ReasonClusterFail   = "ClusterStateFail"
+	ReasonSlotsMissing  = "SlotsNotCovered"
+	ReasonStandby       = "ReadOnlyStandby"
+	ReasonLinkUp        = "LinkUp"
+	ReasonLinkDown      = "LinkDown"
+	ReasonPromoted      = "Promoted"
+	ReasonMigrating     = "Migrating"
+	ReasonPaused        = "Paused"
+	ReasonOutsideWindow = "OutsideMaintenanceWindow"
+	ReasonAboveLimit    = "AboveMemoryLimit"
+	ReasonCutover       = "Cutover"
+	ReasonRestored      = "SourceWritesRestored"
+	ReasonSnapshotSaved = "SnapshotSaved"
+	ReasonSnapshotFail  = "SnapshotFailed"
 )
 
 // RedisClusterStatus defines the observed state of RedisCluster
 // +k8s:openapi-gen=true
 type RedisSentinelStatus struct {
-	// INSERT ADDITIONAL STATUS FIELD - define observed state of cluster
-	// Important: Run "operator-sdk generate k8s" to regenerate code after modifying this file
-	// Add custom validation using kubebuilder tags: https://book.kubebuilder.io/beyond_basics/generating_crd.html
+	// ObservedGeneration is the last generation of the cluster handled by the operator
+	// +optional
+	ObservedGeneration int64 `json:"observedGeneration,omitempty"`
+	// Phase is a summary of the state of the cluster
+	// +optional
+	Phase Phase `json:"phase,omitempty"`
+	// Conditions are the latest observations of the state of the cluster
+	// +optional
 	Conditions []Condition `json:"conditions,omitempty"`
 	MasterIP   string      `json:"masterIP,omitempty"`
-	SentinelIP string      `json:"sentinelIP,omitempty"`
+	// MasterPod is the master seen by the last reconcile, a failover while the operator was
+	// down is detected against it
+	// +optional
+	MasterPod  string `json:"masterPod,omitempty"`
+	SentinelIP string `json:"sentinelIP,omitempty"`
+	// Flavor and Version are the highest redis or valkey version run by the cluster, the
+	// image can't be changed to one unable to load its data
+	// +optional
+	Flavor string `json:"flavor,omitempty"`
+	// +optional
+	Version string `json:"version,omitempty"`
+	// Replication is the link of a standby cluster to its source, nil when it is no standby
+	// +optional
+	Replication *ReplicationStatus `json:"replication,omitempty"`
+	// Migration is the progress of the migration of an unmanaged redis into the cluster
+	// +optional
+	Migration *MigrationStatus `json:"migration,omitempty"`
+}
+
+// ReplicationStatus is the state of the replication of a standby cluster from its source
+type ReplicationStatus struct {
+	// Source is the host:port replicated
+	Source string `json:"source"`
+	// Head is the redis pod replicating the source, the others replicate it
+	Head string `json:"head,omitempty"`
+	// LinkUp is true when the head is connected to the source
+	LinkUp bool `json:"linkUp"`
+	// LastIOSecondsAgo is the time since the head received data from the source
+	// +optional
+	LastIOSecondsAgo int64 `json:"lastIOSecondsAgo,omitempty"`
+	// LagBytes is the replication offset the head is behind the source, unknown when the
+	// operator can't reach the source
+	// +optional
+	LagBytes *int64 `json:"lagBytes,omitempty"`
+}
+
+// MigrationPhase is the step a migration is at
+type MigrationPhase string
+
+// Steps of a migration
+const (
+	MigrationSyncing     MigrationPhase = "Syncing"
+	MigrationInSync      MigrationPhase = "InSync"
+	MigrationCuttingOver MigrationPhase = "CuttingOver"
+	MigrationCompleted   MigrationPhase = "Completed"
+)
+
+// MigrationStatus is the state of the migration of an unmanaged redis into the cluster
+type MigrationStatus struct {
+	Phase MigrationPhase `json:"phase"`
+	// Source is the host:port migrated
+	Source string `json:"source"`
+	// Head is the redis pod replicating the source, it becomes the master at the cutover
+	Head string `json:"head,omitempty"`
+	// LinkUp is true when the head is connected to the source
+	LinkUp bool `json:"linkUp"`
+	// SyncInProgress is true while the head loads the initial copy of the source
+	SyncInProgress bool `json:"syncInProgress,omitempty"`
+	// LagBytes is the replication offset the head is behind the source, unknown when the
+	// operator can't reach the source
+	// +optional
+	LagBytes *int64 `json:"lagBytes,omitempty"`
+	// FinalOffset is the replication offset of the source once read-only, the head reached it
+	// before being promoted so no write was lost
+	// +optional
+	FinalOffset int64 `json:"finalOffset,omitempty"`
+	// CompletedTime is when the head was promoted
+	// +optional
+	CompletedTime *metav1.Time `json:"completedTime,omitempty"`
+	// ReadOnlySource is the source the cutover made read-only, it is reached from it to be
+	// restored once the migration was removed from the spec
+	// +optional
+	ReadOnlySource *MigrationSource `json:"readOnlySource,omitempty"`
+	// SourceWrites are the settings of the source before the cutover, they are restored when
+	// the migration is aborted
+	// +optional
+	SourceWrites *SourceWrites `json:"sourceWrites,omitempty"`
+}
+
+// SourceWrites are the settings deciding whether a source accepts the writes
+type SourceWrites struct {
+	// MinReplicasToWrite is the min-slaves-to-write of the source
+	MinReplicasToWrite string `json:"minReplicasToWrite"`
+	// MinReplicasMaxLag is the min-slaves-max-lag of the source
+	MinReplicasMaxLag string `json:"minReplicasMaxLag"`
 }
 
-func (rss *RedisSentinelStatus) DescConditionsByTime() {
-	sort.Slice(rss.Conditions, func(i, j int) bool {
-		return rss.Conditions[i].LastUpdateAt.After(rss.Conditions[j].LastUpdateAt)
-	})
+// SetProgressingCondition marks the cluster as applying a change of its spec
+func (rss *RedisSentinelStatus) SetProgressingCondition(phase Phase, message string, generation int64) {
+	rss.Phase = phase
+	rss.ObservedGeneration = generation
+	rss.SetCondition(ConditionProgressing, corev1.ConditionTrue, string(phase), message, generation)
+	if phase == PhaseCreating {
+		rss.SetCondition(ConditionReady, corev1.ConditionFalse, string(phase), message, generation)
+	}
+}
+
+// SetRecoveringCondition marks the cluster as not ready while its pods come back
+func (rss *RedisSentinelStatus) SetRecoveringCondition(message string, generation int64) {
+	rss.Phase = PhaseRecovering
+	rss.ObservedGeneration = generation
+	rss.SetCondition(ConditionProgressing, corev1.ConditionTrue, ReasonPodsNotReady, message, generation)
+	rss.SetCondition(ConditionReady, corev1.ConditionFalse, ReasonPodsNotReady, message, generation)
 }
 
-func (rss *RedisSentinelStatus) SetScalingUpCondition(message string) {
-	c := newClusterCondition(ClusterConditionScaling, corev1.ConditionTrue, "Scaling up", message)
-	rss.setClusterCondition(*c)
+// SetFailingOverCondition marks the cluster as not ready while the master moves to a replica
+func (rss *RedisSentinelStatus) SetFailingOverCondition(message string, generation int64) {
+	rss.Phase = PhaseFailingOver
+	rss.ObservedGeneration = generation
+	rss.SetCondition(ConditionProgressing, corev1.ConditionTrue, ReasonNodeDraining, message, generation)
+	rss.SetCondition(ConditionReady, corev1.ConditionFalse, ReasonNodeDraining, message, generation)
 }
 
-func (rss *RedisSentinelStatus) SetCreateCondition(message string) {
-	c := newClusterCondition(ClusterConditionCreating, corev1.ConditionTrue, "Creating", message)
-	rss.setClusterCondition(*c)
+// SetCuttingOverCondition marks the cluster as not ready while it waits to catch up with the
+// source of its migration
+func (rss *RedisSentinelStatus) SetCuttingOverCondition(message string, generation int64) {
+	rss.Phase = PhaseCuttingOver
+	rss.ObservedGeneration = generation
+	rss.SetCondition(ConditionProgressing, corev1.ConditionTrue, ReasonMigrating, message, generation)
+	rss.SetCondition(ConditionReady, corev1.ConditionFalse, ReasonMigrating, message, generation)
 }
 
-func (rss *RedisSentinelStatus) SetScalingDownCondition(message string) {
-	c := newClusterCondition(ClusterConditionScaling, corev1.ConditionTrue, "Scaling down", message)
-	rss.setClusterCondition(*c)
+// SetPausedCondition marks the cluster as left alone by the operator
+func (rss *RedisSentinelStatus) SetPausedCondition(message string, generation int64) {
+	rss.Phase = PhasePaused
+	rss.ObservedGeneration = generation
+	rss.SetCondition(ConditionPaused, corev1.ConditionTrue, ReasonPaused, message, generation)
+	rss.SetCondition(ConditionProgressing, corev1.ConditionFalse, ReasonPaused, message, generation)
 }
 
-func (rss *RedisSentinelStatus) SetUpgradingCondition(message string) {
-	c := newClusterCondition(ClusterConditionUpgrading, corev1.ConditionTrue,
-		"Cluster upgrading", message)
-	rss.setClusterCondition(*c)
+// SetReadyCondition marks the cluster as matching its spec
+func (rss *RedisSentinelStatus) SetReadyCondition(message string, generation int64) {
+	rss.Phase = PhaseRunning
+	rss.ObservedGeneration = generation
+	rss.SetCondition(ConditionReady, corev1.ConditionTrue, ReasonReconciled, message, generation)
+	rss.SetCondition(ConditionProgressing, corev1.ConditionFalse, ReasonReconciled, message, generation)
+	rss.SetCondition(ConditionDegraded, corev1.ConditionFalse, ReasonReconciled, message, generation)
 }
 
-func (rss *RedisSentinelStatus) SetUpdatingCondition(message string) {
-	c := newClusterCondition(ClusterConditionUpdating, corev1.ConditionTrue,
-		"Cluster updating", message)
-	rss.setClusterCondition(*c)
+// SetFailedCondition marks the cluster as degraded because of the given reason
+func (rss *RedisSentinelStatus) SetFailedCondition(reason string, message string, generation int64) {
+	rss.Phase = PhaseFailed
+	rss.ObservedGeneration = generation
+	rss.SetCondition(ConditionReady, corev1.ConditionFalse, reason, message, generation)
+	rss.SetCondition(ConditionDegraded, corev1.ConditionTrue, reason, message, generation)
+}
+
+// SetBoolCondition sets a condition to True or False
+func (rss *RedisSentinelStatus) SetBoolCondition(t ConditionType, ok bool, reason, message string, generation int64) {
+	status := corev1.ConditionFalse
+	if ok {
+		status = corev1.ConditionTrue
+	}
+	rss.SetCondition(t, status, reason, message, generation)
 }
 
-func (rss *RedisSentinelStatus) SetReadyCondition(message string) {
-	c := newClusterCondition(ClusterConditionHealthy, corev1.ConditionTrue, "Cluster available", message)
-	rss.setClusterCondition(*c)
+// SetCondition adds or updates the condition of the given type. The transition time only
+// changes when the status of the condition does.
+func (rss *RedisSentinelStatus) SetCondition(t ConditionType, status corev1.ConditionStatus, reason, message string, generation int64) {
+	setCondition(&rss.Conditions, t, status, reason, message, generation)
 }
 
-func (rss *RedisSentinelStatus) SetFailedCondition(message string) {
-	c := newClusterCondition(ClusterConditionFailed, corev1.ConditionTrue,
-		"Cluster failed", message)
-	rss.setClusterCondition(*c)
+// GetCondition returns the condition of the given type, nil if it isn't set
+func (rss *RedisSentinelStatus) GetCondition(t ConditionType) *Condition {
+	return getCondition(rss.Conditions, t)
 }
 
+// IsConditionTrue returns true if the condition of the given type is set and True
+func (rss *RedisSentinelStatus) IsConditionTrue(t ConditionType) bool {
+	c := rss.GetCondition(t)
+	return c != nil && c.Status == corev1.ConditionTrue
+}
+
+// ClearCondition removes the condition of the given type
 func (rss *RedisSentinelStatus) ClearCondition(t ConditionType) {
-	pos, _ := getClusterCondition(rss, t)
-	if pos == -1 {
-		return
+	for i := range rss.Conditions {
+		if rss.Conditions[i].Type == t {
+			rss.Conditions = append(rss.Conditions[:i], rss.Conditions[i+1:]...)
+			return
+		}
 	}
-	rss.Conditions = append(rss.Conditions[:pos], rss.Conditions[pos+1:]...)
 }
 
-func (rss *RedisSentinelStatus) setClusterCondition(c Condition) {
-	pos, cp := getClusterCondition(rss, c.Type)
-	if cp != nil &&
-		cp.Status == c.Status && cp.Reason == c.Reason && cp.Message == c.Message {
-		now := time.Now()
-		nowString := now.Format(time.RFC3339)
-		rss.Conditions[pos].LastUpdateAt = now
-		rss.Conditions[pos].LastUpdateTime = nowString
-		return
+// SetProgressingCondition marks the cluster as applying a change of its spec
+func (rcs *RedisClusterStatus) SetProgressingCondition(phase Phase, message string, generation int64) {
+	rcs.Phase = phase
+	rcs.ObservedGeneration = generation
+	rcs.SetCondition(ConditionProgressing, corev1.ConditionTrue, string(phase), message, generation)
+	if phase == PhaseCreating {
+		rcs.SetCondition(ConditionReady, corev1.ConditionFalse, string(phase), message, generation)
 	}
+}
 
-	if cp != nil {
-		rss.Conditions[pos] = c
-	} else {
-		rss.Conditions = append(rss.Conditions, c)
+// ShardCount returns the number of shards running, the removed ones included until they are drained
+func (rc *RedisCluster) ShardCount() int32 {
+	if rc.Status.CurrentShards > rc.Spec.Shards {
+		return rc.Status.CurrentShards
 	}
+	return rc.Spec.Shards
 }
 
-func getClusterCondition(rss *RedisSentinelStatus, t ConditionType) (int, *Condition) {
-	for i, c := range rss.Conditions {
-		if t == c.Type {
-			return i, &c
-		}
+// SetReadyCondition marks the cluster as matching its spec
+func (rcs *RedisClusterStatus) SetReadyCondition(message string, generation int64) {
+	rcs.Phase = PhaseRunning
+	rcs.ObservedGeneration = generation
+	rcs.SetCondition(ConditionReady, corev1.ConditionTrue, ReasonReconciled, message, generation)
+	rcs.SetCondition(ConditionProgressing, corev1.ConditionFalse, ReasonReconciled, message, generation)
+	rcs.SetCondition(ConditionDegraded, corev1.ConditionFalse, ReasonReconciled, message, generation)
+}
+
+// SetFailedCondition marks the cluster as degraded because of the given reason
+func (rcs *RedisClusterStatus) SetFailedCondition(reason string, message string, generation int64) {
+	rcs.Phase = PhaseFailed
+	rcs.ObservedGeneration = generation
+	rcs.SetCondition(ConditionReady, corev1.ConditionFalse, reason, message, generation)
+	rcs.SetCondition(ConditionDegraded, corev1.ConditionTrue, reason, message, generation)
+}
+
+// SetBoolCondition sets a condition to True or False
+func (rcs *RedisClusterStatus) SetBoolCondition(t ConditionType, ok bool, reason, message string, generation int64) {
+	status := corev1.ConditionFalse
+	if ok {
+		status = corev1.ConditionTrue
 	}
-	return -1, nil
-}
-
-func newClusterCondition(condType ConditionType, status corev1.ConditionStatus, reason, message string) *Condition {
-	now := time.Now()
-	nowString := now.Format(time.RFC3339)
-	return &Condition{
-		Type:               condType,
-		Status:             status,
-		LastUpdateTime:     nowString,
-		LastUpdateAt:       now,
-		LastTransitionTime: nowString,
-		Reason:             reason,
-		Message:            message,
+	rcs.SetCondition(t, status, reason, message, generation)
+}
+
+// SetCondition adds or updates the condition of the given type
+func (rcs *RedisClusterStatus) SetCondition(t ConditionType, status corev1.ConditionStatus, reason, message string, generation int64) {
+	setCondition(&rcs.Conditions, t, status, reason, message, generation)
+}
+
+// IsConditionTrue returns true if the condition of the given type is set and True
+func (rcs *RedisClusterStatus) IsConditionTrue(t ConditionType) bool {
+	c := getCondition(rcs.Conditions, t)
+	return c != nil && c.Status == corev1.ConditionTrue
+}
+
+func setCondition(conditions *[]Condition, t ConditionType, status corev1.ConditionStatus, reason, message string, generation int64) {
+	c := getCondition(*conditions, t)
+	if c == nil {
+		*conditions = append(*conditions, Condition{
+			Type:               t,
+			Status:             status,
+			ObservedGeneration: generation,
+			LastTransitionTime: metav1.Now(),
+			Reason:             reason,
+			Message:            message,
+		})
+		return
+	}
+	if c.Status != status {
+		c.Status = status
+		c.LastTransitionTime = metav1.Now()
+	}
+	c.ObservedGeneration = generation
+	c.Reason = reason
+	c.Message = message
+}
+
+func getCondition(conditions []Condition, t ConditionType) *Condition {
+	for i := range conditions {
+		if conditions[i].Type == t {
+			return &conditions[i]
+		}
 	}
+	return nil
 }
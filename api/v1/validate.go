@@ -3,9 +3,14 @@ package v1
 import (
 	"errors"
 	"fmt"
+	"strconv"
+	"time"
 
 	"k8s.io/api/core/v1"
 	"k8s.io/apimachinery/pkg/api/resource"
+
+	"redis-sentinel/pkg/schedule"
+	"redis-sentinel/pkg/version"
 )
 
 const (
@@ -13,15 +18,44 @@ const (
 
 	defaultRedisNumber    = 3
 	defaultSentinelNumber = 3
-	defaultRedisImage     = "redis:5.0.4-alpine"
 
 	defaultSlavePriority = "1"
+
+	defaultAlertFor                = "5m"
+	defaultAlertReplicaLagBytes    = 10 * 1024 * 1024
+	defaultAlertMemoryUsagePercent = 90
+
+	maxAutoMaxmemoryPercent = 90
+
+	defaultMaxSkew = 1
+
+	minClusterShards = 3
+
+	defaultRedisPort = 6379
+
+	defaultSlotsPerReconcile = 128
+	defaultKeysPerMigrate    = 100
+
+	maxMaintenanceWindow = 7 * 24 * time.Hour
 )
 
 var (
 	defaultSentinelCustomConfig = []string{"down-after-milliseconds 5000", "failover-timeout 10000"}
+
+	defaultRedisImage    = DefaultImage
+	defaultSentinelImage = DefaultImage
 )
 
+// DefaultImage is run by the redis and the sentinels of the clusters not setting their image,
+// unless the operator is configured with other images
+const DefaultImage = "redis:5.0.4-alpine"
+
+// SetDefaultImages overrides the images run by the clusters not setting them
+func SetDefaultImages(redis, sentinel string) {
+	defaultRedisImage = redis
+	defaultSentinelImage = sentinel
+}
+
 // Validate set the values by default if not defined and checks if the values given are valid
 func (rc *RedisSentinel) Validate() error {
 	if len(rc.Name) > maxNameLength {
@@ -45,19 +79,141 @@ func (rc *RedisSentinel) Validate() error {
 	}
 
 	if rc.Spec.Sentinel.Image == "" {
-		rc.Spec.Sentinel.Image = defaultRedisImage
+		rc.Spec.Sentinel.Image = defaultSentinelImage
+	}
+
+	if rc.Spec.UseHostnames {
+		if err := rc.requireVersion("useHostnames", 6, 2); err != nil {
+			return err
+		}
 	}
 
 	if rc.Spec.Sentinel.Resources.Size() == 0 {
 		rc.Spec.Sentinel.Resources = defaultSentinelResource()
 	}
 
+	if rc.Spec.Expose != nil {
+		switch rc.Spec.Expose.Type {
+		case "":
+			rc.Spec.Expose.Type = v1.ServiceTypeLoadBalancer
+		case v1.ServiceTypeLoadBalancer, v1.ServiceTypeNodePort:
+		default:
+			return fmt.Errorf("expose type %s is not supported, use %s or %s",
+				rc.Spec.Expose.Type, v1.ServiceTypeLoadBalancer, v1.ServiceTypeNodePort)
+		}
+		// the sentinels are given their announce address with SENTINEL CONFIG SET
+		if err := rc.requireVersion("expose", 6, 2); err != nil {
+			return err
+		}
+	}
+	if rc.Spec.Monitoring != nil && rc.Spec.Monitoring.Alerts != nil {
+		// without the metrics of the exporter the master would be reported down forever
+		if !rc.Spec.Exporter.Enabled {
+			return errors.New("monitoring alerts need the exporter, set exporter.enabled")
+		}
+		alerts := rc.Spec.Monitoring.Alerts
+		if alerts.For == "" {
+			alerts.For = defaultAlertFor
+		}
+		if alerts.ReplicaLagBytes == 0 {
+			alerts.ReplicaLagBytes = defaultAlertReplicaLagBytes
+		}
+		if alerts.MemoryUsagePercent == 0 {
+			alerts.MemoryUsagePercent = defaultAlertMemoryUsagePercent
+		} else if alerts.MemoryUsagePercent < 0 || alerts.MemoryUsagePercent > 100 {
+			return errors.New("alerts memoryUsagePercent must be between 1 and 100")
+		}
+	}
+
 	if rc.Spec.Config == nil {
 		rc.Spec.Config = make(map[string]string)
 	}
 
-	// https://github.com/ucloud/redis-operator/issues/6
-	rc.Spec.Config["slave-priority"] = defaultSlavePriority
+	if rc.Spec.Memory != nil && rc.Spec.Memory.AutoMaxmemory != 0 {
+		if err := setAutoMaxmemory(rc); err != nil {
+			return err
+		}
+	}
+
+	if rc.Spec.Placement != nil {
+		placement := rc.Spec.Placement
+		if placement.MaxSkew == 0 {
+			placement.MaxSkew = defaultMaxSkew
+		} else if placement.MaxSkew < 0 {
+			return errors.New("placement maxSkew must be positive")
+		}
+		switch placement.WhenUnsatisfiable {
+		case "":
+			placement.WhenUnsatisfiable = v1.ScheduleAnyway
+		case v1.ScheduleAnyway, v1.DoNotSchedule:
+		default:
+			return fmt.Errorf("placement whenUnsatisfiable %s is not supported, use %s or %s",
+				placement.WhenUnsatisfiable, v1.ScheduleAnyway, v1.DoNotSchedule)
+		}
+	}
+
+	if rc.Spec.PDB != nil {
+		if err := validatePDB("redis", rc.Spec.PDB.Redis); err != nil {
+			return err
+		}
+		if err := validatePDB("sentinel", rc.Spec.PDB.Sentinel); err != nil {
+			return err
+		}
+	}
+
+	if replicaOf := rc.Spec.ReplicaOf; replicaOf != nil {
+		if (replicaOf.Name == "") == (replicaOf.Host == "") {
+			return errors.New("replicaOf needs either the name of a RedisSentinel or a host")
+		}
+		if replicaOf.Name != "" && replicaOf.Namespace == "" {
+			replicaOf.Namespace = rc.Namespace
+		}
+		if replicaOf.Name == rc.Name && replicaOf.Namespace == rc.Namespace {
+			return errors.New("replicaOf can't reference the cluster itself")
+		}
+		if replicaOf.Host != "" && replicaOf.Port == 0 {
+			replicaOf.Port = defaultRedisPort
+		}
+	}
+
+	if rc.Spec.EmergencyHealing == nil {
+		enabled := true
+		rc.Spec.EmergencyHealing = &enabled
+	}
+	if window := rc.Spec.MaintenanceWindow; window != nil {
+		if window.Schedule == "" {
+			return errors.New("maintenanceWindow needs a schedule")
+		}
+		if _, err := schedule.Parse(window.Schedule); err != nil {
+			return fmt.Errorf("maintenanceWindow: %v", err)
+		}
+		if window.Duration.Duration < time.Minute || window.Duration.Duration > maxMaintenanceWindow {
+			return fmt.Errorf("maintenanceWindow duration must be between 1m and %s", maxMaintenanceWindow)
+		}
+	}
+
+	if migration := rc.Spec.Migration; migration != nil {
+		if rc.Spec.ReplicaOf != nil {
+			return errors.New("migration and replicaOf can't be set together")
+		}
+		if migration.Source.Host == "" {
+			return errors.New("migration needs the host of the source")
+		}
+		if migration.Source.Port == 0 {
+			migration.Source.Port = defaultRedisPort
+		}
+		if secret := migration.Source.PasswordSecret; secret != nil && (secret.Name == "" || secret.Key == "") {
+			return errors.New("migration password secret needs a name and a key")
+		}
+	}
+
+	if rc.Spec.Placement != nil && rc.Spec.Placement.PreferredMasterZone != "" {
+		// the priority of every replica depends on its zone, it is set by the operator
+		delete(rc.Spec.Config, "slave-priority")
+	} else {
+		// https://github.com/ucloud/redis-operator/issues/6
+		rc.Spec.Config["slave-priority"] = defaultSlavePriority
+	}
 
 	if !rc.Spec.DisablePersistence {
 		enablePersistence(rc.Spec.Config)
@@ -68,6 +224,110 @@ func (rc *RedisSentinel) Validate() error {
 	return nil
 }
 
+// Validate set the values by default if not defined and checks if the values given are valid
+func (rc *RedisCluster) Validate() error {
+	if len(rc.Name) > maxNameLength {
+		return fmt.Errorf("name length can't be higher than %d", maxNameLength)
+	}
+
+	if rc.Spec.Shards == 0 {
+		rc.Spec.Shards = minClusterShards
+	} else if rc.Spec.Shards < minClusterShards {
+		return errors.New("number of shards in spec is less than the minimum")
+	}
+	if rc.Spec.ReplicasPerShard < 0 {
+		return errors.New("replicasPerShard can't be negative")
+	}
+	if err := validatePDB("shard", rc.Spec.PDB); err != nil {
+		return err
+	}
+
+	if rc.Spec.Image == "" {
+		rc.Spec.Image = defaultRedisImage
+	}
+
+	if rc.Spec.Config == nil {
+		rc.Spec.Config = make(map[string]string)
+	}
+	enablePersistence(rc.Spec.Config)
+
+	if rc.Spec.Rebalance == nil {
+		rc.Spec.Rebalance = &RebalanceSettings{}
+	}
+	if rc.Spec.Rebalance.Strategy == "" {
+		rc.Spec.Rebalance.Strategy = RebalanceSlots
+	}
+	if rc.Spec.Rebalance.SlotsPerReconcile <= 0 {
+		rc.Spec.Rebalance.SlotsPerReconcile = defaultSlotsPerReconcile
+	}
+	if rc.Spec.Rebalance.KeysPerMigrate <= 0 {
+		rc.Spec.Rebalance.KeysPerMigrate = defaultKeysPerMigrate
+	}
+
+	return nil
+}
+
+// Validate checks that the operation has what its action needs
+func (op *RedisSentinelOperation) Validate() error {
+	if op.Spec.ClusterName == "" {
+		return errors.New("clusterName is required")
+	}
+	switch op.Spec.Action {
+	case ActionRestartPod, ActionResyncReplica:
+		if op.Spec.Pod == "" {
+			return fmt.Errorf("%s needs a pod", op.Spec.Action)
+		}
+	case ActionRotatePassword:
+		if secret := op.Spec.PasswordSecret; secret == nil || secret.Name == "" || secret.Key == "" {
+			return fmt.Errorf("%s needs the name and the key of a password secret", op.Spec.Action)
+		}
+	case ActionFailover, ActionResetSentinels, ActionRewriteAOF:
+	default:
+		return fmt.Errorf("unknown action %q", op.Spec.Action)
+	}
+	return nil
+}
+
+// setAutoMaxmemory sets maxmemory to the configured percentage of the memory limit, unless
+// maxmemory is given in the config
+// requireVersion refuses a feature the redis or the sentinel image is too old to run, the
+// images without a version tag are not checked
+func (rc *RedisSentinel) requireVersion(feature string, major, minor int) error {
+	for _, image := range []string{rc.Spec.Image, rc.Spec.Sentinel.Image} {
+		if v, ok := version.ParseImageVersion(image); ok && v.OlderThan(major, minor) {
+			return fmt.Errorf("%s needs redis %d.%d or later, image %s is %s", feature, major, minor, image, v)
+		}
+	}
+	return nil
+}
+
+func setAutoMaxmemory(rc *RedisSentinel) error {
+	percent := rc.Spec.Memory.AutoMaxmemory
+	if percent < 0 || percent > maxAutoMaxmemoryPercent {
+		return fmt.Errorf("memory autoMaxmemory must be between 1 and %d", maxAutoMaxmemoryPercent)
+	}
+	limit, ok := rc.Spec.Resources.Limits[v1.ResourceMemory]
+	if !ok || limit.IsZero() {
+		return errors.New("memory autoMaxmemory needs resources.limits.memory")
+	}
+	setConfigMapIfNotExist("maxmemory", strconv.FormatInt(limit.Value()*int64(percent)/100, 10), rc.Spec.Config)
+	return nil
+}
+
+// validatePDB checks that a component budget sets one of minAvailable and maxUnavailable
+func validatePDB(component string, pdb *PDBComponentSettings) error {
+	if pdb == nil {
+		return nil
+	}
+	if pdb.MinAvailable != nil && pdb.MaxUnavailable != nil {
+		return fmt.Errorf("pdb %s can't set both minAvailable and maxUnavailable", component)
+	}
+	if pdb.MinAvailable == nil && pdb.MaxUnavailable == nil {
+		return fmt.Errorf("pdb %s needs minAvailable or maxUnavailable", component)
+	}
+	return nil
+}
+
 func enablePersistence(config map[string]string) {
 	setConfigMapIfNotExist("appendonly", "yes", config)
 	setConfigMapIfNotExist("auto-aof-rewrite-min-size", "536870912", config)
@@ -4,6 +4,7 @@ package clustercache
 import (
 	"fmt"
 	"sync"
+	"time"
 	"redis-sentinel/pkg/util"
 	rsv1"redis-sentinel/api/v1"
 )
@@ -25,10 +26,13 @@ type Meta struct {
 	Auth      *util.AuthConfig
 	Obj       *rsv1.RedisSentinel
 
-	Status  rsv1.ConditionType
+	Status  rsv1.Phase
 	Message string
 
 	Config map[string]string
+
+	// SentinelsRestored is when the sentinels still missing replicas were restored
+	SentinelsRestored map[string]time.Time
 }
 
 func newCluster(rs *rsv1.RedisSentinel) *Meta {
@@ -36,7 +40,7 @@ func newCluster(rs *rsv1.RedisSentinel) *Meta {
 		Auth: &util.AuthConfig{
 			Password: rs.Spec.Password,
 		},
-		Status:    rsv1.ClusterConditionCreating,
+		Status:    rsv1.PhaseCreating,
 		Config:    rs.Spec.Config,
 		Obj:       rs,
 		Size:      rs.Spec.Size,
@@ -44,15 +48,22 @@ func newCluster(rs *rsv1.RedisSentinel) *Meta {
 		Name:      rs.GetName(),
 		NameSpace: rs.GetNamespace(),
 		Message:   "Bootstrap redis cluster",
+		// created once, a meta replaced by SetPassword shares it
+		SentinelsRestored: map[string]time.Time{},
 	}
 }
 
 // MetaMap cache last RedisCluster and meta data
 type MetaMap struct {
 	sync.Map
+	// mu serializes the changes of the cached metas, the password is rotated by another
+	// controller than the one reconciling the cluster
+	mu sync.Mutex
 }
 
 func (c *MetaMap) Cache(obj *rsv1.RedisSentinel) *Meta {
+	c.mu.Lock()
+	defer c.mu.Unlock()
 	meta, ok := c.Load(getNamespacedName(obj.GetNamespace(), obj.GetName()))
 	if !ok {
 		c.Add(obj)
@@ -67,6 +78,30 @@ func (c *MetaMap) Get(obj *rsv1.RedisSentinel) *Meta {
 	return meta.(*Meta)
 }
 
+// Lookup returns the cached meta of the cluster, if any
+func (c *MetaMap) Lookup(obj *rsv1.RedisSentinel) (*Meta, bool) {
+	meta, ok := c.Load(getNamespacedName(obj.GetNamespace(), obj.GetName()))
+	if !ok {
+		return nil, false
+	}
+	return meta.(*Meta), true
+}
+
+// SetPassword changes the password of the cached cluster once its redis and sentinels use it.
+// The meta is replaced instead of changed, a reconcile running keeps the one it started with,
+// the next one applies the password to the cached object
+func (c *MetaMap) SetPassword(obj *rsv1.RedisSentinel, password string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	meta, ok := c.Lookup(obj)
+	if !ok {
+		return
+	}
+	updated := *meta
+	updated.Auth = &util.AuthConfig{Password: password}
+	c.Store(getNamespacedName(obj.GetNamespace(), obj.GetName()), &updated)
+}
+
 func (c *MetaMap) Add(obj *rsv1.RedisSentinel) {
 	c.Store(getNamespacedName(obj.GetNamespace(), obj.GetName()), newCluster(obj))
 }
@@ -78,29 +113,30 @@ func (c *MetaMap) Del(obj *rsv1.RedisSentinel) {
 func (c *MetaMap) Update(meta *Meta, new *rsv1.RedisSentinel) {
 	if meta.Obj.GetGeneration() == new.GetGeneration() {
 		meta.State = Check
+		// a password rotated since the last reconcile
+		meta.Obj.Spec.Password = meta.Auth.Password
 		return
 	}
 
 	old := meta.Obj
 	meta.State = Update
 	meta.Size = old.Spec.Size
-	// Password change is not allowed
-	new.Spec.Password = old.Spec.Password
-	meta.Auth.Password = old.Spec.Password
+	// Password change is not allowed, only a rotation changes the cached one
+	new.Spec.Password = meta.Auth.Password
 	meta.Obj = new
 
-	meta.Status = rsv1.ClusterConditionUpdating
+	meta.Status = rsv1.PhaseUpdating
 	meta.Message = "Updating redis config"
 	if isImagesChanged(old, new) {
-		meta.Status = rsv1.ClusterConditionUpgrading
+		meta.Status = rsv1.PhaseUpgrading
 		meta.Message = fmt.Sprintf("Upgrading to %s", new.Spec.Image)
 	}
 	if isScalingDown(old, new) {
-		meta.Status = rsv1.ClusterConditionScalingDown
+		meta.Status = rsv1.PhaseScalingDown
 		meta.Message = fmt.Sprintf("Scaling down form: %d to: %d", meta.Size, new.Spec.Size)
 	}
 	if isScalingUp(old, new) {
-		meta.Status = rsv1.ClusterConditionScaling
+		meta.Status = rsv1.PhaseScaling
 		meta.Message = fmt.Sprintf("Scaling up form: %d to: %d", meta.Size, new.Spec.Size)
 	}
 	if isResourcesChange(old, new) {
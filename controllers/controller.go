@@ -18,16 +18,18 @@ package controllers
 
 import (
 	"context"
-	"github.com/spf13/pflag"
 	"k8s.io/apimachinery/pkg/api/errors"
 	"redis-sentinel/controllers/clustercache"
 	"redis-sentinel/controllers/handle"
 	"redis-sentinel/controllers/redisclient"
+	"redis-sentinel/pkg/config"
 	"redis-sentinel/pkg/k8s"
+	"redis-sentinel/pkg/metrics"
+	"redis-sentinel/pkg/util"
 	"redis-sentinel/service"
+	"sigs.k8s.io/controller-runtime/pkg/controller"
 	"sigs.k8s.io/controller-runtime/pkg/manager"
 	"sigs.k8s.io/controller-runtime/pkg/reconcile"
-	"time"
 
 	"github.com/go-logr/logr"
 	"k8s.io/apimachinery/pkg/runtime"
@@ -37,41 +39,35 @@ import (
 	redisv1 "redis-sentinel/api/v1"
 )
 
-var (
-	controllerFlagSet *pflag.FlagSet
-	// maxConcurrentReconciles is the maximum number of concurrent Reconciles which can be run. Defaults to 4.
-	maxConcurrentReconciles int
-	// reconcileTime is the delay between reconciliations. Defaults to 60s.
-	reconcileTime int
-)
-
-func init() {
-	controllerFlagSet = pflag.NewFlagSet("controller", pflag.ExitOnError)
-	controllerFlagSet.IntVar(&maxConcurrentReconciles, "ctr-maxconcurrent", 4, "the maximum number of concurrent Reconciles which can be run. Defaults to 4.")
-	controllerFlagSet.IntVar(&reconcileTime, "ctr-reconciletime", 60, "")
-}
-
 // RedisSentinelReconciler reconciles a RedisSentinel object
 type RedisSentinelReconciler struct {
 	client.Client
 	Log     logr.Logger
 	Scheme  *runtime.Scheme
 	handler *handle.RedisSentinelHandler
+	reconcilerBase
 }
 
-func NewReconciler(mgr manager.Manager) RedisSentinelReconciler {
+// NewReconciler creates the reconciler, cfg sets the timeouts and pool size of the redis
+// connections, the bounds of every reconcile and the clusters it manages.
+func NewReconciler(mgr manager.Manager, cfg *config.Config) (RedisSentinelReconciler, error) {
 	log := ctrl.Log.WithName("controllers").WithName("RedisSentinel")
+	base, err := newReconcilerBase(mgr, cfg)
+	if err != nil {
+		return RedisSentinelReconciler{}, err
+	}
 
 	// Create kubernetes service.
 	k8sService := k8s.New(mgr.GetClient(), log)
 
 	// Create the redis clients
-	redisClient := redisclient.New()
+	redisClient := redisclient.New(cfg.Redis, log)
 
 	// Create internal services.
 	rcService := service.NewRedisClusterKubeClient(k8sService, log)
-	rcChecker := service.NewRedisClusterChecker(k8sService, redisClient, log)
-	rcHealer := service.NewRedisClusterHealer(k8sService, redisClient, log)
+	rcChecker := service.NewRedisClusterChecker(k8sService, redisClient, cfg.TopologyWorkers, log)
+	instrumenter := metrics.ClusterMetrics.ForKind(redisv1.Kind)
+	rcHealer := service.NewRedisClusterHealer(k8sService, redisClient, instrumenter, log)
 
 	handler := &handle.RedisSentinelHandler{
 		K8sServices: k8sService,
@@ -80,21 +76,28 @@ func NewReconciler(mgr manager.Manager) RedisSentinelReconciler {
 		RsHealer:    rcHealer,
 		MetaCache:   new(clustercache.MetaMap),
 		EventsCli:   k8s.NewEvent(mgr.GetEventRecorderFor("redis-operator"), log),
+		Metrics:     instrumenter,
 		Logger:      log,
 	}
 
 	return RedisSentinelReconciler{Client: mgr.GetClient(),
-		Log:     log,
-		Scheme:  mgr.GetScheme(),
-		handler: handler}
+		Log:            log,
+		Scheme:         mgr.GetScheme(),
+		handler:        handler,
+		reconcilerBase: base}, nil
 }
 
 // +kubebuilder:rbac:groups=redis.xuan.io,resources=redissentinels,verbs=get;list;watch;create;update;patch;delete
 // +kubebuilder:rbac:groups=redis.xuan.io,resources=redissentinels/status,verbs=get;update;patch
+// +kubebuilder:rbac:groups="",resources=persistentvolumeclaims,verbs=get;list;watch;update;delete
+// +kubebuilder:rbac:groups="",resources=nodes,verbs=get;list;watch
+// +kubebuilder:rbac:groups="",resources=secrets,verbs=get;list;watch;create;update
+// +kubebuilder:rbac:groups=storage.k8s.io,resources=storageclasses,verbs=get;list;watch
+// +kubebuilder:rbac:groups=monitoring.coreos.com,resources=servicemonitors;prometheusrules,verbs=get;list;watch;create;update;patch;delete
 
 func (r *RedisSentinelReconciler) Reconcile(req ctrl.Request) (ctrl.Result, error) {
 	ctx := context.Background()
-	reqLogger := r.Log.WithValues("redissentinel", req.NamespacedName)
+	reqLogger := r.Log.WithValues("namespace", req.Namespace, "name", req.Name, "reconcileID", util.NewReconcileID())
 	reqLogger.Info("begin Reconcile")
 
 	// your logic here
@@ -108,33 +111,61 @@ func (r *RedisSentinelReconciler) Reconcile(req ctrl.Request) (ctrl.Result, erro
 			instance.Namespace = req.NamespacedName.Namespace
 			instance.Name = req.NamespacedName.Name
 			r.handler.MetaCache.Del(instance)
+			r.backoff.Reset(req.String())
+			r.handler.Metrics.DeleteCluster(instance.Namespace, instance.Name)
 			return reconcile.Result{}, nil
 		}
 		reqLogger.Info("Get RedisSentinel", "error", err)
 		// Error reading the object - requeue the request.
 		return reconcile.Result{}, err
 	}
+	if !r.scope.Manages(instance) {
+		// another instance of the operator manages it now
+		reqLogger.V(2).Info("RedisSentinel out of the scope of this operator")
+		r.handler.MetaCache.Del(instance)
+		r.backoff.Reset(req.String())
+		r.handler.Metrics.DeleteCluster(instance.Namespace, instance.Name)
+		return reconcile.Result{}, nil
+	}
+
+	doCtx, cancel := context.WithTimeout(r.baseCtx, r.reconcileTimeout)
+	defer cancel()
+	doCtx = util.WithLogger(doCtx, reqLogger)
 
-	if err := r.handler.Do(instance); err != nil {
-		if err.Error() == handle.NeedRequeueMsg {
-			reqLogger.Info("handler Do", "msg", "need requeue")
-			return reconcile.Result{RequeueAfter: 20 * time.Second}, nil
+	if instance.DeletionTimestamp != nil {
+		if !util.ContainsString(instance.Finalizers, redisv1.Finalizer) {
+			return reconcile.Result{}, nil
 		}
-		reqLogger.Error(err, "Reconcile handler")
-		return reconcile.Result{}, err
+		if err := r.handler.Finalize(doCtx, instance); err != nil {
+			return requeueOnError(reqLogger.WithValues("step", "finalize"), r.backoff, req.String(), err, r.resyncPeriod), nil
+		}
+		instance.Finalizers = util.RemoveString(instance.Finalizers, redisv1.Finalizer)
+		return reconcile.Result{}, r.Client.Update(ctx, instance)
+	}
+	if !util.ContainsString(instance.Finalizers, redisv1.Finalizer) {
+		instance.Finalizers = append(instance.Finalizers, redisv1.Finalizer)
+		if err := r.Client.Update(ctx, instance); err != nil {
+			return reconcile.Result{}, err
+		}
+	}
+
+	if err := r.handler.Do(doCtx, instance); err != nil {
+		return requeueOnError(reqLogger, r.backoff, req.String(), err, r.resyncPeriod), nil
 	}
 
 	// 检查并调整哨兵副本数量
 	if err := r.handler.RsChecker.CheckSentinelReadyReplicas(instance); err != nil {
-		reqLogger.Info(err.Error())
-		return reconcile.Result{RequeueAfter: 20 * time.Second}, nil
+		return requeueOnError(reqLogger, r.backoff, req.String(), util.WaitingForPods(err), r.resyncPeriod), nil
 	}
-	reqLogger.Info("end Reconcile ,requeue after 60 second")
-	return reconcile.Result{RequeueAfter: time.Duration(reconcileTime) * time.Second}, nil
+	r.backoff.Reset(req.String())
+	reqLogger.Info("end Reconcile", "requeueAfter", r.resyncPeriod.String())
+	return reconcile.Result{RequeueAfter: r.resyncPeriod}, nil
 }
 
 func (r *RedisSentinelReconciler) SetupWithManager(mgr ctrl.Manager) error {
 	return ctrl.NewControllerManagedBy(mgr).
 		For(&redisv1.RedisSentinel{}).
+		WithEventFilter(r.scope.predicate()).
+		WithOptions(controller.Options{MaxConcurrentReconciles: r.maxConcurrentReconciles}).
 		Complete(r)
 }
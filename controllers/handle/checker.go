@@ -1,6 +1,7 @@
 package handle
 
 import (
+	"context"
 	"errors"
 	"fmt"
 	"time"
@@ -8,19 +9,21 @@ import (
 	rsv1 "redis-sentinel/api/v1"
 	"redis-sentinel/controllers/clustercache"
 	"redis-sentinel/pkg/util"
+	"redis-sentinel/pkg/version"
+	"redis-sentinel/service"
 )
 
-const (
-	checkInterval  = 5 * time.Second
-	timeOut        = 30 * time.Second
-	NeedRequeueMsg = "need requeue"
-)
+// restoreSentinelTimeout is the time a restored sentinel has to find the replicas again before
+// it is restored once more
+const restoreSentinelTimeout = 30 * time.Second
 
 var (
-	needRequeueErr = errors.New(NeedRequeueMsg)
+	// needRequeueErr is returned while the cluster is changing, it is checked again soon
+	needRequeueErr = util.WaitingForPods(errors.New("need requeue"))
 )
 
-// CheckAndHeal Check the health of the cluster and heal,
+// CheckAndHeal Check the health of the cluster and heal, the decisions are made from a
+// single snapshot of the redis and sentinel nodes taken concurrently,
 // Waiting Number of ready redis is equal as the set on the RedisCluster spec
 // Waiting Number of ready sentinel is equal as the set on the RedisCluster spec
 // Check only one master
@@ -30,9 +33,11 @@ var (
 // All sentinels points to the same redis master
 // Sentinel has not death nodes
 // Sentinel knows the correct slave number
-func (rsh *RedisSentinelHandler) CheckAndHeal(meta *clustercache.Meta) error {
+// A standby replicates its source instead, see checkAndHealStandby, and so does a cluster
+// migrating an unmanaged redis until the cutover, see checkAndHealMigration
+func (rsh *RedisSentinelHandler) CheckAndHeal(ctx context.Context, meta *clustercache.Meta) error {
 	if err := rsh.RsChecker.CheckRedisNumber(meta.Obj); err != nil {
-		rsh.Logger.WithValues("namespace", meta.Obj.Namespace, "name", meta.Obj.Name).V(2).Info("number of redis mismatch, this could be for a change on the statefulset")
+		util.LoggerFrom(ctx, rsh.Logger).V(2).Info("number of redis mismatch, this could be for a change on the statefulset")
 		rsh.EventsCli.UpdateCluster(meta.Obj, "wait for all redis server start")
 		return needRequeueErr
 	}
@@ -41,105 +46,212 @@ func (rsh *RedisSentinelHandler) CheckAndHeal(meta *clustercache.Meta) error {
 		return nil
 	}
 
-	nMasters, err := rsh.RsChecker.GetNumberMasters(meta.Obj, meta.Auth)
+	topo, err := rsh.RsChecker.GetTopology(ctx, meta.Obj, meta.Auth)
 	if err != nil {
 		return err
 	}
+
+	if meta.Obj.Spec.ReplicaOf != nil {
+		return rsh.checkAndHealStandby(ctx, meta, topo)
+	}
+	if migrating(meta.Obj) {
+		promoted, err := rsh.checkAndHealMigration(ctx, meta, topo)
+		if err != nil || !promoted {
+			return err
+		}
+		if topo, err = rsh.RsChecker.GetTopology(ctx, meta.Obj, meta.Auth); err != nil {
+			return err
+		}
+	}
+	if meta.Obj.Status.Replication != nil {
+		if err := rsh.promoteStandby(ctx, meta, topo); err != nil {
+			return err
+		}
+		if topo, err = rsh.RsChecker.GetTopology(ctx, meta.Obj, meta.Auth); err != nil {
+			return err
+		}
+	}
+
+	nMasters := rsh.RsChecker.GetNumberMasters(topo)
+	if nMasters == 0 {
+		// the master may be one of the redis that didn't answer, electing another one would
+		// leave two masters once it answers again
+		if err := topo.UnreachableError(); err != nil {
+			return err
+		}
+	}
 	switch nMasters {
 	case 0:
+		meta.Obj.Status.SetBoolCondition(rsv1.ConditionAvailable, false, rsv1.ReasonNoMaster, "no redis master found", meta.Obj.Generation)
 		rsh.EventsCli.UpdateCluster(meta.Obj, "set master")
-		rsh.Logger.WithValues("namespace", meta.Obj.Namespace, "name", meta.Obj.Name).V(2).Info("no master find, fixing...")
-		redisesIP, err := rsh.RsChecker.GetRedisesIPs(meta.Obj, meta.Auth)
-		if err != nil {
-			return err
-		}
-		if len(redisesIP) == 1 {
-			if err := rsh.RsHealer.MakeMaster(redisesIP[0], meta.Auth); err != nil {
+		util.LoggerFrom(ctx, rsh.Logger).V(2).Info("no master find, fixing...")
+		if len(topo.Redises) == 1 {
+			if err := rsh.RsHealer.MakeMaster(ctx, topo.Redises[0], meta.Obj, meta.Auth); err != nil {
+				return err
+			}
+		} else {
+			minTime := rsh.RsChecker.GetMinimumRedisPodTime(topo)
+			util.LoggerFrom(ctx, rsh.Logger).Info(fmt.Sprintf("time %.f more than expected. Not even one master, fixing...", minTime.Round(time.Second).Seconds()))
+			if err := rsh.RsHealer.SetOldestAsMaster(ctx, topo, meta.Obj, meta.Auth); err != nil {
 				return err
 			}
-			break
-		}
-		minTime, err := rsh.RsChecker.GetMinimumRedisPodTime(meta.Obj)
-		if err != nil {
-			return err
 		}
-		rsh.Logger.WithValues("namespace", meta.Obj.Namespace, "name", meta.Obj.Name).Info(fmt.Sprintf("time %.f more than expected. Not even one master, fixing...", minTime.Round(time.Second).Seconds()))
-		if err := rsh.RsHealer.SetOldestAsMaster(meta.Obj, meta.Auth); err != nil {
+		// the roles changed, the rest of the checks need a new snapshot
+		if topo, err = rsh.RsChecker.GetTopology(ctx, meta.Obj, meta.Auth); err != nil {
 			return err
 		}
 	case 1:
 		break
 	default:
-		return errors.New("more than one master, fix manually")
+		meta.Obj.Status.SetBoolCondition(rsv1.ConditionAvailable, false, rsv1.ReasonManyMasters,
+			fmt.Sprintf("%d redis masters found", nMasters), meta.Obj.Generation)
+		return util.NeedsHuman(errors.New("more than one master, fix manually"))
+	}
+
+	if err := rsh.RsHealer.SetAnnounceAddrs(ctx, topo, meta.Obj, meta.Auth); err != nil {
+		return err
 	}
 
-	master, err := rsh.RsChecker.GetMasterIP(meta.Obj, meta.Auth)
+	// replicas and sentinels reach the master through its announced address
+	master, err := rsh.RsChecker.GetMaster(topo)
 	if err != nil {
+		meta.Obj.Status.SetBoolCondition(rsv1.ConditionAvailable, false, rsv1.ReasonNoMaster, err.Error(), meta.Obj.Generation)
+		return err
+	}
+	rsh.recordTopology(ctx, meta, master, topo)
+	// a failover done by the sentinels is first seen here, the master service follows it
+	// before any heal can fail and leave it selecting the old master
+	if err := rsh.RsHealer.SetRedisRoleLabels(master, topo, meta.Obj); err != nil {
 		return err
 	}
-	if err := rsh.RsChecker.CheckAllSlavesFromMaster(master, meta.Obj, meta.Auth); err != nil {
-		rsh.Logger.WithValues("namespace", meta.Obj.Namespace, "name", meta.Obj.Name).Info(err.Error())
-		if err := rsh.RsHealer.SetMasterOnAll(master, meta.Obj, meta.Auth); err != nil {
+	if err := rsh.RsChecker.CheckAllSlavesFromMaster(master, topo); err != nil {
+		meta.Obj.Status.SetBoolCondition(rsv1.ConditionReplicationHealthy, false, rsv1.ReasonReplicasWrong, err.Error(), meta.Obj.Generation)
+		util.LoggerFrom(ctx, rsh.Logger).Info(err.Error())
+		if err := rsh.RsHealer.SetMasterOnAll(ctx, master, topo, meta.Obj, meta.Auth); err != nil {
 			return err
 		}
 	}
 
-	if err = rsh.setRedisConfig(meta); err != nil {
+	if err := rsh.RsHealer.SetReplicaPriorities(ctx, topo, meta.Obj, meta.Auth); err != nil {
 		return err
 	}
 
-	sentinels, err := rsh.RsChecker.GetSentinelsIPs(meta.Obj)
-	if err != nil {
+	if err = rsh.setRedisConfig(ctx, meta, topo); err != nil {
 		return err
 	}
-	for _, sip := range sentinels {
-		if err := rsh.RsChecker.CheckSentinelMonitor(sip, master, meta.Auth); err != nil {
-			rsh.Logger.WithValues("namespace", meta.Obj.Namespace, "name", meta.Obj.Name).Info(err.Error())
-			if err := rsh.RsHealer.NewSentinelMonitor(sip, master, meta.Obj, meta.Auth); err != nil {
-				return err
-			}
-		}
-	}
-	for _, sip := range sentinels {
-		if err := rsh.RsChecker.CheckSentinelSlavesNumberInMemory(sip, meta.Obj, meta.Auth); err != nil {
-			rsh.Logger.WithValues("namespace", meta.Obj.Namespace, "name", meta.Obj.Name).
-				Info("restoring sentinel ...", "sentinel", sip, "reason", err.Error())
-			if err := rsh.RsHealer.RestoreSentinel(sip, meta.Auth); err != nil {
+
+	for i, sentinel := range topo.Sentinels {
+		if err := rsh.RsChecker.CheckSentinelMonitor(sentinel, master.AnnounceHost, master.AnnouncePort); err != nil {
+			util.LoggerFrom(ctx, rsh.Logger).Info(err.Error())
+			if err := rsh.RsHealer.NewSentinelMonitor(ctx, sentinel.IP, master.AnnounceHost, master.AnnouncePort, meta.Obj, meta.Auth); err != nil {
 				return err
 			}
-			if err := rsh.waitRestoreSentinelSlavesOK(sip, meta.Obj, meta.Auth); err != nil {
-				rsh.Logger.WithValues("namespace", meta.Obj.Namespace, "name", meta.Obj.Name).Info(err.Error())
+			// the view of the sentinel changed with its new monitor
+			if topo.Sentinels[i], err = rsh.RsChecker.GetSentinelNode(ctx, meta.Obj, sentinel, meta.Auth); err != nil {
 				return err
 			}
 		}
 	}
-	for _, sip := range sentinels {
-		if err := rsh.RsChecker.CheckSentinelNumberInMemory(sip, meta.Obj, meta.Auth); err != nil {
-			rsh.Logger.WithValues("namespace", meta.Obj.Namespace, "name", meta.Obj.Name).
-				Info("restoring sentinel ...", "sentinel", sip, "reason", err.Error())
-			if err := rsh.RsHealer.RestoreSentinel(sip, meta.Auth); err != nil {
+	if err := rsh.restoreSentinelSlaves(ctx, meta, topo); err != nil {
+		return err
+	}
+	for _, sentinel := range topo.Sentinels {
+		if err := rsh.RsChecker.CheckSentinelNumberInMemory(sentinel, meta.Obj); err != nil {
+			util.LoggerFrom(ctx, rsh.Logger).
+				Info("restoring sentinel ...", "sentinel", sentinel.IP, "reason", err.Error())
+			if err := rsh.RsHealer.RestoreSentinel(ctx, sentinel.IP, meta.Obj, meta.Auth); err != nil {
 				return err
 			}
 		}
 	}
 
-	if err = rsh.setSentinelConfig(meta, sentinels); err != nil {
+	if err = rsh.setSentinelConfig(ctx, meta, topo); err != nil {
 		return err
 	}
 
-	return nil
+	// move the master before its node is drained, the eviction then only takes a replica
+	if topo.MasterDraining(master) {
+		msg := fmt.Sprintf("node %s of master %s is cordoned, failing over", master.Pod.Spec.NodeName, master.Pod.Name)
+		util.LoggerFrom(ctx, rsh.Logger).Info(msg)
+		if err := rsh.RsHealer.FailoverMaster(ctx, topo, meta.Obj, meta.Auth); err != nil {
+			return err
+		}
+		rsh.EventsCli.MasterFailover(meta.Obj, msg)
+		meta.Obj.Status.SetFailingOverCondition(msg, meta.Obj.Generation)
+		rsh.K8sServices.UpdateCluster(meta.Obj.Namespace, meta.Obj)
+		return needRequeueErr
+	}
+
+	// the cluster is healed without the unreachable redis, it isn't ready until they answer
+	return topo.UnreachableError()
 }
 
-func (rsh *RedisSentinelHandler) setRedisConfig(meta *clustercache.Meta) error {
-	redises, err := rsh.RsChecker.GetRedisesIPs(meta.Obj, meta.Auth)
-	if err != nil {
-		return err
+// recordTopology updates the metrics and the conditions of the cluster with the state seen before healing it
+func (rsh *RedisSentinelHandler) recordTopology(ctx context.Context, meta *clustercache.Meta, master *service.RedisNode, topo *service.Topology) {
+	rs := meta.Obj
+	rs.Status.MasterIP = master.IP
+	// the status keeps the newest version run, the older ones can't load the data it wrote
+	for _, node := range topo.Redises {
+		running, err := version.ParseVersion(rs.Status.Flavor, rs.Status.Version)
+		if err != nil || version.IsNewer(node.Version, running) {
+			rs.Status.Flavor = node.Version.Flavor
+			rs.Status.Version = fmt.Sprintf("%d.%d.%d", node.Version.Major, node.Version.Minor, node.Version.Patch)
+		}
+	}
+	rs.Status.SetBoolCondition(rsv1.ConditionAvailable, true, rsv1.ReasonMasterFound,
+		fmt.Sprintf("master is %s", master.Pod.Name), rs.Generation)
+	if len(topo.Redises) < int(rs.Spec.Size) {
+		rs.Status.SetBoolCondition(rsv1.ConditionReplicationHealthy, false, rsv1.ReasonReplicasDown,
+			fmt.Sprintf("%d of %d redis running", len(topo.Redises), rs.Spec.Size), rs.Generation)
+	} else {
+		rs.Status.SetBoolCondition(rsv1.ConditionReplicationHealthy, true, rsv1.ReasonReplicasOK,
+			fmt.Sprintf("%d replicas follow the master", len(topo.Redises)-1), rs.Generation)
 	}
-	for _, rip := range redises {
-		if err := rsh.RsChecker.CheckRedisConfig(meta.Obj, rip, meta.Auth); err != nil {
-			rsh.Logger.WithValues("namespace", meta.Obj.Namespace, "name", meta.Obj.Name).Info(err.Error())
+
+	if rs.Status.MasterPod != "" && rs.Status.MasterPod != master.Pod.Name {
+		util.LoggerFrom(ctx, rsh.Logger).
+			Info("master changed", "from", rs.Status.MasterPod, "to", master.Pod.Name)
+		rsh.Metrics.IncFailover(rs.Namespace, rs.Name)
+	}
+	rs.Status.MasterPod = master.Pod.Name
+
+	agreeing := 0
+	for _, sentinel := range topo.Sentinels {
+		if rsh.RsChecker.CheckSentinelMonitor(sentinel, master.AnnounceHost, master.AnnouncePort) == nil {
+			agreeing++
+		}
+	}
+	quorum := service.GetQuorum(rs)
+	message := fmt.Sprintf("%d sentinels monitor the master, quorum is %d", agreeing, quorum)
+	if int32(agreeing) >= quorum {
+		rs.Status.SetBoolCondition(rsv1.ConditionSentinelQuorum, true, rsv1.ReasonQuorumReached, message, rs.Generation)
+	} else {
+		rs.Status.SetBoolCondition(rsv1.ConditionSentinelQuorum, false, rsv1.ReasonQuorumLost, message, rs.Generation)
+	}
+	if rs.Spec.Sentinel.Replicas > 0 {
+		rsh.Metrics.SetSentinelAgreement(rs.Namespace, rs.Name, float64(agreeing)/float64(rs.Spec.Sentinel.Replicas))
+	}
+
+	lags := make(map[string]int64, len(topo.Redises))
+	for _, node := range topo.Redises {
+		if node == master {
+			continue
+		}
+		lag := master.ReplOffset - node.ReplOffset
+		if lag < 0 {
+			lag = 0
+		}
+		lags[node.Pod.Name] = lag
+	}
+	rsh.Metrics.SetReplicaLag(rs.Namespace, rs.Name, lags)
+}
+
+func (rsh *RedisSentinelHandler) setRedisConfig(ctx context.Context, meta *clustercache.Meta, topo *service.Topology) error {
+	for _, node := range topo.Redises {
+		if err := rsh.RsChecker.CheckRedisConfig(meta.Obj, node); err != nil {
+			util.LoggerFrom(ctx, rsh.Logger).Info(err.Error())
 			rsh.EventsCli.UpdateCluster(meta.Obj, "set custom config for redis server")
-			if err := rsh.RsHealer.SetRedisCustomConfig(rip, meta.Obj, meta.Auth); err != nil {
+			if err := rsh.RsHealer.SetRedisCustomConfig(ctx, node, meta.Obj, meta.Auth); err != nil {
 				return err
 			}
 		}
@@ -148,33 +260,45 @@ func (rsh *RedisSentinelHandler) setRedisConfig(meta *clustercache.Meta) error {
 }
 
 // TODO do as set redis config
-func (rsh *RedisSentinelHandler) setSentinelConfig(meta *clustercache.Meta, sentinels []string) error {
+func (rsh *RedisSentinelHandler) setSentinelConfig(ctx context.Context, meta *clustercache.Meta, topo *service.Topology) error {
 	if meta.State == clustercache.Check {
 		return nil
 	}
 
-	for _, sip := range sentinels {
-		if err := rsh.RsHealer.SetSentinelCustomConfig(sip, meta.Obj, meta.Auth); err != nil {
+	for _, sentinel := range topo.Sentinels {
+		if err := rsh.RsHealer.SetSentinelCustomConfig(ctx, sentinel.IP, meta.Obj, meta.Auth); err != nil {
 			return err
 		}
 	}
 	return nil
 }
 
-func (rsh *RedisSentinelHandler) waitRestoreSentinelSlavesOK(sentinel string, rs *rsv1.RedisSentinel, auth *util.AuthConfig) error {
-	timer := time.NewTimer(timeOut)
-	defer timer.Stop()
-	for {
-		select {
-		case <-timer.C:
-			return fmt.Errorf("wait for resetore sentinel slave timeout")
-		default:
-			if err := rsh.RsChecker.CheckSentinelSlavesNumberInMemory(sentinel, rs, auth); err != nil {
-				rsh.Logger.WithValues("namespace", rs.Namespace, "name", rs.Name).Info(err.Error())
-				time.Sleep(checkInterval)
-			} else {
-				return nil
-			}
+// restoreSentinelSlaves restores the sentinels that don't know every replica. A restored
+// sentinel takes a few seconds to find the replicas again, the cluster is checked again once
+// they had the time instead of waiting for them
+func (rsh *RedisSentinelHandler) restoreSentinelSlaves(ctx context.Context, meta *clustercache.Meta, topo *service.Topology) error {
+	restoring := false
+	for _, sentinel := range topo.Sentinels {
+		err := rsh.RsChecker.CheckSentinelSlavesNumberInMemory(sentinel, meta.Obj)
+		if err == nil {
+			delete(meta.SentinelsRestored, sentinel.IP)
+			continue
+		}
+		restoring = true
+		if restored, ok := meta.SentinelsRestored[sentinel.IP]; ok && time.Since(restored) < restoreSentinelTimeout {
+			util.LoggerFrom(ctx, rsh.Logger).V(2).
+				Info("waiting for the restored sentinel", "sentinel", sentinel.IP, "reason", err.Error())
+			continue
+		}
+		util.LoggerFrom(ctx, rsh.Logger).
+			Info("restoring sentinel ...", "sentinel", sentinel.IP, "reason", err.Error())
+		if err := rsh.RsHealer.RestoreSentinel(ctx, sentinel.IP, meta.Obj, meta.Auth); err != nil {
+			return err
 		}
+		meta.SentinelsRestored[sentinel.IP] = time.Now()
+	}
+	if restoring {
+		return needRequeueErr
 	}
+	return nil
 }
@@ -0,0 +1,91 @@
+package handle
+
+import (
+	"context"
+	"testing"
+
+	rsv1 "redis-sentinel/api/v1"
+	"redis-sentinel/pkg/util"
+	"redis-sentinel/service"
+)
+
+// drainHealer records the replica priorities and the failovers asked by the sentinel checks
+type drainHealer struct {
+	fakeHealer
+}
+
+func (h *drainHealer) SetReplicaPriorities(ctx context.Context, topo *service.Topology, rs *rsv1.RedisSentinel, auth *util.AuthConfig) error {
+	h.record("SetReplicaPriorities")
+	return nil
+}
+
+func (h *drainHealer) SetSentinelCustomConfig(ctx context.Context, ip string, rs *rsv1.RedisSentinel, auth *util.AuthConfig) error {
+	return nil
+}
+
+func (h *drainHealer) FailoverMaster(ctx context.Context, topo *service.Topology, rs *rsv1.RedisSentinel, auth *util.AuthConfig) error {
+	h.record("FailoverMaster")
+	return nil
+}
+
+func TestCheckAndHealDrainingMaster(t *testing.T) {
+	tests := []struct {
+		name         string
+		cordoned     []bool
+		wantFailover bool
+	}{
+		{
+			name:     "no node cordoned",
+			cordoned: []bool{false, false},
+		},
+		{
+			name:         "node of the master cordoned",
+			cordoned:     []bool{true, false},
+			wantFailover: true,
+		},
+		{
+			name:     "every node cordoned",
+			cordoned: []bool{true, true},
+		},
+		{
+			name:     "node of a replica cordoned",
+			cordoned: []bool{false, true},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rs := newTestCluster()
+			redises := []*service.RedisNode{newRedisNode(0, "", ""), newRedisNode(1, "10.0.0.1", "6379")}
+			for i, cordoned := range tt.cordoned {
+				redises[i].Cordoned = cordoned
+			}
+			sentinels := newSentinelNodes(3)
+			for _, sentinel := range sentinels {
+				sentinel.MonitorHost, sentinel.MonitorPort = "10.0.0.1", "6379"
+				sentinel.NumSentinels, sentinel.NumSlaves = 3, 1
+			}
+			topo := &service.Topology{Redises: redises, Sentinels: sentinels}
+			h, _, _ := newTestHandler(t, rs, topo)
+			healer := &drainHealer{}
+			h.RsHealer = healer
+
+			err := h.CheckAndHeal(context.TODO(), h.MetaCache.Cache(rs))
+			if tt.wantFailover && err != needRequeueErr {
+				t.Fatalf("CheckAndHeal() error = %v, want a requeue", err)
+			}
+			if !tt.wantFailover && err != nil {
+				t.Fatalf("CheckAndHeal() error = %v", err)
+			}
+			if healer.called("FailoverMaster") != tt.wantFailover {
+				t.Fatalf("heal actions = %q, want the failover %v", healer.calls, tt.wantFailover)
+			}
+			// the cordoned replicas are kept from the promotion before the failover is asked
+			if tt.wantFailover && (len(healer.calls) != 2 || healer.calls[0] != "SetReplicaPriorities") {
+				t.Errorf("heal actions = %q, want the replica priorities set before the failover", healer.calls)
+			}
+			if failingOver := rs.Status.Phase == rsv1.PhaseFailingOver; failingOver != tt.wantFailover {
+				t.Errorf("phase = %s, want failing over %v", rs.Status.Phase, tt.wantFailover)
+			}
+		})
+	}
+}
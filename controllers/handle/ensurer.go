@@ -4,6 +4,7 @@ package handle
 import (
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	rsv1 "redis-sentinel/api/v1"
+	"redis-sentinel/service"
 )
 
 // Ensure the RedisCluster's components are correct.
@@ -11,6 +12,24 @@ func (rsh *RedisSentinelHandler) Ensure(rs *rsv1.RedisSentinel, labels map[strin
 	if err := rsh.RsService.EnsureRedisService(rs, labels, or); err != nil {
 		return err
 	}
+	if err := rsh.RsService.EnsureRedisMasterService(rs, labels, or); err != nil {
+		return err
+	}
+	if err := rsh.RsService.EnsureRedisReplicaService(rs, labels, or); err != nil {
+		return err
+	}
+	if err := rsh.RsService.EnsureExposeServices(rs, labels, or); err != nil {
+		return err
+	}
+	if err := rsh.RsService.EnsureExporterServices(rs, labels, or); err != nil {
+		return err
+	}
+	if err := rsh.RsService.EnsureServiceMonitor(rs, labels, or); err != nil {
+		return err
+	}
+	if err := rsh.RsService.EnsurePrometheusRule(rs, labels, or); err != nil {
+		return err
+	}
 	if err := rsh.RsService.EnsureSentinelService(rs, labels, or); err != nil {
 		return err
 	}
@@ -26,11 +45,23 @@ func (rsh *RedisSentinelHandler) Ensure(rs *rsv1.RedisSentinel, labels map[strin
 	if err := rsh.RsService.EnsureRedisShutdownConfigMap(rs, labels, or); err != nil {
 		return err
 	}
-	if err := rsh.RsService.EnsureRedisStatefulset(rs, labels, or); err != nil {
+	if err := rsh.RsService.EnsureRedisAuthSecret(rs, labels, or); err != nil {
 		return err
 	}
-	if err := rsh.RsService.EnsureSentinelStatefulset(rs, labels, or); err != nil {
-		return err
+	// the changes waiting for the maintenance window of one statefulset don't hold the other
+	pending := &service.MaintenancePending{}
+	for _, ensure := range []func(*rsv1.RedisSentinel, map[string]string, []metav1.OwnerReference) error{
+		rsh.RsService.EnsureRedisStatefulset, rsh.RsService.EnsureSentinelStatefulset} {
+		if err := ensure(rs, labels, or); err != nil {
+			waiting, ok := err.(*service.MaintenancePending)
+			if !ok {
+				return err
+			}
+			pending.Changes = append(pending.Changes, waiting.Changes...)
+		}
+	}
+	if len(pending.Changes) > 0 {
+		return pending
 	}
 
 	return nil
@@ -0,0 +1,88 @@
+package handle
+
+import (
+	"context"
+	"fmt"
+
+	"k8s.io/apimachinery/pkg/api/errors"
+
+	v1 "redis-sentinel/api/v1"
+	"redis-sentinel/pkg/util"
+	"redis-sentinel/service"
+)
+
+// Finalize tears down the cluster before its deletion is released: it takes the final
+// snapshot when asked, makes the sentinels forget the master so they don't failover while
+// the pods terminate, releases the persistent volume claims and drops the metrics.
+func (rsh *RedisSentinelHandler) Finalize(ctx context.Context, rc *v1.RedisSentinel) error {
+	logger := util.LoggerFrom(ctx, rsh.Logger)
+	logger.Info("finalizing")
+	rsh.EventsCli.DeleteCluster(rc, "Tearing down the redis cluster")
+
+	auth := &util.AuthConfig{Password: rc.Spec.Password}
+	if meta, ok := rsh.MetaCache.Lookup(rc); ok {
+		// the cached password is the one running, changes of it are not applied
+		auth = meta.Auth
+	}
+
+	// the snapshot is taken once, the retries of a teardown failing later don't repeat it
+	backup := rc.Spec.Storage.BackupOnDeletion && !rc.Status.IsConditionTrue(v1.ConditionFinalSnapshot)
+	topo, err := rsh.RsChecker.GetTopology(ctx, rc, auth)
+	if err != nil && !errors.IsNotFound(err) {
+		// only the final snapshot needs the pods, a cluster that can't be reached anymore
+		// must still be deletable once it is turned off
+		if backup {
+			return rsh.blockDeletion(rc, err)
+		}
+		logger.Info("can't take the topology, the sentinels are not cleaned up", "error", err.Error())
+		topo = nil
+	}
+	if topo != nil {
+		if backup {
+			if err := rsh.saveFinalSnapshot(ctx, rc, topo, auth); err != nil {
+				return rsh.blockDeletion(rc, err)
+			}
+		}
+		for _, sentinel := range topo.Sentinels {
+			if err := rsh.RsHealer.RemoveSentinelMonitor(ctx, sentinel.IP, rc, auth); err != nil {
+				// the sentinel is deleted with the cluster anyway
+				logger.Info("can't remove the master from sentinel", "sentinel", sentinel.IP, "error", err.Error())
+			}
+		}
+	}
+
+	if err := rsh.RsService.ReleasePersistentVolumeClaims(rc); err != nil {
+		return err
+	}
+
+	rsh.MetaCache.Del(rc)
+	rsh.Metrics.DeleteCluster(rc.Namespace, rc.Name)
+	logger.Info("finalized")
+	return nil
+}
+
+// saveFinalSnapshot saves the dataset of the master before the deletion, the success is kept
+// in the status of the cluster
+func (rsh *RedisSentinelHandler) saveFinalSnapshot(ctx context.Context, rc *v1.RedisSentinel, topo *service.Topology, auth *util.AuthConfig) error {
+	masters := topo.Masters()
+	if len(masters) != 1 {
+		return fmt.Errorf("can't take the final snapshot, %d masters found", len(masters))
+	}
+	if err := rsh.RsHealer.SaveSnapshot(ctx, masters[0].IP, rc, auth); err != nil {
+		return err
+	}
+	msg := fmt.Sprintf("final snapshot saved on %s", masters[0].Pod.Name)
+	util.LoggerFrom(ctx, rsh.Logger).Info(msg)
+	rc.Status.SetBoolCondition(v1.ConditionFinalSnapshot, true, v1.ReasonSnapshotSaved, msg, rc.Generation)
+	rsh.K8sServices.UpdateCluster(rc.Namespace, rc)
+	return nil
+}
+
+// blockDeletion reports that the deletion waits for the final snapshot, and how to give it up
+func (rsh *RedisSentinelHandler) blockDeletion(rc *v1.RedisSentinel, err error) error {
+	msg := fmt.Sprintf("the deletion waits for the final snapshot: %v, set spec.storage.backupOnDeletion to false to delete the cluster without it", err)
+	rc.Status.SetBoolCondition(v1.ConditionFinalSnapshot, false, v1.ReasonSnapshotFail, msg, rc.Generation)
+	rsh.EventsCli.DeletionBlocked(rc, msg)
+	rsh.K8sServices.UpdateCluster(rc.Namespace, rc)
+	return err
+}
@@ -0,0 +1,131 @@
+package handle
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"testing"
+
+	"github.com/go-logr/logr"
+	"k8s.io/client-go/tools/record"
+	logf "sigs.k8s.io/controller-runtime/pkg/log"
+
+	rsv1 "redis-sentinel/api/v1"
+	"redis-sentinel/pkg/k8s"
+	"redis-sentinel/pkg/util"
+	"redis-sentinel/service"
+)
+
+// finalizeHealer records the final snapshots, they fail while snapshotErr is set
+type finalizeHealer struct {
+	fakeHealer
+	snapshotErr error
+}
+
+func (h *finalizeHealer) SaveSnapshot(ctx context.Context, ip string, rs *rsv1.RedisSentinel, auth *util.AuthConfig) error {
+	if h.snapshotErr != nil {
+		return h.snapshotErr
+	}
+	h.record("SaveSnapshot %s", ip)
+	return nil
+}
+
+func TestFinalize(t *testing.T) {
+	tests := []struct {
+		name         string
+		backup       bool
+		saved        bool
+		redises      []*service.RedisNode
+		snapshotErr  error
+		wantErr      bool
+		wantSnapshot bool
+		wantReason   string
+	}{
+		{
+			name:    "no backup",
+			redises: []*service.RedisNode{newRedisNode(0, "", ""), newRedisNode(1, "10.0.0.1", "6379")},
+		},
+		{
+			name:         "backup saved",
+			backup:       true,
+			redises:      []*service.RedisNode{newRedisNode(0, "", ""), newRedisNode(1, "10.0.0.1", "6379")},
+			wantSnapshot: true,
+			wantReason:   rsv1.ReasonSnapshotSaved,
+		},
+		{
+			name:       "backup already saved by an earlier try",
+			backup:     true,
+			saved:      true,
+			redises:    []*service.RedisNode{newRedisNode(0, "", ""), newRedisNode(1, "10.0.0.1", "6379")},
+			wantReason: rsv1.ReasonSnapshotSaved,
+		},
+		{
+			name:        "backup failing",
+			backup:      true,
+			redises:     []*service.RedisNode{newRedisNode(0, "", ""), newRedisNode(1, "10.0.0.1", "6379")},
+			snapshotErr: errors.New("MISCONF no space left on device"),
+			wantErr:     true,
+			wantReason:  rsv1.ReasonSnapshotFail,
+		},
+		{
+			name:       "backup without a master",
+			backup:     true,
+			redises:    []*service.RedisNode{newRedisNode(0, "10.0.0.9", "6379"), newRedisNode(1, "10.0.0.9", "6379")},
+			wantErr:    true,
+			wantReason: rsv1.ReasonSnapshotFail,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rs := newTestCluster()
+			rs.Spec.Storage.BackupOnDeletion = tt.backup
+			if tt.saved {
+				rs.Status.SetBoolCondition(rsv1.ConditionFinalSnapshot, true, rsv1.ReasonSnapshotSaved, "final snapshot saved", rs.Generation)
+			}
+			topo := &service.Topology{Redises: tt.redises, Sentinels: newSentinelNodes(3)}
+			h, _, _ := newTestHandler(t, rs, topo)
+			var logger logr.Logger = logf.NullLogger{}
+			recorder := record.NewFakeRecorder(100)
+			healer := &finalizeHealer{snapshotErr: tt.snapshotErr}
+			h.RsHealer = healer
+			h.RsService = service.NewRedisClusterKubeClient(h.K8sServices, logger)
+			h.EventsCli = k8s.NewEvent(recorder, logger)
+
+			err := h.Finalize(context.TODO(), rs)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("Finalize() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if snapshot := healer.called("SaveSnapshot 10.0.0.1"); snapshot != tt.wantSnapshot {
+				t.Errorf("heal actions = %q, want the snapshot %v", healer.calls, tt.wantSnapshot)
+			}
+			if removed := healer.called("RemoveSentinelMonitor 10.0.1.1"); removed == tt.wantErr {
+				t.Errorf("heal actions = %q, want the sentinels cleaned up %v", healer.calls, !tt.wantErr)
+			}
+
+			// the outcome of the snapshot is kept in the stored status
+			stored, err := h.K8sServices.GetCluster(testNamespace, rs.Name)
+			if err != nil {
+				t.Fatal(err)
+			}
+			var reason string
+			for _, cond := range stored.Status.Conditions {
+				if cond.Type == rsv1.ConditionFinalSnapshot {
+					reason = cond.Reason
+				}
+			}
+			if reason != tt.wantReason {
+				t.Errorf("FinalSnapshot condition reason = %q, want %q", reason, tt.wantReason)
+			}
+
+			blocked := false
+			for len(recorder.Events) > 0 {
+				if event := <-recorder.Events; strings.Contains(event, "DeletionBlocked") {
+					blocked = strings.Contains(event, "backupOnDeletion to false")
+				}
+			}
+			if blocked != tt.wantErr {
+				t.Errorf("deletion blocked event = %v, want %v", blocked, tt.wantErr)
+			}
+		})
+	}
+}
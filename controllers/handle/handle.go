@@ -1,17 +1,26 @@
 package handle
 
 import (
+	"context"
 	"fmt"
+	"strconv"
+	"time"
+
 	"github.com/go-logr/logr"
+	corev1 "k8s.io/api/core/v1"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	v1 "redis-sentinel/api/v1"
 	"redis-sentinel/controllers/clustercache"
 	"redis-sentinel/pkg/k8s"
 	"redis-sentinel/pkg/metrics"
 	"redis-sentinel/pkg/util"
+	"redis-sentinel/pkg/version"
 	"redis-sentinel/service"
 	)
 
+// minSentinelZones is the number of zones the sentinels have to be spread on
+const minSentinelZones = 2
+
 var (
 	defaultLabels = map[string]string{
 		v1.LabelManagedByKey:v1.OperatorName,
@@ -27,65 +36,103 @@ type RedisSentinelHandler struct {
 	RsHealer    service.RedisClusterHeal
 	MetaCache   *clustercache.MetaMap
 	EventsCli   k8s.Event
+	Metrics     metrics.Instrumenter
 	Logger      logr.Logger
 }
 
 // Do will ensure the RedisCluster is in the expected state and update the RedisCluster status.
-func (rsh *RedisSentinelHandler) Do(rc *v1.RedisSentinel) error {
-	rsh.Logger.WithValues("namespace", rc.Namespace, "name", rc.Name).Info("handler doing")
+// The calls made to redis and sentinel are abandoned once ctx is done.
+func (rsh *RedisSentinelHandler) Do(ctx context.Context, rc *v1.RedisSentinel) error {
+	logger := util.LoggerFrom(ctx, rsh.Logger)
+	logger.Info("handler doing")
 	if err := rc.Validate(); err != nil {
-		metrics.ClusterMetrics.SetClusterError(rc.Namespace, rc.Name)
-		return err
+		rsh.Metrics.SetClusterError(rc.Namespace, rc.Name)
+		return util.InvalidSpec(err)
 	}
+	rsh.checkMaxmemory(ctx, rc)
+	rsh.checkSentinelZones(ctx, rc)
 
 	// diff new and new RedisCluster, then update status
 	meta := rsh.MetaCache.Cache(rc)
-	rsh.Logger.WithValues("namespace", rc.Namespace, "name", rc.Name).V(3).
+	logger.V(3).
 		Info(fmt.Sprintf("meta status:%s, mes:%s, state:%s", meta.Status, meta.Message, meta.State))
 	rsh.updateStatus(meta)
+	// the status is kept on the cached object, the conditions found while checking are set on it
+	status := &meta.Obj.Status
+
+	if rc.Spec.Paused {
+		return rsh.checkPaused(ctx, meta)
+	}
+	status.ClearCondition(v1.ConditionPaused)
+
+	if err := checkImageVersions(rc, status); err != nil {
+		rsh.EventsCli.FailedCluster(rc, err.Error())
+		status.SetFailedCondition(v1.ReasonBadVersion, err.Error(), rc.Generation)
+		rsh.K8sServices.UpdateCluster(rc.Namespace, meta.Obj)
+		rsh.Metrics.SetClusterError(rc.Namespace, rc.Name)
+		return util.InvalidSpec(err)
+	}
 
 	// Create owner refs so the objects manager by this handler have ownership to the
 	// received rc.
-	oRefs := rsh.createOwnerReferences(rc)
+	oRefs := createOwnerReferences(rc)
 
 	// Create the labels every object derived from this need to have.
-	labels := rsh.getLabels(rc)
+	labels := getLabels(rc)
 
-	rsh.Logger.WithValues("namespace", rc.Namespace, "name", rc.Name).V(2).Info("Ensure...")
+	logger.V(2).Info("Ensure...")
 	rsh.EventsCli.EnsureCluster(rc)
-	if err := rsh.Ensure(meta.Obj, labels, oRefs); err != nil {
+	start := time.Now()
+	err := rsh.Ensure(meta.Obj, labels, oRefs)
+	rsh.Metrics.ObserveReconcileDuration(rc.Namespace, rc.Name, metrics.PhaseEnsure, time.Since(start))
+	if resizing, ok := err.(*service.StorageResizing); ok {
+		logger.Info(resizing.Error())
+		status.SetProgressingCondition(v1.PhaseResizing, resizing.Error(), rc.Generation)
+		rsh.K8sServices.UpdateCluster(rc.Namespace, meta.Obj)
+		return needRequeueErr
+	}
+	if pending, ok := err.(*service.MaintenancePending); ok {
+		logger.V(2).Info(pending.Error())
+		status.SetBoolCondition(v1.ConditionMaintenancePending, true, v1.ReasonOutsideWindow, pending.Error(), rc.Generation)
+		err = nil
+	} else {
+		status.ClearCondition(v1.ConditionMaintenancePending)
+	}
+	if err != nil {
 		rsh.EventsCli.FailedCluster(rc, err.Error())
-		rc.Status.SetFailedCondition(err.Error())
-		rsh.K8sServices.UpdateCluster(rc.Namespace, rc)
-		metrics.ClusterMetrics.SetClusterError(rc.Namespace, rc.Name)
+		status.SetFailedCondition(v1.ReasonEnsureFailed, err.Error(), rc.Generation)
+		rsh.K8sServices.UpdateCluster(rc.Namespace, meta.Obj)
+		rsh.Metrics.SetClusterError(rc.Namespace, rc.Name)
 		return err
 	}
 
-	rsh.Logger.WithValues("namespace", rc.Namespace, "name", rc.Name).V(2).Info("CheckAndHeal...")
+	logger.V(2).Info("CheckAndHeal...")
 	rsh.EventsCli.CheckCluster(rc)
-	if err := rsh.CheckAndHeal(meta); err != nil {
-		metrics.ClusterMetrics.SetClusterError(rc.Namespace, rc.Name)
-		if err.Error() != NeedRequeueMsg {
+	start = time.Now()
+	err = rsh.CheckAndHeal(ctx, meta)
+	rsh.Metrics.ObserveReconcileDuration(rc.Namespace, rc.Name, metrics.PhaseCheckAndHeal, time.Since(start))
+	if err != nil {
+		rsh.Metrics.SetClusterError(rc.Namespace, rc.Name)
+		if util.KindOf(err) != util.KindWaitingForPods {
 			rsh.EventsCli.FailedCluster(rc, err.Error())
-			rc.Status.SetFailedCondition(err.Error())
-			rsh.K8sServices.UpdateCluster(rc.Namespace, rc)
+			status.SetFailedCondition(v1.ReasonCheckFailed, err.Error(), rc.Generation)
+			rsh.K8sServices.UpdateCluster(rc.Namespace, meta.Obj)
 			return err
 		}
 		// if user delete statefulset or deployment, set status
-		status := rc.Status.Conditions
-		if len(status) > 0 && status[0].Type == v1.ClusterConditionHealthy {
+		if status.IsConditionTrue(v1.ConditionReady) {
 			rsh.EventsCli.CreateCluster(rc)
-			rc.Status.SetCreateCondition("redis server or sentinel server be removed by user, restart")
-			rsh.K8sServices.UpdateCluster(rc.Namespace, rc)
+			status.SetRecoveringCondition("redis server or sentinel server be removed by user, restart", rc.Generation)
+			rsh.K8sServices.UpdateCluster(rc.Namespace, meta.Obj)
 		}
 		return err
 	}
 
-	rsh.Logger.WithValues("namespace", rc.Namespace, "name", rc.Name).V(2).Info("SetReadyCondition...")
+	logger.V(2).Info("SetReadyCondition...")
 	rsh.EventsCli.HealthCluster(rc)
-	rc.Status.SetReadyCondition("Cluster ok")
-	rsh.K8sServices.UpdateCluster(rc.Namespace, rc)
-	metrics.ClusterMetrics.SetClusterOK(rc.Namespace, rc.Name)
+	status.SetReadyCondition("Cluster ok", rc.Generation)
+	rsh.K8sServices.UpdateCluster(rc.Namespace, meta.Obj)
+	rsh.Metrics.SetClusterOK(rc.Namespace, rc.Name)
 
 	return nil
 }
@@ -96,35 +143,111 @@ func (rsh *RedisSentinelHandler) updateStatus(meta *clustercache.Meta) {
 		// Password change is not allowed
 		//rc.Spec.Redis.Password = rc.Spec.Redis.Password
 		switch meta.Status {
-		case v1.ClusterConditionCreating:
+		case v1.PhaseCreating:
 			rsh.EventsCli.CreateCluster(rc)
-			rc.Status.SetCreateCondition(meta.Message)
-		case v1.ClusterConditionScaling:
+		case v1.PhaseScaling:
 			rsh.EventsCli.NewSlaveAdd(rc, meta.Message)
-			rc.Status.SetScalingUpCondition(meta.Message)
-		case v1.ClusterConditionScalingDown:
+		case v1.PhaseScalingDown:
 			rsh.EventsCli.SlaveRemove(rc, meta.Message)
-			rc.Status.SetScalingDownCondition(meta.Message)
-		case v1.ClusterConditionUpgrading:
+		case v1.PhaseUpgrading:
 			rsh.EventsCli.UpdateCluster(rc, meta.Message)
-			rc.Status.SetUpgradingCondition(meta.Message)
 		default:
 			rsh.EventsCli.UpdateCluster(rc, meta.Message)
-			rc.Status.SetUpdatingCondition(meta.Message)
 		}
+		rc.Status.SetProgressingCondition(meta.Status, meta.Message, rc.Generation)
 		rsh.K8sServices.UpdateCluster(rc.Namespace, rc)
 	}
 }
 
+// checkImageVersions refuses the images too old to be managed, and the redis image unable to
+// load the data of the version running. Images without a version tag are not checked
+func checkImageVersions(rc *v1.RedisSentinel, status *v1.RedisSentinelStatus) error {
+	if v, ok := version.ParseImageVersion(rc.Spec.Sentinel.Image); ok {
+		if err := v.CheckSupported(); err != nil {
+			return fmt.Errorf("sentinel image %s: %v", rc.Spec.Sentinel.Image, err)
+		}
+	}
+	v, ok := version.ParseImageVersion(rc.Spec.Image)
+	if !ok {
+		return nil
+	}
+	if err := v.CheckSupported(); err != nil {
+		return fmt.Errorf("image %s: %v", rc.Spec.Image, err)
+	}
+	if status.Version == "" {
+		return nil
+	}
+	running, err := version.ParseVersion(status.Flavor, status.Version)
+	if err != nil {
+		return nil
+	}
+	if version.IsDowngrade(running, v) {
+		return fmt.Errorf("refusing to downgrade from %s to image %s", running, rc.Spec.Image)
+	}
+	return nil
+}
+
+// checkMaxmemory warns when maxmemory is above the memory limit, redis would be OOM killed
+// before evicting keys. The warning is a condition, the event is only sent when it appears
+func (rsh *RedisSentinelHandler) checkMaxmemory(ctx context.Context, rc *v1.RedisSentinel) {
+	limit, ok := rc.Spec.Resources.Limits[corev1.ResourceMemory]
+	value, set := rc.Spec.Config["maxmemory"]
+	if !ok || limit.IsZero() || !set {
+		rc.Status.ClearCondition(v1.ConditionMaxmemoryExceedsLimit)
+		return
+	}
+	parsed, err := util.ParseRedisMemConf(value)
+	if err != nil {
+		return
+	}
+	maxmemory, err := strconv.ParseInt(parsed, 10, 64)
+	if err != nil || maxmemory <= limit.Value() {
+		rc.Status.ClearCondition(v1.ConditionMaxmemoryExceedsLimit)
+		return
+	}
+	message := fmt.Sprintf("maxmemory %s is higher than the memory limit %s", value, limit.String())
+	if !rc.Status.IsConditionTrue(v1.ConditionMaxmemoryExceedsLimit) {
+		util.LoggerFrom(ctx, rsh.Logger).Info(message)
+		rsh.EventsCli.MaxmemoryExceedsLimit(rc, message)
+	}
+	rc.Status.SetBoolCondition(v1.ConditionMaxmemoryExceedsLimit, true, v1.ReasonAboveLimit, message, rc.Generation)
+}
+
+// checkSentinelZones warns when the sentinels are asked to spread across zones but the nodes
+// they can run on are in a single zone, losing that zone would lose the quorum
+func (rsh *RedisSentinelHandler) checkSentinelZones(ctx context.Context, rc *v1.RedisSentinel) {
+	if rc.Spec.Placement == nil || !rc.Spec.Placement.ZoneSpread || !util.IsClusterScoped() {
+		return
+	}
+	nodes, err := rsh.K8sServices.ListNodes(rc.Spec.Sentinel.NodeSelector)
+	if err != nil {
+		util.LoggerFrom(ctx, rsh.Logger).Error(err, "can't list the nodes")
+		return
+	}
+	zones := make(map[string]struct{})
+	for _, node := range nodes.Items {
+		if zone, ok := node.Labels[util.ZoneTopologyKey]; ok {
+			zones[zone] = struct{}{}
+		}
+	}
+	if len(zones) >= minSentinelZones {
+		return
+	}
+	message := fmt.Sprintf("sentinels can only run in %d zones, at least %d are needed to survive a zone failure",
+		len(zones), minSentinelZones)
+	util.LoggerFrom(ctx, rsh.Logger).Info(message)
+	rsh.EventsCli.SentinelsNotSpread(rc, message)
+}
+
 // getLabels merges all the labels (dynamic and operator static ones).
-func (rsh *RedisSentinelHandler) getLabels(rs *v1.RedisSentinel) map[string]string {
+func getLabels(rs *v1.RedisSentinel) map[string]string {
 	dynLabels := map[string]string{
 		v1.LabelNameKey: fmt.Sprintf("%s%c%s", rs.Namespace, '_', rs.Name),
 	}
 	return util.MergeLabels(defaultLabels, dynLabels, rs.Labels)
 }
 
-func (rsh *RedisSentinelHandler) createOwnerReferences(rs *v1.RedisSentinel) []metav1.OwnerReference {
+func createOwnerReferences(rs *v1.RedisSentinel) []metav1.OwnerReference {
 	rsvk := v1.VersionKind(v1.Kind)
 	return []metav1.OwnerReference{
 		*metav1.NewControllerRef(rs, rsvk),
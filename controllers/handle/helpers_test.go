@@ -0,0 +1,199 @@
+package handle
+
+import (
+	"context"
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/go-logr/logr"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	clientgoscheme "k8s.io/client-go/kubernetes/scheme"
+	"k8s.io/client-go/tools/record"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+	logf "sigs.k8s.io/controller-runtime/pkg/log"
+
+	rsv1 "redis-sentinel/api/v1"
+	"redis-sentinel/controllers/clustercache"
+	"redis-sentinel/pkg/k8s"
+	"redis-sentinel/pkg/util"
+	"redis-sentinel/pkg/version"
+	"redis-sentinel/service"
+)
+
+const testNamespace = "testns"
+
+// fakeChecker is the real checker for the decisions taken from the topology, the calls
+// reaching redis are answered from its fields
+type fakeChecker struct {
+	service.RedisClusterCheck
+	topo   *service.Topology
+	offset int64
+}
+
+func (c *fakeChecker) CheckRedisNumber(rs *rsv1.RedisSentinel) error    { return nil }
+func (c *fakeChecker) CheckSentinelNumber(rs *rsv1.RedisSentinel) error { return nil }
+
+func (c *fakeChecker) GetTopology(ctx context.Context, rs *rsv1.RedisSentinel, auth *util.AuthConfig) (*service.Topology, error) {
+	return c.topo, nil
+}
+
+func (c *fakeChecker) GetSourceOffset(ctx context.Context, source *service.ReplicaOfSource) (int64, error) {
+	return c.offset, nil
+}
+
+func (c *fakeChecker) CheckRedisConfig(rs *rsv1.RedisSentinel, node *service.RedisNode) error {
+	return nil
+}
+
+// nopMetrics drops the metrics of the handlers
+type nopMetrics struct{}
+
+func (nopMetrics) SetClusterOK(namespace string, name string)                              {}
+func (nopMetrics) SetClusterError(namespace string, name string)                           {}
+func (nopMetrics) DeleteCluster(namespace string, name string)                             {}
+func (nopMetrics) ObserveReconcileDuration(namespace, name, phase string, d time.Duration) {}
+func (nopMetrics) IncHealAction(namespace string, name string, action string)              {}
+func (nopMetrics) IncFailover(namespace string, name string)                               {}
+func (nopMetrics) SetSentinelAgreement(namespace string, name string, ratio float64)       {}
+func (nopMetrics) SetReplicaLag(namespace string, name string, lags map[string]int64)      {}
+
+// fakeHealer records the heal actions instead of running them
+type fakeHealer struct {
+	service.RedisClusterHeal
+	calls []string
+}
+
+func (h *fakeHealer) record(format string, args ...interface{}) {
+	h.calls = append(h.calls, fmt.Sprintf(format, args...))
+}
+
+func (h *fakeHealer) called(call string) bool {
+	for _, c := range h.calls {
+		if c == call {
+			return true
+		}
+	}
+	return false
+}
+
+func (h *fakeHealer) RemoveSentinelMonitor(ctx context.Context, ip string, rs *rsv1.RedisSentinel, auth *util.AuthConfig) error {
+	h.record("RemoveSentinelMonitor %s", ip)
+	return nil
+}
+
+func (h *fakeHealer) SetAnnounceAddrs(ctx context.Context, topo *service.Topology, rs *rsv1.RedisSentinel, auth *util.AuthConfig) error {
+	return nil
+}
+
+func (h *fakeHealer) ReplicateSource(ctx context.Context, head *service.RedisNode, source *service.ReplicaOfSource, rs *rsv1.RedisSentinel, auth *util.AuthConfig) error {
+	h.record("ReplicateSource %s %s", head.Pod.Name, source)
+	return nil
+}
+
+func (h *fakeHealer) SetStandbyReplicas(ctx context.Context, head *service.RedisNode, topo *service.Topology, rs *rsv1.RedisSentinel, auth *util.AuthConfig) error {
+	h.record("SetStandbyReplicas %s", head.Pod.Name)
+	return nil
+}
+
+func (h *fakeHealer) SetRedisRoleLabels(master *service.RedisNode, topo *service.Topology, rs *rsv1.RedisSentinel) error {
+	return nil
+}
+
+func (h *fakeHealer) PromoteStandby(ctx context.Context, head *service.RedisNode, rs *rsv1.RedisSentinel, auth *util.AuthConfig) error {
+	h.record("PromoteStandby %s", head.Pod.Name)
+	return nil
+}
+
+func (h *fakeHealer) SetSourceReadOnly(ctx context.Context, source *service.ReplicaOfSource, rs *rsv1.RedisSentinel) (*rsv1.SourceWrites, error) {
+	h.record("SetSourceReadOnly %s", source)
+	return &rsv1.SourceWrites{MinReplicasToWrite: "0", MinReplicasMaxLag: "10"}, nil
+}
+
+func (h *fakeHealer) RestoreSourceWrites(ctx context.Context, source *service.ReplicaOfSource, writes *rsv1.SourceWrites, rs *rsv1.RedisSentinel) error {
+	h.record("RestoreSourceWrites %s %s %s", source, writes.MinReplicasToWrite, writes.MinReplicasMaxLag)
+	return nil
+}
+
+func (h *fakeHealer) SetOldestAsMaster(ctx context.Context, topo *service.Topology, rs *rsv1.RedisSentinel, auth *util.AuthConfig) error {
+	h.record("SetOldestAsMaster")
+	return nil
+}
+
+func (h *fakeHealer) MakeMaster(ctx context.Context, node *service.RedisNode, rs *rsv1.RedisSentinel, auth *util.AuthConfig) error {
+	h.record("MakeMaster %s", node.Pod.Name)
+	return nil
+}
+
+func newTestCluster() *rsv1.RedisSentinel {
+	rs := &rsv1.RedisSentinel{
+		ObjectMeta: metav1.ObjectMeta{Name: "test", Namespace: testNamespace},
+	}
+	rs.Spec.Size = 2
+	rs.Spec.Sentinel.Replicas = 3
+	return rs
+}
+
+// newRedisNode returns a redis of the cluster test, a master when masterHost is empty
+func newRedisNode(index int, masterHost, masterPort string) *service.RedisNode {
+	name := fmt.Sprintf("redis-test-%d", index)
+	ip := fmt.Sprintf("10.0.0.%d", index+1)
+	return &service.RedisNode{
+		Pod: &corev1.Pod{ObjectMeta: metav1.ObjectMeta{
+			Name:              name,
+			Namespace:         testNamespace,
+			CreationTimestamp: metav1.NewTime(time.Unix(int64(index), 0)),
+		}},
+		IP:           ip,
+		AnnounceHost: ip,
+		AnnouncePort: "6379",
+		IsMaster:     masterHost == "",
+		MasterHost:   masterHost,
+		MasterPort:   masterPort,
+		MasterLinkUp: masterHost != "",
+		Version:      &version.ServerVersion{Flavor: version.FlavorRedis, Major: 5, Minor: 0, Patch: 4},
+	}
+}
+
+func newSentinelNodes(n int) []*service.SentinelNode {
+	sentinels := make([]*service.SentinelNode, n)
+	for i := range sentinels {
+		sentinels[i] = &service.SentinelNode{IP: fmt.Sprintf("10.0.1.%d", i+1)}
+	}
+	return sentinels
+}
+
+// newTestClient returns a fake kubernetes holding the given objects
+func newTestClient(t *testing.T, objs ...runtime.Object) client.Client {
+	scheme := runtime.NewScheme()
+	if err := clientgoscheme.AddToScheme(scheme); err != nil {
+		t.Fatal(err)
+	}
+	if err := rsv1.AddToScheme(scheme); err != nil {
+		t.Fatal(err)
+	}
+	return fake.NewFakeClientWithScheme(scheme, objs...)
+}
+
+// newTestHandler returns a handler of the cluster on a fake kubernetes holding it
+func newTestHandler(t *testing.T, rs *rsv1.RedisSentinel, topo *service.Topology) (*RedisSentinelHandler, *fakeHealer, client.Client) {
+	cli := newTestClient(t, rs)
+	var logger logr.Logger = logf.NullLogger{}
+	k8sServices := k8s.New(cli, logger)
+	healer := &fakeHealer{}
+	return &RedisSentinelHandler{
+		K8sServices: k8sServices,
+		RsChecker: &fakeChecker{
+			RedisClusterCheck: service.NewRedisClusterChecker(k8sServices, nil, 1, logger),
+			topo:              topo,
+		},
+		RsHealer:  healer,
+		MetaCache: &clustercache.MetaMap{},
+		EventsCli: k8s.NewEvent(record.NewFakeRecorder(100), logger),
+		Metrics:   nopMetrics{},
+		Logger:    logger,
+	}, healer, cli
+}
@@ -0,0 +1,188 @@
+package handle
+
+import (
+	"context"
+	"errors"
+	"fmt"
+
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	rsv1 "redis-sentinel/api/v1"
+	"redis-sentinel/controllers/clustercache"
+	"redis-sentinel/pkg/util"
+	"redis-sentinel/service"
+)
+
+// migrating is true while the data of an unmanaged redis is moved into the cluster, or when a
+// migration not completed was removed from the spec
+func migrating(rs *rsv1.RedisSentinel) bool {
+	if rs.Status.Migration != nil && rs.Status.Migration.Phase == rsv1.MigrationCompleted {
+		return false
+	}
+	return rs.Spec.Migration != nil || rs.Status.Migration != nil
+}
+
+// checkAndHealMigration keeps the cluster a replica of the source of its migration, like a
+// standby, until the cutover. The cutover makes the source read-only, waits for the head to
+// reach the offset of the source and promotes it. It returns true once the head is promoted,
+// the checks that follow then make the sentinels monitor it
+func (rsh *RedisSentinelHandler) checkAndHealMigration(ctx context.Context, meta *clustercache.Meta, topo *service.Topology) (bool, error) {
+	rs := meta.Obj
+	if rs.Spec.Migration == nil {
+		return true, rsh.abortMigration(ctx, meta, topo)
+	}
+	source, err := rsh.RsChecker.GetMigrationSource(rs, &rs.Spec.Migration.Source)
+	if err != nil {
+		return false, err
+	}
+	cutover := rs.Spec.Migration.Cutover
+	readOnly := rs.Status.IsConditionTrue(rsv1.ConditionSourceReadOnly)
+	switch {
+	case cutover && !readOnly:
+		if err := rsh.setSourceReadOnly(ctx, rs, source); err != nil {
+			return false, err
+		}
+	case !cutover && readOnly:
+		// the cutover was cancelled, the source takes the writes again
+		if err := rsh.restoreSourceWrites(ctx, rs); err != nil {
+			return false, err
+		}
+	}
+	head, err := rsh.followSource(ctx, meta, topo, source)
+	if err != nil {
+		return false, err
+	}
+	// the offset is read after the source became read-only, the head has all the writes once
+	// it reached it
+	offset, offsetErr := rsh.RsChecker.GetSourceOffset(ctx, source)
+	rsh.recordMigration(meta, head, source, offset, offsetErr)
+	if !cutover {
+		return false, nil
+	}
+	if offsetErr != nil {
+		return false, offsetErr
+	}
+
+	if !replicates(head, source) || !head.MasterLinkUp || head.MasterSyncing || head.ReplOffset < offset {
+		msg := fmt.Sprintf("cutover from %s, waiting for %s to reach offset %d", source, head.Pod.Name, offset)
+		util.LoggerFrom(ctx, rsh.Logger).Info(msg)
+		rs.Status.SetCuttingOverCondition(msg, rs.Generation)
+		rsh.K8sServices.UpdateCluster(rs.Namespace, rs)
+		return false, needRequeueErr
+	}
+
+	if err := rsh.RsHealer.PromoteStandby(ctx, head, rs, meta.Auth); err != nil {
+		return false, err
+	}
+	now := metav1.Now()
+	zero := int64(0)
+	migration := rs.Status.Migration
+	migration.Phase = rsv1.MigrationCompleted
+	migration.LagBytes = &zero
+	migration.FinalOffset = offset
+	migration.CompletedTime = &now
+	msg := fmt.Sprintf("migration from %s completed at offset %d, %s promoted", source, offset, head.Pod.Name)
+	util.LoggerFrom(ctx, rsh.Logger).Info(msg)
+	rsh.EventsCli.UpdateCluster(rs, msg)
+	rs.Status.SetBoolCondition(rsv1.ConditionSourceLinkUp, false, rsv1.ReasonPromoted, msg, rs.Generation)
+	return true, nil
+}
+
+// recordMigration sets the progress of the head replicating the source on the status
+func (rsh *RedisSentinelHandler) recordMigration(meta *clustercache.Meta, head *service.RedisNode, source *service.ReplicaOfSource, offset int64, offsetErr error) {
+	rs := meta.Obj
+	migration := &rsv1.MigrationStatus{
+		Phase:          rsv1.MigrationSyncing,
+		Source:         source.String(),
+		Head:           head.Pod.Name,
+		LinkUp:         head.MasterLinkUp,
+		SyncInProgress: head.MasterSyncing,
+	}
+	switch {
+	case rs.Spec.Migration.Cutover:
+		migration.Phase = rsv1.MigrationCuttingOver
+	case replicates(head, source) && head.MasterLinkUp && !head.MasterSyncing:
+		migration.Phase = rsv1.MigrationInSync
+	}
+	if offsetErr == nil {
+		lag := offset - head.ReplOffset
+		if lag < 0 {
+			lag = 0
+		}
+		migration.LagBytes = &lag
+	}
+	if rs.Status.Migration != nil {
+		migration.ReadOnlySource = rs.Status.Migration.ReadOnlySource
+		migration.SourceWrites = rs.Status.Migration.SourceWrites
+	}
+	rs.Status.Migration = migration
+	rs.Status.MasterIP = head.IP
+	rs.Status.MasterPod = head.Pod.Name
+
+	rs.Status.SetBoolCondition(rsv1.ConditionAvailable, false, rsv1.ReasonMigrating,
+		fmt.Sprintf("migrating from %s, %s is read-only until the cutover", source, head.Pod.Name), rs.Generation)
+	setSourceLinkCondition(rs, head, source)
+}
+
+// abortMigration detaches the head from the source, the migration was removed from the spec
+// before its cutover completed. A source made read-only by the cutover takes the writes again
+func (rsh *RedisSentinelHandler) abortMigration(ctx context.Context, meta *clustercache.Meta, topo *service.Topology) error {
+	rs := meta.Obj
+	if rs.Status.IsConditionTrue(rsv1.ConditionSourceReadOnly) {
+		if err := rsh.restoreSourceWrites(ctx, rs); err != nil {
+			return err
+		}
+	}
+	if err := rsh.promoteHead(ctx, meta, topo, rs.Status.Migration.Head); err != nil {
+		return err
+	}
+	msg := fmt.Sprintf("migration from %s aborted", rs.Status.Migration.Source)
+	util.LoggerFrom(ctx, rsh.Logger).Info(msg)
+	rsh.EventsCli.UpdateCluster(rs, msg)
+	rs.Status.Migration = nil
+	rs.Status.SetBoolCondition(rsv1.ConditionSourceLinkUp, false, rsv1.ReasonPromoted, msg, rs.Generation)
+	return nil
+}
+
+// setSourceReadOnly starts the cutover, once. The settings of the source before it are saved
+// on the status right away, the source only has the read-only ones afterwards
+func (rsh *RedisSentinelHandler) setSourceReadOnly(ctx context.Context, rs *rsv1.RedisSentinel, source *service.ReplicaOfSource) error {
+	writes, err := rsh.RsHealer.SetSourceReadOnly(ctx, source, rs)
+	if err != nil {
+		return err
+	}
+	if rs.Status.Migration == nil {
+		rs.Status.Migration = &rsv1.MigrationStatus{Phase: rsv1.MigrationCuttingOver, Source: source.String()}
+	}
+	rs.Status.Migration.ReadOnlySource = rs.Spec.Migration.Source.DeepCopy()
+	rs.Status.Migration.SourceWrites = writes
+	msg := fmt.Sprintf("source %s made read-only", source)
+	util.LoggerFrom(ctx, rsh.Logger).Info(msg)
+	rsh.EventsCli.UpdateCluster(rs, msg)
+	rs.Status.SetBoolCondition(rsv1.ConditionSourceReadOnly, true, rsv1.ReasonCutover, msg, rs.Generation)
+	return rsh.K8sServices.UpdateCluster(rs.Namespace, rs)
+}
+
+// restoreSourceWrites gives back to the source made read-only by the cutover the settings it
+// had before
+func (rsh *RedisSentinelHandler) restoreSourceWrites(ctx context.Context, rs *rsv1.RedisSentinel) error {
+	migration := rs.Status.Migration
+	if migration == nil || migration.ReadOnlySource == nil || migration.SourceWrites == nil {
+		rs.Status.SetBoolCondition(rsv1.ConditionSourceReadOnly, false, rsv1.ReasonRestored,
+			"the settings of the source before the cutover are unknown", rs.Generation)
+		return util.NeedsHuman(errors.New("the source was made read-only but its settings before are unknown, restore its writes manually"))
+	}
+	source, err := rsh.RsChecker.GetMigrationSource(rs, migration.ReadOnlySource)
+	if err != nil {
+		return err
+	}
+	if err := rsh.RsHealer.RestoreSourceWrites(ctx, source, migration.SourceWrites, rs); err != nil {
+		return err
+	}
+	msg := fmt.Sprintf("source %s takes the writes again", source)
+	util.LoggerFrom(ctx, rsh.Logger).Info(msg)
+	rsh.EventsCli.UpdateCluster(rs, msg)
+	migration.ReadOnlySource = nil
+	migration.SourceWrites = nil
+	rs.Status.SetBoolCondition(rsv1.ConditionSourceReadOnly, false, rsv1.ReasonRestored, msg, rs.Generation)
+	return nil
+}
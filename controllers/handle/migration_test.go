@@ -0,0 +1,162 @@
+package handle
+
+import (
+	"context"
+	"testing"
+
+	"k8s.io/apimachinery/pkg/types"
+
+	rsv1 "redis-sentinel/api/v1"
+	"redis-sentinel/service"
+)
+
+const migrationSource = "10.2.0.1:6379"
+
+func newMigratingCluster(cutover bool) *rsv1.RedisSentinel {
+	rs := newTestCluster()
+	rs.Spec.Migration = &rsv1.MigrationSettings{
+		Source:  rsv1.MigrationSource{Host: "10.2.0.1", Port: 6379},
+		Cutover: cutover,
+	}
+	return rs
+}
+
+// setReadOnly records on the status a source made read-only by a previous cutover
+func setReadOnly(rs *rsv1.RedisSentinel) {
+	rs.Status.Migration = &rsv1.MigrationStatus{
+		Phase:          rsv1.MigrationCuttingOver,
+		Source:         migrationSource,
+		Head:           "redis-test-0",
+		ReadOnlySource: &rsv1.MigrationSource{Host: "10.2.0.1", Port: 6379},
+		SourceWrites:   &rsv1.SourceWrites{MinReplicasToWrite: "2", MinReplicasMaxLag: "5"},
+	}
+	rs.Status.SetBoolCondition(rsv1.ConditionSourceReadOnly, true, rsv1.ReasonCutover, "read-only", rs.Generation)
+}
+
+func newMigrationTopology(headOffset int64) *service.Topology {
+	head := newRedisNode(0, "10.2.0.1", "6379")
+	head.ReplOffset = headOffset
+	return &service.Topology{
+		Redises:   []*service.RedisNode{head, newRedisNode(1, "10.0.0.1", "6379")},
+		Sentinels: newSentinelNodes(1),
+	}
+}
+
+func TestMigrationCutoverSetsSourceReadOnlyOnce(t *testing.T) {
+	rs := newMigratingCluster(true)
+	h, healer, cli := newTestHandler(t, rs, newMigrationTopology(50))
+	h.RsChecker.(*fakeChecker).offset = 100
+	meta := h.MetaCache.Cache(rs)
+
+	for i := 0; i < 2; i++ {
+		promoted, err := h.checkAndHealMigration(context.TODO(), meta, newMigrationTopology(50))
+		if promoted || err != needRequeueErr {
+			t.Fatalf("checkAndHealMigration() = %v, %v, want to wait for the head", promoted, err)
+		}
+	}
+	n := 0
+	for _, call := range healer.calls {
+		if call == "SetSourceReadOnly "+migrationSource {
+			n++
+		}
+	}
+	if n != 1 {
+		t.Errorf("source made read-only %d times, want once", n)
+	}
+
+	stored := &rsv1.RedisSentinel{}
+	if err := cli.Get(context.TODO(), types.NamespacedName{Namespace: testNamespace, Name: rs.Name}, stored); err != nil {
+		t.Fatal(err)
+	}
+	if !stored.Status.IsConditionTrue(rsv1.ConditionSourceReadOnly) {
+		t.Errorf("SourceReadOnly condition not saved")
+	}
+	migration := stored.Status.Migration
+	if migration == nil || migration.SourceWrites == nil || migration.SourceWrites.MinReplicasToWrite != "0" ||
+		migration.ReadOnlySource == nil || migration.ReadOnlySource.Host != "10.2.0.1" {
+		t.Errorf("migration status = %+v, want the settings of the source before the cutover", migration)
+	}
+}
+
+func TestMigrationCutoverCompletes(t *testing.T) {
+	rs := newMigratingCluster(true)
+	setReadOnly(rs)
+	h, healer, _ := newTestHandler(t, rs, nil)
+	h.RsChecker.(*fakeChecker).offset = 100
+
+	promoted, err := h.checkAndHealMigration(context.TODO(), h.MetaCache.Cache(rs), newMigrationTopology(100))
+	if !promoted || err != nil {
+		t.Fatalf("checkAndHealMigration() = %v, %v, want the head promoted", promoted, err)
+	}
+	if healer.called("SetSourceReadOnly " + migrationSource) {
+		t.Errorf("source made read-only again")
+	}
+	if !healer.called("PromoteStandby redis-test-0") {
+		t.Errorf("heal actions = %q, want the head promoted", healer.calls)
+	}
+	if rs.Status.Migration.Phase != rsv1.MigrationCompleted || rs.Status.Migration.FinalOffset != 100 {
+		t.Errorf("migration status = %+v, want completed at offset 100", rs.Status.Migration)
+	}
+	if rs.Status.Migration.SourceWrites == nil {
+		t.Errorf("settings of the source before the cutover lost")
+	}
+}
+
+func TestMigrationCutoverCancelled(t *testing.T) {
+	rs := newMigratingCluster(false)
+	setReadOnly(rs)
+	h, healer, _ := newTestHandler(t, rs, nil)
+
+	promoted, err := h.checkAndHealMigration(context.TODO(), h.MetaCache.Cache(rs), newMigrationTopology(50))
+	if promoted || err != nil {
+		t.Fatalf("checkAndHealMigration() = %v, %v, want to keep syncing", promoted, err)
+	}
+	if !healer.called("RestoreSourceWrites " + migrationSource + " 2 5") {
+		t.Errorf("heal actions = %q, want the writes of the source restored", healer.calls)
+	}
+	if rs.Status.IsConditionTrue(rsv1.ConditionSourceReadOnly) {
+		t.Errorf("SourceReadOnly still true")
+	}
+	if rs.Status.Migration.Phase != rsv1.MigrationSyncing && rs.Status.Migration.Phase != rsv1.MigrationInSync {
+		t.Errorf("migration phase = %s, want it syncing", rs.Status.Migration.Phase)
+	}
+	if rs.Status.Migration.SourceWrites != nil {
+		t.Errorf("settings of the source kept after their restore")
+	}
+}
+
+func TestMigrationAbortedAfterCutover(t *testing.T) {
+	tests := []struct {
+		name        string
+		readOnly    bool
+		wantRestore bool
+	}{
+		{name: "before the cutover"},
+		{name: "after the cutover", readOnly: true, wantRestore: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rs := newTestCluster()
+			rs.Status.Migration = &rsv1.MigrationStatus{Phase: rsv1.MigrationSyncing, Source: migrationSource, Head: "redis-test-0"}
+			if tt.readOnly {
+				setReadOnly(rs)
+			}
+			h, healer, _ := newTestHandler(t, rs, nil)
+
+			promoted, err := h.checkAndHealMigration(context.TODO(), h.MetaCache.Cache(rs), newMigrationTopology(50))
+			if !promoted || err != nil {
+				t.Fatalf("checkAndHealMigration() = %v, %v, want the head promoted", promoted, err)
+			}
+			restored := healer.called("RestoreSourceWrites " + migrationSource + " 2 5")
+			if restored != tt.wantRestore {
+				t.Errorf("writes of the source restored = %v, want %v", restored, tt.wantRestore)
+			}
+			if !healer.called("PromoteStandby redis-test-0") {
+				t.Errorf("heal actions = %q, want the head promoted", healer.calls)
+			}
+			if rs.Status.Migration != nil || rs.Status.IsConditionTrue(rsv1.ConditionSourceReadOnly) {
+				t.Errorf("migration status = %+v, want it removed", rs.Status.Migration)
+			}
+		})
+	}
+}
@@ -0,0 +1,550 @@
+package handle
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sort"
+
+	"github.com/go-logr/logr"
+	kerrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	rsv1 "redis-sentinel/api/v1"
+	"redis-sentinel/controllers/clustercache"
+	"redis-sentinel/pkg/k8s"
+	"redis-sentinel/pkg/util"
+	"redis-sentinel/service"
+)
+
+// specTarget is the target of RotatePassword standing for the spec of the cluster
+const specTarget = "spec"
+
+// RedisSentinelOperationHandler runs the manual operations on the RedisSentinels, it shares the
+// services and the cached passwords of the RedisSentinelHandler
+type RedisSentinelOperationHandler struct {
+	K8sServices k8s.Services
+	RsService   service.RedisSentinelClient
+	RsChecker   service.RedisClusterCheck
+	RsHealer    service.RedisClusterHeal
+	MetaCache   *clustercache.MetaMap
+	EventsCli   k8s.Event
+	Logger      logr.Logger
+}
+
+// Do runs the operation until it succeeds or fails, it never runs again afterwards.
+// The pre-checks run once before the operation starts, a single operation runs on a cluster
+// at a time and its targets are handled in order, the progress is saved after every step
+func (h *RedisSentinelOperationHandler) Do(ctx context.Context, op *rsv1.RedisSentinelOperation) error {
+	if op.Status.Finished() {
+		return nil
+	}
+	rs, err := h.K8sServices.GetCluster(op.Namespace, op.Spec.ClusterName)
+	if err != nil {
+		if kerrors.IsNotFound(err) {
+			return h.fail(ctx, op, nil, fmt.Sprintf("RedisSentinel %s not found", op.Spec.ClusterName))
+		}
+		return err
+	}
+	meta, ok := h.MetaCache.Lookup(rs)
+	if !ok {
+		// the cluster was not reconciled since the operator started, its password is unknown
+		return needRequeueErr
+	}
+
+	if op.Status.Phase != rsv1.OperationRunning {
+		if err := op.Validate(); err != nil {
+			return h.fail(ctx, op, rs, err.Error())
+		}
+		running, err := h.runningOperation(op)
+		if err != nil {
+			return err
+		}
+		if running != "" {
+			op.Status.Phase = rsv1.OperationPending
+			op.Status.Message = fmt.Sprintf("waiting for operation %s to finish", running)
+			h.K8sServices.UpdateOperation(op.Namespace, op)
+			return needRequeueErr
+		}
+		targets, err := h.preCheck(ctx, op, rs, meta)
+		if err != nil {
+			return h.fail(ctx, op, rs, err.Error())
+		}
+		now := metav1.Now()
+		op.Status = rsv1.RedisSentinelOperationStatus{
+			Phase:     rsv1.OperationRunning,
+			Message:   fmt.Sprintf("%s started", op.Spec.Action),
+			Targets:   targets,
+			StartTime: &now,
+		}
+		msg := fmt.Sprintf("operation %s: %s started", op.Name, op.Spec.Action)
+		util.LoggerFrom(ctx, h.Logger).WithValues("cluster", rs.Name).Info(msg)
+		h.EventsCli.OperationStarted(op, msg)
+		h.EventsCli.OperationStarted(rs, msg)
+		if err := h.K8sServices.UpdateOperation(op.Namespace, op); err != nil {
+			return err
+		}
+	}
+
+	done, err := h.run(ctx, op, rs, meta)
+	if err != nil {
+		switch util.KindOf(err) {
+		case util.KindNeedsHuman, util.KindInvalidSpec:
+			return h.fail(ctx, op, rs, err.Error())
+		}
+		// the step is retried, the progress of the steps done before it is kept
+		if target := nextTarget(op); target != nil {
+			target.Message = err.Error()
+		}
+		h.K8sServices.UpdateOperation(op.Namespace, op)
+		return err
+	}
+	if !done {
+		h.K8sServices.UpdateOperation(op.Namespace, op)
+		return needRequeueErr
+	}
+
+	now := metav1.Now()
+	op.Status.Phase = rsv1.OperationSucceeded
+	op.Status.Message = fmt.Sprintf("%s succeeded", op.Spec.Action)
+	op.Status.CompletionTime = &now
+	msg := fmt.Sprintf("operation %s: %s succeeded", op.Name, op.Spec.Action)
+	util.LoggerFrom(ctx, h.Logger).WithValues("cluster", rs.Name).Info(msg)
+	h.EventsCli.OperationSucceeded(op, msg)
+	h.EventsCli.OperationSucceeded(rs, msg)
+	return h.K8sServices.UpdateOperation(op.Namespace, op)
+}
+
+// fail marks the operation and its current target as failed, it is not retried. Only the errors
+// a retry can't fix fail an operation once it runs, the others requeue it
+func (h *RedisSentinelOperationHandler) fail(ctx context.Context, op *rsv1.RedisSentinelOperation, rs *rsv1.RedisSentinel, message string) error {
+	now := metav1.Now()
+	op.Status.Phase = rsv1.OperationFailed
+	op.Status.Message = message
+	op.Status.CompletionTime = &now
+	if target := nextTarget(op); target != nil {
+		target.Phase = rsv1.OperationFailed
+		target.Message = message
+	}
+	msg := fmt.Sprintf("operation %s: %s failed: %s", op.Name, op.Spec.Action, message)
+	util.LoggerFrom(ctx, h.Logger).WithValues("cluster", op.Spec.ClusterName).Info(msg)
+	h.EventsCli.OperationFailed(op, msg)
+	if rs != nil {
+		h.EventsCli.OperationFailed(rs, msg)
+	}
+	return h.K8sServices.UpdateOperation(op.Namespace, op)
+}
+
+// runningOperation returns the name of another operation running on the same cluster
+func (h *RedisSentinelOperationHandler) runningOperation(op *rsv1.RedisSentinelOperation) (string, error) {
+	ops, err := h.K8sServices.ListOperations(op.Namespace)
+	if err != nil {
+		return "", err
+	}
+	for _, other := range ops.Items {
+		if other.Name != op.Name && other.Spec.ClusterName == op.Spec.ClusterName && other.Status.Phase == rsv1.OperationRunning {
+			return other.Name, nil
+		}
+	}
+	return "", nil
+}
+
+// preCheck refuses the operations the cluster is not in a state to run and returns the targets
+// of the others
+func (h *RedisSentinelOperationHandler) preCheck(ctx context.Context, op *rsv1.RedisSentinelOperation, rs *rsv1.RedisSentinel, meta *clustercache.Meta) ([]rsv1.OperationTarget, error) {
+	if rs.DeletionTimestamp != nil {
+		return nil, fmt.Errorf("cluster %s is being deleted", rs.Name)
+	}
+	switch op.Spec.Action {
+	case rsv1.ActionRestartPod, rsv1.ActionResetSentinels:
+		// they are used to repair a cluster
+	default:
+		if !rs.Status.IsConditionTrue(rsv1.ConditionReady) {
+			return nil, fmt.Errorf("cluster %s is not ready", rs.Name)
+		}
+	}
+
+	switch op.Spec.Action {
+	case rsv1.ActionRestartPod:
+		redises, err := h.podNames(rs, util.GetRedisName(rs))
+		if err != nil {
+			return nil, err
+		}
+		sentinels, err := h.podNames(rs, util.GetSentinelName(rs))
+		if err != nil {
+			return nil, err
+		}
+		if !util.ContainsString(redises, op.Spec.Pod) && !util.ContainsString(sentinels, op.Spec.Pod) {
+			return nil, fmt.Errorf("pod %s is not a redis or a sentinel of cluster %s", op.Spec.Pod, rs.Name)
+		}
+		return newTargets(op.Spec.Pod), nil
+
+	case rsv1.ActionFailover:
+		if rs.Spec.Size < 2 {
+			return nil, errors.New("a failover needs a replica")
+		}
+		if replicatesSource(rs) {
+			return nil, errors.New("the cluster replicates a source, it has no master to fail over")
+		}
+		topo, err := h.RsChecker.GetTopology(ctx, rs, meta.Auth)
+		if err != nil {
+			return nil, err
+		}
+		master, err := h.RsChecker.GetMaster(topo)
+		if err != nil {
+			return nil, err
+		}
+		return newTargets(master.Pod.Name), nil
+
+	case rsv1.ActionResetSentinels:
+		sentinels, err := h.podNames(rs, util.GetSentinelName(rs))
+		if err != nil {
+			return nil, err
+		}
+		return newTargets(sentinels...), nil
+
+	case rsv1.ActionRewriteAOF:
+		if rs.Spec.DisablePersistence {
+			return nil, errors.New("persistence is disabled, there is no append only file")
+		}
+		redises, err := h.podNames(rs, util.GetRedisName(rs))
+		if err != nil {
+			return nil, err
+		}
+		return newTargets(redises...), nil
+
+	case rsv1.ActionResyncReplica:
+		if replicatesSource(rs) {
+			return nil, errors.New("the cluster replicates a source, its replicas can't be resynced")
+		}
+		topo, err := h.RsChecker.GetTopology(ctx, rs, meta.Auth)
+		if err != nil {
+			return nil, err
+		}
+		node := findRedis(topo, op.Spec.Pod)
+		if node == nil {
+			return nil, fmt.Errorf("pod %s is not a running redis of cluster %s", op.Spec.Pod, rs.Name)
+		}
+		if node.IsMaster {
+			return nil, fmt.Errorf("pod %s is the master, only a replica can be resynced", op.Spec.Pod)
+		}
+		return newTargets(op.Spec.Pod), nil
+
+	case rsv1.ActionRotatePassword:
+		password, err := h.newPassword(op)
+		if err != nil {
+			return nil, err
+		}
+		if password == "" {
+			return nil, errors.New("the new password is empty")
+		}
+		if password == meta.Auth.Password {
+			return nil, errors.New("the new password is the current one")
+		}
+		redises, err := h.podNames(rs, util.GetRedisName(rs))
+		if err != nil {
+			return nil, err
+		}
+		sentinels, err := h.podNames(rs, util.GetSentinelName(rs))
+		if err != nil {
+			return nil, err
+		}
+		return newTargets(append(append(redises, sentinels...), specTarget)...), nil
+	}
+	return nil, fmt.Errorf("unknown action %q", op.Spec.Action)
+}
+
+// run runs the next step of the operation, it returns true once all the targets succeeded
+func (h *RedisSentinelOperationHandler) run(ctx context.Context, op *rsv1.RedisSentinelOperation, rs *rsv1.RedisSentinel, meta *clustercache.Meta) (bool, error) {
+	switch op.Spec.Action {
+	case rsv1.ActionRestartPod:
+		return h.restartPod(ctx, op, rs, meta)
+	case rsv1.ActionFailover:
+		return h.failover(ctx, op, rs, meta)
+	case rsv1.ActionResetSentinels:
+		// one sentinel at a time, the others keep the quorum while it finds them again
+		return h.eachPod(op, rs, func(ip string) error {
+			return h.RsHealer.RestoreSentinel(ctx, ip, rs, meta.Auth)
+		})
+	case rsv1.ActionRewriteAOF:
+		// one redis at a time, the rewrites don't load all the disks together
+		return h.eachPod(op, rs, func(ip string) error {
+			return h.RsHealer.RewriteAOF(ctx, ip, rs, meta.Auth)
+		})
+	case rsv1.ActionResyncReplica:
+		return h.resyncReplica(ctx, op, rs, meta)
+	case rsv1.ActionRotatePassword:
+		return h.rotatePassword(ctx, op, rs, meta)
+	}
+	return false, fmt.Errorf("unknown action %q", op.Spec.Action)
+}
+
+// restartPod deletes the pod, a master is failed over first so the restart takes a replica
+func (h *RedisSentinelOperationHandler) restartPod(ctx context.Context, op *rsv1.RedisSentinelOperation, rs *rsv1.RedisSentinel, meta *clustercache.Meta) (bool, error) {
+	target := &op.Status.Targets[0]
+	pod, err := h.K8sServices.GetPod(rs.Namespace, target.Name)
+	if err != nil {
+		return false, err
+	}
+	isMaster := pod.Labels[util.RedisRoleLabelKey] == util.RedisRoleLabelMaster
+	if isMaster && rs.Spec.Size > 1 && !replicatesSource(rs) {
+		if target.Phase == rsv1.OperationPending {
+			topo, err := h.RsChecker.GetTopology(ctx, rs, meta.Auth)
+			if err != nil {
+				return false, err
+			}
+			if err := h.RsHealer.FailoverMaster(ctx, topo, rs, meta.Auth); err != nil {
+				return false, err
+			}
+			h.EventsCli.MasterFailover(rs, fmt.Sprintf("failing over master %s before its restart", target.Name))
+			target.Phase = rsv1.OperationRunning
+			target.Message = "failing over the master before the restart"
+		}
+		// the role label moves once the failover is seen
+		return false, nil
+	}
+	if err := h.RsHealer.RestartPod(target.Name, rs); err != nil {
+		return false, err
+	}
+	target.Phase = rsv1.OperationSucceeded
+	target.Message = "deleted, its statefulset creates it again"
+	return true, nil
+}
+
+// failover asks the sentinels to promote a replica and waits for another master
+func (h *RedisSentinelOperationHandler) failover(ctx context.Context, op *rsv1.RedisSentinelOperation, rs *rsv1.RedisSentinel, meta *clustercache.Meta) (bool, error) {
+	target := &op.Status.Targets[0]
+	topo, err := h.RsChecker.GetTopology(ctx, rs, meta.Auth)
+	if err != nil {
+		return false, err
+	}
+	if target.Phase == rsv1.OperationPending {
+		if err := h.RsHealer.FailoverMaster(ctx, topo, rs, meta.Auth); err != nil {
+			return false, err
+		}
+		h.EventsCli.MasterFailover(rs, fmt.Sprintf("failing over master %s", target.Name))
+		target.Phase = rsv1.OperationRunning
+		target.Message = "failover requested"
+		return false, nil
+	}
+	master, err := h.RsChecker.GetMaster(topo)
+	if err != nil || master.Pod.Name == target.Name {
+		// the failover is still running
+		return false, nil
+	}
+	target.Phase = rsv1.OperationSucceeded
+	target.Message = fmt.Sprintf("%s is the new master", master.Pod.Name)
+	return true, nil
+}
+
+// resyncReplica makes the replica load a full copy of the master and waits for it
+func (h *RedisSentinelOperationHandler) resyncReplica(ctx context.Context, op *rsv1.RedisSentinelOperation, rs *rsv1.RedisSentinel, meta *clustercache.Meta) (bool, error) {
+	target := &op.Status.Targets[0]
+	topo, err := h.RsChecker.GetTopology(ctx, rs, meta.Auth)
+	if err != nil {
+		return false, err
+	}
+	node := findRedis(topo, target.Name)
+	if node == nil {
+		return false, nil
+	}
+	if target.Phase == rsv1.OperationPending {
+		master, err := h.RsChecker.GetMaster(topo)
+		if err != nil {
+			return false, err
+		}
+		if master.Pod.Name == node.Pod.Name {
+			// promoted since the operation started, its keys are the ones of the cluster
+			return false, util.NeedsHuman(fmt.Errorf("pod %s became the master, only a replica can be resynced", node.Pod.Name))
+		}
+		if err := h.RsHealer.ResyncReplica(ctx, node, master, rs, meta.Auth); err != nil {
+			return false, err
+		}
+		target.Phase = rsv1.OperationRunning
+		target.Message = fmt.Sprintf("loading a full copy of %s", master.Pod.Name)
+		return false, nil
+	}
+	if node.IsMaster || !node.MasterLinkUp || node.MasterSyncing {
+		return false, nil
+	}
+	target.Phase = rsv1.OperationSucceeded
+	target.Message = "in sync with the master"
+	return true, nil
+}
+
+// rotatePassword sets the new password on every redis, then on the sentinels, then in the spec
+// and the objects holding it. The redis authenticate to their master with it before any of them
+// requires it, so the replication links survive. A step failing is retried with both passwords,
+// a redis changed by an earlier attempt only accepts the new one
+func (h *RedisSentinelOperationHandler) rotatePassword(ctx context.Context, op *rsv1.RedisSentinelOperation, rs *rsv1.RedisSentinel, meta *clustercache.Meta) (bool, error) {
+	password, err := h.newPassword(op)
+	if err != nil {
+		return false, err
+	}
+	current := &util.AuthConfig{Password: meta.Auth.Password}
+	next := &util.AuthConfig{Password: password}
+
+	redises, err := h.podIPs(rs, util.GetRedisName(rs))
+	if err != nil {
+		return false, err
+	}
+	sentinels, err := h.podIPs(rs, util.GetSentinelName(rs))
+	if err != nil {
+		return false, err
+	}
+	for _, target := range op.Status.Targets {
+		ip, ok := redises[target.Name]
+		if !ok || target.Phase == rsv1.OperationSucceeded {
+			continue
+		}
+		if err := withPasswords(current, next, func(auth *util.AuthConfig) error {
+			return h.RsHealer.SetMasterAuth(ctx, ip, password, rs, auth)
+		}); err != nil {
+			return false, err
+		}
+	}
+
+	for i := range op.Status.Targets {
+		target := &op.Status.Targets[i]
+		if target.Phase == rsv1.OperationSucceeded {
+			continue
+		}
+		if ip, ok := redises[target.Name]; ok {
+			if err := withPasswords(current, next, func(auth *util.AuthConfig) error {
+				return h.RsHealer.SetRedisPassword(ctx, ip, password, rs, auth)
+			}); err != nil {
+				return false, err
+			}
+		} else if ip, ok := sentinels[target.Name]; ok {
+			if err := h.RsHealer.SetSentinelAuthPass(ctx, ip, password, rs, meta.Auth); err != nil {
+				return false, err
+			}
+		} else if target.Name == specTarget {
+			if err := h.setPassword(rs, password); err != nil {
+				return false, err
+			}
+		} else {
+			target.Message = "the pod is gone"
+		}
+		target.Phase = rsv1.OperationSucceeded
+	}
+	return true, nil
+}
+
+// setPassword commits the password to the spec, then to the cache, then to the secret and the
+// configmaps, the pods restarted afterwards start with it. Every step is repeated on a retry
+func (h *RedisSentinelOperationHandler) setPassword(rs *rsv1.RedisSentinel, password string) error {
+	if rs.Spec.Password != password {
+		rs.Spec.Password = password
+		if err := h.K8sServices.UpdateClusterSpec(rs.Namespace, rs); err != nil {
+			// a conflict is retried with the cluster read again
+			return err
+		}
+	}
+	h.MetaCache.SetPassword(rs, password)
+	return h.RsService.EnsurePassword(rs, getLabels(rs), createOwnerReferences(rs))
+}
+
+// eachPod runs fn on the next pod of the targets, it returns true once it ran on all of them
+func (h *RedisSentinelOperationHandler) eachPod(op *rsv1.RedisSentinelOperation, rs *rsv1.RedisSentinel, fn func(ip string) error) (bool, error) {
+	target := nextTarget(op)
+	if target == nil {
+		return true, nil
+	}
+	pod, err := h.K8sServices.GetPod(rs.Namespace, target.Name)
+	if err != nil {
+		return false, err
+	}
+	if pod.Status.PodIP == "" {
+		// wait for the pod to run again
+		return false, nil
+	}
+	if err := fn(pod.Status.PodIP); err != nil {
+		return false, err
+	}
+	target.Phase = rsv1.OperationSucceeded
+	return nextTarget(op) == nil, nil
+}
+
+// newPassword reads the password set by RotatePassword from its Secret
+func (h *RedisSentinelOperationHandler) newPassword(op *rsv1.RedisSentinelOperation) (string, error) {
+	ref := op.Spec.PasswordSecret
+	secret, err := h.K8sServices.GetSecret(op.Namespace, ref.Name)
+	if err != nil {
+		return "", err
+	}
+	password, ok := secret.Data[ref.Key]
+	if !ok {
+		return "", fmt.Errorf("secret %s has no key %s", ref.Name, ref.Key)
+	}
+	return string(password), nil
+}
+
+// podNames returns the sorted names of the pods of a statefulset of the cluster
+func (h *RedisSentinelOperationHandler) podNames(rs *rsv1.RedisSentinel, statefulSet string) ([]string, error) {
+	pods, err := h.K8sServices.GetStatefulSetPods(rs.Namespace, statefulSet)
+	if err != nil {
+		return nil, err
+	}
+	names := make([]string, 0, len(pods.Items))
+	for _, pod := range pods.Items {
+		names = append(names, pod.Name)
+	}
+	sort.Strings(names)
+	return names, nil
+}
+
+// podIPs returns the IP of every pod of a statefulset of the cluster by name
+func (h *RedisSentinelOperationHandler) podIPs(rs *rsv1.RedisSentinel, statefulSet string) (map[string]string, error) {
+	pods, err := h.K8sServices.GetStatefulSetPods(rs.Namespace, statefulSet)
+	if err != nil {
+		return nil, err
+	}
+	ips := make(map[string]string, len(pods.Items))
+	for _, pod := range pods.Items {
+		if pod.Status.PodIP != "" {
+			ips[pod.Name] = pod.Status.PodIP
+		}
+	}
+	return ips, nil
+}
+
+// withPasswords runs fn with the current password, then with the next one
+func withPasswords(current, next *util.AuthConfig, fn func(auth *util.AuthConfig) error) error {
+	if err := fn(current); err == nil {
+		return nil
+	}
+	return fn(next)
+}
+
+func newTargets(names ...string) []rsv1.OperationTarget {
+	targets := make([]rsv1.OperationTarget, 0, len(names))
+	for _, name := range names {
+		targets = append(targets, rsv1.OperationTarget{Name: name, Phase: rsv1.OperationPending})
+	}
+	return targets
+}
+
+// nextTarget returns the first target not done yet
+func nextTarget(op *rsv1.RedisSentinelOperation) *rsv1.OperationTarget {
+	for i := range op.Status.Targets {
+		if op.Status.Targets[i].Phase != rsv1.OperationSucceeded {
+			return &op.Status.Targets[i]
+		}
+	}
+	return nil
+}
+
+func findRedis(topo *service.Topology, name string) *service.RedisNode {
+	for _, node := range topo.Redises {
+		if node.Pod.Name == name {
+			return node
+		}
+	}
+	return nil
+}
+
+// replicatesSource is true for a standby and for a cluster migrating a redis, their head
+// replicates a redis outside of the cluster
+func replicatesSource(rs *rsv1.RedisSentinel) bool {
+	return rs.Spec.ReplicaOf != nil || migrating(rs)
+}
@@ -0,0 +1,258 @@
+package handle
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"testing"
+
+	"github.com/go-logr/logr"
+	appsv1 "k8s.io/api/apps/v1"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/client-go/tools/record"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	logf "sigs.k8s.io/controller-runtime/pkg/log"
+
+	rsv1 "redis-sentinel/api/v1"
+	"redis-sentinel/controllers/clustercache"
+	"redis-sentinel/pkg/k8s"
+	"redis-sentinel/pkg/util"
+	"redis-sentinel/service"
+)
+
+// operationHealer records the password and resync actions, the sentinels fail while
+// sentinelErr is set
+type operationHealer struct {
+	fakeHealer
+	sentinelErr error
+}
+
+func (h *operationHealer) SetMasterAuth(ctx context.Context, ip string, password string, rs *rsv1.RedisSentinel, auth *util.AuthConfig) error {
+	h.record("SetMasterAuth %s %s", ip, password)
+	return nil
+}
+
+func (h *operationHealer) SetRedisPassword(ctx context.Context, ip string, password string, rs *rsv1.RedisSentinel, auth *util.AuthConfig) error {
+	h.record("SetRedisPassword %s %s", ip, password)
+	return nil
+}
+
+func (h *operationHealer) SetSentinelAuthPass(ctx context.Context, ip string, password string, rs *rsv1.RedisSentinel, auth *util.AuthConfig) error {
+	if h.sentinelErr != nil {
+		return h.sentinelErr
+	}
+	h.record("SetSentinelAuthPass %s %s", ip, password)
+	return nil
+}
+
+func (h *operationHealer) ResyncReplica(ctx context.Context, node *service.RedisNode, master *service.RedisNode, rs *rsv1.RedisSentinel, auth *util.AuthConfig) error {
+	h.record("ResyncReplica %s %s", node.Pod.Name, master.Pod.Name)
+	return nil
+}
+
+// newStatefulSetPods returns a statefulset and its running pods
+func newStatefulSetPods(name, subnet string, replicas int) []runtime.Object {
+	selector := map[string]string{"app.kubernetes.io/name": name}
+	objs := []runtime.Object{&appsv1.StatefulSet{
+		ObjectMeta: metav1.ObjectMeta{Name: name, Namespace: testNamespace},
+		Spec:       appsv1.StatefulSetSpec{Selector: &metav1.LabelSelector{MatchLabels: selector}},
+	}}
+	for i := 0; i < replicas; i++ {
+		objs = append(objs, &corev1.Pod{
+			ObjectMeta: metav1.ObjectMeta{Name: fmt.Sprintf("%s-%d", name, i), Namespace: testNamespace, Labels: selector},
+			Status:     corev1.PodStatus{PodIP: fmt.Sprintf("%s.%d", subnet, i+1)},
+		})
+	}
+	return objs
+}
+
+// newTestOperationHandler returns an operation handler on a fake kubernetes holding the cluster,
+// the operation and objs, the cluster is cached as reconciled
+func newTestOperationHandler(t *testing.T, rs *rsv1.RedisSentinel, op *rsv1.RedisSentinelOperation, topo *service.Topology, objs ...runtime.Object) (*RedisSentinelOperationHandler, *operationHealer, client.Client) {
+	cli := newTestClient(t, append(objs, rs, op)...)
+	var logger logr.Logger = logf.NullLogger{}
+	k8sServices := k8s.New(cli, logger)
+	healer := &operationHealer{}
+	metaCache := &clustercache.MetaMap{}
+	metaCache.Cache(rs)
+	return &RedisSentinelOperationHandler{
+		K8sServices: k8sServices,
+		RsService:   service.NewRedisClusterKubeClient(k8sServices, logger),
+		RsChecker: &fakeChecker{
+			RedisClusterCheck: service.NewRedisClusterChecker(k8sServices, nil, 1, logger),
+			topo:              topo,
+		},
+		RsHealer:  healer,
+		MetaCache: metaCache,
+		EventsCli: k8s.NewEvent(record.NewFakeRecorder(100), logger),
+		Logger:    logger,
+	}, healer, cli
+}
+
+func newRotatePasswordTest(t *testing.T) (*RedisSentinelOperationHandler, *operationHealer, client.Client, *rsv1.RedisSentinelOperation) {
+	rs := newTestCluster()
+	rs.Spec.Password = "old"
+	rs.Status.SetReadyCondition("ready", rs.Generation)
+	op := &rsv1.RedisSentinelOperation{
+		ObjectMeta: metav1.ObjectMeta{Name: "rotate", Namespace: testNamespace},
+		Spec: rsv1.RedisSentinelOperationSpec{
+			ClusterName: rs.Name,
+			Action:      rsv1.ActionRotatePassword,
+			PasswordSecret: &corev1.SecretKeySelector{
+				LocalObjectReference: corev1.LocalObjectReference{Name: "new-password"},
+				Key:                  "password",
+			},
+		},
+	}
+	objs := []runtime.Object{
+		&corev1.Secret{
+			ObjectMeta: metav1.ObjectMeta{Name: "new-password", Namespace: testNamespace},
+			Data:       map[string][]byte{"password": []byte("new")},
+		},
+		&corev1.ConfigMap{
+			ObjectMeta: metav1.ObjectMeta{Name: util.GetSentinelName(rs), Namespace: testNamespace},
+			Data:       map[string]string{util.SentinelConfigFileName: "sentinel auth-pass mymaster old\n"},
+		},
+	}
+	objs = append(objs, newStatefulSetPods(util.GetRedisName(rs), "10.0.0", 2)...)
+	objs = append(objs, newStatefulSetPods(util.GetSentinelName(rs), "10.0.1", 3)...)
+	h, healer, cli := newTestOperationHandler(t, rs, op, nil, objs...)
+	return h, healer, cli, op
+}
+
+// checkPassword checks every place holding the password of the cluster test has want
+func checkPassword(t *testing.T, h *RedisSentinelOperationHandler, cli client.Client, want string) {
+	t.Helper()
+	rs, err := h.K8sServices.GetCluster(testNamespace, "test")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if rs.Spec.Password != want {
+		t.Errorf("spec password = %q, want %q", rs.Spec.Password, want)
+	}
+	if meta, ok := h.MetaCache.Lookup(rs); !ok {
+		t.Error("cluster not cached")
+	} else if meta.Auth.Password != want {
+		t.Errorf("cached password = %q, want %q", meta.Auth.Password, want)
+	}
+
+	secret := &corev1.Secret{}
+	if err := cli.Get(context.TODO(), types.NamespacedName{Namespace: testNamespace, Name: util.GetRedisAuthName(rs)}, secret); err != nil {
+		if want != "old" {
+			t.Errorf("auth secret: %v", err)
+		}
+	} else if password := string(secret.Data["password"]); password != want {
+		t.Errorf("auth secret password = %q, want %q", password, want)
+	}
+
+	cm := &corev1.ConfigMap{}
+	if err := cli.Get(context.TODO(), types.NamespacedName{Namespace: testNamespace, Name: util.GetSentinelName(rs)}, cm); err != nil {
+		t.Fatal(err)
+	}
+	if config := cm.Data[util.SentinelConfigFileName]; !strings.Contains(config, "auth-pass mymaster "+want+"\n") {
+		t.Errorf("sentinel config = %q, want the auth-pass %q", config, want)
+	}
+}
+
+func TestRotatePassword(t *testing.T) {
+	h, healer, cli, op := newRotatePasswordTest(t)
+
+	if err := h.Do(context.TODO(), op); err != nil {
+		t.Fatalf("Do() error = %v", err)
+	}
+	if op.Status.Phase != rsv1.OperationSucceeded {
+		t.Fatalf("operation = %s: %s, want it succeeded", op.Status.Phase, op.Status.Message)
+	}
+	for _, call := range []string{
+		"SetMasterAuth 10.0.0.1 new",
+		"SetMasterAuth 10.0.0.2 new",
+		"SetRedisPassword 10.0.0.1 new",
+		"SetRedisPassword 10.0.0.2 new",
+		"SetSentinelAuthPass 10.0.1.1 new",
+		"SetSentinelAuthPass 10.0.1.3 new",
+	} {
+		if !healer.called(call) {
+			t.Errorf("heal actions = %q, missing %q", healer.calls, call)
+		}
+	}
+	checkPassword(t, h, cli, "new")
+}
+
+func TestRotatePasswordRetried(t *testing.T) {
+	h, healer, cli, op := newRotatePasswordTest(t)
+	healer.sentinelErr = errors.New("connection refused")
+
+	if err := h.Do(context.TODO(), op); err == nil {
+		t.Fatal("Do() succeeded with the sentinels failing")
+	}
+	if op.Status.Phase != rsv1.OperationRunning {
+		t.Fatalf("operation = %s: %s, want it retried", op.Status.Phase, op.Status.Message)
+	}
+	for _, target := range op.Status.Targets {
+		if strings.HasPrefix(target.Name, "redis-test-") && target.Phase != rsv1.OperationSucceeded {
+			t.Errorf("redis %s = %s, want its progress kept", target.Name, target.Phase)
+		}
+	}
+	checkPassword(t, h, cli, "old")
+
+	healer.sentinelErr = nil
+	if err := h.Do(context.TODO(), op); err != nil {
+		t.Fatalf("Do() retry error = %v", err)
+	}
+	if op.Status.Phase != rsv1.OperationSucceeded {
+		t.Fatalf("operation = %s: %s, want it succeeded", op.Status.Phase, op.Status.Message)
+	}
+	checkPassword(t, h, cli, "new")
+}
+
+func TestResyncReplica(t *testing.T) {
+	tests := []struct {
+		name      string
+		redises   []*service.RedisNode
+		wantPhase rsv1.OperationPhase
+		wantCall  bool
+	}{
+		{
+			name:      "replica",
+			redises:   []*service.RedisNode{newRedisNode(0, "", ""), newRedisNode(1, "10.0.0.1", "6379")},
+			wantPhase: rsv1.OperationRunning,
+			wantCall:  true,
+		},
+		{
+			name:      "replica promoted since the operation started",
+			redises:   []*service.RedisNode{newRedisNode(0, "10.0.0.2", "6379"), newRedisNode(1, "", "")},
+			wantPhase: rsv1.OperationFailed,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rs := newTestCluster()
+			op := &rsv1.RedisSentinelOperation{
+				ObjectMeta: metav1.ObjectMeta{Name: "resync", Namespace: testNamespace},
+				Spec: rsv1.RedisSentinelOperationSpec{
+					ClusterName: rs.Name,
+					Action:      rsv1.ActionResyncReplica,
+					Pod:         "redis-test-1",
+				},
+				Status: rsv1.RedisSentinelOperationStatus{
+					Phase:   rsv1.OperationRunning,
+					Targets: newTargets("redis-test-1"),
+				},
+			}
+			topo := &service.Topology{Redises: tt.redises, Sentinels: newSentinelNodes(3)}
+			h, healer, _ := newTestOperationHandler(t, rs, op, topo)
+
+			h.Do(context.TODO(), op)
+			if op.Status.Phase != tt.wantPhase {
+				t.Errorf("operation = %s: %s, want %s", op.Status.Phase, op.Status.Message, tt.wantPhase)
+			}
+			if called := healer.called("ResyncReplica redis-test-1 redis-test-0"); called != tt.wantCall {
+				t.Errorf("heal actions = %q, want the resync %v", healer.calls, tt.wantCall)
+			}
+		})
+	}
+}
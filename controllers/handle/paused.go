@@ -0,0 +1,44 @@
+package handle
+
+import (
+	"context"
+	"fmt"
+
+	"redis-sentinel/controllers/clustercache"
+	"redis-sentinel/pkg/util"
+)
+
+// checkPaused only records the state of a paused cluster, it is repaired by hand. A cluster
+// without master gets one unless the emergency healing is disabled, the sentinels don't elect
+// a master when none is left
+func (rsh *RedisSentinelHandler) checkPaused(ctx context.Context, meta *clustercache.Meta) error {
+	rs := meta.Obj
+	logger := util.LoggerFrom(ctx, rsh.Logger)
+	msg := "reconciliation paused"
+
+	topo, err := rsh.RsChecker.GetTopology(ctx, rs, meta.Auth)
+	if err != nil {
+		logger.Info(fmt.Sprintf("paused, topology unknown: %v", err))
+	} else {
+		if rsh.RsChecker.GetNumberMasters(topo) == 0 && len(topo.Redises) > 0 && *rs.Spec.EmergencyHealing && !replicatesSource(rs) {
+			// the master may be one of the redis that didn't answer, electing another one would
+			// leave two masters once it answers again
+			if err := topo.UnreachableError(); err != nil {
+				rs.Status.SetPausedCondition(fmt.Sprintf("reconciliation paused, no master found: %v", err), rs.Generation)
+				rsh.K8sServices.UpdateCluster(rs.Namespace, rs)
+				return err
+			}
+			logger.Info("paused cluster has no master, promoting the oldest redis")
+			rsh.EventsCli.UpdateCluster(rs, "paused cluster has no master, set master")
+			if err := rsh.RsHealer.SetOldestAsMaster(ctx, topo, rs, meta.Auth); err != nil {
+				return err
+			}
+			msg = "reconciliation paused, the oldest redis was promoted as there was no master"
+		} else if master, err := rsh.RsChecker.GetMaster(topo); err == nil {
+			rsh.recordTopology(ctx, meta, master, topo)
+		}
+	}
+
+	rs.Status.SetPausedCondition(msg, rs.Generation)
+	return rsh.K8sServices.UpdateCluster(rs.Namespace, rs)
+}
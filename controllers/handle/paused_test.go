@@ -0,0 +1,75 @@
+package handle
+
+import (
+	"context"
+	"testing"
+
+	rsv1 "redis-sentinel/api/v1"
+	"redis-sentinel/pkg/util"
+	"redis-sentinel/service"
+)
+
+func TestCheckPaused(t *testing.T) {
+	unreachable := newRedisNode(0, "", "")
+	unreachable.Err = context.DeadlineExceeded
+	tests := []struct {
+		name             string
+		emergencyHealing bool
+		topo             *service.Topology
+		wantPromoted     bool
+		wantErrKind      util.ErrorKind
+	}{
+		{
+			name:             "no master",
+			emergencyHealing: true,
+			topo: &service.Topology{Redises: []*service.RedisNode{
+				newRedisNode(0, "10.0.0.9", "6379"), newRedisNode(1, "10.0.0.9", "6379"),
+			}},
+			wantPromoted: true,
+		},
+		{
+			name:             "master unreachable",
+			emergencyHealing: true,
+			topo: &service.Topology{
+				Redises:     []*service.RedisNode{newRedisNode(1, "10.0.0.1", "6379")},
+				Unreachable: []*service.RedisNode{unreachable},
+			},
+			wantErrKind: util.KindWaitingForPods,
+		},
+		{
+			name: "emergency healing disabled",
+			topo: &service.Topology{Redises: []*service.RedisNode{
+				newRedisNode(0, "10.0.0.9", "6379"), newRedisNode(1, "10.0.0.9", "6379"),
+			}},
+		},
+		{
+			name:             "master running",
+			emergencyHealing: true,
+			topo: &service.Topology{Redises: []*service.RedisNode{
+				newRedisNode(0, "", ""), newRedisNode(1, "10.0.0.1", "6379"),
+			}},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rs := newTestCluster()
+			rs.Spec.Paused = true
+			rs.Spec.EmergencyHealing = &tt.emergencyHealing
+			h, healer, _ := newTestHandler(t, rs, tt.topo)
+
+			err := h.checkPaused(context.TODO(), h.MetaCache.Cache(rs))
+			if tt.wantErrKind == "" && err != nil {
+				t.Fatalf("checkPaused() error = %v", err)
+			}
+			if tt.wantErrKind != "" && util.KindOf(err) != tt.wantErrKind {
+				t.Fatalf("checkPaused() error = %v, want a %s error", err, tt.wantErrKind)
+			}
+			if promoted := healer.called("SetOldestAsMaster"); promoted != tt.wantPromoted {
+				t.Errorf("master promoted = %v, want %v", promoted, tt.wantPromoted)
+			}
+			if !rs.Status.IsConditionTrue(rsv1.ConditionPaused) {
+				t.Errorf("Paused condition not set")
+			}
+		})
+	}
+}
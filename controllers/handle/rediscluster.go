@@ -0,0 +1,364 @@
+package handle
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/go-logr/logr"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+
+	v1 "redis-sentinel/api/v1"
+	"redis-sentinel/pkg/k8s"
+	"redis-sentinel/pkg/metrics"
+	"redis-sentinel/pkg/util"
+	"redis-sentinel/service"
+)
+
+// RedisClusterHandler is the sharded RedisCluster handler. This handler will create the required
+// resources that a RedisCluster needs and bootstrap the cluster.
+type RedisClusterHandler struct {
+	K8sServices k8s.Services
+	Service     service.ShardedClusterClient
+	Checker     service.ShardedClusterCheck
+	Healer      service.ShardedClusterHeal
+	EventsCli   k8s.Event
+	Metrics     metrics.Instrumenter
+	Logger      logr.Logger
+}
+
+// Do will ensure the RedisCluster is in the expected state and update the RedisCluster status.
+// The calls made to redis are abandoned once ctx is done.
+func (h *RedisClusterHandler) Do(ctx context.Context, rc *v1.RedisCluster) error {
+	logger := util.LoggerFrom(ctx, h.Logger)
+	logger.Info("handler doing")
+	if err := rc.Validate(); err != nil {
+		h.Metrics.SetClusterError(rc.Namespace, rc.Name)
+		return util.InvalidSpec(err)
+	}
+
+	if rc.Status.ObservedGeneration != rc.Generation {
+		if rc.Status.ObservedGeneration == 0 {
+			h.EventsCli.CreateCluster(rc)
+			rc.Status.SetProgressingCondition(v1.PhaseCreating, "Bootstrap redis cluster", rc.Generation)
+		} else {
+			h.EventsCli.UpdateCluster(rc, "spec changed")
+			rc.Status.SetProgressingCondition(v1.PhaseUpdating, "spec changed", rc.Generation)
+		}
+		h.K8sServices.UpdateShardedCluster(rc.Namespace, rc)
+	}
+
+	logger.V(2).Info("Ensure...")
+	h.EventsCli.EnsureCluster(rc)
+	start := time.Now()
+	err := h.Ensure(rc, h.getLabels(rc), h.createOwnerReferences(rc))
+	h.Metrics.ObserveReconcileDuration(rc.Namespace, rc.Name, metrics.PhaseEnsure, time.Since(start))
+	if err == nil && rc.Spec.Shards > rc.Status.CurrentShards {
+		// the removed shards are counted until they are drained, the new ones once they exist
+		rc.Status.CurrentShards = rc.Spec.Shards
+	}
+	if err != nil {
+		h.EventsCli.FailedCluster(rc, err.Error())
+		rc.Status.SetFailedCondition(v1.ReasonEnsureFailed, err.Error(), rc.Generation)
+		h.K8sServices.UpdateShardedCluster(rc.Namespace, rc)
+		h.Metrics.SetClusterError(rc.Namespace, rc.Name)
+		return err
+	}
+
+	logger.V(2).Info("CheckAndHeal...")
+	h.EventsCli.CheckCluster(rc)
+	start = time.Now()
+	err = h.CheckAndHeal(ctx, rc)
+	h.Metrics.ObserveReconcileDuration(rc.Namespace, rc.Name, metrics.PhaseCheckAndHeal, time.Since(start))
+	if err != nil {
+		h.Metrics.SetClusterError(rc.Namespace, rc.Name)
+		if util.KindOf(err) != util.KindWaitingForPods {
+			h.EventsCli.FailedCluster(rc, err.Error())
+			rc.Status.SetFailedCondition(v1.ReasonCheckFailed, err.Error(), rc.Generation)
+		}
+		h.K8sServices.UpdateShardedCluster(rc.Namespace, rc)
+		return err
+	}
+
+	logger.V(2).Info("SetReadyCondition...")
+	h.EventsCli.HealthCluster(rc)
+	rc.Status.SetReadyCondition("Cluster ok", rc.Generation)
+	h.K8sServices.UpdateShardedCluster(rc.Namespace, rc)
+	h.Metrics.SetClusterOK(rc.Namespace, rc.Name)
+	return nil
+}
+
+// Ensure makes sure the services, the password secret and the statefulsets of every shard exist
+func (h *RedisClusterHandler) Ensure(rc *v1.RedisCluster, labels map[string]string, or []metav1.OwnerReference) error {
+	if err := h.Service.EnsureShardedClusterServices(rc, labels, or); err != nil {
+		return err
+	}
+	if err := h.Service.EnsureShardedClusterAuthSecret(rc, labels, or); err != nil {
+		return err
+	}
+	return h.Service.EnsureShardStatefulSets(rc, labels, or)
+}
+
+// CheckAndHeal checks the health of the cluster and heals it, the decisions are made from a
+// single snapshot of the redis nodes taken concurrently,
+// Waiting all the redis of every shard are ready
+// Nodes restarted without their data are forgotten
+// All the nodes know each other
+// All the slots are served, the slots of a shard without master go to its first node
+// All the other nodes of a shard replicate its master
+// Set Custom Redis config
+// The cluster state is ok
+// The slots are migrated to the shards of the spec, the removed shards are deleted once drained
+func (h *RedisClusterHandler) CheckAndHeal(ctx context.Context, rc *v1.RedisCluster) error {
+	logger := util.LoggerFrom(ctx, h.Logger)
+	if err := h.Checker.CheckShardsReady(rc); err != nil {
+		logger.V(2).Info(err.Error())
+		h.EventsCli.UpdateCluster(rc, "wait for all redis server start")
+		rc.Status.SetBoolCondition(v1.ConditionReady, false, v1.ReasonPodsNotReady, err.Error(), rc.Generation)
+		return needRequeueErr
+	}
+
+	auth := &util.AuthConfig{Password: rc.Spec.Password}
+	topo, err := h.Checker.GetShardedTopology(ctx, rc, auth)
+	if err != nil {
+		return err
+	}
+
+	if removed := h.Checker.GetRemovedNodeIDs(topo); len(removed) > 0 {
+		logger.Info(fmt.Sprintf("forgetting the removed nodes %v", removed))
+		if err := h.Healer.ForgetNodes(ctx, removed, topo, rc, auth); err != nil {
+			return err
+		}
+	}
+
+	if unknown := h.Checker.GetUnknownNodes(topo); len(unknown) > 0 {
+		h.EventsCli.UpdateCluster(rc, fmt.Sprintf("%d redis joining the cluster", len(unknown)))
+		if err := h.Healer.MeetNodes(ctx, unknown, topo, rc, auth); err != nil {
+			return err
+		}
+		// the nodes learn about each other through the cluster bus, check again once they did
+		return needRequeueErr
+	}
+
+	missing, err := h.Checker.GetMissingSlots(topo)
+	if err != nil {
+		return err
+	}
+	if len(missing) > 0 {
+		message := fmt.Sprintf("%d slots not served", len(missing))
+		rc.Status.SetBoolCondition(v1.ConditionAvailable, false, v1.ReasonSlotsMissing, message, rc.Generation)
+		h.EventsCli.UpdateCluster(rc, message)
+		for shard, slots := range h.assignMissingSlots(rc, topo, missing) {
+			if err := h.Healer.AssignSlots(ctx, shard, slots, topo, rc, auth); err != nil {
+				return err
+			}
+		}
+		return needRequeueErr
+	}
+
+	if err := h.Checker.CheckShardReplicas(rc, topo); err != nil {
+		rc.Status.SetBoolCondition(v1.ConditionReplicationHealthy, false, v1.ReasonReplicasWrong, err.Error(), rc.Generation)
+		h.EventsCli.UpdateCluster(rc, err.Error())
+		for shard := int32(0); shard < rc.ShardCount(); shard++ {
+			if err := h.Healer.ReplicateShard(ctx, shard, topo, rc, auth); err != nil {
+				return err
+			}
+		}
+		return needRequeueErr
+	}
+	rc.Status.SetBoolCondition(v1.ConditionReplicationHealthy, true, v1.ReasonReplicasOK, "all the replicas follow the master of their shard", rc.Generation)
+
+	for _, node := range topo.Nodes {
+		if err := h.Checker.CheckShardConfig(rc, node); err != nil {
+			h.EventsCli.UpdateCluster(rc, "set custom config for redis server")
+			if err := h.Healer.SetShardConfig(ctx, node, rc, auth); err != nil {
+				return err
+			}
+		}
+	}
+
+	state, err := h.Checker.GetClusterState(ctx, topo, auth)
+	if err != nil {
+		return err
+	}
+	h.recordShards(rc, topo)
+	if state != "ok" {
+		rc.Status.SetBoolCondition(v1.ConditionAvailable, false, v1.ReasonClusterFail, "cluster state is "+state, rc.Generation)
+		return needRequeueErr
+	}
+	rc.Status.SetBoolCondition(v1.ConditionAvailable, true, v1.ReasonClusterOK, "all the slots are served", rc.Generation)
+
+	if plan := rc.Status.Resharding; plan != nil && plan.Shards != rc.Spec.Shards {
+		// the number of shards changed again, the slots are planned from where they are now
+		rc.Status.Resharding = nil
+	}
+	if rc.Status.Resharding == nil && h.Checker.NeedResharding(rc, topo) {
+		plan, err := h.Checker.PlanResharding(ctx, rc, topo, auth)
+		if err != nil {
+			return err
+		}
+		if len(plan.Migrations) > 0 {
+			h.EventsCli.UpdateCluster(rc, fmt.Sprintf("resharding to %d shards with %d slot migrations", plan.Shards, len(plan.Migrations)))
+			rc.Status.Resharding = plan
+		}
+	}
+	if rc.Status.Resharding != nil {
+		return h.reshard(ctx, rc, topo, auth)
+	}
+
+	if rc.ShardCount() > rc.Spec.Shards {
+		return h.removeDrainedShards(ctx, rc, topo, auth)
+	}
+	return nil
+}
+
+// assignMissingSlots returns the shard serving every missing slot. The slots of a cluster
+// serving none are split evenly between the shards, the other slots go back to the shard last
+// seen serving them or, if unknown, to the shard serving the fewest slots
+func (h *RedisClusterHandler) assignMissingSlots(rc *v1.RedisCluster, topo *service.ShardedTopology, missing []int) map[int32][]int {
+	assigned := map[int32][]int{}
+	if len(missing) == util.ClusterSlots {
+		for _, slot := range missing {
+			for shard := int32(0); shard < rc.Spec.Shards; shard++ {
+				if start, end := util.ShardSlotRange(shard, rc.Spec.Shards); slot >= start && slot <= end {
+					assigned[shard] = append(assigned[shard], slot)
+					break
+				}
+			}
+		}
+		return assigned
+	}
+
+	owners := map[int]int32{}
+	for _, shard := range rc.Status.Shards {
+		if shard.Slots == "" {
+			continue
+		}
+		slots, err := util.ExpandSlotRanges(strings.Split(shard.Slots, ","))
+		if err != nil {
+			continue
+		}
+		for _, slot := range slots {
+			owners[slot] = shard.Index
+		}
+	}
+	fewest, fewestSlots := int32(0), util.ClusterSlots+1
+	for shard := int32(0); shard < rc.Spec.Shards; shard++ {
+		served := 0
+		if master := topo.ShardMaster(shard); master != nil {
+			slots, _ := util.ExpandSlotRanges(master.Self.Slots)
+			served = len(slots)
+		}
+		if served < fewestSlots {
+			fewest, fewestSlots = shard, served
+		}
+	}
+	for _, slot := range missing {
+		shard, ok := owners[slot]
+		if !ok || shard >= rc.ShardCount() {
+			shard = fewest
+		}
+		assigned[shard] = append(assigned[shard], slot)
+	}
+	return assigned
+}
+
+// reshard runs the next slot migrations of the plan, the progress is saved on the status after
+// every batch so an interrupted resharding resumes from the last slot moved
+func (h *RedisClusterHandler) reshard(ctx context.Context, rc *v1.RedisCluster, topo *service.ShardedTopology, auth *util.AuthConfig) error {
+	plan := rc.Status.Resharding
+	budget := rc.Spec.Rebalance.SlotsPerReconcile
+	moved, total := int32(0), int32(0)
+	for i := range plan.Migrations {
+		migration := &plan.Migrations[i]
+		for budget > 0 && !migration.Done() {
+			source, target := topo.ShardPrimary(migration.Source), topo.ShardPrimary(migration.Target)
+			if source == nil || target == nil {
+				return fmt.Errorf("shard %d or %d has no master to migrate the slots %s", migration.Source, migration.Target, migration.Slots)
+			}
+			slots, err := util.ExpandSlotRanges(strings.Split(migration.Slots, ","))
+			if err != nil {
+				return err
+			}
+			if err := h.Healer.MigrateSlot(ctx, slots[migration.Migrated], source, target, rc, auth); err != nil {
+				return err
+			}
+			migration.Migrated++
+			budget--
+		}
+		moved += migration.Migrated
+		total += migration.Total
+	}
+
+	message := fmt.Sprintf("moved %d of %d slots to %d shards", moved, total, plan.Shards)
+	util.LoggerFrom(ctx, h.Logger).Info(message)
+	rc.Status.SetProgressingCondition(v1.PhaseResharding, message, rc.Generation)
+	if moved == total {
+		h.EventsCli.UpdateCluster(rc, message)
+		rc.Status.Resharding = nil
+	}
+	return needRequeueErr
+}
+
+// removeDrainedShards deletes the shards removed from the spec once they serve no slot, the
+// other nodes forget them
+func (h *RedisClusterHandler) removeDrainedShards(ctx context.Context, rc *v1.RedisCluster, topo *service.ShardedTopology, auth *util.AuthConfig) error {
+	ids := []string{}
+	for shard := rc.Spec.Shards; shard < rc.ShardCount(); shard++ {
+		for _, node := range topo.Shards[shard] {
+			ids = append(ids, node.Self.ID)
+		}
+		if err := h.Service.DeleteShard(rc, shard); err != nil {
+			return err
+		}
+	}
+	h.EventsCli.ShardsRemoved(rc, fmt.Sprintf("removed %d drained shards", rc.ShardCount()-rc.Spec.Shards))
+
+	kept := &service.ShardedTopology{}
+	for _, node := range topo.Nodes {
+		if node.Shard < rc.Spec.Shards {
+			kept.Nodes = append(kept.Nodes, node)
+		}
+	}
+	if err := h.Healer.ForgetNodes(ctx, ids, kept, rc, auth); err != nil {
+		return err
+	}
+	rc.Status.CurrentShards = rc.Spec.Shards
+	return needRequeueErr
+}
+
+// recordShards sets the master, slots and replicas of every shard on the status
+func (h *RedisClusterHandler) recordShards(rc *v1.RedisCluster, topo *service.ShardedTopology) {
+	shards := make([]v1.ShardStatus, 0, rc.ShardCount())
+	for shard := int32(0); shard < rc.ShardCount(); shard++ {
+		status := v1.ShardStatus{Index: shard}
+		if master := topo.ShardMaster(shard); master != nil {
+			slots, _ := util.ExpandSlotRanges(master.Self.Slots)
+			status.Master = master.Pod.Name
+			status.Slots = util.FormatSlotRanges(slots)
+			for _, node := range topo.Shards[shard] {
+				if node.Self.MasterID == master.Self.ID {
+					status.Replicas++
+				}
+			}
+		}
+		shards = append(shards, status)
+	}
+	rc.Status.Shards = shards
+}
+
+// getLabels merges all the labels (dynamic and operator static ones).
+func (h *RedisClusterHandler) getLabels(rc *v1.RedisCluster) map[string]string {
+	dynLabels := map[string]string{
+		v1.LabelNameKey: fmt.Sprintf("%s%c%s", rc.Namespace, '_', rc.Name),
+	}
+	return util.MergeLabels(defaultLabels, dynLabels, rc.Labels)
+}
+
+func (h *RedisClusterHandler) createOwnerReferences(rc *v1.RedisCluster) []metav1.OwnerReference {
+	rcvk := v1.VersionKind(v1.ClusterKind)
+	return []metav1.OwnerReference{
+		*metav1.NewControllerRef(rc, rcvk),
+	}
+}
@@ -0,0 +1,150 @@
+package handle
+
+import (
+	"context"
+	"errors"
+	"fmt"
+
+	rsv1 "redis-sentinel/api/v1"
+	"redis-sentinel/controllers/clustercache"
+	"redis-sentinel/pkg/util"
+	"redis-sentinel/service"
+)
+
+// checkAndHealStandby keeps a cluster with replicaOf a read-only copy of its source. The head
+// redis replicates the source, the others replicate the head and the sentinels monitor nothing,
+// a master replicating another one would look down to them and they would fail over.
+func (rsh *RedisSentinelHandler) checkAndHealStandby(ctx context.Context, meta *clustercache.Meta, topo *service.Topology) error {
+	source, err := rsh.RsChecker.GetReplicaOfSource(meta.Obj)
+	if err != nil {
+		return err
+	}
+	head, err := rsh.followSource(ctx, meta, topo, source)
+	if err != nil {
+		return err
+	}
+	rsh.recordStandby(ctx, meta, head, source)
+	return nil
+}
+
+// followSource makes the head replicate the source and the other redis the head, it returns
+// the head as seen before healing it
+func (rsh *RedisSentinelHandler) followSource(ctx context.Context, meta *clustercache.Meta, topo *service.Topology, source *service.ReplicaOfSource) (*service.RedisNode, error) {
+	rs := meta.Obj
+	logger := util.LoggerFrom(ctx, rsh.Logger)
+
+	for _, sentinel := range topo.Sentinels {
+		if sentinel.MonitorErr != nil {
+			continue
+		}
+		if err := rsh.RsHealer.RemoveSentinelMonitor(ctx, sentinel.IP, rs, meta.Auth); err != nil {
+			return nil, err
+		}
+	}
+
+	if err := rsh.RsHealer.SetAnnounceAddrs(ctx, topo, rs, meta.Auth); err != nil {
+		return nil, err
+	}
+
+	head := rsh.RsChecker.GetStandbyHead(topo, source, rs)
+	if head == nil || !replicates(head, source) {
+		// the head may be one of the redis that didn't answer
+		if err := topo.UnreachableError(); err != nil {
+			return nil, err
+		}
+	}
+	if head == nil {
+		return nil, errors.New("no redis running to replicate the source")
+	}
+	if !replicates(head, source) {
+		msg := fmt.Sprintf("redis %s replicates the source %s", head.Pod.Name, source)
+		logger.Info(msg)
+		rsh.EventsCli.UpdateCluster(rs, msg)
+		if err := rsh.RsHealer.ReplicateSource(ctx, head, source, rs, meta.Auth); err != nil {
+			return nil, err
+		}
+	}
+	if err := rsh.RsChecker.CheckAllSlavesFromMaster(head, topo); err != nil {
+		logger.Info(err.Error())
+		if err := rsh.RsHealer.SetStandbyReplicas(ctx, head, topo, rs, meta.Auth); err != nil {
+			return nil, err
+		}
+	}
+
+	if err := rsh.RsHealer.SetRedisRoleLabels(head, topo, rs); err != nil {
+		return nil, err
+	}
+	if err := rsh.setRedisConfig(ctx, meta, topo); err != nil {
+		return nil, err
+	}
+	return head, nil
+}
+
+// replicates is true when the redis was replicating the source when the topology was taken
+func replicates(node *service.RedisNode, source *service.ReplicaOfSource) bool {
+	return !node.IsMaster && node.MasterHost == source.Host && node.MasterPort == source.Port
+}
+
+// recordStandby sets the link of the head to the source and its lag on the status
+func (rsh *RedisSentinelHandler) recordStandby(ctx context.Context, meta *clustercache.Meta, head *service.RedisNode, source *service.ReplicaOfSource) {
+	rs := meta.Obj
+	replication := &rsv1.ReplicationStatus{
+		Source:           source.String(),
+		Head:             head.Pod.Name,
+		LinkUp:           head.MasterLinkUp,
+		LastIOSecondsAgo: head.MasterLastIO,
+	}
+	if offset, err := rsh.RsChecker.GetSourceOffset(ctx, source); err == nil {
+		lag := offset - head.ReplOffset
+		if lag < 0 {
+			lag = 0
+		}
+		replication.LagBytes = &lag
+	}
+	rs.Status.Replication = replication
+	rs.Status.MasterIP = head.IP
+	rs.Status.MasterPod = head.Pod.Name
+
+	rs.Status.SetBoolCondition(rsv1.ConditionAvailable, false, rsv1.ReasonStandby,
+		fmt.Sprintf("standby of %s, %s is read-only", source, head.Pod.Name), rs.Generation)
+	setSourceLinkCondition(rs, head, source)
+}
+
+// setSourceLinkCondition sets whether the head is connected to the source
+func setSourceLinkCondition(rs *rsv1.RedisSentinel, head *service.RedisNode, source *service.ReplicaOfSource) {
+	if head.MasterLinkUp {
+		rs.Status.SetBoolCondition(rsv1.ConditionSourceLinkUp, true, rsv1.ReasonLinkUp,
+			fmt.Sprintf("%s replicates %s", head.Pod.Name, source), rs.Generation)
+	} else {
+		rs.Status.SetBoolCondition(rsv1.ConditionSourceLinkUp, false, rsv1.ReasonLinkDown,
+			fmt.Sprintf("%s is not connected to %s", head.Pod.Name, source), rs.Generation)
+	}
+}
+
+// promoteStandby detaches the head of a former standby from its source, replicaOf was removed
+// from the spec. The checks that follow make the sentinels monitor it again
+func (rsh *RedisSentinelHandler) promoteStandby(ctx context.Context, meta *clustercache.Meta, topo *service.Topology) error {
+	rs := meta.Obj
+	if err := rsh.promoteHead(ctx, meta, topo, rs.Status.Replication.Head); err != nil {
+		return err
+	}
+	msg := fmt.Sprintf("standby of %s promoted", rs.Status.Replication.Source)
+	util.LoggerFrom(ctx, rsh.Logger).Info(msg)
+	rsh.EventsCli.UpdateCluster(rs, msg)
+	rs.Status.Replication = nil
+	rs.Status.SetBoolCondition(rsv1.ConditionSourceLinkUp, false, rsv1.ReasonPromoted, msg, rs.Generation)
+	return nil
+}
+
+// promoteHead makes the named redis a master if it still replicates
+func (rsh *RedisSentinelHandler) promoteHead(ctx context.Context, meta *clustercache.Meta, topo *service.Topology, head string) error {
+	for _, node := range topo.Redises {
+		if node.Pod.Name != head || node.IsMaster {
+			continue
+		}
+		if err := rsh.RsHealer.PromoteStandby(ctx, node, meta.Obj, meta.Auth); err != nil {
+			return err
+		}
+	}
+	return nil
+}
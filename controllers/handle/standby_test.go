@@ -0,0 +1,104 @@
+package handle
+
+import (
+	"context"
+	"testing"
+
+	rsv1 "redis-sentinel/api/v1"
+	"redis-sentinel/pkg/util"
+	"redis-sentinel/service"
+)
+
+func TestCheckAndHealStandby(t *testing.T) {
+	const source = "10.1.0.1:6379"
+	tests := []struct {
+		name      string
+		redises   []*service.RedisNode
+		wantCalls []string
+		wantHead  string
+		wantLink  bool
+	}{
+		{
+			name:    "new standby",
+			redises: []*service.RedisNode{newRedisNode(0, "", ""), newRedisNode(1, "", "")},
+			wantCalls: []string{
+				"RemoveSentinelMonitor 10.0.1.1",
+				"ReplicateSource redis-test-0 " + source,
+				"SetStandbyReplicas redis-test-0",
+			},
+			wantHead: "redis-test-0",
+		},
+		{
+			name:      "standby following its source",
+			redises:   []*service.RedisNode{newRedisNode(0, "10.1.0.1", "6379"), newRedisNode(1, "10.0.0.1", "6379")},
+			wantCalls: []string{"RemoveSentinelMonitor 10.0.1.1"},
+			wantHead:  "redis-test-0",
+			wantLink:  true,
+		},
+		{
+			name:      "replica of the head lost",
+			redises:   []*service.RedisNode{newRedisNode(0, "", ""), newRedisNode(1, "10.1.0.1", "6379")},
+			wantCalls: []string{"RemoveSentinelMonitor 10.0.1.1", "SetStandbyReplicas redis-test-1"},
+			wantHead:  "redis-test-1",
+			wantLink:  true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rs := newTestCluster()
+			rs.Spec.ReplicaOf = &rsv1.ReplicaOfSettings{Host: "10.1.0.1", Port: 6379}
+			topo := &service.Topology{Redises: tt.redises, Sentinels: newSentinelNodes(1)}
+			h, healer, _ := newTestHandler(t, rs, topo)
+			meta := h.MetaCache.Cache(rs)
+
+			if err := h.CheckAndHeal(context.TODO(), meta); err != nil {
+				t.Fatalf("CheckAndHeal() error = %v", err)
+			}
+			if len(healer.calls) != len(tt.wantCalls) {
+				t.Fatalf("heal actions = %q, want %q", healer.calls, tt.wantCalls)
+			}
+			for _, call := range tt.wantCalls {
+				if !healer.called(call) {
+					t.Errorf("heal actions = %q, missing %q", healer.calls, call)
+				}
+			}
+			if healer.called("MakeMaster redis-test-0") || healer.called("MakeMaster redis-test-1") {
+				t.Errorf("a redis of a standby was made master")
+			}
+
+			replication := rs.Status.Replication
+			if replication == nil || replication.Head != tt.wantHead || replication.Source != source {
+				t.Fatalf("replication status = %+v, want head %s replicating %s", replication, tt.wantHead, source)
+			}
+			if rs.Status.MasterPod != tt.wantHead {
+				t.Errorf("master pod = %s, want %s", rs.Status.MasterPod, tt.wantHead)
+			}
+			if rs.Status.IsConditionTrue(rsv1.ConditionSourceLinkUp) != tt.wantLink {
+				t.Errorf("SourceLinkUp = %v, want %v", !tt.wantLink, tt.wantLink)
+			}
+		})
+	}
+}
+
+func TestCheckAndHealStandbyHeadUnreachable(t *testing.T) {
+	rs := newTestCluster()
+	rs.Spec.ReplicaOf = &rsv1.ReplicaOfSettings{Host: "10.1.0.1", Port: 6379}
+	unreachable := newRedisNode(0, "", "")
+	unreachable.Err = context.DeadlineExceeded
+	topo := &service.Topology{
+		Redises:     []*service.RedisNode{newRedisNode(1, "10.0.0.1", "6379")},
+		Unreachable: []*service.RedisNode{unreachable},
+		Sentinels:   newSentinelNodes(1),
+	}
+	h, healer, _ := newTestHandler(t, rs, topo)
+
+	err := h.CheckAndHeal(context.TODO(), h.MetaCache.Cache(rs))
+	if kind := util.KindOf(err); kind != util.KindWaitingForPods {
+		t.Errorf("CheckAndHeal() error = %v, want to wait for the pods", err)
+	}
+	for _, call := range healer.calls {
+		if call != "RemoveSentinelMonitor 10.0.1.1" {
+			t.Errorf("unexpected heal action %q while the head may be unreachable", call)
+		}
+	}
+}
@@ -0,0 +1,65 @@
+package controllers
+
+import (
+	"context"
+	"time"
+
+	"sigs.k8s.io/controller-runtime/pkg/manager"
+
+	"redis-sentinel/pkg/config"
+	"redis-sentinel/pkg/util"
+)
+
+// reconcilerBase is what the reconcilers of the operator share, the bounds of their reconciles
+// and the objects they manage
+type reconcilerBase struct {
+	// baseCtx is cancelled when the manager stops, aborting the in flight calls to redis
+	baseCtx context.Context
+	// reconcileTimeout bounds the time a single reconcile can spend talking to redis
+	reconcileTimeout time.Duration
+	// backoff delays the requeues of the objects failing again and again
+	backoff *util.Backoff
+	// scope selects the objects managed by this instance of the operator
+	scope Scope
+	// resyncPeriod is the delay between the reconciles of a healthy object, and before an
+	// invalid one is checked again
+	resyncPeriod time.Duration
+	// maxConcurrentReconciles is the number of objects reconciled at the same time
+	maxConcurrentReconciles int
+}
+
+// newReconcilerBase returns the settings of a reconciler from cfg, its context is cancelled
+// when mgr stops
+func newReconcilerBase(mgr manager.Manager, cfg *config.Config) (reconcilerBase, error) {
+	scope, err := NewScope(cfg.InstanceSelector)
+	if err != nil {
+		return reconcilerBase{}, err
+	}
+
+	// Cancel the reconciles still running when the manager is stopped
+	baseCtx, cancel := context.WithCancel(context.Background())
+	if err := mgr.Add(manager.RunnableFunc(func(stop <-chan struct{}) error {
+		<-stop
+		cancel()
+		return nil
+	})); err != nil {
+		cancel()
+		return reconcilerBase{}, err
+	}
+
+	return reconcilerBase{
+		baseCtx:                 baseCtx,
+		reconcileTimeout:        cfg.ReconcileTimeout,
+		backoff:                 util.NewBackoff(),
+		scope:                   scope,
+		resyncPeriod:            cfg.ResyncPeriod,
+		maxConcurrentReconciles: cfg.MaxConcurrentReconciles,
+	}, nil
+}
+
+// withBackoff returns the same settings with a backoff of their own, the reconcilers of other
+// kinds don't share the consecutive errors of their objects
+func (b reconcilerBase) withBackoff() reconcilerBase {
+	b.backoff = util.NewBackoff()
+	return b
+}
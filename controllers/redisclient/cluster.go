@@ -0,0 +1,229 @@
+package redisclient
+
+import (
+	"context"
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+
+	rediscli "github.com/go-redis/redis"
+	"redis-sentinel/pkg/util"
+)
+
+// ClusterClient defines the functions necessary to bootstrap and heal a sharded redis cluster
+type ClusterClient interface {
+	GetClusterNodes(ctx context.Context, ip string, auth *util.AuthConfig) ([]*ClusterNode, error)
+	GetClusterState(ctx context.Context, ip string, auth *util.AuthConfig) (string, error)
+	ClusterMeet(ctx context.Context, ip string, peerIP string, auth *util.AuthConfig) error
+	ClusterAddSlots(ctx context.Context, ip string, slots []int, auth *util.AuthConfig) error
+	ClusterReplicate(ctx context.Context, ip string, masterID string, auth *util.AuthConfig) error
+	ClusterForget(ctx context.Context, ip string, nodeID string, auth *util.AuthConfig) error
+	ClusterSetSlot(ctx context.Context, ip string, slot int, state string, nodeID string, auth *util.AuthConfig) error
+	ClusterGetKeysInSlot(ctx context.Context, ip string, slot int, count int, auth *util.AuthConfig) ([]string, error)
+	MigrateKeys(ctx context.Context, ip string, targetIP string, keys []string, timeout time.Duration, auth *util.AuthConfig) error
+	GetDBSize(ctx context.Context, ip string, auth *util.AuthConfig) (int64, error)
+	GetUsedMemory(ctx context.Context, ip string, auth *util.AuthConfig) (int64, error)
+}
+
+// The states of CLUSTER SETSLOT
+const (
+	SlotImporting = "IMPORTING"
+	SlotMigrating = "MIGRATING"
+	SlotNode      = "NODE"
+)
+
+const (
+	clusterStateREString = "cluster_state:([a-z]+)"
+	usedMemoryREString   = "used_memory:([0-9]+)"
+)
+
+var (
+	clusterStateRE = regexp.MustCompile(clusterStateREString)
+	usedMemoryRE   = regexp.MustCompile(usedMemoryREString)
+)
+
+// ClusterNode is a node of a sharded redis cluster as seen by one of its nodes
+type ClusterNode struct {
+	ID string
+	IP string
+	// Myself is true for the node answering CLUSTER NODES
+	Myself bool
+	Master bool
+	// Failed is true when the node is flagged fail or has no address
+	Failed bool
+	// MasterID is the node a replica follows, empty for a master
+	MasterID string
+	// Slots are the slot ranges served by a master, like 0-5460
+	Slots []string
+}
+
+// GetClusterNodes returns the nodes known by the given redis
+func (c *client) GetClusterNodes(ctx context.Context, ip string, auth *util.AuthConfig) ([]*ClusterNode, error) {
+	var res string
+	err := c.do(ctx, ip, redisPort, auth, func(rClient *rediscli.Client) error {
+		var err error
+		res, err = rClient.ClusterNodes().Result()
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+	return parseClusterNodes(res)
+}
+
+// parseClusterNodes parses the lines of CLUSTER NODES:
+// <id> <ip:port@cport> <flags> <master> <ping-sent> <pong-recv> <config-epoch> <link-state> <slot> ...
+func parseClusterNodes(res string) ([]*ClusterNode, error) {
+	nodes := []*ClusterNode{}
+	for _, line := range strings.Split(res, "\n") {
+		fields := strings.Fields(line)
+		if len(fields) == 0 {
+			continue
+		}
+		if len(fields) < 8 {
+			return nil, fmt.Errorf("cluster node %q malformed", line)
+		}
+		node := &ClusterNode{ID: fields[0]}
+		addr := strings.SplitN(fields[1], "@", 2)[0]
+		if i := strings.LastIndex(addr, ":"); i >= 0 {
+			node.IP = addr[:i]
+		}
+		for _, flag := range strings.Split(fields[2], ",") {
+			switch flag {
+			case "myself":
+				node.Myself = true
+			case "master":
+				node.Master = true
+			case "fail", "noaddr":
+				node.Failed = true
+			}
+		}
+		if fields[3] != "-" {
+			node.MasterID = fields[3]
+		}
+		for _, slot := range fields[8:] {
+			// the slots being migrated are listed as [slot->-id], they still belong to the node
+			if !strings.HasPrefix(slot, "[") {
+				node.Slots = append(node.Slots, slot)
+			}
+		}
+		nodes = append(nodes, node)
+	}
+	return nodes, nil
+}
+
+// GetClusterState returns the cluster_state reported by CLUSTER INFO, ok or fail
+func (c *client) GetClusterState(ctx context.Context, ip string, auth *util.AuthConfig) (string, error) {
+	var info string
+	err := c.do(ctx, ip, redisPort, auth, func(rClient *rediscli.Client) error {
+		var err error
+		info, err = rClient.ClusterInfo().Result()
+		return err
+	})
+	if err != nil {
+		return "", err
+	}
+	match := clusterStateRE.FindStringSubmatch(info)
+	if len(match) == 0 {
+		return "", fmt.Errorf("cluster state not found")
+	}
+	return match[1], nil
+}
+
+// ClusterMeet makes the given redis join the cluster of the peer
+func (c *client) ClusterMeet(ctx context.Context, ip string, peerIP string, auth *util.AuthConfig) error {
+	return c.do(ctx, ip, redisPort, auth, func(rClient *rediscli.Client) error {
+		return rClient.ClusterMeet(peerIP, redisPort).Err()
+	})
+}
+
+// ClusterAddSlots makes the given master serve the slots
+func (c *client) ClusterAddSlots(ctx context.Context, ip string, slots []int, auth *util.AuthConfig) error {
+	return c.do(ctx, ip, redisPort, auth, func(rClient *rediscli.Client) error {
+		return rClient.ClusterAddSlots(slots...).Err()
+	})
+}
+
+// ClusterReplicate makes the given redis a replica of the master
+func (c *client) ClusterReplicate(ctx context.Context, ip string, masterID string, auth *util.AuthConfig) error {
+	return c.do(ctx, ip, redisPort, auth, func(rClient *rediscli.Client) error {
+		return rClient.ClusterReplicate(masterID).Err()
+	})
+}
+
+// ClusterForget removes the node from the ones known by the given redis, a node already
+// forgotten is not an error
+func (c *client) ClusterForget(ctx context.Context, ip string, nodeID string, auth *util.AuthConfig) error {
+	return c.do(ctx, ip, redisPort, auth, func(rClient *rediscli.Client) error {
+		err := rClient.ClusterForget(nodeID).Err()
+		if err != nil && strings.Contains(err.Error(), "Unknown node") {
+			return nil
+		}
+		return err
+	})
+}
+
+// ClusterSetSlot sets the state of the slot on the given redis, the node is the source of an
+// importing slot, the target of a migrating one and the owner of the slot for NODE
+func (c *client) ClusterSetSlot(ctx context.Context, ip string, slot int, state string, nodeID string, auth *util.AuthConfig) error {
+	return c.do(ctx, ip, redisPort, auth, func(rClient *rediscli.Client) error {
+		return rClient.Do("CLUSTER", "SETSLOT", slot, state, nodeID).Err()
+	})
+}
+
+// ClusterGetKeysInSlot returns up to count keys of the slot
+func (c *client) ClusterGetKeysInSlot(ctx context.Context, ip string, slot int, count int, auth *util.AuthConfig) ([]string, error) {
+	var keys []string
+	err := c.do(ctx, ip, redisPort, auth, func(rClient *rediscli.Client) error {
+		var err error
+		keys, err = rClient.ClusterGetKeysInSlot(slot, count).Result()
+		return err
+	})
+	return keys, err
+}
+
+// MigrateKeys moves the keys to the target redis, the keys already there are replaced
+func (c *client) MigrateKeys(ctx context.Context, ip string, targetIP string, keys []string, timeout time.Duration, auth *util.AuthConfig) error {
+	args := []interface{}{"MIGRATE", targetIP, redisPort, "", 0, int64(timeout / time.Millisecond), "REPLACE"}
+	if auth != nil && auth.Password != "" {
+		args = append(args, "AUTH", auth.Password)
+	}
+	args = append(args, "KEYS")
+	for _, key := range keys {
+		args = append(args, key)
+	}
+	return c.do(ctx, ip, redisPort, auth, func(rClient *rediscli.Client) error {
+		return rClient.Do(args...).Err()
+	})
+}
+
+// GetDBSize returns the number of keys of the given redis
+func (c *client) GetDBSize(ctx context.Context, ip string, auth *util.AuthConfig) (int64, error) {
+	var size int64
+	err := c.do(ctx, ip, redisPort, auth, func(rClient *rediscli.Client) error {
+		var err error
+		size, err = rClient.DBSize().Result()
+		return err
+	})
+	return size, err
+}
+
+// GetUsedMemory returns the used_memory reported by INFO memory, in bytes
+func (c *client) GetUsedMemory(ctx context.Context, ip string, auth *util.AuthConfig) (int64, error) {
+	var info string
+	err := c.do(ctx, ip, redisPort, auth, func(rClient *rediscli.Client) error {
+		var err error
+		info, err = rClient.Info("memory").Result()
+		return err
+	})
+	if err != nil {
+		return 0, err
+	}
+	match := usedMemoryRE.FindStringSubmatch(info)
+	if len(match) == 0 {
+		return 0, fmt.Errorf("used memory not found")
+	}
+	return strconv.ParseInt(match[1], 10, 64)
+}
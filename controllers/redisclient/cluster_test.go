@@ -0,0 +1,62 @@
+package redisclient
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestParseClusterNodes(t *testing.T) {
+	tests := []struct {
+		name    string
+		res     string
+		want    []*ClusterNode
+		wantErr bool
+	}{
+		{
+			name: "empty",
+			res:  "",
+			want: []*ClusterNode{},
+		},
+		{
+			name: "master and replica",
+			res: "07c37dfeb235213a872192d90877d0cd55635b91 10.0.0.1:6379@16379 myself,master - 0 0 1 connected 0-5460 5462\n" +
+				"e7d1eecce10fd6bb5eb35b9f99a514335d9ba9ca 10.0.0.2:6379@16379 slave 07c37dfeb235213a872192d90877d0cd55635b91 0 1426238317239 1 connected\n",
+			want: []*ClusterNode{
+				{ID: "07c37dfeb235213a872192d90877d0cd55635b91", IP: "10.0.0.1", Myself: true, Master: true, Slots: []string{"0-5460", "5462"}},
+				{ID: "e7d1eecce10fd6bb5eb35b9f99a514335d9ba9ca", IP: "10.0.0.2", MasterID: "07c37dfeb235213a872192d90877d0cd55635b91"},
+			},
+		},
+		{
+			name: "migrating slots stay with their node",
+			res:  "67ed2db8d677e59ec4a4cefb06858cf2a1a89fa1 10.0.0.3:6379@16379 master - 0 1426238316232 2 connected 5461-10922 [5461->-292f8b365bb7edb5e285caf0b7e6ddc7265d2f4f]",
+			want: []*ClusterNode{
+				{ID: "67ed2db8d677e59ec4a4cefb06858cf2a1a89fa1", IP: "10.0.0.3", Master: true, Slots: []string{"5461-10922"}},
+			},
+		},
+		{
+			name: "failed and without address",
+			res: "292f8b365bb7edb5e285caf0b7e6ddc7265d2f4f 10.0.0.4:6379@16379 master,fail - 1426238316232 1426238315232 3 disconnected\n" +
+				"824fe116063bc5fcf9f4ffd895bc17aee7731ac3 :0@0 slave,noaddr 292f8b365bb7edb5e285caf0b7e6ddc7265d2f4f 0 0 3 disconnected",
+			want: []*ClusterNode{
+				{ID: "292f8b365bb7edb5e285caf0b7e6ddc7265d2f4f", IP: "10.0.0.4", Master: true, Failed: true},
+				{ID: "824fe116063bc5fcf9f4ffd895bc17aee7731ac3", IP: "", Failed: true, MasterID: "292f8b365bb7edb5e285caf0b7e6ddc7265d2f4f"},
+			},
+		},
+		{
+			name:    "malformed",
+			res:     "07c37dfeb235213a872192d90877d0cd55635b91 10.0.0.1:6379@16379 myself,master",
+			wantErr: true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := parseClusterNodes(tt.res)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("parseClusterNodes() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("parseClusterNodes() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,152 @@
+package redisclient
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"net"
+	"sync"
+	"time"
+
+	rediscli "github.com/go-redis/redis"
+	"redis-sentinel/pkg/util"
+)
+
+const (
+	// cacheTTL is how long an unused connection pool is kept before it is closed
+	cacheTTL = 10 * time.Minute
+	// pruneInterval is the minimum time between two lookups for unused connection pools
+	pruneInterval = time.Minute
+)
+
+// Config holds the settings shared by all the connections opened to redis and sentinel
+type Config struct {
+	// DialTimeout bounds the time to establish a new connection
+	DialTimeout time.Duration
+	// ReadTimeout bounds the time to wait for a reply
+	ReadTimeout time.Duration
+	// WriteTimeout bounds the time to send a command
+	WriteTimeout time.Duration
+	// IdleTimeout closes the connections of a pool that stay idle longer than it
+	IdleTimeout time.Duration
+	// PoolSize is the maximum number of connections kept per redis or sentinel
+	PoolSize int
+}
+
+// DefaultConfig returns the connection settings used when no flag overrides them
+func DefaultConfig() Config {
+	return Config{
+		DialTimeout:  5 * time.Second,
+		ReadTimeout:  3 * time.Second,
+		WriteTimeout: 3 * time.Second,
+		IdleTimeout:  5 * time.Minute,
+		PoolSize:     2,
+	}
+}
+
+type cachedClient struct {
+	*rediscli.Client
+	lastUsed time.Time
+}
+
+// clientCache keeps one connection pool per address and credentials, so the connections
+// are reused between reconciles instead of being opened for every command. The pool of an
+// older password is left to prune, a call still running on it isn't cut when the password
+// changes.
+type clientCache struct {
+	config Config
+	mu     sync.Mutex
+	// clients are keyed by the address and a hash of the password, never the password itself
+	clients   map[string]*cachedClient
+	lastPrune time.Time
+}
+
+func newClientCache(config Config) *clientCache {
+	return &clientCache{
+		config:  config,
+		clients: make(map[string]*cachedClient),
+	}
+}
+
+// get returns the pooled client for the given address, creating it if needed
+func (cc *clientCache) get(ip, port string, auth *util.AuthConfig) *rediscli.Client {
+	passwd := auth.Password
+	if port == sentinelPort {
+		passwd = ""
+	}
+	addr := net.JoinHostPort(ip, port)
+	key := cacheKey(addr, passwd)
+
+	cc.mu.Lock()
+	defer cc.mu.Unlock()
+
+	now := time.Now()
+	if now.Sub(cc.lastPrune) > pruneInterval {
+		cc.prune(now)
+	}
+
+	if cached, ok := cc.clients[key]; ok {
+		cached.lastUsed = now
+		return cached.Client
+	}
+	rClient := rediscli.NewClient(&rediscli.Options{
+		Addr:         addr,
+		Password:     passwd,
+		DB:           0,
+		DialTimeout:  cc.config.DialTimeout,
+		ReadTimeout:  cc.config.ReadTimeout,
+		WriteTimeout: cc.config.WriteTimeout,
+		IdleTimeout:  cc.config.IdleTimeout,
+		PoolSize:     cc.config.PoolSize,
+	})
+	cc.clients[key] = &cachedClient{Client: rClient, lastUsed: now}
+	return rClient
+}
+
+// cacheKey returns the key of the client of the address using the password
+func cacheKey(addr, password string) string {
+	sum := sha256.Sum256([]byte(password))
+	return addr + "|" + hex.EncodeToString(sum[:])
+}
+
+// prune closes the pools not used during the last cacheTTL, pods that went away or changed ip
+// and rotated passwords leave them behind. Must be called with the lock held.
+func (cc *clientCache) prune(now time.Time) {
+	for key, cached := range cc.clients {
+		if now.Sub(cached.lastUsed) > cacheTTL {
+			cached.Close()
+			delete(cc.clients, key)
+		}
+	}
+	cc.lastPrune = now
+}
+
+// do runs fn with the pooled client of the given address. It returns as soon as ctx is done,
+// the command still running is bounded by the read and write timeouts.
+func (c *client) do(ctx context.Context, ip, port string, auth *util.AuthConfig, fn func(rClient *rediscli.Client) error) (err error) {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	rClient := c.cache.get(ip, port, auth)
+
+	start := time.Now()
+	defer func() {
+		logger := util.LoggerFrom(ctx, c.logger).WithValues("addr", net.JoinHostPort(ip, port), "duration", time.Since(start).String()).V(5)
+		if err != nil {
+			logger.Info("redis call failed", "error", util.RedactPassword(err.Error(), auth.Password))
+			return
+		}
+		logger.Info("redis call done")
+	}()
+
+	errCh := make(chan error, 1)
+	go func() {
+		errCh <- fn(rClient)
+	}()
+	select {
+	case <-ctx.Done():
+		return ctx.Err()
+	case err := <-errCh:
+		return err
+	}
+}
@@ -0,0 +1,67 @@
+package redisclient
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	"redis-sentinel/pkg/util"
+)
+
+func TestClientCacheGet(t *testing.T) {
+	cc := newClientCache(DefaultConfig())
+	defer func() {
+		for _, cached := range cc.clients {
+			cached.Close()
+		}
+	}()
+
+	first := cc.get("10.0.0.1", "6379", &util.AuthConfig{Password: "secret"})
+	if again := cc.get("10.0.0.1", "6379", &util.AuthConfig{Password: "secret"}); again != first {
+		t.Errorf("get() returned a new client for the same address and password")
+	}
+	for key := range cc.clients {
+		if strings.Contains(key, "secret") {
+			t.Errorf("cache key %q holds the password", key)
+		}
+	}
+
+	rotated := cc.get("10.0.0.1", "6379", &util.AuthConfig{Password: "rotated"})
+	if rotated == first {
+		t.Errorf("get() returned the client of the old password")
+	}
+	// a call still running with the old password keeps its pool until it is pruned
+	if _, ok := cc.clients[cacheKey("10.0.0.1:6379", "secret")]; !ok || len(cc.clients) != 2 {
+		t.Errorf("got %d clients after the password changed, want the old one kept", len(cc.clients))
+	}
+
+	cc.get("10.0.0.2", "6379", &util.AuthConfig{Password: "rotated"})
+	if len(cc.clients) != 3 {
+		t.Errorf("got %d clients for two addresses and passwords, want 3", len(cc.clients))
+	}
+}
+
+func TestClientCachePrune(t *testing.T) {
+	cc := newClientCache(DefaultConfig())
+	defer func() {
+		for _, cached := range cc.clients {
+			cached.Close()
+		}
+	}()
+
+	cc.get("10.0.0.1", "6379", &util.AuthConfig{Password: "secret"})
+	cc.get("10.0.0.1", "6379", &util.AuthConfig{Password: "rotated"})
+	stale := cc.clients[cacheKey("10.0.0.1:6379", "secret")]
+	stale.lastUsed = time.Now().Add(-cacheTTL - time.Second)
+
+	cc.prune(time.Now())
+	if _, ok := cc.clients[cacheKey("10.0.0.1:6379", "secret")]; ok {
+		t.Errorf("the pool of the old password wasn't pruned")
+	}
+	if _, ok := cc.clients[cacheKey("10.0.0.1:6379", "rotated")]; !ok {
+		t.Errorf("the pool in use was pruned")
+	}
+	if err := stale.Ping().Err(); err == nil || !strings.Contains(err.Error(), "closed") {
+		t.Errorf("pruned pool ping error = %v, want it closed", err)
+	}
+}
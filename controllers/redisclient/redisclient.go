@@ -1,46 +1,77 @@
 package redisclient
 
 import (
+	"context"
 	"errors"
 	"fmt"
-	"net"
 	"regexp"
 	"strconv"
 	"strings"
+	"time"
 
+	"github.com/go-logr/logr"
 	rediscli "github.com/go-redis/redis"
 	"redis-sentinel/pkg/util"
+	"redis-sentinel/pkg/version"
 )
 
 // Client defines the functions necessary to connect to redis and sentinel to get or set what we need
 type Client interface {
-	GetNumberSentinelsInMemory(ip string, auth *util.AuthConfig) (int32, error)
-	GetNumberSentinelSlavesInMemory(ip string, auth *util.AuthConfig) (int32, error)
-	ResetSentinel(ip string, auth *util.AuthConfig) error
-	GetSlaveMasterIP(ip string, auth *util.AuthConfig) (string, error)
-	IsMaster(ip string, auth *util.AuthConfig) (bool, error)
-	MonitorRedis(ip string, monitor string, quorum string, auth *util.AuthConfig) error
-	MakeMaster(ip string, auth *util.AuthConfig) error
-	MakeSlaveOf(ip string, masterIP string, auth *util.AuthConfig) error
-	GetSentinelMonitor(ip string, auth *util.AuthConfig) (string, error)
-	SetCustomSentinelConfig(ip string, configs []string, auth *util.AuthConfig) error
-	SetCustomRedisConfig(ip string, configs map[string]string, auth *util.AuthConfig) error
-	GetAllRedisConfig(rClient *rediscli.Client) (map[string]string, error)
+	GetNumberSentinelsInMemory(ctx context.Context, ip string, auth *util.AuthConfig) (int32, error)
+	GetNumberSentinelSlavesInMemory(ctx context.Context, ip string, version *version.ServerVersion, auth *util.AuthConfig) (int32, error)
+	ResetSentinel(ctx context.Context, ip string, auth *util.AuthConfig) error
+	IsMaster(ctx context.Context, ip string, auth *util.AuthConfig) (bool, error)
+	GetReplicationInfo(ctx context.Context, ip string, auth *util.AuthConfig) (*ReplicationInfo, error)
+	GetSourceReplicationInfo(ctx context.Context, host string, port string, auth *util.AuthConfig) (*ReplicationInfo, error)
+	SetSourceReadOnly(ctx context.Context, host string, port string, auth *util.AuthConfig) (string, string, error)
+	RestoreSourceWrites(ctx context.Context, host string, port string, minReplicas string, maxLag string, auth *util.AuthConfig) error
+	MonitorRedis(ctx context.Context, ip string, monitor string, monitorPort string, quorum string, auth *util.AuthConfig) error
+	MakeMaster(ctx context.Context, ip string, version *version.ServerVersion, auth *util.AuthConfig) error
+	MakeSlaveOf(ctx context.Context, ip string, masterIP string, masterPort string, version *version.ServerVersion, auth *util.AuthConfig) error
+	GetSentinelMonitor(ctx context.Context, ip string, auth *util.AuthConfig) (string, string, error)
+	SetRedisAnnounce(ctx context.Context, ip string, announceIP string, announcePort string, auth *util.AuthConfig) error
+	SetSentinelAnnounce(ctx context.Context, ip string, announceIP string, announcePort string, auth *util.AuthConfig) error
+	EnableSentinelHostnames(ctx context.Context, ip string, auth *util.AuthConfig) error
+	GetSentinelConfig(ctx context.Context, ip string, auth *util.AuthConfig) (map[string]string, error)
+	SetCustomSentinelConfig(ctx context.Context, ip string, configs []string, auth *util.AuthConfig) error
+	SetCustomRedisConfig(ctx context.Context, ip string, configs map[string]string, version *version.ServerVersion, auth *util.AuthConfig) error
+	GetAllRedisConfig(ctx context.Context, ip string, auth *util.AuthConfig) (map[string]string, error)
+	RemoveSentinelMonitor(ctx context.Context, ip string, auth *util.AuthConfig) error
+	SaveSnapshot(ctx context.Context, ip string, auth *util.AuthConfig) error
+	RewriteAOF(ctx context.Context, ip string, auth *util.AuthConfig) error
+	FlushAll(ctx context.Context, ip string, auth *util.AuthConfig) error
+	SetMasterAuth(ctx context.Context, ip string, password string, auth *util.AuthConfig) error
+	SetRedisPassword(ctx context.Context, ip string, password string, auth *util.AuthConfig) error
+	SetSentinelAuthPass(ctx context.Context, ip string, password string, auth *util.AuthConfig) error
+	SentinelFailover(ctx context.Context, ip string, auth *util.AuthConfig) error
+	GetRedisVersion(ctx context.Context, ip string, auth *util.AuthConfig) (*version.ServerVersion, error)
+	GetSentinelVersion(ctx context.Context, ip string, auth *util.AuthConfig) (*version.ServerVersion, error)
+	ClusterClient
 }
 
 type client struct {
+	cache  *clientCache
+	logger logr.Logger
 }
 
-// New returns a redis client
-func New() Client {
-	return &client{}
+// New returns a redis client reusing its connections with the given settings
+func New(config Config, logger logr.Logger) Client {
+	return &client{
+		cache:  newClientCache(config),
+		logger: logger,
+	}
 }
 
 const (
 	sentinelsNumberREString = "sentinels=([0-9]+)"
-	slaveNumberREString     = "slaves=([0-9]+)"
+	slaveNumberREString     = "(?:slaves|replicas)=([0-9]+)"
 	sentinelStatusREString  = "status=([a-z]+)"
-	redisMasterHostREString = "master_host:([0-9a-zA-Z:.]+)"
+	redisMasterHostREString = "master_host:([0-9a-zA-Z:.-]+)"
+	redisMasterPortREString = "master_port:([0-9]+)"
+	redisReplOffsetREString = "master_repl_offset:([0-9]+)"
+	redisLinkStatusREString = "master_link_status:([a-z]+)"
+	redisLastIOREString     = "master_last_io_seconds_ago:(-?[0-9]+)"
+	redisSyncingREString    = "master_sync_in_progress:([01])"
 	redisRoleMaster         = "role:master"
 	redisPort               = "6379"
 	sentinelPort            = "26379"
@@ -49,6 +80,14 @@ const (
 	defaultDownAfterMilliseconds = "5000"
 	defaultFailovertimeout       = "3000"
 	defaultParallelSyncs         = "2"
+
+	// readOnlyMinReplicas is more replicas than a source can have, it rejects the writes once
+	// it needs them
+	readOnlyMinReplicas = "1000000"
+	readOnlyMaxLag      = "10"
+
+	// snapshotPollInterval is the time between the checks of a running BGSAVE
+	snapshotPollInterval = time.Second
 )
 
 var (
@@ -56,14 +95,21 @@ var (
 	sentinelStatusRE  = regexp.MustCompile(sentinelStatusREString)
 	slaveNumberRE     = regexp.MustCompile(slaveNumberREString)
 	redisMasterHostRE = regexp.MustCompile(redisMasterHostREString)
+	redisMasterPortRE = regexp.MustCompile(redisMasterPortREString)
+	redisReplOffsetRE = regexp.MustCompile(redisReplOffsetREString)
+	redisLinkStatusRE = regexp.MustCompile(redisLinkStatusREString)
+	redisLastIORE     = regexp.MustCompile(redisLastIOREString)
+	redisSyncingRE    = regexp.MustCompile(redisSyncingREString)
 )
 
 // GetNumberSentinelsInMemory return the number of sentinels that the requested sentinel has
-func (c *client) GetNumberSentinelsInMemory(ip string, auth *util.AuthConfig) (int32, error) {
-	options := c.setOptions(ip, sentinelPort, auth)
-	rClient := rediscli.NewClient(options)
-	defer rClient.Close()
-	info, err := rClient.Info("sentinel").Result()
+func (c *client) GetNumberSentinelsInMemory(ctx context.Context, ip string, auth *util.AuthConfig) (int32, error) {
+	var info string
+	err := c.do(ctx, ip, sentinelPort, auth, func(rClient *rediscli.Client) error {
+		var err error
+		info, err = rClient.Info("sentinel").Result()
+		return err
+	})
 	if err != nil {
 		return 0, err
 	}
@@ -81,23 +127,28 @@ func (c *client) GetNumberSentinelsInMemory(ip string, auth *util.AuthConfig) (i
 	return int32(nSentinels), nil
 }
 
-// GetNumberSentinelsInMemory return the number of sentinels that the requested sentinel has
-func (c *client) GetNumberSentinelSlavesInMemory(ip string, auth *util.AuthConfig) (int32, error) {
-	options := c.setOptions(ip, sentinelPort, auth)
-	rClient := rediscli.NewClient(options)
-	defer rClient.Close()
-	info, err := rClient.Info("sentinel").Result()
-	if err != nil {
-		return 0, err
-	}
+// GetNumberSentinelSlavesInMemory return the number of replicas that the requested sentinel knows
+func (c *client) GetNumberSentinelSlavesInMemory(ctx context.Context, ip string, version *version.ServerVersion, auth *util.AuthConfig) (int32, error) {
+	var slaveInfoBlobs []interface{}
+	err := c.do(ctx, ip, sentinelPort, auth, func(rClient *rediscli.Client) error {
+		info, err := rClient.Info("sentinel").Result()
+		if err != nil {
+			return err
+		}
 
-	if err = isSentinelReady(info); err != nil {
-		return 0, err
-	}
+		if err = isSentinelReady(info); err != nil {
+			return err
+		}
 
-	cmd := rediscli.NewSliceCmd("sentinel", "slaves", masterName)
-	rClient.Process(cmd)
-	slaveInfoBlobs, err := cmd.Result()
+		subcommand := "slaves"
+		if version.UsesReplicaNames() {
+			subcommand = "replicas"
+		}
+		cmd := rediscli.NewSliceCmd("sentinel", subcommand, masterName)
+		rClient.Process(cmd)
+		slaveInfoBlobs, err = cmd.Result()
+		return err
+	})
 	if err != nil {
 		return 0, err
 	}
@@ -135,165 +186,444 @@ func isSentinelReady(info string) error {
 }
 
 // ResetSentinel sends a sentinel reset * for the given sentinel
-func (c *client) ResetSentinel(ip string, auth *util.AuthConfig) error {
-	options := c.setOptions(ip, sentinelPort, auth)
-	rClient := rediscli.NewClient(options)
-	defer rClient.Close()
-	cmd := rediscli.NewIntCmd("SENTINEL", "reset", "*")
-	rClient.Process(cmd)
-	_, err := cmd.Result()
-	if err != nil {
+func (c *client) ResetSentinel(ctx context.Context, ip string, auth *util.AuthConfig) error {
+	return c.do(ctx, ip, sentinelPort, auth, func(rClient *rediscli.Client) error {
+		cmd := rediscli.NewIntCmd("SENTINEL", "reset", "*")
+		rClient.Process(cmd)
+		_, err := cmd.Result()
+		return err
+	})
+}
+
+// RemoveSentinelMonitor makes the given sentinel stop monitoring the master, a sentinel
+// not monitoring it is not an error
+func (c *client) RemoveSentinelMonitor(ctx context.Context, ip string, auth *util.AuthConfig) error {
+	return c.do(ctx, ip, sentinelPort, auth, func(rClient *rediscli.Client) error {
+		cmd := rediscli.NewStatusCmd("SENTINEL", "REMOVE", masterName)
+		rClient.Process(cmd)
+		if err := cmd.Err(); err != nil && !strings.Contains(err.Error(), "No such master") {
+			return err
+		}
+		return nil
+	})
+}
+
+// RewriteAOF starts a BGREWRITEAOF on the given redis, a rewrite already running is enough
+func (c *client) RewriteAOF(ctx context.Context, ip string, auth *util.AuthConfig) error {
+	return c.do(ctx, ip, redisPort, auth, func(rClient *rediscli.Client) error {
+		err := rClient.BgRewriteAOF().Err()
+		if err != nil && strings.Contains(err.Error(), "already in progress") {
+			return nil
+		}
+		return err
+	})
+}
+
+// FlushAll removes all the keys of the given redis
+func (c *client) FlushAll(ctx context.Context, ip string, auth *util.AuthConfig) error {
+	return c.do(ctx, ip, redisPort, auth, func(rClient *rediscli.Client) error {
+		return rClient.FlushAll().Err()
+	})
+}
+
+// SetMasterAuth changes the password the given redis uses when it connects to its master,
+// the replication link already open is kept
+func (c *client) SetMasterAuth(ctx context.Context, ip string, password string, auth *util.AuthConfig) error {
+	return c.do(ctx, ip, redisPort, auth, func(rClient *rediscli.Client) error {
+		return rClient.ConfigSet("masterauth", password).Err()
+	})
+}
+
+// SetRedisPassword changes the password of the given redis, the connections already
+// authenticated are kept
+func (c *client) SetRedisPassword(ctx context.Context, ip string, password string, auth *util.AuthConfig) error {
+	return c.do(ctx, ip, redisPort, auth, func(rClient *rediscli.Client) error {
+		return rClient.ConfigSet("requirepass", password).Err()
+	})
+}
+
+// SetSentinelAuthPass changes the password the given sentinel uses to reach the redis
+func (c *client) SetSentinelAuthPass(ctx context.Context, ip string, password string, auth *util.AuthConfig) error {
+	return c.do(ctx, ip, sentinelPort, auth, func(rClient *rediscli.Client) error {
+		cmd := rediscli.NewStatusCmd("SENTINEL", "SET", masterName, "auth-pass", password)
+		rClient.Process(cmd)
+		return cmd.Err()
+	})
+}
+
+// SentinelFailover asks the given sentinel to promote a replica without waiting for the
+// master to be down
+func (c *client) SentinelFailover(ctx context.Context, ip string, auth *util.AuthConfig) error {
+	return c.do(ctx, ip, sentinelPort, auth, func(rClient *rediscli.Client) error {
+		cmd := rediscli.NewStatusCmd("SENTINEL", "FAILOVER", masterName)
+		rClient.Process(cmd)
+		return cmd.Err()
+	})
+}
+
+// SaveSnapshot runs a BGSAVE on the given redis and waits until LASTSAVE reports it finished
+func (c *client) SaveSnapshot(ctx context.Context, ip string, auth *util.AuthConfig) error {
+	return c.do(ctx, ip, redisPort, auth, func(rClient *rediscli.Client) error {
+		before, err := rClient.LastSave().Result()
+		if err != nil {
+			return err
+		}
+		if err := rClient.BgSave().Err(); err != nil {
+			return err
+		}
+		ticker := time.NewTicker(snapshotPollInterval)
+		defer ticker.Stop()
+		for {
+			last, err := rClient.LastSave().Result()
+			if err != nil {
+				return err
+			}
+			if last > before {
+				return nil
+			}
+			select {
+			case <-ctx.Done():
+				return ctx.Err()
+			case <-ticker.C:
+			}
+		}
+	})
+}
+
+// ReplicationInfo is the replication state reported by a redis
+type ReplicationInfo struct {
+	// IsMaster is true when the redis has the master role
+	IsMaster bool
+	// MasterHost and MasterPort are the master the redis replicates from, empty for a master
+	MasterHost string
+	MasterPort string
+	// Offset is the replication offset of the redis
+	Offset int64
+	// LinkUp is true when a replica is connected to its master, LastIOSecondsAgo is the
+	// time since it received data from it
+	LinkUp           bool
+	LastIOSecondsAgo int64
+	// SyncInProgress is true while a replica loads the full copy of its master
+	SyncInProgress bool
+}
+
+// GetReplicationInfo returns the role, master and replication offset of the given redis with a single INFO call
+func (c *client) GetReplicationInfo(ctx context.Context, ip string, auth *util.AuthConfig) (*ReplicationInfo, error) {
+	return c.getReplicationInfo(ctx, ip, redisPort, auth)
+}
+
+// GetSourceReplicationInfo returns the replication info of a redis outside of the cluster, like
+// the source of a standby
+func (c *client) GetSourceReplicationInfo(ctx context.Context, host string, port string, auth *util.AuthConfig) (*ReplicationInfo, error) {
+	return c.getReplicationInfo(ctx, host, port, auth)
+}
+
+func (c *client) getReplicationInfo(ctx context.Context, ip string, port string, auth *util.AuthConfig) (*ReplicationInfo, error) {
+	var info string
+	err := c.do(ctx, ip, port, auth, func(rClient *rediscli.Client) error {
+		var err error
+		info, err = rClient.Info("replication").Result()
 		return err
+	})
+	if err != nil {
+		return nil, err
 	}
-	return nil
+	repl := &ReplicationInfo{
+		IsMaster: strings.Contains(info, redisRoleMaster),
+	}
+	if !repl.IsMaster {
+		if match := redisMasterHostRE.FindStringSubmatch(info); len(match) != 0 {
+			repl.MasterHost = match[1]
+			repl.MasterPort = redisPort
+			if portMatch := redisMasterPortRE.FindStringSubmatch(info); len(portMatch) != 0 {
+				repl.MasterPort = portMatch[1]
+			}
+		}
+	}
+	if match := redisReplOffsetRE.FindStringSubmatch(info); len(match) != 0 {
+		if repl.Offset, err = strconv.ParseInt(match[1], 10, 64); err != nil {
+			return nil, err
+		}
+	}
+	if match := redisLinkStatusRE.FindStringSubmatch(info); len(match) != 0 {
+		repl.LinkUp = match[1] == "up"
+	}
+	if match := redisLastIORE.FindStringSubmatch(info); len(match) != 0 {
+		if repl.LastIOSecondsAgo, err = strconv.ParseInt(match[1], 10, 64); err != nil {
+			return nil, err
+		}
+	}
+	if match := redisSyncingRE.FindStringSubmatch(info); len(match) != 0 {
+		repl.SyncInProgress = match[1] == "1"
+	}
+	return repl, nil
+}
+
+// SetSourceReadOnly makes a redis outside of the cluster reject the writes by requiring more
+// replicas than it has, its replicas keep receiving what was written before. It returns the
+// min-slaves-to-write and min-slaves-max-lag the source had before
+func (c *client) SetSourceReadOnly(ctx context.Context, host string, port string, auth *util.AuthConfig) (string, string, error) {
+	var minReplicas, maxLag string
+	err := c.do(ctx, host, port, auth, func(rClient *rediscli.Client) error {
+		var err error
+		if minReplicas, err = getConfig(rClient, "min-slaves-to-write"); err != nil {
+			return err
+		}
+		if maxLag, err = getConfig(rClient, "min-slaves-max-lag"); err != nil {
+			return err
+		}
+		if err := rClient.ConfigSet("min-slaves-max-lag", readOnlyMaxLag).Err(); err != nil {
+			return err
+		}
+		return rClient.ConfigSet("min-slaves-to-write", readOnlyMinReplicas).Err()
+	})
+	return minReplicas, maxLag, err
 }
 
-// GetSlaveMasterIP returns the master of the given redis, or nil if it's master
-func (c *client) GetSlaveMasterIP(ip string, auth *util.AuthConfig) (string, error) {
-	options := c.setOptions(ip, redisPort, auth)
-	rClient := rediscli.NewClient(options)
-	defer rClient.Close()
-	info, err := rClient.Info("replication").Result()
+// RestoreSourceWrites gives back to a source made read-only the settings it had before
+func (c *client) RestoreSourceWrites(ctx context.Context, host string, port string, minReplicas string, maxLag string, auth *util.AuthConfig) error {
+	return c.do(ctx, host, port, auth, func(rClient *rediscli.Client) error {
+		if err := rClient.ConfigSet("min-slaves-to-write", minReplicas).Err(); err != nil {
+			return err
+		}
+		return rClient.ConfigSet("min-slaves-max-lag", maxLag).Err()
+	})
+}
+
+// getConfig returns the value of a single config of a redis
+func getConfig(rClient *rediscli.Client, name string) (string, error) {
+	val, err := rClient.ConfigGet(name).Result()
 	if err != nil {
 		return "", err
 	}
-	match := redisMasterHostRE.FindStringSubmatch(info)
-	if len(match) == 0 {
-		return "", nil
+	if len(val) != 2 {
+		return "", fmt.Errorf("config %s not found", name)
 	}
-	return match[1], nil
+	value, _ := val[1].(string)
+	return value, nil
 }
 
-func (c *client) IsMaster(ip string, auth *util.AuthConfig) (bool, error) {
-	options := c.setOptions(ip, redisPort, auth)
-	rClient := rediscli.NewClient(options)
-	defer rClient.Close()
-	info, err := rClient.Info("replication").Result()
+func (c *client) IsMaster(ctx context.Context, ip string, auth *util.AuthConfig) (bool, error) {
+	var info string
+	err := c.do(ctx, ip, redisPort, auth, func(rClient *rediscli.Client) error {
+		var err error
+		info, err = rClient.Info("replication").Result()
+		return err
+	})
 	if err != nil {
 		return false, err
 	}
 	return strings.Contains(info, redisRoleMaster), nil
 }
 
-func (c *client) MonitorRedis(ip string, monitor string, quorum string, auth *util.AuthConfig) error {
-	options := c.setOptions(ip, sentinelPort, auth)
-	rClient := rediscli.NewClient(options)
-	defer rClient.Close()
-	cmd := rediscli.NewBoolCmd("SENTINEL", "REMOVE", masterName)
-	rClient.Process(cmd)
-	// We'll continue even if it fails, the priority is to have the redises monitored
-	cmd = rediscli.NewBoolCmd("SENTINEL", "MONITOR", masterName, monitor, redisPort, quorum)
-	rClient.Process(cmd)
-	_, err := cmd.Result()
-	if err != nil {
-		return err
-	}
-	if auth.Password != "" {
-		sCmd := rediscli.NewStatusCmd("SENTINEL", "SET", masterName, "auth-pass", auth.Password)
+func (c *client) MonitorRedis(ctx context.Context, ip string, monitor string, monitorPort string, quorum string, auth *util.AuthConfig) error {
+	return c.do(ctx, ip, sentinelPort, auth, func(rClient *rediscli.Client) error {
+		cmd := rediscli.NewBoolCmd("SENTINEL", "REMOVE", masterName)
+		rClient.Process(cmd)
+		// We'll continue even if it fails, the priority is to have the redises monitored
+		cmd = rediscli.NewBoolCmd("SENTINEL", "MONITOR", masterName, monitor, monitorPort, quorum)
+		rClient.Process(cmd)
+		_, err := cmd.Result()
+		if err != nil {
+			return err
+		}
+		if auth.Password != "" {
+			sCmd := rediscli.NewStatusCmd("SENTINEL", "SET", masterName, "auth-pass", auth.Password)
+			rClient.Process(sCmd)
+			if err = sCmd.Err(); err != nil {
+				return err
+			}
+		}
+
+		sCmd := rediscli.NewStatusCmd("SENTINEL", "SET", masterName, "down-after-milliseconds", defaultDownAfterMilliseconds)
 		rClient.Process(sCmd)
 		if err = sCmd.Err(); err != nil {
 			return err
 		}
-	}
+		sCmd = rediscli.NewStatusCmd("SENTINEL", "SET", masterName, "failover-timeout", defaultFailovertimeout)
+		rClient.Process(sCmd)
+		if err = sCmd.Err(); err != nil {
+			return err
+		}
+		sCmd = rediscli.NewStatusCmd("SENTINEL", "SET", masterName, "parallel-syncs", defaultParallelSyncs)
+		rClient.Process(sCmd)
+		return sCmd.Err()
+	})
+}
 
-	sCmd := rediscli.NewStatusCmd("SENTINEL", "SET", masterName, "down-after-milliseconds", defaultDownAfterMilliseconds)
-	rClient.Process(sCmd)
-	if err = sCmd.Err(); err != nil {
-		return err
-	}
-	sCmd = rediscli.NewStatusCmd("SENTINEL", "SET", masterName, "failover-timeout", defaultFailovertimeout)
-	rClient.Process(sCmd)
-	if err = sCmd.Err(); err != nil {
-		return err
-	}
-	sCmd = rediscli.NewStatusCmd("SENTINEL", "SET", masterName, "parallel-syncs", defaultParallelSyncs)
-	rClient.Process(sCmd)
-	if err = sCmd.Err(); err != nil {
-		return err
-	}
+func (c *client) MakeMaster(ctx context.Context, ip string, version *version.ServerVersion, auth *util.AuthConfig) error {
+	return c.do(ctx, ip, redisPort, auth, func(rClient *rediscli.Client) error {
+		return replicaOf(rClient, version, "NO", "ONE")
+	})
+}
 
-	return nil
+func (c *client) MakeSlaveOf(ctx context.Context, ip string, masterIP string, masterPort string, version *version.ServerVersion, auth *util.AuthConfig) error {
+	return c.do(ctx, ip, redisPort, auth, func(rClient *rediscli.Client) error {
+		return replicaOf(rClient, version, masterIP, masterPort)
+	})
 }
 
-func (c *client) MakeMaster(ip string, auth *util.AuthConfig) error {
-	options := c.setOptions(ip, redisPort, auth)
-	rClient := rediscli.NewClient(options)
-	defer rClient.Close()
-	if res := rClient.SlaveOf("NO", "ONE"); res.Err() != nil {
-		return res.Err()
+// replicaOf runs REPLICAOF on the servers knowing it, SLAVEOF on the older ones
+func replicaOf(rClient *rediscli.Client, version *version.ServerVersion, host string, port string) error {
+	if !version.UsesReplicaNames() {
+		return rClient.SlaveOf(host, port).Err()
 	}
-	return nil
+	cmd := rediscli.NewStatusCmd("REPLICAOF", host, port)
+	rClient.Process(cmd)
+	return cmd.Err()
 }
 
-func (c *client) MakeSlaveOf(ip string, masterIP string, auth *util.AuthConfig) error {
-	options := c.setOptions(ip, redisPort, auth)
-	rClient := rediscli.NewClient(options)
-	defer rClient.Close()
-	if res := rClient.SlaveOf(masterIP, redisPort); res.Err() != nil {
-		return res.Err()
-	}
-	return nil
+// GetRedisVersion returns the flavor and version reported by the given redis
+func (c *client) GetRedisVersion(ctx context.Context, ip string, auth *util.AuthConfig) (*version.ServerVersion, error) {
+	return c.getVersion(ctx, ip, redisPort, auth)
 }
 
-func (c *client) GetSentinelMonitor(ip string, auth *util.AuthConfig) (string, error) {
-	options := c.setOptions(ip, sentinelPort, auth)
-	rClient := rediscli.NewClient(options)
-	defer rClient.Close()
-	cmd := rediscli.NewSliceCmd("SENTINEL", "master", masterName)
-	rClient.Process(cmd)
-	res, err := cmd.Result()
+// GetSentinelVersion returns the flavor and version reported by the given sentinel
+func (c *client) GetSentinelVersion(ctx context.Context, ip string, auth *util.AuthConfig) (*version.ServerVersion, error) {
+	return c.getVersion(ctx, ip, sentinelPort, auth)
+}
+
+func (c *client) getVersion(ctx context.Context, ip string, port string, auth *util.AuthConfig) (*version.ServerVersion, error) {
+	var info string
+	err := c.do(ctx, ip, port, auth, func(rClient *rediscli.Client) error {
+		var err error
+		info, err = rClient.Info("server").Result()
+		return err
+	})
 	if err != nil {
-		return "", err
+		return nil, err
 	}
-	masterIP := res[3].(string)
-	return masterIP, nil
+	return version.ParseServerInfo(info)
 }
 
-func (c *client) SetCustomSentinelConfig(ip string, configs []string, auth *util.AuthConfig) error {
-	options := c.setOptions(ip, sentinelPort, auth)
-	rClient := rediscli.NewClient(options)
-	defer rClient.Close()
+func (c *client) GetSentinelMonitor(ctx context.Context, ip string, auth *util.AuthConfig) (string, string, error) {
+	var res []interface{}
+	err := c.do(ctx, ip, sentinelPort, auth, func(rClient *rediscli.Client) error {
+		cmd := rediscli.NewSliceCmd("SENTINEL", "master", masterName)
+		rClient.Process(cmd)
+		var err error
+		res, err = cmd.Result()
+		return err
+	})
+	if err != nil {
+		return "", "", err
+	}
+	masterIP := slaveInfoFieldByName("ip", res)
+	masterPort := slaveInfoFieldByName("port", res)
+	return masterIP, masterPort, nil
+}
 
-	for _, config := range configs {
-		param, value, err := c.getConfigParameters(config)
-		if err != nil {
+// SetRedisAnnounce makes the given redis report the announce address to its master instead of its own ip
+func (c *client) SetRedisAnnounce(ctx context.Context, ip string, announceIP string, announcePort string, auth *util.AuthConfig) error {
+	return c.do(ctx, ip, redisPort, auth, func(rClient *rediscli.Client) error {
+		if err := c.applyRedisConfig("replica-announce-ip", announceIP, rClient); err != nil {
 			return err
 		}
-		if err := c.applySentinelConfig(param, value, rClient); err != nil {
+		return c.applyRedisConfig("replica-announce-port", announcePort, rClient)
+	})
+}
+
+// SetSentinelAnnounce makes the given sentinel advertise the announce address to the other sentinels
+func (c *client) SetSentinelAnnounce(ctx context.Context, ip string, announceIP string, announcePort string, auth *util.AuthConfig) error {
+	return c.do(ctx, ip, sentinelPort, auth, func(rClient *rediscli.Client) error {
+		cmd := rediscli.NewStatusCmd("SENTINEL", "CONFIG", "SET", "announce-ip", announceIP)
+		rClient.Process(cmd)
+		if err := cmd.Err(); err != nil {
 			return err
 		}
+		cmd = rediscli.NewStatusCmd("SENTINEL", "CONFIG", "SET", "announce-port", announcePort)
+		rClient.Process(cmd)
+		return cmd.Err()
+	})
+}
+
+// EnableSentinelHostnames makes the given sentinel resolve and announce hostnames instead of ips
+func (c *client) EnableSentinelHostnames(ctx context.Context, ip string, auth *util.AuthConfig) error {
+	return c.do(ctx, ip, sentinelPort, auth, func(rClient *rediscli.Client) error {
+		for _, param := range []string{"resolve-hostnames", "announce-hostnames"} {
+			cmd := rediscli.NewStatusCmd("SENTINEL", "CONFIG", "SET", param, "yes")
+			rClient.Process(cmd)
+			if err := cmd.Err(); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
+
+// GetSentinelConfig returns the global parameters of the given sentinel, as set by SENTINEL CONFIG SET
+func (c *client) GetSentinelConfig(ctx context.Context, ip string, auth *util.AuthConfig) (map[string]string, error) {
+	var val []interface{}
+	err := c.do(ctx, ip, sentinelPort, auth, func(rClient *rediscli.Client) error {
+		cmd := rediscli.NewSliceCmd("SENTINEL", "CONFIG", "GET", "*")
+		rClient.Process(cmd)
+		var err error
+		val, err = cmd.Result()
+		return err
+	})
+	if err != nil {
+		return nil, err
 	}
-	return nil
+
+	valMap := make(map[string]string)
+	for i := 0; i+1 < len(val); i += 2 {
+		name, _ := val[i].(string)
+		value, _ := val[i+1].(string)
+		valMap[name] = value
+	}
+	return valMap, nil
 }
 
-func (c *client) SetCustomRedisConfig(ip string, configs map[string]string, auth *util.AuthConfig) error {
-	options := c.setOptions(ip, redisPort, auth)
-	rClient := rediscli.NewClient(options)
-	defer rClient.Close()
+func (c *client) SetCustomSentinelConfig(ctx context.Context, ip string, configs []string, auth *util.AuthConfig) error {
+	return c.do(ctx, ip, sentinelPort, auth, func(rClient *rediscli.Client) error {
+		for _, config := range configs {
+			param, value, err := c.getConfigParameters(config)
+			if err != nil {
+				return err
+			}
+			if err := c.applySentinelConfig(param, value, rClient); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
 
-	for param, value := range configs {
-		//param, value, err := c.getConfigParameters(config)
-		//if err != nil {
-		//	return err
-		//}
-		if err := c.applyRedisConfig(param, value, rClient); err != nil {
-			return err
+// SetCustomRedisConfig sets the given configs, renamed to the keys preferred by the version of the redis
+func (c *client) SetCustomRedisConfig(ctx context.Context, ip string, configs map[string]string, v *version.ServerVersion, auth *util.AuthConfig) error {
+	return c.do(ctx, ip, redisPort, auth, func(rClient *rediscli.Client) error {
+		for param, value := range configs {
+			if err := c.applyRedisConfig(version.ConfigName(v, param), value, rClient); err != nil {
+				return err
+			}
 		}
-	}
-	return nil
+		return nil
+	})
 }
 
-func (c *client) GetAllRedisConfig(rClient *rediscli.Client) (map[string]string, error) {
-	result := rClient.ConfigGet("*")
-	if result.Err() != nil {
-		return nil, result.Err()
+func (c *client) GetAllRedisConfig(ctx context.Context, ip string, auth *util.AuthConfig) (map[string]string, error) {
+	var val []interface{}
+	err := c.do(ctx, ip, redisPort, auth, func(rClient *rediscli.Client) error {
+		var err error
+		val, err = rClient.ConfigGet("*").Result()
+		return err
+	})
+	if err != nil {
+		return nil, err
 	}
 
 	valMap := make(map[string]string)
-	val := result.Val()
 	for i := 0; i < len(val); i += 2 {
 		valMap[val[i].(string)] = val[i+1].(string)
 	}
+	// the configs are checked by the names of the spec, the renamed ones are reported by a single name
+	for key, value := range valMap {
+		for _, alias := range version.ConfigAliases(key) {
+			if _, ok := valMap[alias]; !ok {
+				valMap[alias] = value
+			}
+		}
+	}
 
 	return valMap, nil
 }
@@ -316,15 +646,3 @@ func (c *client) getConfigParameters(config string) (parameter string, value str
 	}
 	return s[0], strings.Join(s[1:], " "), nil
 }
-
-func (c *client) setOptions(ip, port string, auth *util.AuthConfig) *rediscli.Options {
-	passwd := auth.Password
-	if port == sentinelPort {
-		passwd = ""
-	}
-	return &rediscli.Options{
-		Addr:     net.JoinHostPort(ip, port),
-		Password: passwd,
-		DB:       0,
-	}
-}
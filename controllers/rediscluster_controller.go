@@ -0,0 +1,130 @@
+/*
+
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controllers
+
+import (
+	"context"
+
+	"github.com/go-logr/logr"
+	"k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/runtime"
+	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/controller"
+	"sigs.k8s.io/controller-runtime/pkg/manager"
+	"sigs.k8s.io/controller-runtime/pkg/reconcile"
+
+	redisv1 "redis-sentinel/api/v1"
+	"redis-sentinel/controllers/handle"
+	"redis-sentinel/controllers/redisclient"
+	"redis-sentinel/pkg/config"
+	"redis-sentinel/pkg/k8s"
+	"redis-sentinel/pkg/metrics"
+	"redis-sentinel/pkg/util"
+	"redis-sentinel/service"
+)
+
+// RedisClusterReconciler reconciles a sharded RedisCluster object
+type RedisClusterReconciler struct {
+	client.Client
+	Log     logr.Logger
+	Scheme  *runtime.Scheme
+	handler *handle.RedisClusterHandler
+	reconcilerBase
+}
+
+// NewRedisClusterReconciler creates the reconciler of the sharded clusters, it takes the same
+// settings as NewReconciler.
+func NewRedisClusterReconciler(mgr manager.Manager, cfg *config.Config) (RedisClusterReconciler, error) {
+	log := ctrl.Log.WithName("controllers").WithName("RedisCluster")
+	base, err := newReconcilerBase(mgr, cfg)
+	if err != nil {
+		return RedisClusterReconciler{}, err
+	}
+
+	k8sService := k8s.New(mgr.GetClient(), log)
+	redisClient := redisclient.New(cfg.Redis, log)
+	instrumenter := metrics.ClusterMetrics.ForKind(redisv1.ClusterKind)
+
+	handler := &handle.RedisClusterHandler{
+		K8sServices: k8sService,
+		Service:     service.NewShardedClusterKubeClient(k8sService, log),
+		Checker:     service.NewShardedClusterChecker(k8sService, redisClient, cfg.TopologyWorkers, log),
+		Healer:      service.NewShardedClusterHealer(k8sService, redisClient, instrumenter, log),
+		EventsCli:   k8s.NewEvent(mgr.GetEventRecorderFor("redis-operator"), log),
+		Metrics:     instrumenter,
+		Logger:      log,
+	}
+
+	return RedisClusterReconciler{Client: mgr.GetClient(),
+		Log:            log,
+		Scheme:         mgr.GetScheme(),
+		handler:        handler,
+		reconcilerBase: base}, nil
+}
+
+// +kubebuilder:rbac:groups=redis.xuan.io,resources=redisclusters,verbs=get;list;watch;create;update;patch;delete
+// +kubebuilder:rbac:groups=redis.xuan.io,resources=redisclusters/status,verbs=get;update;patch
+
+func (r *RedisClusterReconciler) Reconcile(req ctrl.Request) (ctrl.Result, error) {
+	ctx := context.Background()
+	reqLogger := r.Log.WithValues("namespace", req.Namespace, "name", req.Name, "reconcileID", util.NewReconcileID())
+	reqLogger.Info("begin Reconcile")
+
+	instance := &redisv1.RedisCluster{}
+	if err := r.Client.Get(ctx, req.NamespacedName, instance); err != nil {
+		if errors.IsNotFound(err) {
+			// The owned objects are garbage collected, only the metrics are left
+			reqLogger.Info("RedisCluster delete", "error", err)
+			r.handler.Metrics.DeleteCluster(req.Namespace, req.Name)
+			r.backoff.Reset(req.String())
+			return reconcile.Result{}, nil
+		}
+		reqLogger.Info("Get RedisCluster", "error", err)
+		return reconcile.Result{}, err
+	}
+	if !r.scope.Manages(instance) {
+		// another instance of the operator manages it now
+		reqLogger.V(2).Info("RedisCluster out of the scope of this operator")
+		r.backoff.Reset(req.String())
+		r.handler.Metrics.DeleteCluster(req.Namespace, req.Name)
+		return reconcile.Result{}, nil
+	}
+	if instance.DeletionTimestamp != nil {
+		return reconcile.Result{}, nil
+	}
+
+	doCtx, cancel := context.WithTimeout(r.baseCtx, r.reconcileTimeout)
+	defer cancel()
+	doCtx = util.WithLogger(doCtx, reqLogger)
+
+	if err := r.handler.Do(doCtx, instance); err != nil {
+		return requeueOnError(reqLogger, r.backoff, req.String(), err, r.resyncPeriod), nil
+	}
+	r.backoff.Reset(req.String())
+
+	reqLogger.Info("end Reconcile", "requeueAfter", r.resyncPeriod.String())
+	return reconcile.Result{RequeueAfter: r.resyncPeriod}, nil
+}
+
+func (r *RedisClusterReconciler) SetupWithManager(mgr ctrl.Manager) error {
+	return ctrl.NewControllerManagedBy(mgr).
+		For(&redisv1.RedisCluster{}).
+		WithEventFilter(r.scope.predicate()).
+		WithOptions(controller.Options{MaxConcurrentReconciles: r.maxConcurrentReconciles}).
+		Complete(r)
+}
@@ -0,0 +1,117 @@
+/*
+
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controllers
+
+import (
+	"context"
+
+	"github.com/go-logr/logr"
+	"k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/types"
+	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/controller"
+	"sigs.k8s.io/controller-runtime/pkg/reconcile"
+
+	redisv1 "redis-sentinel/api/v1"
+	"redis-sentinel/controllers/handle"
+	"redis-sentinel/pkg/util"
+)
+
+// RedisSentinelOperationReconciler runs the RedisSentinelOperation objects
+type RedisSentinelOperationReconciler struct {
+	client.Client
+	Log     logr.Logger
+	Scheme  *runtime.Scheme
+	handler *handle.RedisSentinelOperationHandler
+	reconcilerBase
+}
+
+// NewOperationReconciler creates the reconciler of the operations, it uses the services and the
+// cached passwords of the RedisSentinel reconciler so the operations see the clusters as it does
+func NewOperationReconciler(mgr ctrl.Manager, sentinels *RedisSentinelReconciler) RedisSentinelOperationReconciler {
+	log := ctrl.Log.WithName("controllers").WithName("RedisSentinelOperation")
+	handler := &handle.RedisSentinelOperationHandler{
+		K8sServices: sentinels.handler.K8sServices,
+		RsService:   sentinels.handler.RsService,
+		RsChecker:   sentinels.handler.RsChecker,
+		RsHealer:    sentinels.handler.RsHealer,
+		MetaCache:   sentinels.handler.MetaCache,
+		EventsCli:   sentinels.handler.EventsCli,
+		Logger:      log,
+	}
+	return RedisSentinelOperationReconciler{Client: mgr.GetClient(),
+		Log:            log,
+		Scheme:         mgr.GetScheme(),
+		handler:        handler,
+		reconcilerBase: sentinels.reconcilerBase.withBackoff()}
+}
+
+// +kubebuilder:rbac:groups=redis.xuan.io,resources=redissentineloperations,verbs=get;list;watch;create;update;patch;delete
+// +kubebuilder:rbac:groups=redis.xuan.io,resources=redissentineloperations/status,verbs=get;update;patch
+
+func (r *RedisSentinelOperationReconciler) Reconcile(req ctrl.Request) (ctrl.Result, error) {
+	ctx := context.Background()
+	reqLogger := r.Log.WithValues("namespace", req.Namespace, "name", req.Name, "reconcileID", util.NewReconcileID())
+
+	instance := &redisv1.RedisSentinelOperation{}
+	if err := r.Client.Get(ctx, req.NamespacedName, instance); err != nil {
+		if errors.IsNotFound(err) {
+			r.backoff.Reset(req.String())
+			return reconcile.Result{}, nil
+		}
+		reqLogger.Info("Get RedisSentinelOperation", "error", err)
+		return reconcile.Result{}, err
+	}
+	if instance.DeletionTimestamp != nil || instance.Status.Finished() {
+		return reconcile.Result{}, nil
+	}
+	if managed, err := r.manages(ctx, instance); err != nil || !managed {
+		return reconcile.Result{}, err
+	}
+
+	doCtx, cancel := context.WithTimeout(r.baseCtx, r.reconcileTimeout)
+	defer cancel()
+	doCtx = util.WithLogger(doCtx, reqLogger)
+
+	if err := r.handler.Do(doCtx, instance); err != nil {
+		return requeueOnError(reqLogger, r.backoff, req.String(), err, r.resyncPeriod), nil
+	}
+	r.backoff.Reset(req.String())
+	return reconcile.Result{}, nil
+}
+
+// manages is true when the operation runs on a cluster managed by this instance of the
+// operator, the operation itself decides when its cluster doesn't exist
+func (r *RedisSentinelOperationReconciler) manages(ctx context.Context, op *redisv1.RedisSentinelOperation) (bool, error) {
+	rs := &redisv1.RedisSentinel{}
+	if err := r.Client.Get(ctx, types.NamespacedName{Namespace: op.Namespace, Name: op.Spec.ClusterName}, rs); err != nil {
+		if errors.IsNotFound(err) {
+			return r.scope.Manages(op), nil
+		}
+		return false, err
+	}
+	return r.scope.Manages(rs), nil
+}
+
+func (r *RedisSentinelOperationReconciler) SetupWithManager(mgr ctrl.Manager) error {
+	return ctrl.NewControllerManagedBy(mgr).
+		For(&redisv1.RedisSentinelOperation{}).
+		WithOptions(controller.Options{MaxConcurrentReconciles: r.maxConcurrentReconciles}).
+		Complete(r)
+}
@@ -0,0 +1,42 @@
+package controllers
+
+import (
+	"time"
+
+	"github.com/go-logr/logr"
+	ctrl "sigs.k8s.io/controller-runtime"
+
+	"redis-sentinel/pkg/util"
+)
+
+// requeuePolicy is how the errors of a kind are retried, the delay doubles with every
+// consecutive error of the same kind of an object, from base up to max
+type requeuePolicy struct {
+	base, max time.Duration
+}
+
+var requeuePolicies = map[util.ErrorKind]requeuePolicy{
+	util.KindTransient:      {base: 5 * time.Second, max: 5 * time.Minute},
+	util.KindWaitingForPods: {base: 5 * time.Second, max: 20 * time.Second},
+	util.KindNeedsHuman:     {base: time.Minute, max: 30 * time.Minute},
+}
+
+// requeueOnError returns the result of a reconcile of key that failed with err. The error is
+// not given back to controller-runtime, its own backoff would retry it on top of the policy.
+// An invalid spec is only checked again after resync, changing it reconciles at once
+func requeueOnError(logger logr.Logger, backoff *util.Backoff, key string, err error, resync time.Duration) ctrl.Result {
+	kind := util.KindOf(err)
+	policy, ok := requeuePolicies[kind]
+	if !ok {
+		backoff.Reset(key)
+		logger.Info("invalid spec, waiting for it to change", "error", err.Error())
+		return ctrl.Result{RequeueAfter: resync}
+	}
+	delay := backoff.Next(key, string(kind), policy.base, policy.max)
+	if kind == util.KindWaitingForPods {
+		logger.Info("handler Do", "msg", err.Error(), "requeueAfter", delay.String())
+	} else {
+		logger.Error(err, "Reconcile handler", "kind", string(kind), "requeueAfter", delay.String())
+	}
+	return ctrl.Result{RequeueAfter: delay}
+}
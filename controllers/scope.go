@@ -0,0 +1,59 @@
+package controllers
+
+import (
+	"fmt"
+
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/labels"
+	"sigs.k8s.io/controller-runtime/pkg/event"
+	"sigs.k8s.io/controller-runtime/pkg/predicate"
+
+	"redis-sentinel/pkg/util"
+)
+
+// Scope selects the objects an operator instance manages among the ones it watches, several
+// instances split the clusters between them with disjoint label selectors
+type Scope struct {
+	// Selector is matched against the labels of the objects, nil matches all of them
+	Selector labels.Selector
+}
+
+// NewScope parses the label selector of the instance, an empty selector manages every object
+func NewScope(selector string) (Scope, error) {
+	if selector == "" {
+		return Scope{}, nil
+	}
+	parsed, err := labels.Parse(selector)
+	if err != nil {
+		return Scope{}, fmt.Errorf("instance selector %q: %v", selector, err)
+	}
+	return Scope{Selector: parsed}, nil
+}
+
+// Manages is true when the instance manages obj. A namespace scoped instance leaves the objects
+// annotated cluster scoped to the operators watching all the namespaces
+func (s Scope) Manages(obj metav1.Object) bool {
+	if !util.IsClusterScoped() && obj.GetAnnotations()[util.AnnotationScope] == util.AnnotationClusterScoped {
+		return false
+	}
+	return s.Selector == nil || s.Selector.Matches(labels.Set(obj.GetLabels()))
+}
+
+// predicate drops the events of the objects the instance doesn't manage, an object leaving the
+// scope is forgotten when its next periodic reconcile finds it
+func (s Scope) predicate() predicate.Predicate {
+	return predicate.Funcs{
+		CreateFunc: func(e event.CreateEvent) bool {
+			return s.Manages(e.Meta)
+		},
+		UpdateFunc: func(e event.UpdateEvent) bool {
+			return s.Manages(e.MetaNew)
+		},
+		DeleteFunc: func(e event.DeleteEvent) bool {
+			return s.Manages(e.Meta)
+		},
+		GenericFunc: func(e event.GenericEvent) bool {
+			return s.Manages(e.Meta)
+		},
+	}
+}
@@ -17,13 +17,18 @@ limitations under the License.
 package main
 
 import (
-	"flag"
+	"fmt"
+	"github.com/spf13/pflag"
+	uzap "go.uber.org/zap"
 	"k8s.io/apimachinery/pkg/runtime"
 	clientgoscheme "k8s.io/client-go/kubernetes/scheme"
 	_ "k8s.io/client-go/plugin/pkg/client/auth/gcp"
 	"os"
+	"redis-sentinel/pkg/config"
 	"redis-sentinel/pkg/metrics"
+	"redis-sentinel/pkg/util"
 	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/cache"
 	"sigs.k8s.io/controller-runtime/pkg/log/zap"
 	sigsMetrics "sigs.k8s.io/controller-runtime/pkg/metrics"
 
@@ -45,30 +50,44 @@ func init() {
 }
 
 var (
-	metricsHost               = "0.0.0.0"
-	metricsPort         int32 = 8383
-	operatorMetricsPort int32 = 8686
-	metricsNamespace          = "redis_operator"
+	metricsNamespace = "redis_operator"
 )
 
 func main() {
-	var metricsAddr string
-	var enableLeaderElection bool
-	flag.StringVar(&metricsAddr, "metrics-addr", ":8080", "The address the metric endpoint binds to.")
-	flag.BoolVar(&enableLeaderElection, "enable-leader-election", false,
-		"Enable leader election for controller manager. "+
-			"Enabling this will ensure there is only one active controller manager.")
-	flag.Parse()
-
-	ctrl.SetLogger(zap.New(zap.UseDevMode(true)))
-
-	mgr, err := ctrl.NewManager(ctrl.GetConfigOrDie(), ctrl.Options{
-		Scheme:             scheme,
-		MetricsBindAddress: metricsAddr,
-		Port:               9443,
-		LeaderElection:     enableLeaderElection,
-		LeaderElectionID:   "c793cb2f.xuan.io",
-	})
+	cfg, err := config.Load(os.Args[1:], os.LookupEnv)
+	if err == pflag.ErrHelp {
+		os.Exit(0)
+	}
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "invalid configuration: %v\n", err)
+		os.Exit(1)
+	}
+
+	level, _ := cfg.Level()
+	atomicLevel := uzap.NewAtomicLevelAt(level)
+	ctrl.SetLogger(zap.New(zap.UseDevMode(cfg.LogFormat == config.LogFormatConsole), zap.Level(&atomicLevel)))
+
+	util.SetClusterScoped(cfg.WatchNamespaces)
+	util.SetClusterDomain(cfg.ClusterDomain)
+	redisv1.SetDefaultImages(cfg.RedisImage, cfg.SentinelImage)
+
+	options := ctrl.Options{
+		Scheme:                  scheme,
+		MetricsBindAddress:      cfg.MetricsAddr,
+		Port:                    9443,
+		LeaderElection:          cfg.LeaderElection,
+		LeaderElectionNamespace: cfg.LeaderElectionNamespace,
+		LeaderElectionID:        cfg.LeaderElectionID,
+	}
+	switch len(cfg.WatchNamespaces) {
+	case 0:
+	case 1:
+		options.Namespace = cfg.WatchNamespaces[0]
+	default:
+		options.NewCache = cache.MultiNamespacedCacheBuilder(cfg.WatchNamespaces)
+	}
+	setupLog.Info("starting with", "config", cfg)
+	mgr, err := ctrl.NewManager(ctrl.GetConfigOrDie(), options)
 	if err != nil {
 		setupLog.Error(err, "unable to start manager")
 		os.Exit(1)
@@ -77,11 +96,29 @@ func main() {
 	// Regist
 	metrics.InitPrometheusMetrics(metricsNamespace, sigsMetrics.Registry)
 
-	rsReconciler := controllers.NewReconciler(mgr)
+	rsReconciler, err := controllers.NewReconciler(mgr, cfg)
+	if err != nil {
+		setupLog.Error(err, "unable to create controller", "controller", "RedisSentinel")
+		os.Exit(1)
+	}
 	if err = (&rsReconciler).SetupWithManager(mgr); err != nil {
 		setupLog.Error(err, "unable to create controller", "controller", "RedisSentinel")
 		os.Exit(1)
 	}
+	opReconciler := controllers.NewOperationReconciler(mgr, &rsReconciler)
+	if err = (&opReconciler).SetupWithManager(mgr); err != nil {
+		setupLog.Error(err, "unable to create controller", "controller", "RedisSentinelOperation")
+		os.Exit(1)
+	}
+	rcReconciler, err := controllers.NewRedisClusterReconciler(mgr, cfg)
+	if err != nil {
+		setupLog.Error(err, "unable to create controller", "controller", "RedisCluster")
+		os.Exit(1)
+	}
+	if err = (&rcReconciler).SetupWithManager(mgr); err != nil {
+		setupLog.Error(err, "unable to create controller", "controller", "RedisCluster")
+		os.Exit(1)
+	}
 	// +kubebuilder:scaffold:builder
 
 	setupLog.Info("starting manager")
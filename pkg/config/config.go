@@ -0,0 +1,283 @@
+package config
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"hash/fnv"
+	"io/ioutil"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/spf13/pflag"
+	"go.uber.org/zap/zapcore"
+	"k8s.io/apimachinery/pkg/labels"
+	"k8s.io/apimachinery/pkg/util/yaml"
+
+	rsv1 "redis-sentinel/api/v1"
+	"redis-sentinel/controllers/redisclient"
+)
+
+const (
+	// EnvPrefix prefixes the environment variables of the options, REDIS_OPERATOR_LOG_LEVEL sets
+	// --log-level
+	EnvPrefix = "REDIS_OPERATOR_"
+
+	defaultLeaderElectionID = "c793cb2f.xuan.io"
+	defaultClusterDomain    = "cluster.local"
+
+	// LogFormatJSON logs a JSON object per line, LogFormatConsole logs human readable lines
+	LogFormatJSON    = "json"
+	LogFormatConsole = "console"
+)
+
+// Config is the configuration of the operator. Every option is set by its flag, by its
+// environment variable or by the config file, in that order of precedence
+type Config struct {
+	// File is the YAML config file, its keys are the names of the flags
+	File string
+
+	MetricsAddr string
+
+	LeaderElection bool
+	// LeaderElectionNamespace holds the lock, the namespace of the operator when it runs in the cluster
+	LeaderElectionNamespace string
+	// LeaderElectionID names the lock, the instances watching different clusters get their own by default
+	LeaderElectionID string
+
+	// MaxConcurrentReconciles is the number of objects of each kind reconciled at the same time
+	MaxConcurrentReconciles int
+	// ResyncPeriod is the delay between the reconciles of a healthy cluster
+	ResyncPeriod time.Duration
+	// ReconcileTimeout bounds the time a single reconcile can spend talking to redis
+	ReconcileTimeout time.Duration
+	// TopologyWorkers is the maximum number of redis and sentinel queried at the same time
+	TopologyWorkers int
+	Redis           redisclient.Config
+
+	// RedisImage and SentinelImage are run by the clusters not setting their image
+	RedisImage    string
+	SentinelImage string
+
+	// LogLevel is debug, info, error or the verbosity of the debug logs as a number
+	LogLevel string
+	// LogFormat is json or console
+	LogFormat string
+
+	// ClusterDomain is the DNS domain of the kubernetes cluster, the hostnames given to redis and
+	// sentinel end with it
+	ClusterDomain string
+
+	// WatchNamespaces are the namespaces watched, all of them when empty
+	WatchNamespaces []string
+	// InstanceSelector selects the clusters managed by this instance of the operator
+	InstanceSelector string
+}
+
+// Default returns the configuration used when no option is set
+func Default() *Config {
+	return &Config{
+		MetricsAddr:             ":8080",
+		MaxConcurrentReconciles: 4,
+		ResyncPeriod:            time.Minute,
+		ReconcileTimeout:        2 * time.Minute,
+		TopologyWorkers:         8,
+		Redis:                   redisclient.DefaultConfig(),
+		RedisImage:              rsv1.DefaultImage,
+		SentinelImage:           rsv1.DefaultImage,
+		LogLevel:                "info",
+		LogFormat:               LogFormatJSON,
+		ClusterDomain:           defaultClusterDomain,
+	}
+}
+
+func (c *Config) bindFlags(fs *pflag.FlagSet) {
+	fs.StringVar(&c.File, "config", c.File, "YAML file setting the options by their flag name, the flags and the environment override it.")
+	fs.StringVar(&c.MetricsAddr, "metrics-addr", c.MetricsAddr, "The address the metric endpoint binds to.")
+	fs.BoolVar(&c.LeaderElection, "enable-leader-election", c.LeaderElection,
+		"Enable leader election for controller manager. "+
+			"Enabling this will ensure there is only one active controller manager.")
+	fs.StringVar(&c.LeaderElectionNamespace, "leader-election-namespace", c.LeaderElectionNamespace, "Namespace of the leader election lock, the namespace of the operator by default.")
+	fs.StringVar(&c.LeaderElectionID, "leader-election-id", c.LeaderElectionID, "Name of the leader election lock, derived from the watched namespaces and the instance selector by default.")
+	fs.IntVar(&c.MaxConcurrentReconciles, "max-concurrent-reconciles", c.MaxConcurrentReconciles, "Maximum number of objects of each kind reconciled at the same time.")
+	fs.DurationVar(&c.ResyncPeriod, "resync-period", c.ResyncPeriod, "Delay between the reconciles of a healthy cluster.")
+	fs.DurationVar(&c.ReconcileTimeout, "reconcile-timeout", c.ReconcileTimeout, "Maximum time a reconcile can spend checking and healing a cluster.")
+	fs.IntVar(&c.TopologyWorkers, "topology-workers", c.TopologyWorkers, "Maximum number of redis and sentinel queried at the same time during a reconcile.")
+	fs.DurationVar(&c.Redis.DialTimeout, "redis-dial-timeout", c.Redis.DialTimeout, "Timeout to connect to redis and sentinel.")
+	fs.DurationVar(&c.Redis.ReadTimeout, "redis-read-timeout", c.Redis.ReadTimeout, "Timeout to read a reply from redis and sentinel.")
+	fs.DurationVar(&c.Redis.WriteTimeout, "redis-write-timeout", c.Redis.WriteTimeout, "Timeout to send a command to redis and sentinel.")
+	fs.DurationVar(&c.Redis.IdleTimeout, "redis-idle-timeout", c.Redis.IdleTimeout, "Idle connections to redis and sentinel are closed after this time.")
+	fs.IntVar(&c.Redis.PoolSize, "redis-pool-size", c.Redis.PoolSize, "Maximum number of connections kept per redis or sentinel.")
+	fs.StringVar(&c.RedisImage, "redis-image", c.RedisImage, "Image of the redis of the clusters not setting it.")
+	fs.StringVar(&c.SentinelImage, "sentinel-image", c.SentinelImage, "Image of the sentinels of the clusters not setting it.")
+	fs.StringVar(&c.LogLevel, "log-level", c.LogLevel, "Log level: debug, info, error or the verbosity of the debug logs as a number.")
+	fs.StringVar(&c.LogFormat, "log-format", c.LogFormat, "Log format: json or console.")
+	fs.StringVar(&c.ClusterDomain, "cluster-domain", c.ClusterDomain, "DNS domain of the kubernetes cluster, used in the hostnames given to redis and sentinel.")
+	fs.StringSliceVar(&c.WatchNamespaces, "watch-namespaces", c.WatchNamespaces, "Comma separated namespaces watched by the operator, all of them when empty. "+
+		"The operator only needs the permissions of a Role in each of them when they are given.")
+	fs.StringVar(&c.InstanceSelector, "instance-selector", c.InstanceSelector, "Label selector of the clusters managed by this instance of the operator, "+
+		"several instances split the clusters with disjoint selectors.")
+}
+
+// Load reads the configuration from the command line arguments, the environment variables
+// found by lookupEnv and the config file, then validates it
+func Load(args []string, lookupEnv func(string) (string, bool)) (*Config, error) {
+	c := Default()
+	fs := pflag.NewFlagSet("redis-operator", pflag.ContinueOnError)
+	c.bindFlags(fs)
+	if err := fs.Parse(args); err != nil {
+		return nil, err
+	}
+
+	// every option is set once, by the source of highest precedence
+	set := map[string]bool{}
+	fs.Visit(func(f *pflag.Flag) { set[f.Name] = true })
+	var err error
+	fs.VisitAll(func(f *pflag.Flag) {
+		value, ok := lookupEnv(EnvName(f.Name))
+		if err != nil || set[f.Name] || !ok {
+			return
+		}
+		if err = fs.Set(f.Name, value); err != nil {
+			err = fmt.Errorf("%s: %v", EnvName(f.Name), err)
+		}
+		set[f.Name] = true
+	})
+	if err != nil {
+		return nil, err
+	}
+	if c.File != "" {
+		if err := c.loadFile(fs, set); err != nil {
+			return nil, err
+		}
+	}
+
+	// "a, b" watches a and b
+	for i, namespace := range c.WatchNamespaces {
+		c.WatchNamespaces[i] = strings.TrimSpace(namespace)
+	}
+	if c.LeaderElectionID == "" {
+		c.LeaderElectionID = instanceLeaderElectionID(c.WatchNamespaces, c.InstanceSelector)
+	}
+	return c, c.Validate()
+}
+
+// EnvName returns the environment variable of a flag
+func EnvName(flag string) string {
+	return EnvPrefix + strings.ToUpper(strings.Replace(flag, "-", "_", -1))
+}
+
+// loadFile sets the options of the config file not set already
+func (c *Config) loadFile(fs *pflag.FlagSet, set map[string]bool) error {
+	data, err := ioutil.ReadFile(c.File)
+	if err != nil {
+		return fmt.Errorf("config file: %v", err)
+	}
+	if data, err = yaml.ToJSON(data); err != nil {
+		return fmt.Errorf("config file %s: %v", c.File, err)
+	}
+	values := map[string]interface{}{}
+	if err := json.Unmarshal(data, &values); err != nil {
+		return fmt.Errorf("config file %s: %v", c.File, err)
+	}
+	for name, value := range values {
+		if fs.Lookup(name) == nil || name == "config" {
+			return fmt.Errorf("config file %s: unknown option %s", c.File, name)
+		}
+		if set[name] {
+			continue
+		}
+		if err := fs.Set(name, fileValue(value)); err != nil {
+			return fmt.Errorf("config file %s: %s: %v", c.File, name, err)
+		}
+	}
+	return nil
+}
+
+// fileValue returns the value of the config file as given on the command line
+func fileValue(value interface{}) string {
+	switch v := value.(type) {
+	case []interface{}:
+		items := make([]string, len(v))
+		for i, item := range v {
+			items[i] = fileValue(item)
+		}
+		return strings.Join(items, ",")
+	case float64:
+		return strconv.FormatFloat(v, 'f', -1, 64)
+	case nil:
+		return ""
+	default:
+		return fmt.Sprint(v)
+	}
+}
+
+// Validate checks the options are usable
+func (c *Config) Validate() error {
+	if c.MaxConcurrentReconciles < 1 {
+		return errors.New("max-concurrent-reconciles must be at least 1")
+	}
+	if c.ResyncPeriod < time.Second {
+		return errors.New("resync-period must be at least 1s")
+	}
+	if c.ReconcileTimeout <= 0 {
+		return errors.New("reconcile-timeout must be positive")
+	}
+	if c.TopologyWorkers < 1 {
+		return errors.New("topology-workers must be at least 1")
+	}
+	if c.Redis.DialTimeout <= 0 || c.Redis.ReadTimeout <= 0 || c.Redis.WriteTimeout <= 0 || c.Redis.IdleTimeout <= 0 {
+		return errors.New("the redis timeouts must be positive")
+	}
+	if c.Redis.PoolSize < 1 {
+		return errors.New("redis-pool-size must be at least 1")
+	}
+	if c.RedisImage == "" || c.SentinelImage == "" {
+		return errors.New("redis-image and sentinel-image can't be empty")
+	}
+	if _, err := c.Level(); err != nil {
+		return err
+	}
+	if c.LogFormat != LogFormatJSON && c.LogFormat != LogFormatConsole {
+		return fmt.Errorf("log-format %q must be %s or %s", c.LogFormat, LogFormatJSON, LogFormatConsole)
+	}
+	if c.ClusterDomain == "" {
+		return errors.New("cluster-domain can't be empty")
+	}
+	for _, namespace := range c.WatchNamespaces {
+		if strings.TrimSpace(namespace) == "" {
+			return errors.New("watch-namespaces can't have an empty namespace")
+		}
+	}
+	if _, err := labels.Parse(c.InstanceSelector); err != nil {
+		return fmt.Errorf("instance-selector %q: %v", c.InstanceSelector, err)
+	}
+	return nil
+}
+
+// Level returns the zap level of LogLevel, the verbosity n of the debug logs is the level -n
+func (c *Config) Level() (zapcore.Level, error) {
+	if n, err := strconv.Atoi(c.LogLevel); err == nil {
+		if n < 0 {
+			return 0, fmt.Errorf("log-level %d must be positive", n)
+		}
+		return zapcore.Level(-n), nil
+	}
+	var level zapcore.Level
+	if err := level.UnmarshalText([]byte(c.LogLevel)); err != nil {
+		return 0, fmt.Errorf("log-level %q: %v", c.LogLevel, err)
+	}
+	return level, nil
+}
+
+// instanceLeaderElectionID returns the leader election ID of the instances watching the same
+// clusters, the default one when the instance watches all of them
+func instanceLeaderElectionID(namespaces []string, selector string) string {
+	if len(namespaces) == 0 && selector == "" {
+		return defaultLeaderElectionID
+	}
+	h := fnv.New32a()
+	h.Write([]byte(strings.Join(namespaces, ",") + "/" + selector))
+	return fmt.Sprintf("%x.%s", h.Sum32(), defaultLeaderElectionID)
+}
@@ -0,0 +1,151 @@
+package config
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestLoad(t *testing.T) {
+	dir, err := ioutil.TempDir("", "config")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	file := filepath.Join(dir, "config.yaml")
+	content := "resync-period: 30s\nmax-concurrent-reconciles: 8\nwatch-namespaces:\n- a\n- b\nlog-level: debug\n"
+	if err := ioutil.WriteFile(file, []byte(content), 0600); err != nil {
+		t.Fatal(err)
+	}
+	unknown := filepath.Join(dir, "unknown.yaml")
+	if err := ioutil.WriteFile(unknown, []byte("resync: 30s\n"), 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name    string
+		args    []string
+		env     map[string]string
+		check   func(*Config) interface{}
+		want    interface{}
+		wantErr bool
+	}{
+		{
+			name:  "defaults",
+			check: func(c *Config) interface{} { return c.ResyncPeriod },
+			want:  time.Minute,
+		},
+		{
+			name:  "default leader election ID",
+			check: func(c *Config) interface{} { return c.LeaderElectionID },
+			want:  defaultLeaderElectionID,
+		},
+		{
+			name:  "file",
+			args:  []string{"--config", file},
+			check: func(c *Config) interface{} { return c.WatchNamespaces },
+			want:  []string{"a", "b"},
+		},
+		{
+			name:  "namespaces trimmed",
+			args:  []string{"--watch-namespaces=a, b"},
+			check: func(c *Config) interface{} { return c.WatchNamespaces },
+			want:  []string{"a", "b"},
+		},
+		{
+			name:  "env overrides the file",
+			args:  []string{"--config", file},
+			env:   map[string]string{"REDIS_OPERATOR_RESYNC_PERIOD": "10s"},
+			check: func(c *Config) interface{} { return c.ResyncPeriod },
+			want:  10 * time.Second,
+		},
+		{
+			name:  "flag overrides the env",
+			args:  []string{"--config", file, "--max-concurrent-reconciles=2"},
+			env:   map[string]string{"REDIS_OPERATOR_MAX_CONCURRENT_RECONCILES": "6"},
+			check: func(c *Config) interface{} { return c.MaxConcurrentReconciles },
+			want:  2,
+		},
+		{
+			name:  "config file from the env",
+			env:   map[string]string{"REDIS_OPERATOR_CONFIG": file},
+			check: func(c *Config) interface{} { return c.MaxConcurrentReconciles },
+			want:  8,
+		},
+		{
+			name:  "verbosity",
+			args:  []string{"--log-level=3"},
+			check: func(c *Config) interface{} { l, _ := c.Level(); return int8(l) },
+			want:  int8(-3),
+		},
+		{
+			name:  "log format from the env",
+			env:   map[string]string{"REDIS_OPERATOR_LOG_FORMAT": "console"},
+			check: func(c *Config) interface{} { return c.LogFormat },
+			want:  LogFormatConsole,
+		},
+		{
+			name:  "cluster domain",
+			args:  []string{"--cluster-domain=k8s.internal"},
+			check: func(c *Config) interface{} { return c.ClusterDomain },
+			want:  "k8s.internal",
+		},
+		{
+			name:    "unknown option in the file",
+			args:    []string{"--config", unknown},
+			wantErr: true,
+		},
+		{
+			name:    "malformed env",
+			env:     map[string]string{"REDIS_OPERATOR_TOPOLOGY_WORKERS": "many"},
+			wantErr: true,
+		},
+		{
+			name:    "invalid concurrency",
+			args:    []string{"--max-concurrent-reconciles=0"},
+			wantErr: true,
+		},
+		{
+			name:    "invalid log level",
+			args:    []string{"--log-level=loud"},
+			wantErr: true,
+		},
+		{
+			name:    "invalid log format",
+			args:    []string{"--log-format=xml"},
+			wantErr: true,
+		},
+		{
+			name:    "empty cluster domain",
+			args:    []string{"--cluster-domain="},
+			wantErr: true,
+		},
+		{
+			name:    "invalid selector",
+			args:    []string{"--instance-selector=shard in (a"},
+			wantErr: true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			lookupEnv := func(name string) (string, bool) {
+				value, ok := tt.env[name]
+				return value, ok
+			}
+			got, err := Load(tt.args, lookupEnv)
+			if (err != nil) != tt.wantErr {
+				t.Errorf("Load() error = %v, wantErr %v", err, tt.wantErr)
+				return
+			}
+			if tt.wantErr {
+				return
+			}
+			if value := tt.check(got); !reflect.DeepEqual(value, tt.want) {
+				t.Errorf("Load() got = %v, want %v", value, tt.want)
+			}
+		})
+	}
+}
@@ -14,6 +14,8 @@ type Event interface {
 	NewSlaveAdd(object runtime.Object, message string)
 	// SlaveRemove event ClusterScalingDown
 	SlaveRemove(object runtime.Object, message string)
+	// ShardsRemoved event the drained shards of a RedisCluster were deleted
+	ShardsRemoved(object runtime.Object, message string)
 	// CreateCluster event ClusterCreating
 	CreateCluster(object runtime.Object)
 	// UpdateCluster event ClusterUpdating
@@ -28,6 +30,22 @@ type Event interface {
 	FailedCluster(object runtime.Object, message string)
 	// HealthCluster event ClusterHealthy
 	HealthCluster(object runtime.Object)
+	// MaxmemoryExceedsLimit event MaxmemoryExceedsLimit
+	MaxmemoryExceedsLimit(object runtime.Object, message string)
+	// SentinelsNotSpread event SentinelsNotSpread
+	SentinelsNotSpread(object runtime.Object, message string)
+	// DeleteCluster event ClusterTerminating
+	DeleteCluster(object runtime.Object, message string)
+	// DeletionBlocked event the deletion of the cluster waits for its final snapshot
+	DeletionBlocked(object runtime.Object, message string)
+	// MasterFailover event the master is moved off a node being drained
+	MasterFailover(object runtime.Object, message string)
+	// OperationStarted event a RedisSentinelOperation runs
+	OperationStarted(object runtime.Object, message string)
+	// OperationSucceeded event a RedisSentinelOperation succeeded
+	OperationSucceeded(object runtime.Object, message string)
+	// OperationFailed event a RedisSentinelOperation failed
+	OperationFailed(object runtime.Object, message string)
 }
 
 // EventOption is the Event client interface implementation that using API calls to kubernetes.
@@ -46,27 +64,32 @@ func NewEvent(eventCli record.EventRecorder, logger logr.Logger) Event {
 
 // NewSlaveAdd implement the Event.Interface
 func (e *EventOption) NewSlaveAdd(object runtime.Object, message string) {
-	e.eventsCli.Event(object, v1.EventTypeNormal, string(rsv1.ClusterConditionScaling), message)
+	e.eventsCli.Event(object, v1.EventTypeNormal, string(rsv1.PhaseScaling), message)
 }
 
 // SlaveRemove implement the Event.Interface
 func (e *EventOption) SlaveRemove(object runtime.Object, message string) {
-	e.eventsCli.Event(object, v1.EventTypeNormal, string(rsv1.ClusterConditionScalingDown), message)
+	e.eventsCli.Event(object, v1.EventTypeNormal, string(rsv1.PhaseScalingDown), message)
+}
+
+// ShardsRemoved implement the Event.Interface
+func (e *EventOption) ShardsRemoved(object runtime.Object, message string) {
+	e.eventsCli.Event(object, v1.EventTypeNormal, "ShardsRemoved", message)
 }
 
 // CreateCluster implement the Event.Interface
 func (e *EventOption) CreateCluster(object runtime.Object) {
-	e.eventsCli.Event(object, v1.EventTypeNormal, string(rsv1.ClusterConditionCreating), "Bootstrap redis cluster")
+	e.eventsCli.Event(object, v1.EventTypeNormal, string(rsv1.PhaseCreating), "Bootstrap redis cluster")
 }
 
 // UpdateCluster implement the Event.Interface
 func (e *EventOption) UpdateCluster(object runtime.Object, message string) {
-	e.eventsCli.Event(object, v1.EventTypeNormal, string(rsv1.ClusterConditionUpdating), message)
+	e.eventsCli.Event(object, v1.EventTypeNormal, string(rsv1.PhaseUpdating), message)
 }
 
 // UpgradedCluster implement the Event.Interface
 func (e *EventOption) UpgradedCluster(object runtime.Object, message string) {
-	e.eventsCli.Event(object, v1.EventTypeNormal, string(rsv1.ClusterConditionUpgrading), message)
+	e.eventsCli.Event(object, v1.EventTypeNormal, string(rsv1.PhaseUpgrading), message)
 }
 
 // EnsureCluster implement the Event.Interface
@@ -81,10 +104,50 @@ func (e *EventOption) CheckCluster(object runtime.Object) {
 
 // FailedCluster implement the Event.Interface
 func (e *EventOption) FailedCluster(object runtime.Object, message string) {
-	e.eventsCli.Event(object, v1.EventTypeWarning, string(rsv1.ClusterConditionFailed), message)
+	e.eventsCli.Event(object, v1.EventTypeWarning, string(rsv1.PhaseFailed), message)
 }
 
 // HealthCluster implement the Event.Interface
 func (e *EventOption) HealthCluster(object runtime.Object) {
-	e.eventsCli.Event(object, v1.EventTypeNormal, string(rsv1.ClusterConditionHealthy), "Redis cluster is healthy")
+	e.eventsCli.Event(object, v1.EventTypeNormal, string(rsv1.ConditionReady), "Redis cluster is healthy")
+}
+
+// DeleteCluster implement the Event.Interface
+func (e *EventOption) DeleteCluster(object runtime.Object, message string) {
+	e.eventsCli.Event(object, v1.EventTypeNormal, string(rsv1.PhaseTerminating), message)
+}
+
+// DeletionBlocked implement the Event.Interface
+func (e *EventOption) DeletionBlocked(object runtime.Object, message string) {
+	e.eventsCli.Event(object, v1.EventTypeWarning, "DeletionBlocked", message)
+}
+
+// MaxmemoryExceedsLimit implement the Event.Interface
+func (e *EventOption) MaxmemoryExceedsLimit(object runtime.Object, message string) {
+	e.eventsCli.Event(object, v1.EventTypeWarning, "MaxmemoryExceedsLimit", message)
+}
+
+// SentinelsNotSpread implement the Event.Interface
+func (e *EventOption) SentinelsNotSpread(object runtime.Object, message string) {
+	e.eventsCli.Event(object, v1.EventTypeWarning, "SentinelsNotSpread", message)
+}
+
+// MasterFailover implement the Event.Interface
+func (e *EventOption) MasterFailover(object runtime.Object, message string) {
+	e.eventsCli.Event(object, v1.EventTypeNormal, string(rsv1.PhaseFailingOver), message)
+}
+
+// OperationStarted implement the Event.Interface
+func (e *EventOption) OperationStarted(object runtime.Object, message string) {
+	e.eventsCli.Event(object, v1.EventTypeNormal, "OperationStarted", message)
+}
+
+// OperationSucceeded implement the Event.Interface
+func (e *EventOption) OperationSucceeded(object runtime.Object, message string) {
+	e.eventsCli.Event(object, v1.EventTypeNormal, "OperationSucceeded", message)
+}
+
+// OperationFailed implement the Event.Interface
+func (e *EventOption) OperationFailed(object runtime.Object, message string) {
+	e.eventsCli.Event(object, v1.EventTypeWarning, "OperationFailed", message)
 }
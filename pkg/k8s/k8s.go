@@ -15,6 +15,13 @@ type Services interface {
 	Deployment
 	StatefulSet
 	Cluster
+	ServiceMonitor
+	PrometheusRule
+	PersistentVolumeClaim
+	StorageClass
+	Node
+	Secret
+	Operation
 }
 
 type services struct {
@@ -26,18 +33,32 @@ type services struct {
 	Deployment
 	StatefulSet
 	Cluster
+	ServiceMonitor
+	PrometheusRule
+	PersistentVolumeClaim
+	StorageClass
+	Node
+	Secret
+	Operation
 }
 
 // New returns a new Kubernetes client set.
 func New(kubecli client.Client, logger logr.Logger) Services {
 	return &services{
-		ConfigMap:           NewConfigMap(kubecli, logger),
-		Pod:                 NewPod(kubecli, logger),
-		PodDisruptionBudget: NewPodDisruptionBudget(kubecli, logger),
-		Service:             NewService(kubecli, logger),
-		NameSpaces:          NewNameSpaces(logger),
-		Deployment:          NewDeployment(kubecli, logger),
-		StatefulSet:         NewStatefulSet(kubecli, logger),
-		Cluster:             NewCluster(kubecli, logger),
+		ConfigMap:             NewConfigMap(kubecli, logger),
+		Pod:                   NewPod(kubecli, logger),
+		PodDisruptionBudget:   NewPodDisruptionBudget(kubecli, logger),
+		Service:               NewService(kubecli, logger),
+		NameSpaces:            NewNameSpaces(kubecli, logger),
+		Deployment:            NewDeployment(kubecli, logger),
+		StatefulSet:           NewStatefulSet(kubecli, logger),
+		Cluster:               NewCluster(kubecli, logger),
+		ServiceMonitor:        NewServiceMonitor(kubecli, logger),
+		PrometheusRule:        NewPrometheusRule(kubecli, logger),
+		PersistentVolumeClaim: NewPersistentVolumeClaim(kubecli, logger),
+		StorageClass:          NewStorageClass(kubecli, logger),
+		Node:                  NewNode(kubecli, logger),
+		Secret:                NewSecret(kubecli, logger),
+		Operation:             NewOperation(kubecli, logger),
 	}
 }
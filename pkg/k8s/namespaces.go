@@ -4,7 +4,6 @@ import (
 	"context"
 	corev1 "k8s.io/api/core/v1"
 	"k8s.io/apimachinery/pkg/types"
-	"sigs.k8s.io/controller-runtime/pkg/client/config"
 
 	"sigs.k8s.io/controller-runtime/pkg/client"
 
@@ -24,16 +23,8 @@ type NameSpacesOption struct {
 }
 
 // NewNameSpaces returns a new NameSpaces client.
-func NewNameSpaces(logger logr.Logger) NameSpaces {
+func NewNameSpaces(kubeClient client.Client, logger logr.Logger) NameSpaces {
 	logger = logger.WithValues("service", "k8s.namespaces")
-	cfg, err := config.GetConfig()
-	if err != nil {
-		panic(err)
-	}
-	kubeClient, err := client.New(cfg, client.Options{})
-	if err != nil {
-		panic(err)
-	}
 	return &NameSpacesOption{
 		client: kubeClient,
 		logger: logger,
@@ -44,8 +35,7 @@ func NewNameSpaces(logger logr.Logger) NameSpaces {
 func (n *NameSpacesOption) GetNameSpace(namespace string) (*corev1.Namespace, error) {
 	nm := &corev1.Namespace{}
 	err := n.client.Get(context.TODO(), types.NamespacedName{
-		Name:      namespace,
-		Namespace: namespace,
+		Name: namespace,
 	}, nm)
 	if err != nil {
 		return nil, err
@@ -0,0 +1,53 @@
+package k8s
+
+import (
+	"context"
+
+	"github.com/go-logr/logr"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/labels"
+	"k8s.io/apimachinery/pkg/types"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+)
+
+// Node the client that knows how to interact with kubernetes to read them
+type Node interface {
+	// GetNode get the node with the given name
+	GetNode(name string) (*corev1.Node, error)
+	// ListNodes get the nodes matching the given labels
+	ListNodes(selector map[string]string) (*corev1.NodeList, error)
+}
+
+// NodeOption is the Node client implementation using API calls to kubernetes.
+type NodeOption struct {
+	client client.Client
+	logger logr.Logger
+}
+
+// NewNode returns a new Node client.
+func NewNode(kubeClient client.Client, logger logr.Logger) Node {
+	logger = logger.WithValues("service", "k8s.node")
+	return &NodeOption{
+		client: kubeClient,
+		logger: logger,
+	}
+}
+
+// GetNode implement the Node.Interface
+func (n *NodeOption) GetNode(name string) (*corev1.Node, error) {
+	node := &corev1.Node{}
+	err := n.client.Get(context.TODO(), types.NamespacedName{Name: name}, node)
+	if err != nil {
+		return nil, err
+	}
+	return node, nil
+}
+
+// ListNodes implement the Node.Interface
+func (n *NodeOption) ListNodes(selector map[string]string) (*corev1.NodeList, error) {
+	nodes := &corev1.NodeList{}
+	err := n.client.List(context.TODO(), nodes, &client.ListOptions{
+		LabelSelector: labels.SelectorFromSet(selector),
+	})
+	return nodes, err
+}
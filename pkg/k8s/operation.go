@@ -0,0 +1,66 @@
+package k8s
+
+import (
+	"context"
+
+	"github.com/go-logr/logr"
+	"k8s.io/apimachinery/pkg/types"
+	rsv1 "redis-sentinel/api/v1"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+)
+
+// Operation the client that knows how to interact with kubernetes to manage RedisSentinelOperation
+type Operation interface {
+	// ListOperations get the RedisSentinelOperations of a namespace
+	ListOperations(namespace string) (*rsv1.RedisSentinelOperationList, error)
+	// UpdateOperation update the status of the RedisSentinelOperation
+	UpdateOperation(namespace string, op *rsv1.RedisSentinelOperation) error
+}
+
+// OperationOption is the RedisSentinelOperation client that using API calls to kubernetes.
+type OperationOption struct {
+	client client.Client
+	logger logr.Logger
+}
+
+// NewOperation returns a new RedisSentinelOperation client.
+func NewOperation(kubeClient client.Client, logger logr.Logger) Operation {
+	logger = logger.WithValues("service", "crd.redisSentinelOperation")
+	return &OperationOption{
+		client: kubeClient,
+		logger: logger,
+	}
+}
+
+// ListOperations implement the Operation.Interface
+func (o *OperationOption) ListOperations(namespace string) (*rsv1.RedisSentinelOperationList, error) {
+	ops := &rsv1.RedisSentinelOperationList{}
+	if err := o.client.List(context.TODO(), ops, client.InNamespace(namespace)); err != nil {
+		return nil, err
+	}
+	return ops, nil
+}
+
+// UpdateOperation implement the Operation.Interface
+func (o *OperationOption) UpdateOperation(namespace string, op *rsv1.RedisSentinelOperation) error {
+	instance := &rsv1.RedisSentinelOperation{}
+	if err := o.client.Get(context.TODO(), types.NamespacedName{
+		Namespace: op.Namespace,
+		Name:      op.Name,
+	}, instance); err != nil {
+		o.logger.WithValues("namespace", op.Namespace, "operation", op.Name).
+			Error(err, "RedisSentinelOperation.GET")
+		return err
+	}
+
+	// only the status is written
+	instance.Status = op.Status
+	if err := o.client.Status().Update(context.TODO(), instance); err != nil {
+		o.logger.WithValues("namespace", namespace, "operation", op.Name, "phase", op.Status.Phase).
+			Error(err, "redisSentinelOperationStatus")
+		return err
+	}
+	o.logger.WithValues("namespace", namespace, "operation", op.Name, "phase", op.Status.Phase).
+		V(3).Info("redisSentinelOperationStatus updated")
+	return nil
+}
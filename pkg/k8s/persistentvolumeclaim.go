@@ -0,0 +1,67 @@
+package k8s
+
+import (
+	"context"
+
+	"github.com/go-logr/logr"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/labels"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+)
+
+// PersistentVolumeClaim the client that knows how to interact with kubernetes to manage them
+type PersistentVolumeClaim interface {
+	// ListPersistentVolumeClaims get the PersistentVolumeClaims of a namespace matching the given labels
+	ListPersistentVolumeClaims(namespace string, selector map[string]string) (*corev1.PersistentVolumeClaimList, error)
+	// UpdatePersistentVolumeClaim will update the given PersistentVolumeClaim
+	UpdatePersistentVolumeClaim(namespace string, pvc *corev1.PersistentVolumeClaim) error
+	// DeletePersistentVolumeClaim will delete the given PersistentVolumeClaim
+	DeletePersistentVolumeClaim(namespace string, name string) error
+}
+
+// PersistentVolumeClaimOption is the PersistentVolumeClaim client implementation using API calls to kubernetes.
+type PersistentVolumeClaimOption struct {
+	client client.Client
+	logger logr.Logger
+}
+
+// NewPersistentVolumeClaim returns a new PersistentVolumeClaim client.
+func NewPersistentVolumeClaim(kubeClient client.Client, logger logr.Logger) PersistentVolumeClaim {
+	logger = logger.WithValues("service", "k8s.persistentVolumeClaim")
+	return &PersistentVolumeClaimOption{
+		client: kubeClient,
+		logger: logger,
+	}
+}
+
+// ListPersistentVolumeClaims implement the PersistentVolumeClaim.Interface
+func (p *PersistentVolumeClaimOption) ListPersistentVolumeClaims(namespace string, selector map[string]string) (*corev1.PersistentVolumeClaimList, error) {
+	pvcs := &corev1.PersistentVolumeClaimList{}
+	err := p.client.List(context.TODO(), pvcs, &client.ListOptions{
+		Namespace:     namespace,
+		LabelSelector: labels.SelectorFromSet(selector),
+	})
+	return pvcs, err
+}
+
+// UpdatePersistentVolumeClaim implement the PersistentVolumeClaim.Interface
+func (p *PersistentVolumeClaimOption) UpdatePersistentVolumeClaim(namespace string, pvc *corev1.PersistentVolumeClaim) error {
+	err := p.client.Update(context.TODO(), pvc)
+	if err != nil {
+		return err
+	}
+	p.logger.WithValues("namespace", namespace, "persistentVolumeClaim", pvc.Name).Info("persistentVolumeClaim updated")
+	return nil
+}
+
+// DeletePersistentVolumeClaim implement the PersistentVolumeClaim.Interface
+func (p *PersistentVolumeClaimOption) DeletePersistentVolumeClaim(namespace string, name string) error {
+	pvc := &corev1.PersistentVolumeClaim{}
+	pvc.Name = name
+	pvc.Namespace = namespace
+	if err := p.client.Delete(context.TODO(), pvc); err != nil {
+		return err
+	}
+	p.logger.WithValues("namespace", namespace, "persistentVolumeClaim", name).Info("persistentVolumeClaim deleted")
+	return nil
+}
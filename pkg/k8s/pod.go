@@ -25,6 +25,8 @@ type Pod interface {
 	DeletePod(namespace string, name string) error
 	// ListPods get set of pod on a given namespace
 	ListPods(namespace string) (*corev1.PodList, error)
+	// UpdatePodLabels will merge the given labels into the pod labels
+	UpdatePodLabels(namespace string, name string, labels map[string]string) error
 }
 
 // PodOption is the pod client interface implementation using API calls to kubernetes.
@@ -116,3 +118,23 @@ func (p *PodOption) ListPods(namespace string) (*corev1.PodList, error) {
 	err := p.client.List(context.TODO(), ps, listOps)
 	return ps, err
 }
+
+// UpdatePodLabels implement the Pod.Interface
+func (p *PodOption) UpdatePodLabels(namespace string, name string, labels map[string]string) error {
+	pod, err := p.GetPod(namespace, name)
+	if err != nil {
+		return err
+	}
+	patch := client.MergeFrom(pod.DeepCopy())
+	if pod.Labels == nil {
+		pod.Labels = make(map[string]string)
+	}
+	for k, v := range labels {
+		pod.Labels[k] = v
+	}
+	if err := p.client.Patch(context.TODO(), pod, patch); err != nil {
+		return err
+	}
+	p.logger.WithValues("namespace", namespace, "pod", name, "labels", labels).V(2).Info("pod labels updated")
+	return nil
+}
@@ -0,0 +1,92 @@
+package k8s
+
+import (
+	"context"
+
+	"github.com/go-logr/logr"
+	"k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/apimachinery/pkg/types"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+)
+
+// PrometheusRuleGVK is the kind of the prometheus-operator PrometheusRule. Its types are not
+// imported, the objects are handled as unstructured.
+var PrometheusRuleGVK = schema.GroupVersionKind{
+	Group:   "monitoring.coreos.com",
+	Version: "v1",
+	Kind:    "PrometheusRule",
+}
+
+// PrometheusRule the client that knows how to interact with kubernetes to manage them
+type PrometheusRule interface {
+	// GetPrometheusRule get prometheusrule from kubernetes with namespace and name
+	GetPrometheusRule(namespace string, name string) (*unstructured.Unstructured, error)
+	// CreateOrUpdatePrometheusRule will update the given prometheusrule or create it if does not exist
+	CreateOrUpdatePrometheusRule(namespace string, prometheusRule *unstructured.Unstructured) error
+	// DeletePrometheusRule will delete the given prometheusrule
+	DeletePrometheusRule(namespace string, name string) error
+}
+
+// PrometheusRuleOption is the prometheusrule client implementation using API calls to kubernetes.
+type PrometheusRuleOption struct {
+	client client.Client
+	logger logr.Logger
+}
+
+// NewPrometheusRule returns a new PrometheusRule client.
+func NewPrometheusRule(kubeClient client.Client, logger logr.Logger) PrometheusRule {
+	logger = logger.WithValues("service", "k8s.prometheusrule")
+	return &PrometheusRuleOption{
+		client: kubeClient,
+		logger: logger,
+	}
+}
+
+// GetPrometheusRule implement the PrometheusRule.Interface
+func (s *PrometheusRuleOption) GetPrometheusRule(namespace string, name string) (*unstructured.Unstructured, error) {
+	prometheusRule := &unstructured.Unstructured{}
+	prometheusRule.SetGroupVersionKind(PrometheusRuleGVK)
+	err := s.client.Get(context.TODO(), types.NamespacedName{
+		Name:      name,
+		Namespace: namespace,
+	}, prometheusRule)
+	if err != nil {
+		return nil, err
+	}
+	return prometheusRule, nil
+}
+
+// CreateOrUpdatePrometheusRule implement the PrometheusRule.Interface
+func (s *PrometheusRuleOption) CreateOrUpdatePrometheusRule(namespace string, prometheusRule *unstructured.Unstructured) error {
+	stored, err := s.GetPrometheusRule(namespace, prometheusRule.GetName())
+	if err != nil {
+		// If no resource we need to create.
+		if errors.IsNotFound(err) {
+			if err := s.client.Create(context.TODO(), prometheusRule); err != nil {
+				return err
+			}
+			s.logger.WithValues("namespace", namespace, "prometheusRule", prometheusRule.GetName()).Info("prometheusRule created")
+			return nil
+		}
+		return err
+	}
+
+	// Already exists, need to Update.
+	prometheusRule.SetResourceVersion(stored.GetResourceVersion())
+	if err := s.client.Update(context.TODO(), prometheusRule); err != nil {
+		return err
+	}
+	s.logger.WithValues("namespace", namespace, "prometheusRule", prometheusRule.GetName()).V(2).Info("prometheusRule updated")
+	return nil
+}
+
+// DeletePrometheusRule implement the PrometheusRule.Interface
+func (s *PrometheusRuleOption) DeletePrometheusRule(namespace string, name string) error {
+	prometheusRule, err := s.GetPrometheusRule(namespace, name)
+	if err != nil {
+		return err
+	}
+	return s.client.Delete(context.TODO(), prometheusRule)
+}
@@ -10,8 +10,14 @@ import (
 
 // Cluster the client that knows how to interact with kubernetes to manage RedisCluster
 type Cluster interface {
-	// UpdateCluster update the RedisCluster
+	// GetCluster get the RedisSentinel
+	GetCluster(namespace string, name string) (*rsv1.RedisSentinel, error)
+	// UpdateCluster update the status of the RedisCluster
 	UpdateCluster(namespace string, rs *rsv1.RedisSentinel) error
+	// UpdateClusterSpec update the spec of the RedisSentinel
+	UpdateClusterSpec(namespace string, rs *rsv1.RedisSentinel) error
+	// UpdateShardedCluster update the status of the sharded RedisCluster
+	UpdateShardedCluster(namespace string, rc *rsv1.RedisCluster) error
 }
 
 // ClusterOption is the RedisCluster client that using API calls to kubernetes.
@@ -29,6 +35,18 @@ func NewCluster(kubeClient client.Client, logger logr.Logger) Cluster {
 	}
 }
 
+// GetCluster implement the  Cluster.Interface
+func (c *ClusterOption) GetCluster(namespace string, name string) (*rsv1.RedisSentinel, error) {
+	instance := &rsv1.RedisSentinel{}
+	if err := c.client.Get(context.TODO(), types.NamespacedName{
+		Namespace: namespace,
+		Name:      name,
+	}, instance); err != nil {
+		return nil, err
+	}
+	return instance, nil
+}
+
 // UpdateCluster implement the  Cluster.Interface
 func (c *ClusterOption) UpdateCluster(namespace string, rs *rsv1.RedisSentinel) error {
 	instance := &rsv1.RedisSentinel{}
@@ -41,12 +59,9 @@ func (c *ClusterOption) UpdateCluster(namespace string, rs *rsv1.RedisSentinel)
 		return err
 	}
 
-	instance.Labels = instance.Labels
-	instance.Annotations = instance.Annotations
-	instance.Spec = instance.Spec
-	instance.ClusterName = instance.ClusterName
-
-	err := c.client.Update(context.TODO(), instance)
+	// only the status is written, the spec may have been changed since rs was read
+	instance.Status = rs.Status
+	err := c.client.Status().Update(context.TODO(), instance)
 	if err != nil {
 		c.logger.WithValues("namespace", namespace, "cluster", rs.Name, "conditions", rs.Status.Conditions).
 			Error(err, "redisClusterStatus")
@@ -56,3 +71,37 @@ func (c *ClusterOption) UpdateCluster(namespace string, rs *rsv1.RedisSentinel)
 		V(3).Info("redisClusterStatus updated")
 	return nil
 }
+
+// UpdateClusterSpec implement the  Cluster.Interface
+func (c *ClusterOption) UpdateClusterSpec(namespace string, rs *rsv1.RedisSentinel) error {
+	if err := c.client.Update(context.TODO(), rs); err != nil {
+		c.logger.WithValues("namespace", namespace, "cluster", rs.Name).Error(err, "redisClusterSpec")
+		return err
+	}
+	c.logger.WithValues("namespace", namespace, "cluster", rs.Name).V(3).Info("redisClusterSpec updated")
+	return nil
+}
+
+// UpdateShardedCluster implement the  Cluster.Interface
+func (c *ClusterOption) UpdateShardedCluster(namespace string, rc *rsv1.RedisCluster) error {
+	instance := &rsv1.RedisCluster{}
+	if err := c.client.Get(context.TODO(), types.NamespacedName{
+		Namespace: rc.Namespace,
+		Name:      rc.Name,
+	}, instance); err != nil {
+		c.logger.WithValues("namespace", rc.Namespace, "cluster", rc.Name).
+			Error(err, "RedisCluster.GET")
+		return err
+	}
+
+	// only the status is written, the spec may have been changed since rc was read
+	instance.Status = rc.Status
+	if err := c.client.Status().Update(context.TODO(), instance); err != nil {
+		c.logger.WithValues("namespace", namespace, "cluster", rc.Name, "conditions", rc.Status.Conditions).
+			Error(err, "redisClusterStatus")
+		return err
+	}
+	c.logger.WithValues("namespace", namespace, "cluster", rc.Name, "conditions", rc.Status.Conditions).
+		V(3).Info("redisClusterStatus updated")
+	return nil
+}
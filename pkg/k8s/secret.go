@@ -0,0 +1,87 @@
+package k8s
+
+import (
+	"context"
+	"reflect"
+
+	"github.com/go-logr/logr"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/types"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+)
+
+// Secret the client that knows how to interact with kubernetes to manage them
+type Secret interface {
+	// GetSecret get Secret from kubernetes with namespace and name
+	GetSecret(namespace string, name string) (*corev1.Secret, error)
+	// CreateSecret create the given Secret
+	CreateSecret(namespace string, secret *corev1.Secret) error
+	// UpdateSecret update the given Secret
+	UpdateSecret(namespace string, secret *corev1.Secret) error
+	// CreateOrUpdateSecret create the Secret if it doesn't exist, otherwise update it when its data changed
+	CreateOrUpdateSecret(namespace string, secret *corev1.Secret) error
+}
+
+// SecretOption is the secret client interface implementation that using API calls to kubernetes.
+type SecretOption struct {
+	client client.Client
+	logger logr.Logger
+}
+
+// NewSecret returns a new Secret client.
+func NewSecret(kubeClient client.Client, logger logr.Logger) Secret {
+	logger = logger.WithValues("service", "k8s.secret")
+	return &SecretOption{
+		client: kubeClient,
+		logger: logger,
+	}
+}
+
+// GetSecret implement the Secret.Interface
+func (s *SecretOption) GetSecret(namespace string, name string) (*corev1.Secret, error) {
+	secret := &corev1.Secret{}
+	err := s.client.Get(context.TODO(), types.NamespacedName{
+		Name:      name,
+		Namespace: namespace,
+	}, secret)
+	if err != nil {
+		return nil, err
+	}
+	return secret, nil
+}
+
+// CreateSecret implement the Secret.Interface
+func (s *SecretOption) CreateSecret(namespace string, secret *corev1.Secret) error {
+	if err := s.client.Create(context.TODO(), secret); err != nil {
+		return err
+	}
+	s.logger.WithValues("namespace", namespace, "secret", secret.Name).Info("secret created")
+	return nil
+}
+
+// UpdateSecret implement the Secret.Interface
+func (s *SecretOption) UpdateSecret(namespace string, secret *corev1.Secret) error {
+	if err := s.client.Update(context.TODO(), secret); err != nil {
+		return err
+	}
+	s.logger.WithValues("namespace", namespace, "secret", secret.Name).Info("secret updated")
+	return nil
+}
+
+// CreateOrUpdateSecret implement the Secret.Interface
+func (s *SecretOption) CreateOrUpdateSecret(namespace string, secret *corev1.Secret) error {
+	storedSecret, err := s.GetSecret(namespace, secret.Name)
+	if err != nil {
+		// If no resource we need to create.
+		if errors.IsNotFound(err) {
+			return s.CreateSecret(namespace, secret)
+		}
+		return err
+	}
+	if reflect.DeepEqual(storedSecret.Data, secret.Data) {
+		return nil
+	}
+	secret.ResourceVersion = storedSecret.ResourceVersion
+	return s.UpdateSecret(namespace, secret)
+}
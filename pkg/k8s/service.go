@@ -4,6 +4,7 @@ import (
 	"context"
 	corev1 "k8s.io/api/core/v1"
 	"k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/labels"
 	"k8s.io/apimachinery/pkg/types"
 
 	"github.com/go-logr/logr"
@@ -27,6 +28,8 @@ type Service interface {
 	DeleteService(namespace string, name string) error
 	// ListServices get set of service on a given namespace
 	ListServices(namespace string) (*corev1.ServiceList, error)
+	// ListServicesByLabels get the services of the namespace matching the given labels
+	ListServicesByLabels(namespace string, selector map[string]string) (*corev1.ServiceList, error)
 }
 
 // ServiceOption is the service client implementation using API calls to kubernetes.
@@ -130,3 +133,13 @@ func (s *ServiceOption) ListServices(namespace string) (*corev1.ServiceList, err
 	err := s.client.List(context.TODO(), services, listOps)
 	return services, err
 }
+
+// ListServicesByLabels implement the Service.Interface
+func (s *ServiceOption) ListServicesByLabels(namespace string, selector map[string]string) (*corev1.ServiceList, error) {
+	services := &corev1.ServiceList{}
+	err := s.client.List(context.TODO(), services, &client.ListOptions{
+		Namespace:     namespace,
+		LabelSelector: labels.SelectorFromSet(selector),
+	})
+	return services, err
+}
@@ -0,0 +1,92 @@
+package k8s
+
+import (
+	"context"
+
+	"github.com/go-logr/logr"
+	"k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/apimachinery/pkg/types"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+)
+
+// ServiceMonitorGVK is the kind of the prometheus-operator ServiceMonitor. Its types are not
+// imported, the objects are handled as unstructured.
+var ServiceMonitorGVK = schema.GroupVersionKind{
+	Group:   "monitoring.coreos.com",
+	Version: "v1",
+	Kind:    "ServiceMonitor",
+}
+
+// ServiceMonitor the client that knows how to interact with kubernetes to manage them
+type ServiceMonitor interface {
+	// GetServiceMonitor get servicemonitor from kubernetes with namespace and name
+	GetServiceMonitor(namespace string, name string) (*unstructured.Unstructured, error)
+	// CreateOrUpdateServiceMonitor will update the given servicemonitor or create it if does not exist
+	CreateOrUpdateServiceMonitor(namespace string, serviceMonitor *unstructured.Unstructured) error
+	// DeleteServiceMonitor will delete the given servicemonitor
+	DeleteServiceMonitor(namespace string, name string) error
+}
+
+// ServiceMonitorOption is the servicemonitor client implementation using API calls to kubernetes.
+type ServiceMonitorOption struct {
+	client client.Client
+	logger logr.Logger
+}
+
+// NewServiceMonitor returns a new ServiceMonitor client.
+func NewServiceMonitor(kubeClient client.Client, logger logr.Logger) ServiceMonitor {
+	logger = logger.WithValues("service", "k8s.servicemonitor")
+	return &ServiceMonitorOption{
+		client: kubeClient,
+		logger: logger,
+	}
+}
+
+// GetServiceMonitor implement the ServiceMonitor.Interface
+func (s *ServiceMonitorOption) GetServiceMonitor(namespace string, name string) (*unstructured.Unstructured, error) {
+	serviceMonitor := &unstructured.Unstructured{}
+	serviceMonitor.SetGroupVersionKind(ServiceMonitorGVK)
+	err := s.client.Get(context.TODO(), types.NamespacedName{
+		Name:      name,
+		Namespace: namespace,
+	}, serviceMonitor)
+	if err != nil {
+		return nil, err
+	}
+	return serviceMonitor, nil
+}
+
+// CreateOrUpdateServiceMonitor implement the ServiceMonitor.Interface
+func (s *ServiceMonitorOption) CreateOrUpdateServiceMonitor(namespace string, serviceMonitor *unstructured.Unstructured) error {
+	stored, err := s.GetServiceMonitor(namespace, serviceMonitor.GetName())
+	if err != nil {
+		// If no resource we need to create.
+		if errors.IsNotFound(err) {
+			if err := s.client.Create(context.TODO(), serviceMonitor); err != nil {
+				return err
+			}
+			s.logger.WithValues("namespace", namespace, "serviceMonitor", serviceMonitor.GetName()).Info("serviceMonitor created")
+			return nil
+		}
+		return err
+	}
+
+	// Already exists, need to Update.
+	serviceMonitor.SetResourceVersion(stored.GetResourceVersion())
+	if err := s.client.Update(context.TODO(), serviceMonitor); err != nil {
+		return err
+	}
+	s.logger.WithValues("namespace", namespace, "serviceMonitor", serviceMonitor.GetName()).V(2).Info("serviceMonitor updated")
+	return nil
+}
+
+// DeleteServiceMonitor implement the ServiceMonitor.Interface
+func (s *ServiceMonitorOption) DeleteServiceMonitor(namespace string, name string) error {
+	serviceMonitor, err := s.GetServiceMonitor(namespace, name)
+	if err != nil {
+		return err
+	}
+	return s.client.Delete(context.TODO(), serviceMonitor)
+}
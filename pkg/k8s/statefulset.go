@@ -8,6 +8,7 @@ import (
 	appsv1 "k8s.io/api/apps/v1"
 	corev1 "k8s.io/api/core/v1"
 	"k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	"k8s.io/apimachinery/pkg/labels"
 	"k8s.io/apimachinery/pkg/types"
 	"sigs.k8s.io/controller-runtime/pkg/client"
@@ -23,10 +24,14 @@ type StatefulSet interface {
 	CreateStatefulSet(namespace string, statefulSet *appsv1.StatefulSet) error
 	// UpdateStatefulSet will update the given StatefulSet
 	UpdateStatefulSet(namespace string, statefulSet *appsv1.StatefulSet) error
+	// ScaleStatefulSet will patch the replicas of the given StatefulSet, leaving the rest of it as is
+	ScaleStatefulSet(namespace string, statefulSet *appsv1.StatefulSet, replicas int32) error
 	// CreateOrUpdateStatefulSet will update the given StatefulSet or create it if does not exist
 	CreateOrUpdateStatefulSet(namespace string, StatefulSet *appsv1.StatefulSet) error
 	// DeleteStatefulSet will delete the given StatefulSet
 	DeleteStatefulSet(namespace string, name string) error
+	// DeleteStatefulSetOrphan will delete the given StatefulSet leaving its pods running
+	DeleteStatefulSetOrphan(namespace string, name string) error
 	// ListStatefulSets get set of StatefulSet on a given namespace
 	ListStatefulSets(namespace string) (*appsv1.StatefulSetList, error)
 	CreateIfNotExistsStatefulSet(namespace string, statefulSet *appsv1.StatefulSet) error
@@ -97,6 +102,18 @@ func (s *StatefulSetOption) UpdateStatefulSet(namespace string, statefulSet *app
 	return err
 }
 
+// ScaleStatefulSet implement the StatefulSet.Interface
+func (s *StatefulSetOption) ScaleStatefulSet(namespace string, statefulSet *appsv1.StatefulSet, replicas int32) error {
+	scaled := statefulSet.DeepCopy()
+	patch := client.MergeFrom(statefulSet)
+	scaled.Spec.Replicas = &replicas
+	if err := s.client.Patch(context.TODO(), scaled, patch); err != nil {
+		return err
+	}
+	s.logger.WithValues("namespace", namespace, "statefulSet", statefulSet.Name, "replicas", replicas).Info("statefulSet scaled")
+	return nil
+}
+
 // CreateOrUpdateStatefulSet implement the StatefulSet.Interface
 func (s *StatefulSetOption) CreateOrUpdateStatefulSet(namespace string, statefulSet *appsv1.StatefulSet) error {
 	storedStatefulSet, err := s.GetStatefulSet(namespace, statefulSet.Name)
@@ -146,6 +163,22 @@ func (s *StatefulSetOption) DeleteStatefulSet(namespace, name string) error {
 	return s.client.Delete(context.TODO(), statefulset)
 }
 
+// DeleteStatefulSetOrphan implement the StatefulSet.Interface
+func (s *StatefulSetOption) DeleteStatefulSetOrphan(namespace, name string) error {
+	statefulset := &appsv1.StatefulSet{}
+	if err := s.client.Get(context.TODO(), types.NamespacedName{
+		Name:      name,
+		Namespace: namespace,
+	}, statefulset); err != nil {
+		return err
+	}
+	if err := s.client.Delete(context.TODO(), statefulset, client.PropagationPolicy(metav1.DeletePropagationOrphan)); err != nil {
+		return err
+	}
+	s.logger.WithValues("namespace", namespace, "statefulSet", name).Info("statefulSet deleted, pods orphaned")
+	return nil
+}
+
 // ListStatefulSets implement the StatefulSet.Interface
 func (s *StatefulSetOption) ListStatefulSets(namespace string) (*appsv1.StatefulSetList, error) {
 	statelfulSets := &appsv1.StatefulSetList{}
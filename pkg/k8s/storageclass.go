@@ -0,0 +1,60 @@
+package k8s
+
+import (
+	"context"
+
+	"github.com/go-logr/logr"
+	storagev1 "k8s.io/api/storage/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+)
+
+// defaultStorageClassAnnotation marks the StorageClass used by the claims without one
+const defaultStorageClassAnnotation = "storageclass.kubernetes.io/is-default-class"
+
+// StorageClass the client that knows how to interact with kubernetes to read them
+type StorageClass interface {
+	// GetStorageClass get the StorageClass with the given name
+	GetStorageClass(name string) (*storagev1.StorageClass, error)
+	// GetDefaultStorageClass get the default StorageClass of the cluster, nil if there isn't one
+	GetDefaultStorageClass() (*storagev1.StorageClass, error)
+}
+
+// StorageClassOption is the StorageClass client implementation using API calls to kubernetes.
+type StorageClassOption struct {
+	client client.Client
+	logger logr.Logger
+}
+
+// NewStorageClass returns a new StorageClass client.
+func NewStorageClass(kubeClient client.Client, logger logr.Logger) StorageClass {
+	logger = logger.WithValues("service", "k8s.storageClass")
+	return &StorageClassOption{
+		client: kubeClient,
+		logger: logger,
+	}
+}
+
+// GetStorageClass implement the StorageClass.Interface
+func (s *StorageClassOption) GetStorageClass(name string) (*storagev1.StorageClass, error) {
+	sc := &storagev1.StorageClass{}
+	err := s.client.Get(context.TODO(), types.NamespacedName{Name: name}, sc)
+	if err != nil {
+		return nil, err
+	}
+	return sc, nil
+}
+
+// GetDefaultStorageClass implement the StorageClass.Interface
+func (s *StorageClassOption) GetDefaultStorageClass() (*storagev1.StorageClass, error) {
+	scs := &storagev1.StorageClassList{}
+	if err := s.client.List(context.TODO(), scs); err != nil {
+		return nil, err
+	}
+	for i := range scs.Items {
+		if scs.Items[i].Annotations[defaultStorageClassAnnotation] == "true" {
+			return &scs.Items[i], nil
+		}
+	}
+	return nil, nil
+}
@@ -1,5 +1,9 @@
 package metrics
+
 import (
+	"sync"
+	"time"
+
 	"github.com/prometheus/client_golang/prometheus"
 )
 
@@ -7,19 +11,69 @@ const (
 	promControllerSubsystem = "controller"
 )
 
+// Reconcile phases measured by the operator
+const (
+	PhaseEnsure       = "ensure"
+	PhaseCheckAndHeal = "check_and_heal"
+)
+
+// Heal actions counted by the operator
+const (
+	HealMakeMaster          = "make_master"
+	HealSetOldestAsMaster   = "set_oldest_as_master"
+	HealSetMasterOnAll      = "set_master_on_all"
+	HealRestoreSentinel     = "restore_sentinel"
+	HealNewSentinelMonitor  = "new_sentinel_monitor"
+	HealSetRedisConfig      = "set_redis_config"
+	HealSetSentinelConfig   = "set_sentinel_config"
+	HealFailoverMaster      = "failover_master"
+	HealClusterMeet         = "cluster_meet"
+	HealClusterForget       = "cluster_forget"
+	HealClusterAddSlots     = "cluster_add_slots"
+	HealClusterReplicate    = "cluster_replicate"
+	HealClusterMigrateSlot  = "cluster_migrate_slot"
+	HealReplicateSource     = "replicate_source"
+	HealPromoteStandby      = "promote_standby"
+	HealSetSourceReadOnly   = "set_source_read_only"
+	HealRestoreSourceWrites = "restore_source_writes"
+)
+
 var ClusterMetrics = &PromMetrics{}
 
+// promNamespace is the namespace of the metrics, set by InitPrometheusMetrics
+var promNamespace = "redis_operator"
+
+// MetricName returns the full name of an operator metric, as used in prometheus queries
+func MetricName(name string) string {
+	return prometheus.BuildFQName(promNamespace, promControllerSubsystem, name)
+}
+
 // Instrumenter is the interface that will collect the metrics and has ability to send/expose those metrics.
 type Instrumenter interface {
 	SetClusterOK(namespace string, name string)
 	SetClusterError(namespace string, name string)
 	DeleteCluster(namespace string, name string)
+	ObserveReconcileDuration(namespace string, name string, phase string, duration time.Duration)
+	IncHealAction(namespace string, name string, action string)
+	IncFailover(namespace string, name string)
+	SetSentinelAgreement(namespace string, name string, ratio float64)
+	SetReplicaLag(namespace string, name string, lags map[string]int64)
 }
 
-// PromMetrics implements the instrumenter so the metrics can be managed by Prometheus.
+// PromMetrics holds the metrics managed by Prometheus, ForKind returns their instrumenter.
 type PromMetrics struct {
 	// Metrics fields.
-	clusterHealthy *prometheus.GaugeVec // clusterOk is the status of a cluster
+	clusterHealthy    *prometheus.GaugeVec     // clusterOk is the status of a cluster
+	reconcileDuration *prometheus.HistogramVec // reconcileDuration is the time spent on each phase of a reconcile
+	healActions       *prometheus.CounterVec   // healActions is the number of heal actions run by type
+	failovers         *prometheus.CounterVec   // failovers is the number of times the master moved to another pod
+	masterLastChange  *prometheus.GaugeVec     // masterLastChange is the time of the last master change
+	sentinelAgreement *prometheus.GaugeVec     // sentinelAgreement is the ratio of sentinels monitoring the master
+	replicaLag        *prometheus.GaugeVec     // replicaLag is the replication lag of every replica in bytes
+
+	// replicaPods remembers the pods with a lag per cluster, so the replicas gone are removed
+	mu          sync.Mutex
+	replicaPods map[string]map[string]struct{}
 
 	// Instrumentation fields.
 	registry prometheus.Registerer
@@ -27,15 +81,67 @@ type PromMetrics struct {
 
 // InitPrometheusMetrics returns a init PromMetrics object.
 func InitPrometheusMetrics(namespace string, registry *prometheus.Registry) {
+	promNamespace = namespace
+
 	// Create metrics.
 	clusterHealthy := prometheus.NewGaugeVec(prometheus.GaugeOpts{
 		Namespace: namespace,
 		Subsystem: promControllerSubsystem,
 		Name:      "cluster_healthy",
 		Help:      "Status of redis clusters managed by the operator.",
-	}, []string{"namespace", "name"})
+	}, []string{"kind", "namespace", "name"})
+
+	reconcileDuration := prometheus.NewHistogramVec(prometheus.HistogramOpts{
+		Namespace: namespace,
+		Subsystem: promControllerSubsystem,
+		Name:      "reconcile_duration_seconds",
+		Help:      "Time spent on each phase of the reconcile of a redis cluster.",
+		Buckets:   []float64{0.01, 0.05, 0.1, 0.25, 0.5, 1, 2.5, 5, 10, 30, 60},
+	}, []string{"kind", "namespace", "name", "phase"})
+
+	healActions := prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Subsystem: promControllerSubsystem,
+		Name:      "heal_actions_total",
+		Help:      "Number of heal actions run on redis clusters by type.",
+	}, []string{"kind", "namespace", "name", "action"})
+
+	failovers := prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Subsystem: promControllerSubsystem,
+		Name:      "failovers_total",
+		Help:      "Number of times the master of a redis cluster moved to another pod.",
+	}, []string{"kind", "namespace", "name"})
+
+	masterLastChange := prometheus.NewGaugeVec(prometheus.GaugeOpts{
+		Namespace: namespace,
+		Subsystem: promControllerSubsystem,
+		Name:      "master_last_change_timestamp_seconds",
+		Help:      "Unix time of the last master change of a redis cluster.",
+	}, []string{"kind", "namespace", "name"})
+
+	sentinelAgreement := prometheus.NewGaugeVec(prometheus.GaugeOpts{
+		Namespace: namespace,
+		Subsystem: promControllerSubsystem,
+		Name:      "sentinel_agreement_ratio",
+		Help:      "Ratio of the sentinels of a redis cluster monitoring its current master.",
+	}, []string{"kind", "namespace", "name"})
+
+	replicaLag := prometheus.NewGaugeVec(prometheus.GaugeOpts{
+		Namespace: namespace,
+		Subsystem: promControllerSubsystem,
+		Name:      "replica_lag_bytes",
+		Help:      "Replication offset difference between the master and each replica of a redis cluster.",
+	}, []string{"kind", "namespace", "name", "pod"})
 
 	ClusterMetrics.clusterHealthy = clusterHealthy
+	ClusterMetrics.reconcileDuration = reconcileDuration
+	ClusterMetrics.healActions = healActions
+	ClusterMetrics.failovers = failovers
+	ClusterMetrics.masterLastChange = masterLastChange
+	ClusterMetrics.sentinelAgreement = sentinelAgreement
+	ClusterMetrics.replicaLag = replicaLag
+	ClusterMetrics.replicaPods = make(map[string]map[string]struct{})
 	ClusterMetrics.registry = registry
 
 	// Register metrics on prometheus.
@@ -45,19 +151,96 @@ func InitPrometheusMetrics(namespace string, registry *prometheus.Registry) {
 // register will register all the required prometheus metrics on the Prometheus collector.
 func (p *PromMetrics) register() {
 	p.registry.MustRegister(p.clusterHealthy)
+	p.registry.MustRegister(p.reconcileDuration)
+	p.registry.MustRegister(p.healActions)
+	p.registry.MustRegister(p.failovers)
+	p.registry.MustRegister(p.masterLastChange)
+	p.registry.MustRegister(p.sentinelAgreement)
+	p.registry.MustRegister(p.replicaLag)
+}
+
+// ForKind returns the instrumenter of the clusters of the given kind, a RedisSentinel and a
+// RedisCluster of the same namespace may have the same name
+func (p *PromMetrics) ForKind(kind string) Instrumenter {
+	return &kindMetrics{PromMetrics: p, kind: kind}
+}
+
+// kindMetrics sets the kind label of the metrics of a kind of cluster
+type kindMetrics struct {
+	*PromMetrics
+	kind string
 }
 
 // SetClusterOK set the cluster status to OK
-func (p *PromMetrics) SetClusterOK(namespace string, name string) {
-	p.clusterHealthy.WithLabelValues(namespace, name).Set(1)
+func (p *kindMetrics) SetClusterOK(namespace string, name string) {
+	p.clusterHealthy.WithLabelValues(p.kind, namespace, name).Set(1)
 }
 
 // SetClusterError set the cluster status to Error
-func (p *PromMetrics) SetClusterError(namespace string, name string) {
-	p.clusterHealthy.WithLabelValues(namespace, name).Set(0)
+func (p *kindMetrics) SetClusterError(namespace string, name string) {
+	p.clusterHealthy.WithLabelValues(p.kind, namespace, name).Set(0)
 }
 
-// DeleteCluster set the cluster status to Error
-func (p *PromMetrics) DeleteCluster(namespace string, name string) {
-	p.clusterHealthy.DeleteLabelValues(namespace, name)
+// DeleteCluster removes all the metrics of the cluster
+func (p *kindMetrics) DeleteCluster(namespace string, name string) {
+	p.clusterHealthy.DeleteLabelValues(p.kind, namespace, name)
+	for _, phase := range []string{PhaseEnsure, PhaseCheckAndHeal} {
+		p.reconcileDuration.DeleteLabelValues(p.kind, namespace, name, phase)
+	}
+	for _, action := range []string{HealMakeMaster, HealSetOldestAsMaster, HealSetMasterOnAll, HealRestoreSentinel,
+		HealNewSentinelMonitor, HealSetRedisConfig, HealSetSentinelConfig, HealFailoverMaster,
+		HealClusterMeet, HealClusterForget, HealClusterAddSlots, HealClusterReplicate, HealClusterMigrateSlot,
+		HealReplicateSource, HealPromoteStandby, HealSetSourceReadOnly,
+		HealRestoreSourceWrites} {
+		p.healActions.DeleteLabelValues(p.kind, namespace, name, action)
+	}
+	p.failovers.DeleteLabelValues(p.kind, namespace, name)
+	p.masterLastChange.DeleteLabelValues(p.kind, namespace, name)
+	p.sentinelAgreement.DeleteLabelValues(p.kind, namespace, name)
+	p.SetReplicaLag(namespace, name, nil)
+}
+
+// ObserveReconcileDuration records the time spent on a phase of the reconcile
+func (p *kindMetrics) ObserveReconcileDuration(namespace string, name string, phase string, duration time.Duration) {
+	p.reconcileDuration.WithLabelValues(p.kind, namespace, name, phase).Observe(duration.Seconds())
+}
+
+// IncHealAction counts a heal action run on the cluster
+func (p *kindMetrics) IncHealAction(namespace string, name string, action string) {
+	p.healActions.WithLabelValues(p.kind, namespace, name, action).Inc()
+}
+
+// IncFailover counts a master change and records when it happened
+func (p *kindMetrics) IncFailover(namespace string, name string) {
+	p.failovers.WithLabelValues(p.kind, namespace, name).Inc()
+	p.masterLastChange.WithLabelValues(p.kind, namespace, name).SetToCurrentTime()
+}
+
+// SetSentinelAgreement set the ratio of sentinels monitoring the master
+func (p *kindMetrics) SetSentinelAgreement(namespace string, name string, ratio float64) {
+	p.sentinelAgreement.WithLabelValues(p.kind, namespace, name).Set(ratio)
+}
+
+// SetReplicaLag set the lag of the replicas of the cluster by pod name, the replicas
+// not in lags are removed
+func (p *kindMetrics) SetReplicaLag(namespace string, name string, lags map[string]int64) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	key := p.kind + "/" + namespace + "/" + name
+	for pod := range p.replicaPods[key] {
+		if _, ok := lags[pod]; !ok {
+			p.replicaLag.DeleteLabelValues(p.kind, namespace, name, pod)
+		}
+	}
+	if len(lags) == 0 {
+		delete(p.replicaPods, key)
+		return
+	}
+	pods := make(map[string]struct{}, len(lags))
+	for pod, lag := range lags {
+		p.replicaLag.WithLabelValues(p.kind, namespace, name, pod).Set(float64(lag))
+		pods[pod] = struct{}{}
+	}
+	p.replicaPods[key] = pods
 }
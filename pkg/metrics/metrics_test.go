@@ -0,0 +1,51 @@
+package metrics
+
+import (
+	"testing"
+
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// gatherKinds returns the kind labels of the gathered samples of the metric
+func gatherKinds(t *testing.T, registry *prometheus.Registry, name string) []string {
+	families, err := registry.Gather()
+	if err != nil {
+		t.Fatal(err)
+	}
+	kinds := []string{}
+	for _, family := range families {
+		if family.GetName() != MetricName(name) {
+			continue
+		}
+		for _, metric := range family.GetMetric() {
+			for _, label := range metric.GetLabel() {
+				if label.GetName() == "kind" {
+					kinds = append(kinds, label.GetValue())
+				}
+			}
+		}
+	}
+	return kinds
+}
+
+func TestForKind(t *testing.T) {
+	registry := prometheus.NewRegistry()
+	InitPrometheusMetrics("test", registry)
+	sentinels, clusters := ClusterMetrics.ForKind("RedisSentinel"), ClusterMetrics.ForKind("RedisCluster")
+
+	sentinels.SetClusterOK("ns", "redis")
+	clusters.SetClusterError("ns", "redis")
+	sentinels.SetReplicaLag("ns", "redis", map[string]int64{"redis-0": 10})
+	clusters.SetReplicaLag("ns", "redis", map[string]int64{"redis-0": 20})
+	if kinds := gatherKinds(t, registry, "cluster_healthy"); len(kinds) != 2 {
+		t.Fatalf("cluster_healthy has kinds %v, want one sample per kind", kinds)
+	}
+
+	sentinels.DeleteCluster("ns", "redis")
+	for _, name := range []string{"cluster_healthy", "replica_lag_bytes"} {
+		kinds := gatherKinds(t, registry, name)
+		if len(kinds) != 1 || kinds[0] != "RedisCluster" {
+			t.Errorf("%s has kinds %v after the RedisSentinel is deleted, want [RedisCluster]", name, kinds)
+		}
+	}
+}
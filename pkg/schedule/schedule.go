@@ -0,0 +1,123 @@
+// Package schedule parses the cron expressions of the maintenance windows, it imports no other
+// package of the operator so the api can validate them
+package schedule
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Schedule is a cron expression of 5 fields: minute, hour, day of month, month and day of week.
+// A field is *, a value, a range like 1-5 or a list of them, with an optional step like */15
+type Schedule struct {
+	minutes, hours, days, months, weekdays map[int]bool
+	// anyDay and anyWeekday are true when the field is *, a day then matches when both match
+	// instead of either, like cron does
+	anyDay, anyWeekday bool
+}
+
+type scheduleField struct {
+	name     string
+	min, max int
+}
+
+var scheduleFields = []scheduleField{
+	{name: "minute", min: 0, max: 59},
+	{name: "hour", min: 0, max: 23},
+	{name: "day of month", min: 1, max: 31},
+	{name: "month", min: 1, max: 12},
+	// 0 and 7 are sunday
+	{name: "day of week", min: 0, max: 7},
+}
+
+// Parse parses a cron expression of 5 fields
+func Parse(expr string) (*Schedule, error) {
+	fields := strings.Fields(expr)
+	if len(fields) != len(scheduleFields) {
+		return nil, fmt.Errorf("schedule %q must have %d fields", expr, len(scheduleFields))
+	}
+	values := make([]map[int]bool, len(fields))
+	for i, field := range fields {
+		set, err := parseScheduleField(field, scheduleFields[i])
+		if err != nil {
+			return nil, fmt.Errorf("schedule %q: %v", expr, err)
+		}
+		values[i] = set
+	}
+	if values[4][7] {
+		values[4][0] = true
+	}
+	return &Schedule{
+		minutes:    values[0],
+		hours:      values[1],
+		days:       values[2],
+		months:     values[3],
+		weekdays:   values[4],
+		anyDay:     fields[2] == "*",
+		anyWeekday: fields[4] == "*",
+	}, nil
+}
+
+func parseScheduleField(field string, f scheduleField) (map[int]bool, error) {
+	set := map[int]bool{}
+	for _, part := range strings.Split(field, ",") {
+		rng, step := part, 1
+		if i := strings.Index(part, "/"); i >= 0 {
+			var err error
+			if step, err = strconv.Atoi(part[i+1:]); err != nil || step <= 0 {
+				return nil, fmt.Errorf("%s step %q malformed", f.name, part)
+			}
+			rng = part[:i]
+		}
+		start, end := f.min, f.max
+		if rng != "*" {
+			bounds := strings.SplitN(rng, "-", 2)
+			var err error
+			if start, err = strconv.Atoi(bounds[0]); err != nil {
+				return nil, fmt.Errorf("%s %q malformed", f.name, part)
+			}
+			end = start
+			if len(bounds) == 2 {
+				if end, err = strconv.Atoi(bounds[1]); err != nil {
+					return nil, fmt.Errorf("%s %q malformed", f.name, part)
+				}
+			} else if step > 1 {
+				// 5/15 is every 15 from 5
+				end = f.max
+			}
+		}
+		if start < f.min || end > f.max || start > end {
+			return nil, fmt.Errorf("%s %q out of %d-%d", f.name, part, f.min, f.max)
+		}
+		for v := start; v <= end; v += step {
+			set[v] = true
+		}
+	}
+	return set, nil
+}
+
+// Matches is true when the schedule fires at the minute of t
+func (s *Schedule) Matches(t time.Time) bool {
+	if !s.minutes[t.Minute()] || !s.hours[t.Hour()] || !s.months[int(t.Month())] {
+		return false
+	}
+	day, weekday := s.days[t.Day()], s.weekdays[int(t.Weekday())]
+	if s.anyDay || s.anyWeekday {
+		return day && weekday
+	}
+	return day || weekday
+}
+
+// InWindow is true when the schedule fired less than duration before now, the window it
+// opened is still open
+func (s *Schedule) InWindow(duration time.Duration, now time.Time) bool {
+	now = now.UTC().Truncate(time.Minute)
+	for elapsed := time.Duration(0); elapsed < duration; elapsed += time.Minute {
+		if s.Matches(now.Add(-elapsed)) {
+			return true
+		}
+	}
+	return false
+}
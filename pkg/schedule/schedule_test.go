@@ -0,0 +1,111 @@
+package schedule
+
+import (
+	"testing"
+	"time"
+)
+
+func TestParse(t *testing.T) {
+	tests := []struct {
+		name    string
+		expr    string
+		wantErr bool
+	}{
+		{name: "every minute", expr: "* * * * *"},
+		{name: "lists ranges and steps", expr: "0,30 1-5/2 */10 1-12 1-5"},
+		{name: "sunday as 7", expr: "0 2 * * 7"},
+		{name: "missing field", expr: "0 2 * *", wantErr: true},
+		{name: "minute out of range", expr: "60 2 * * *", wantErr: true},
+		{name: "reversed range", expr: "0 5-1 * * *", wantErr: true},
+		{name: "zero step", expr: "*/0 * * * *", wantErr: true},
+		{name: "not a number", expr: "0 two * * *", wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := Parse(tt.expr)
+			if (err != nil) != tt.wantErr {
+				t.Errorf("Parse() error = %v, wantErr %v", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestScheduleInWindow(t *testing.T) {
+	// 2024-06-01 is a saturday
+	saturday := time.Date(2024, 6, 1, 0, 0, 0, 0, time.UTC)
+	tests := []struct {
+		name     string
+		expr     string
+		duration time.Duration
+		now      time.Time
+		want     bool
+	}{
+		{
+			name:     "when it fires",
+			expr:     "0 2 * * 6",
+			duration: 2 * time.Hour,
+			now:      saturday.Add(2 * time.Hour),
+			want:     true,
+		},
+		{
+			name:     "before the end",
+			expr:     "0 2 * * 6",
+			duration: 2 * time.Hour,
+			now:      saturday.Add(3*time.Hour + 59*time.Minute),
+			want:     true,
+		},
+		{
+			name:     "at the end",
+			expr:     "0 2 * * 6",
+			duration: 2 * time.Hour,
+			now:      saturday.Add(4 * time.Hour),
+			want:     false,
+		},
+		{
+			name:     "before it fires",
+			expr:     "0 2 * * 6",
+			duration: 2 * time.Hour,
+			now:      saturday.Add(time.Hour + 59*time.Minute),
+			want:     false,
+		},
+		{
+			name:     "other weekday",
+			expr:     "0 2 * * 0",
+			duration: 2 * time.Hour,
+			now:      saturday.Add(2 * time.Hour),
+			want:     false,
+		},
+		{
+			name:     "across midnight",
+			expr:     "0 23 * * 5",
+			duration: 3 * time.Hour,
+			now:      saturday.Add(time.Hour),
+			want:     true,
+		},
+		{
+			name:     "day of month or weekday",
+			expr:     "0 2 15 * 6",
+			duration: time.Hour,
+			now:      saturday.Add(2 * time.Hour),
+			want:     true,
+		},
+		{
+			name:     "day of month and any weekday",
+			expr:     "0 2 15 * *",
+			duration: time.Hour,
+			now:      saturday.Add(2 * time.Hour),
+			want:     false,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			schedule, err := Parse(tt.expr)
+			if err != nil {
+				t.Fatalf("Parse() error = %v", err)
+			}
+			if got := schedule.InWindow(tt.duration, tt.now); got != tt.want {
+				t.Errorf("InWindow() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
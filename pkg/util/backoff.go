@@ -0,0 +1,51 @@
+package util
+
+import (
+	"sync"
+	"time"
+)
+
+// Backoff counts the consecutive failures of keys, the delay before retrying a key doubles
+// with every failure of the same reason. It is safe for concurrent use
+type Backoff struct {
+	mu       sync.Mutex
+	failures map[string]backoffEntry
+}
+
+type backoffEntry struct {
+	reason string
+	count  int
+}
+
+// NewBackoff creates a Backoff without failures
+func NewBackoff() *Backoff {
+	return &Backoff{failures: map[string]backoffEntry{}}
+}
+
+// Next records a failure of key and returns the delay before retrying it, base doubled for
+// every previous failure up to max. A failure for another reason starts again from base
+func (b *Backoff) Next(key, reason string, base, max time.Duration) time.Duration {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	entry := b.failures[key]
+	if entry.reason != reason {
+		entry = backoffEntry{reason: reason}
+	}
+	delay := base
+	for i := 0; i < entry.count && delay < max; i++ {
+		delay *= 2
+	}
+	if delay > max {
+		delay = max
+	}
+	entry.count++
+	b.failures[key] = entry
+	return delay
+}
+
+// Reset forgets the failures of key
+func (b *Backoff) Reset(key string) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	delete(b.failures, key)
+}
@@ -0,0 +1,66 @@
+package util
+
+import (
+	"testing"
+	"time"
+)
+
+func TestBackoffNext(t *testing.T) {
+	type failure struct {
+		key, reason string
+		want        time.Duration
+	}
+	tests := []struct {
+		name     string
+		failures []failure
+		reset    string
+	}{
+		{
+			name: "doubles up to max",
+			failures: []failure{
+				{key: "a", reason: "Transient", want: time.Second},
+				{key: "a", reason: "Transient", want: 2 * time.Second},
+				{key: "a", reason: "Transient", want: 4 * time.Second},
+				{key: "a", reason: "Transient", want: 5 * time.Second},
+				{key: "a", reason: "Transient", want: 5 * time.Second},
+			},
+		},
+		{
+			name: "keys are independent",
+			failures: []failure{
+				{key: "a", reason: "Transient", want: time.Second},
+				{key: "b", reason: "Transient", want: time.Second},
+				{key: "a", reason: "Transient", want: 2 * time.Second},
+			},
+		},
+		{
+			name: "another reason starts again",
+			failures: []failure{
+				{key: "a", reason: "Transient", want: time.Second},
+				{key: "a", reason: "Transient", want: 2 * time.Second},
+				{key: "a", reason: "NeedsHuman", want: time.Second},
+			},
+		},
+		{
+			name:  "reset",
+			reset: "a",
+			failures: []failure{
+				{key: "a", reason: "Transient", want: time.Second},
+				{key: "a", reason: "Transient", want: time.Second},
+			},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			b := NewBackoff()
+			for i, f := range tt.failures {
+				if got := b.Next(f.key, f.reason, time.Second, 5*time.Second); got != f.want {
+					t.Errorf("Next() failure %d = %v, want %v", i, got, f.want)
+				}
+				if tt.reset != "" {
+					b.Reset(tt.reset)
+				}
+			}
+		})
+	}
+}
@@ -0,0 +1,72 @@
+package util
+
+import "errors"
+
+// ErrorKind classifies the errors of a reconcile, each kind is requeued with its own policy
+type ErrorKind string
+
+const (
+	// KindTransient errors are expected to go away by themselves, like a redis unreachable
+	// for a moment. The errors not classified are transient
+	KindTransient ErrorKind = "Transient"
+	// KindWaitingForPods is not a failure, the pods or the cluster are still changing and are
+	// checked again soon
+	KindWaitingForPods ErrorKind = "WaitingForPods"
+	// KindNeedsHuman errors are not fixed by the operator, the cluster is checked again slowly
+	// until someone repairs it
+	KindNeedsHuman ErrorKind = "NeedsHuman"
+	// KindInvalidSpec errors are fixed by changing the spec, retrying before is pointless
+	KindInvalidSpec ErrorKind = "InvalidSpec"
+)
+
+// ReconcileError is an error of a known kind
+type ReconcileError struct {
+	Kind ErrorKind
+	Err  error
+}
+
+func (e *ReconcileError) Error() string {
+	return e.Err.Error()
+}
+
+// Unwrap returns the classified error
+func (e *ReconcileError) Unwrap() error {
+	return e.Err
+}
+
+// Transient classifies err as transient
+func Transient(err error) error {
+	return classify(KindTransient, err)
+}
+
+// WaitingForPods classifies err as a wait for the pods or the cluster to change
+func WaitingForPods(err error) error {
+	return classify(KindWaitingForPods, err)
+}
+
+// NeedsHuman classifies err as needing someone to repair the cluster
+func NeedsHuman(err error) error {
+	return classify(KindNeedsHuman, err)
+}
+
+// InvalidSpec classifies err as caused by the spec
+func InvalidSpec(err error) error {
+	return classify(KindInvalidSpec, err)
+}
+
+func classify(kind ErrorKind, err error) error {
+	if err == nil {
+		return nil
+	}
+	return &ReconcileError{Kind: kind, Err: err}
+}
+
+// KindOf returns the kind of err, the kind of the outermost classified error it wraps or
+// transient when none is
+func KindOf(err error) ErrorKind {
+	var classified *ReconcileError
+	if errors.As(err, &classified) {
+		return classified.Kind
+	}
+	return KindTransient
+}
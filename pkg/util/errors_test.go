@@ -0,0 +1,43 @@
+package util
+
+import (
+	"errors"
+	"fmt"
+	"testing"
+)
+
+func TestKindOf(t *testing.T) {
+	tests := []struct {
+		name string
+		err  error
+		want ErrorKind
+	}{
+		{
+			name: "not classified",
+			err:  errors.New("connection refused"),
+			want: KindTransient,
+		},
+		{
+			name: "waiting",
+			err:  WaitingForPods(errors.New("need requeue")),
+			want: KindWaitingForPods,
+		},
+		{
+			name: "wrapped",
+			err:  fmt.Errorf("check: %w", NeedsHuman(errors.New("more than one master"))),
+			want: KindNeedsHuman,
+		},
+		{
+			name: "outermost wins",
+			err:  InvalidSpec(Transient(errors.New("storage can't shrink"))),
+			want: KindInvalidSpec,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := KindOf(tt.err); got != tt.want {
+				t.Errorf("KindOf() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
@@ -13,3 +13,13 @@ func MergeLabels(allLabels ...map[string]string) map[string]string {
 	}
 	return res
 }
+
+// MapContains reports whether all the entries of subset are in set with the same value.
+func MapContains(set, subset map[string]string) bool {
+	for k, v := range subset {
+		if value, ok := set[k]; !ok || value != v {
+			return false
+		}
+	}
+	return true
+}
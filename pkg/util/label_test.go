@@ -0,0 +1,44 @@
+package util
+
+import "testing"
+
+func TestMapContains(t *testing.T) {
+	tests := []struct {
+		name   string
+		set    map[string]string
+		subset map[string]string
+		want   bool
+	}{
+		{
+			name:   "empty subset",
+			set:    map[string]string{"a": "1"},
+			subset: nil,
+			want:   true,
+		},
+		{
+			name:   "contained",
+			set:    map[string]string{"a": "1", "b": "2"},
+			subset: map[string]string{"a": "1"},
+			want:   true,
+		},
+		{
+			name:   "missing key",
+			set:    map[string]string{"a": "1"},
+			subset: map[string]string{"b": "2"},
+			want:   false,
+		},
+		{
+			name:   "other value",
+			set:    map[string]string{"a": "1"},
+			subset: map[string]string{"a": "2"},
+			want:   false,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := MapContains(tt.set, tt.subset); got != tt.want {
+				t.Errorf("MapContains() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,89 @@
+package util
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"strings"
+
+	"github.com/go-logr/logr"
+)
+
+// redacted replaces the sensitive values in the logs
+const redacted = "<redacted>"
+
+// sensitiveConfigKeys are the redis and sentinel settings holding a password
+var sensitiveConfigKeys = []string{"requirepass", "masterauth", "auth-pass", "sentinel-pass"}
+
+type loggerKey struct{}
+
+// WithLogger returns a context carrying the logger of a reconcile, every log of the reconcile
+// then names its object and its reconcile ID
+func WithLogger(ctx context.Context, logger logr.Logger) context.Context {
+	return context.WithValue(ctx, loggerKey{}, logger)
+}
+
+// LoggerFrom returns the logger carried by ctx, fallback when it carries none
+func LoggerFrom(ctx context.Context, fallback logr.Logger) logr.Logger {
+	if logger, ok := ctx.Value(loggerKey{}).(logr.Logger); ok {
+		return logger
+	}
+	return fallback
+}
+
+// NewReconcileID returns a random ID correlating the logs of a reconcile
+func NewReconcileID() string {
+	id := make([]byte, 8)
+	if _, err := rand.Read(id); err != nil {
+		return "unknown"
+	}
+	return hex.EncodeToString(id)
+}
+
+// RedactConfig returns a copy of the config with the passwords redacted, to be logged
+func RedactConfig(config map[string]string) map[string]string {
+	redactedConfig := make(map[string]string, len(config))
+	for key, value := range config {
+		if isSensitiveConfig(key) {
+			value = redacted
+		}
+		redactedConfig[key] = value
+	}
+	return redactedConfig
+}
+
+// RedactConfigLines returns a copy of the config lines with the passwords redacted, to be
+// logged. The value of a password is the last field of its line
+func RedactConfigLines(lines []string) []string {
+	redactedLines := make([]string, len(lines))
+	for i, line := range lines {
+		fields := strings.Fields(line)
+		for j := 0; j < len(fields)-1; j++ {
+			if isSensitiveConfig(fields[j]) {
+				fields[len(fields)-1] = redacted
+				line = strings.Join(fields, " ")
+				break
+			}
+		}
+		redactedLines[i] = line
+	}
+	return redactedLines
+}
+
+func isSensitiveConfig(key string) bool {
+	key = strings.ToLower(key)
+	for _, sensitive := range sensitiveConfigKeys {
+		if strings.Contains(key, sensitive) {
+			return true
+		}
+	}
+	return false
+}
+
+// RedactPassword replaces the password in s, to be logged
+func RedactPassword(s, password string) string {
+	if password == "" {
+		return s
+	}
+	return strings.Replace(s, password, redacted, -1)
+}
@@ -0,0 +1,97 @@
+package util
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestRedactConfig(t *testing.T) {
+	tests := []struct {
+		name   string
+		config map[string]string
+		want   map[string]string
+	}{
+		{
+			name:   "no password",
+			config: map[string]string{"maxmemory": "1gb", "appendonly": "yes"},
+			want:   map[string]string{"maxmemory": "1gb", "appendonly": "yes"},
+		},
+		{
+			name:   "passwords",
+			config: map[string]string{"maxmemory": "1gb", "requirepass": "secret", "MasterAuth": "secret"},
+			want:   map[string]string{"maxmemory": "1gb", "requirepass": redacted, "MasterAuth": redacted},
+		},
+		{
+			name:   "sentinel auth-pass",
+			config: map[string]string{"sentinel auth-pass mymaster": "secret"},
+			want:   map[string]string{"sentinel auth-pass mymaster": redacted},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := RedactConfig(tt.config); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("RedactConfig() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestRedactConfigLines(t *testing.T) {
+	tests := []struct {
+		name  string
+		lines []string
+		want  []string
+	}{
+		{
+			name:  "no password",
+			lines: []string{"down-after-milliseconds 5000", "failover-timeout 10000"},
+			want:  []string{"down-after-milliseconds 5000", "failover-timeout 10000"},
+		},
+		{
+			name:  "passwords",
+			lines: []string{"requirepass secret", "sentinel auth-pass mymaster secret", "failover-timeout 10000"},
+			want:  []string{"requirepass " + redacted, "sentinel auth-pass mymaster " + redacted, "failover-timeout 10000"},
+		},
+		{
+			name:  "empty line",
+			lines: []string{""},
+			want:  []string{""},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := RedactConfigLines(tt.lines); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("RedactConfigLines() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestRedactPassword(t *testing.T) {
+	tests := []struct {
+		name     string
+		s        string
+		password string
+		want     string
+	}{
+		{
+			name:     "no password",
+			s:        "redis-cli -h $(hostname) ping",
+			password: "",
+			want:     "redis-cli -h $(hostname) ping",
+		},
+		{
+			name:     "password",
+			s:        "ERR invalid password secret for user default",
+			password: "secret",
+			want:     "ERR invalid password " + redacted + " for user default",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := RedactPassword(tt.s, tt.password); got != tt.want {
+				t.Errorf("RedactPassword() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
@@ -16,6 +16,29 @@ const (
 	RedisRoleName          = "redis"
 	AppLabel               = "redis-cluster"
 	HostnameTopologyKey    = "kubernetes.io/hostname"
+	ZoneTopologyKey        = "topology.kubernetes.io/zone"
+
+	// RedisRoleLabelKey is the pod label the operator keeps in sync with the replication role
+	RedisRoleLabelKey     = "redis-role"
+	RedisRoleLabelMaster  = "master"
+	RedisRoleLabelReplica = "replica"
+
+	// ExporterLabelKey marks the services exposing the exporters, the ServiceMonitor selects them with it
+	ExporterLabelKey = "redis-exporter"
+	ExporterName     = "-exporter"
+
+	// ExposeLabelKey marks the services publishing a single pod, the ones left by a scale down
+	// or a removed expose are found with it
+	ExposeLabelKey = "redis-expose"
+
+	// AuthName is the suffix of the secret holding the password of a cluster
+	AuthName = "-auth"
+
+	// ShardName and ShardRoleName name the resources of a sharded RedisCluster
+	ShardName     = "-shard"
+	ShardRoleName = "shard"
+	// ShardLabelKey is the pod label holding the index of the shard of the pod
+	ShardLabelKey = "redis.xuan.io/shard"
 )
 
 // GetRedisShutdownConfigMapName returns the name for redis configmap
@@ -31,6 +54,31 @@ func GetRedisName(rc *rsv1.RedisSentinel) string {
 	return GenerateName(RedisName, rc.Name)
 }
 
+// GetRedisMasterName returns the name for the service pointing to the redis master
+func GetRedisMasterName(rc *rsv1.RedisSentinel) string {
+	return GetRedisName(rc) + "-master"
+}
+
+// GetRedisReplicaName returns the name for the service pointing to the redis replicas
+func GetRedisReplicaName(rc *rsv1.RedisSentinel) string {
+	return GetRedisName(rc) + "-replicas"
+}
+
+// GetRedisExporterName returns the name for the service exposing the redis exporters
+func GetRedisExporterName(rc *rsv1.RedisSentinel) string {
+	return GetRedisName(rc) + ExporterName
+}
+
+// GetRedisAuthName returns the name for the secret holding the password of a RedisSentinel
+func GetRedisAuthName(rc *rsv1.RedisSentinel) string {
+	return GetRedisName(rc) + AuthName
+}
+
+// GetSentinelExporterName returns the name for the service exposing the sentinel exporters
+func GetSentinelExporterName(rc *rsv1.RedisSentinel) string {
+	return GetSentinelName(rc) + ExporterName
+}
+
 // GetRedisShutdownName returns the name for redis resources
 func GetRedisShutdownName(rc *rsv1.RedisSentinel) string {
 	return GenerateName(RedisShutdownName, rc.Name)
@@ -52,3 +100,23 @@ func GetSentinelReadinessCm(rc *rsv1.RedisSentinel) string {
 func GetSentinelHeadlessSvc(rc *rsv1.RedisSentinel) string {
 	return GenerateName("-sentinel-headless", rc.Name)
 }
+
+// GetShardedClusterName returns the name for the services of a RedisCluster
+func GetShardedClusterName(rc *rsv1.RedisCluster) string {
+	return GenerateName(ShardName, rc.Name)
+}
+
+// GetShardedClusterHeadlessSvc returns the name for the headless service of a RedisCluster
+func GetShardedClusterHeadlessSvc(rc *rsv1.RedisCluster) string {
+	return GetShardedClusterName(rc) + "-headless"
+}
+
+// GetShardName returns the name for the statefulset running the given shard
+func GetShardName(rc *rsv1.RedisCluster, shard int32) string {
+	return fmt.Sprintf("%s-%d", GetShardedClusterName(rc), shard)
+}
+
+// GetShardedClusterAuthName returns the name for the secret holding the password of a RedisCluster
+func GetShardedClusterAuthName(rc *rsv1.RedisCluster) string {
+	return GetShardedClusterName(rc) + AuthName
+}
@@ -0,0 +1,23 @@
+package util
+
+import (
+	"fmt"
+	"time"
+
+	rsv1 "redis-sentinel/api/v1"
+	"redis-sentinel/pkg/schedule"
+)
+
+// InMaintenanceWindow is true when the disruptive changes of the cluster can run now, always
+// when it has no maintenance window
+func InMaintenanceWindow(rs *rsv1.RedisSentinel, now time.Time) (bool, error) {
+	window := rs.Spec.MaintenanceWindow
+	if window == nil {
+		return true, nil
+	}
+	sched, err := schedule.Parse(window.Schedule)
+	if err != nil {
+		return false, fmt.Errorf("maintenanceWindow: %v", err)
+	}
+	return sched.InWindow(window.Duration.Duration, now), nil
+}
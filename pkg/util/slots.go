@@ -0,0 +1,162 @@
+package util
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// ClusterSlots is the number of hash slots of a redis cluster
+const ClusterSlots = 16384
+
+// ShardSlotRange returns the first and last slot given to the shard when the cluster is created,
+// the slots are split evenly between the shards
+func ShardSlotRange(shard, shards int32) (int, int) {
+	start := int(shard) * ClusterSlots / int(shards)
+	end := int(shard+1)*ClusterSlots/int(shards) - 1
+	return start, end
+}
+
+// ExpandSlotRanges returns the slots of ranges like 0-5460 or 5461 reported by CLUSTER NODES
+func ExpandSlotRanges(ranges []string) ([]int, error) {
+	slots := []int{}
+	for _, r := range ranges {
+		bounds := strings.SplitN(r, "-", 2)
+		start, err := strconv.Atoi(bounds[0])
+		if err != nil {
+			return nil, fmt.Errorf("slot range %q malformed", r)
+		}
+		end := start
+		if len(bounds) == 2 {
+			if end, err = strconv.Atoi(bounds[1]); err != nil {
+				return nil, fmt.Errorf("slot range %q malformed", r)
+			}
+		}
+		for slot := start; slot <= end; slot++ {
+			slots = append(slots, slot)
+		}
+	}
+	return slots, nil
+}
+
+// FormatSlotRanges returns the sorted slots as ranges, like 0-5460,5470
+func FormatSlotRanges(slots []int) string {
+	ranges := []string{}
+	for i := 0; i < len(slots); {
+		j := i
+		for j+1 < len(slots) && slots[j+1] == slots[j]+1 {
+			j++
+		}
+		if i == j {
+			ranges = append(ranges, strconv.Itoa(slots[i]))
+		} else {
+			ranges = append(ranges, fmt.Sprintf("%d-%d", slots[i], slots[j]))
+		}
+		i = j + 1
+	}
+	return strings.Join(ranges, ",")
+}
+
+// SlotMove is a set of slots moved from a shard to another
+type SlotMove struct {
+	Source int32
+	Target int32
+	Slots  []int
+}
+
+// PlanSlotMoves returns the slot moves balancing the loads of the first shards, the shards from
+// shards on are drained. owned are the sorted slots served by every shard and loads what they
+// are balanced on, their slot count, keys or memory. A shard gives away the share of its slots
+// above the average load, assuming its load is spread evenly on them, and the slots go to the
+// shards below the average in proportion of what they miss. The highest slots of a shard are
+// moved first so the slots of the shards stay in few ranges.
+func PlanSlotMoves(owned [][]int, loads []int64, shards int32) []SlotMove {
+	total := int64(0)
+	for _, load := range loads {
+		total += load
+	}
+	if total < int64(shards) {
+		// too little to balance on, the slots are balanced instead
+		loads = make([]int64, len(owned))
+		for s := range owned {
+			loads[s] = int64(len(owned[s]))
+			total += loads[s]
+		}
+	}
+	average := total / int64(shards)
+
+	give := make([]int, len(owned))
+	moved, draining := 0, false
+	for s := range owned {
+		switch {
+		case int32(s) >= shards:
+			give[s] = len(owned[s])
+			draining = draining || give[s] > 0
+		case loads[s] > average:
+			give[s] = int(int64(len(owned[s])) * (loads[s] - average) / loads[s])
+		}
+		moved += give[s]
+	}
+	if moved == 0 {
+		return nil
+	}
+
+	missing := make([]int64, shards)
+	sumMissing := int64(0)
+	for s := int32(0); s < shards && int(s) < len(owned); s++ {
+		if loads[s] < average {
+			missing[s] = average - loads[s]
+			sumMissing += missing[s]
+		}
+	}
+	for s := len(owned); s < int(shards); s++ {
+		// new shards serve nothing yet
+		missing[s] = average
+		sumMissing += average
+	}
+	if sumMissing == 0 {
+		if !draining {
+			return nil
+		}
+		// the shards left are balanced, they share the slots of the drained ones evenly
+		for s := range missing {
+			missing[s] = 1
+		}
+		sumMissing = int64(shards)
+	}
+
+	// the number of slots every shard receives, the rounding goes to the last one
+	want := make([]int, shards)
+	given := 0
+	last := -1
+	for s := range missing {
+		if missing[s] == 0 {
+			continue
+		}
+		want[s] = int(int64(moved) * missing[s] / sumMissing)
+		given += want[s]
+		last = s
+	}
+	if last >= 0 {
+		want[last] += moved - given
+	}
+
+	moves := []SlotMove{}
+	target := 0
+	for s := range owned {
+		slots := owned[s][len(owned[s])-give[s]:]
+		for len(slots) > 0 {
+			for want[target] == 0 {
+				target++
+			}
+			n := want[target]
+			if n > len(slots) {
+				n = len(slots)
+			}
+			moves = append(moves, SlotMove{Source: int32(s), Target: int32(target), Slots: slots[:n]})
+			want[target] -= n
+			slots = slots[n:]
+		}
+	}
+	return moves
+}
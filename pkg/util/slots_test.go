@@ -0,0 +1,149 @@
+package util
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestShardSlotRange(t *testing.T) {
+	tests := []struct {
+		name      string
+		shard     int32
+		shards    int32
+		wantStart int
+		wantEnd   int
+	}{
+		{name: "first of 3", shard: 0, shards: 3, wantStart: 0, wantEnd: 5460},
+		{name: "second of 3", shard: 1, shards: 3, wantStart: 5461, wantEnd: 10921},
+		{name: "last of 3", shard: 2, shards: 3, wantStart: 10922, wantEnd: 16383},
+		{name: "last of 5", shard: 4, shards: 5, wantStart: 13107, wantEnd: 16383},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			start, end := ShardSlotRange(tt.shard, tt.shards)
+			if start != tt.wantStart || end != tt.wantEnd {
+				t.Errorf("ShardSlotRange() got = %d-%d, want %d-%d", start, end, tt.wantStart, tt.wantEnd)
+			}
+		})
+	}
+}
+
+func TestExpandSlotRanges(t *testing.T) {
+	tests := []struct {
+		name    string
+		ranges  []string
+		want    []int
+		wantErr bool
+	}{
+		{name: "range", ranges: []string{"0-3"}, want: []int{0, 1, 2, 3}},
+		{name: "single slots", ranges: []string{"5", "7-8"}, want: []int{5, 7, 8}},
+		{name: "empty", ranges: nil, want: []int{}},
+		{name: "malformed", ranges: []string{"a-3"}, wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := ExpandSlotRanges(tt.ranges)
+			if (err != nil) != tt.wantErr {
+				t.Errorf("ExpandSlotRanges() error = %v, wantErr %v", err, tt.wantErr)
+				return
+			}
+			if !tt.wantErr && !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("ExpandSlotRanges() got = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestFormatSlotRanges(t *testing.T) {
+	tests := []struct {
+		name  string
+		slots []int
+		want  string
+	}{
+		{name: "range", slots: []int{0, 1, 2, 3}, want: "0-3"},
+		{name: "mixed", slots: []int{5, 7, 8, 10}, want: "5,7-8,10"},
+		{name: "empty", slots: nil, want: ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := FormatSlotRanges(tt.slots); got != tt.want {
+				t.Errorf("FormatSlotRanges() got = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func slotRange(start, end int) []int {
+	slots := []int{}
+	for slot := start; slot <= end; slot++ {
+		slots = append(slots, slot)
+	}
+	return slots
+}
+
+func TestPlanSlotMoves(t *testing.T) {
+	tests := []struct {
+		name   string
+		owned  [][]int
+		loads  []int64
+		shards int32
+		want   []SlotMove
+	}{
+		{
+			name:   "balanced",
+			owned:  [][]int{slotRange(0, 5460), slotRange(5461, 10921), slotRange(10922, 16383)},
+			loads:  []int64{5461, 5461, 5462},
+			shards: 3,
+			want:   nil,
+		},
+		{
+			name:   "grow from 3 to 4 shards",
+			owned:  [][]int{slotRange(0, 5460), slotRange(5461, 10921), slotRange(10922, 16383), {}},
+			loads:  []int64{5461, 5461, 5462, 0},
+			shards: 4,
+			want: []SlotMove{
+				{Source: 0, Target: 3, Slots: slotRange(4096, 5460)},
+				{Source: 1, Target: 3, Slots: slotRange(9557, 10921)},
+				{Source: 2, Target: 3, Slots: slotRange(15018, 16383)},
+			},
+		},
+		{
+			name:   "shrink from 4 to 3 shards",
+			owned:  [][]int{slotRange(0, 4095), slotRange(4096, 8191), slotRange(8192, 12287), slotRange(12288, 16383)},
+			loads:  []int64{4096, 4096, 4096, 4096},
+			shards: 3,
+			want: []SlotMove{
+				{Source: 3, Target: 0, Slots: slotRange(12288, 13652)},
+				{Source: 3, Target: 1, Slots: slotRange(13653, 15017)},
+				{Source: 3, Target: 2, Slots: slotRange(15018, 16383)},
+			},
+		},
+		{
+			name:   "balance on keys",
+			owned:  [][]int{slotRange(0, 99), slotRange(100, 199), {}},
+			loads:  []int64{300, 0, 0},
+			shards: 3,
+			want: []SlotMove{
+				{Source: 0, Target: 1, Slots: slotRange(34, 66)},
+				{Source: 0, Target: 2, Slots: slotRange(67, 99)},
+			},
+		},
+		{
+			name:   "drain an empty shard",
+			owned:  [][]int{slotRange(0, 1), slotRange(2, 3), slotRange(4, 5)},
+			loads:  []int64{10, 10, 0},
+			shards: 2,
+			want: []SlotMove{
+				{Source: 2, Target: 0, Slots: []int{4}},
+				{Source: 2, Target: 1, Slots: []int{5}},
+			},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := PlanSlotMoves(tt.owned, tt.loads, tt.shards); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("PlanSlotMoves() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
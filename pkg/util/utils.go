@@ -1,6 +1,7 @@
 package util
 
 import (
+	"fmt"
 	"strconv"
 	"strings"
 )
@@ -15,16 +16,42 @@ const (
 
 var isClusterScoped = true
 
+// IsClusterScoped is true when the operator watches all the namespaces, a namespace scoped
+// operator can't read the cluster wide resources like the nodes and the StorageClasses
 func IsClusterScoped() bool {
 	return isClusterScoped
 }
 
-func SetClusterScoped(namespace string) {
-	if namespace != "" {
-		isClusterScoped = false
+// SetClusterScoped sets the scope of the operator from the namespaces it watches, it is
+// namespace scoped when they are given
+func SetClusterScoped(namespaces []string) {
+	isClusterScoped = len(namespaces) == 0
+}
+
+var clusterDomain = "cluster.local"
+
+// GetClusterDomain returns the DNS domain of the kubernetes cluster
+func GetClusterDomain() string {
+	return clusterDomain
+}
+
+// SetClusterDomain overrides the DNS domain of the kubernetes cluster
+func SetClusterDomain(domain string) {
+	if domain != "" {
+		clusterDomain = domain
 	}
 }
 
+// GetPodFQDN returns the DNS name of a pod governed by the given headless service
+func GetPodFQDN(podName, serviceName, namespace string) string {
+	return fmt.Sprintf("%s.%s.%s.svc.%s", podName, serviceName, namespace, clusterDomain)
+}
+
+// GetServiceFQDN returns the DNS name of a service
+func GetServiceFQDN(serviceName, namespace string) string {
+	return fmt.Sprintf("%s.%s.svc.%s", serviceName, namespace, clusterDomain)
+}
+
 func ParseRedisMemConf(p string) (string, error) {
 	var mul int64 = 1
 	u := strings.ToLower(p)
@@ -60,3 +87,24 @@ func ParseRedisMemConf(p string) (string, error) {
 
 	return strconv.FormatInt(val*mul, 10), nil
 }
+
+// ContainsString returns true if the slice has the given string
+func ContainsString(slice []string, s string) bool {
+	for _, item := range slice {
+		if item == s {
+			return true
+		}
+	}
+	return false
+}
+
+// RemoveString returns a copy of the slice without the given string
+func RemoveString(slice []string, s string) []string {
+	result := make([]string, 0, len(slice))
+	for _, item := range slice {
+		if item != s {
+			result = append(result, item)
+		}
+	}
+	return result
+}
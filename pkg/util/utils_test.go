@@ -1,6 +1,9 @@
 package util
 
-import "testing"
+import (
+	"reflect"
+	"testing"
+)
 
 func TestParseRedisMemConf(t *testing.T) {
 	type args struct {
@@ -114,3 +117,111 @@ func TestParseRedisMemConf(t *testing.T) {
 		})
 	}
 }
+
+func TestGetPodFQDN(t *testing.T) {
+	tests := []struct {
+		name    string
+		pod     string
+		service string
+		ns      string
+		domain  string
+		want    string
+	}{
+		{
+			name:    "default domain",
+			pod:     "redis-cluster-foo-0",
+			service: "redis-cluster-foo",
+			ns:      "default",
+			want:    "redis-cluster-foo-0.redis-cluster-foo.default.svc.cluster.local",
+		},
+		{
+			name:    "custom domain",
+			pod:     "redis-sentinel-foo-1",
+			service: "redis-sentinel-headless-foo",
+			ns:      "db",
+			domain:  "k8s.internal",
+			want:    "redis-sentinel-foo-1.redis-sentinel-headless-foo.db.svc.k8s.internal",
+		},
+	}
+	defer SetClusterDomain("cluster.local")
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			SetClusterDomain(tt.domain)
+			if got := GetPodFQDN(tt.pod, tt.service, tt.ns); got != tt.want {
+				t.Errorf("GetPodFQDN() got = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestGetServiceFQDN(t *testing.T) {
+	tests := []struct {
+		name    string
+		service string
+		ns      string
+		domain  string
+		want    string
+	}{
+		{
+			name:    "default domain",
+			service: "redis-cluster-foo-master",
+			ns:      "default",
+			want:    "redis-cluster-foo-master.default.svc.cluster.local",
+		},
+		{
+			name:    "custom domain",
+			service: "redis-cluster-foo-master",
+			ns:      "db",
+			domain:  "k8s.internal",
+			want:    "redis-cluster-foo-master.db.svc.k8s.internal",
+		},
+	}
+	defer SetClusterDomain("cluster.local")
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			SetClusterDomain(tt.domain)
+			if got := GetServiceFQDN(tt.service, tt.ns); got != tt.want {
+				t.Errorf("GetServiceFQDN() got = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestRemoveString(t *testing.T) {
+	tests := []struct {
+		name  string
+		slice []string
+		s     string
+		want  []string
+	}{
+		{
+			name:  "present",
+			slice: []string{"foo", "redis.xuan.io/finalizer", "bar"},
+			s:     "redis.xuan.io/finalizer",
+			want:  []string{"foo", "bar"},
+		},
+		{
+			name:  "missing",
+			slice: []string{"foo"},
+			s:     "redis.xuan.io/finalizer",
+			want:  []string{"foo"},
+		},
+		{
+			name:  "empty",
+			slice: nil,
+			s:     "redis.xuan.io/finalizer",
+			want:  []string{},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := RemoveString(tt.slice, tt.s)
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("RemoveString() got = %v, want %v", got, tt.want)
+			}
+			if ContainsString(got, tt.s) {
+				t.Errorf("ContainsString() got = true after RemoveString()")
+			}
+		})
+	}
+}
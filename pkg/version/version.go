@@ -0,0 +1,214 @@
+package version
+
+import (
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+// Flavors of the servers the operator can run
+const (
+	FlavorRedis  = "redis"
+	FlavorValkey = "valkey"
+)
+
+// minimum major version supported for every flavor
+var minSupportedMajor = map[string]int{
+	FlavorRedis:  5,
+	FlavorValkey: 7,
+}
+
+var (
+	versionRE       = regexp.MustCompile(`^v?([0-9]+)(?:\.([0-9]+))?(?:\.([0-9]+))?`)
+	redisVersionRE  = regexp.MustCompile(`(?m)^redis_version:([0-9.]+)`)
+	valkeyVersionRE = regexp.MustCompile(`(?m)^valkey_version:([0-9.]+)`)
+)
+
+// ServerVersion is the flavor and version of a redis or sentinel server. A Minor of -1
+// means any minor version, it comes from an image tag like redis:7
+type ServerVersion struct {
+	Flavor string
+	Major  int
+	Minor  int
+	Patch  int
+}
+
+// String returns the version as "flavor major.minor.patch"
+func (v *ServerVersion) String() string {
+	if v.Minor < 0 {
+		return fmt.Sprintf("%s %d", v.Flavor, v.Major)
+	}
+	return fmt.Sprintf("%s %d.%d.%d", v.Flavor, v.Major, v.Minor, v.Patch)
+}
+
+// ParseVersion parses a version like 7.2.4 of the given flavor
+func ParseVersion(flavor, version string) (*ServerVersion, error) {
+	match := versionRE.FindStringSubmatch(version)
+	if len(match) == 0 {
+		return nil, fmt.Errorf("version %q of %s malformed", version, flavor)
+	}
+	v := &ServerVersion{Flavor: flavor, Minor: -1}
+	v.Major, _ = strconv.Atoi(match[1])
+	if match[2] != "" {
+		v.Minor, _ = strconv.Atoi(match[2])
+	}
+	if match[3] != "" {
+		v.Patch, _ = strconv.Atoi(match[3])
+	}
+	return v, nil
+}
+
+// ParseServerInfo returns the version reported by the server section of INFO. Valkey reports
+// a redis_version for compatibility, its own version is valkey_version
+func ParseServerInfo(info string) (*ServerVersion, error) {
+	if match := valkeyVersionRE.FindStringSubmatch(info); len(match) != 0 {
+		return ParseVersion(FlavorValkey, match[1])
+	}
+	if match := redisVersionRE.FindStringSubmatch(info); len(match) != 0 {
+		return ParseVersion(FlavorRedis, match[1])
+	}
+	return nil, fmt.Errorf("no version found in server info")
+}
+
+// ParseImageVersion returns the version of the tag of the image, false when the tag isn't
+// a version, like latest
+func ParseImageVersion(image string) (*ServerVersion, bool) {
+	if i := strings.Index(image, "@"); i >= 0 {
+		image = image[:i]
+	}
+	repository, tag := image, ""
+	if i := strings.LastIndex(image, ":"); i > strings.LastIndex(image, "/") {
+		repository, tag = image[:i], image[i+1:]
+	}
+	flavor := FlavorRedis
+	if strings.Contains(repository[strings.LastIndex(repository, "/")+1:], FlavorValkey) {
+		flavor = FlavorValkey
+	}
+	v, err := ParseVersion(flavor, tag)
+	if err != nil {
+		return nil, false
+	}
+	return v, true
+}
+
+// CheckSupported returns an error if the operator can't manage this version
+func (v *ServerVersion) CheckSupported() error {
+	min, ok := minSupportedMajor[v.Flavor]
+	if !ok {
+		return fmt.Errorf("%s is not supported", v.Flavor)
+	}
+	if v.Major < min {
+		return fmt.Errorf("%s is not supported, the minimum is %s %d", v, v.Flavor, min)
+	}
+	return nil
+}
+
+// UsesReplicaNames is true when the server prefers the replica commands and config keys
+// over the slave ones
+func (v *ServerVersion) UsesReplicaNames() bool {
+	return v != nil && (v.Flavor == FlavorValkey || v.Major >= 6)
+}
+
+// UsesListpack is true when the server names the compact encodings listpack instead of ziplist
+func (v *ServerVersion) UsesListpack() bool {
+	return v != nil && v.Major >= 7
+}
+
+// OlderThan is true when v is a release before major.minor, an image tag without a minor
+// version is only compared on its major one
+func (v *ServerVersion) OlderThan(major, minor int) bool {
+	return v.lessThan(major, minor)
+}
+
+// lessThan compares the major and minor versions, the minor only when both know it
+func (v *ServerVersion) lessThan(major, minor int) bool {
+	if v.Major != major || v.Minor < 0 || minor < 0 {
+		return v.Major < major
+	}
+	return v.Minor < minor
+}
+
+// IsDowngrade returns true when the data written by from can't be loaded by to. Valkey 7
+// is redis 7.2, the later releases of both flavors use formats unknown by the other one
+func IsDowngrade(from, to *ServerVersion) bool {
+	switch {
+	case from.Flavor == to.Flavor:
+		return to.lessThan(from.Major, from.Minor)
+	case from.Flavor == FlavorRedis:
+		// redis to valkey, up to redis 7.2
+		return !from.lessThan(7, 3) || to.lessThan(7, 2)
+	default:
+		// valkey to redis, only valkey 7 to redis 7.2
+		return from.Major >= 8 || to.lessThan(7, 2)
+	}
+}
+
+// IsNewer returns true when v is a later release than the given version, or when the
+// given version can't load the data written by v
+func IsNewer(v, than *ServerVersion) bool {
+	if v.Flavor != than.Flavor {
+		return IsDowngrade(v, than)
+	}
+	if v.Major != than.Major {
+		return v.Major > than.Major
+	}
+	if v.Minor != than.Minor {
+		return v.Minor > than.Minor
+	}
+	return v.Patch > than.Patch
+}
+
+// configRenames are the config keys renamed by the newer servers, the old names
+// are kept as aliases
+var (
+	replicaConfigRenames = map[string]string{
+		"slave-priority":         "replica-priority",
+		"slave-read-only":        "replica-read-only",
+		"slave-serve-stale-data": "replica-serve-stale-data",
+		"slave-lazy-flush":       "replica-lazy-flush",
+		"slave-ignore-maxmemory": "replica-ignore-maxmemory",
+		"slave-announce-ip":      "replica-announce-ip",
+		"slave-announce-port":    "replica-announce-port",
+	}
+	listpackConfigRenames = map[string]string{
+		"hash-max-ziplist-entries": "hash-max-listpack-entries",
+		"hash-max-ziplist-value":   "hash-max-listpack-value",
+		"zset-max-ziplist-entries": "zset-max-listpack-entries",
+		"zset-max-ziplist-value":   "zset-max-listpack-value",
+		"list-max-ziplist-size":    "list-max-listpack-size",
+	}
+)
+
+// ConfigName returns the name of the config key the server prefers
+func ConfigName(v *ServerVersion, key string) string {
+	if v.UsesReplicaNames() {
+		if name, ok := replicaConfigRenames[key]; ok {
+			return name
+		}
+	}
+	for old, name := range listpackConfigRenames {
+		if v.UsesListpack() && key == old {
+			return name
+		}
+		if !v.UsesListpack() && key == name {
+			return old
+		}
+	}
+	return key
+}
+
+// ConfigAliases returns the config keys with the same meaning as the given one
+func ConfigAliases(key string) []string {
+	aliases := []string{}
+	for _, renames := range []map[string]string{replicaConfigRenames, listpackConfigRenames} {
+		for old, name := range renames {
+			if key == old {
+				aliases = append(aliases, name)
+			} else if key == name {
+				aliases = append(aliases, old)
+			}
+		}
+	}
+	return aliases
+}
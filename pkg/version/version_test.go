@@ -0,0 +1,227 @@
+package version
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestParseServerInfo(t *testing.T) {
+	tests := []struct {
+		name    string
+		info    string
+		want    *ServerVersion
+		wantErr bool
+	}{
+		{
+			name: "redis 5",
+			info: "# Server\r\nredis_version:5.0.14\r\nredis_git_sha1:00000000\r\n",
+			want: &ServerVersion{Flavor: FlavorRedis, Major: 5, Minor: 0, Patch: 14},
+		},
+		{
+			name: "redis 7",
+			info: "# Server\r\nredis_version:7.2.4\r\nredis_mode:standalone\r\n",
+			want: &ServerVersion{Flavor: FlavorRedis, Major: 7, Minor: 2, Patch: 4},
+		},
+		{
+			name: "valkey 8",
+			info: "# Server\r\nredis_version:7.2.4\r\nserver_name:valkey\r\nvalkey_version:8.0.1\r\n",
+			want: &ServerVersion{Flavor: FlavorValkey, Major: 8, Minor: 0, Patch: 1},
+		},
+		{
+			name:    "no version",
+			info:    "# Server\r\nredis_mode:standalone\r\n",
+			wantErr: true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := ParseServerInfo(tt.info)
+			if (err != nil) != tt.wantErr {
+				t.Errorf("ParseServerInfo() error = %v, wantErr %v", err, tt.wantErr)
+				return
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("ParseServerInfo() got = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestParseImageVersion(t *testing.T) {
+	tests := []struct {
+		name   string
+		image  string
+		want   *ServerVersion
+		wantOk bool
+	}{
+		{
+			name:   "redis",
+			image:  "redis:6.2.14-alpine",
+			want:   &ServerVersion{Flavor: FlavorRedis, Major: 6, Minor: 2, Patch: 14},
+			wantOk: true,
+		},
+		{
+			name:   "major only",
+			image:  "registry:5000/library/redis:7",
+			want:   &ServerVersion{Flavor: FlavorRedis, Major: 7, Minor: -1},
+			wantOk: true,
+		},
+		{
+			name:   "valkey",
+			image:  "valkey/valkey:8.0@sha256:abc",
+			want:   &ServerVersion{Flavor: FlavorValkey, Major: 8, Minor: 0},
+			wantOk: true,
+		},
+		{
+			name:  "latest",
+			image: "redis:latest",
+		},
+		{
+			name:  "no tag",
+			image: "registry:5000/redis",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, ok := ParseImageVersion(tt.image)
+			if ok != tt.wantOk {
+				t.Errorf("ParseImageVersion() ok = %v, want %v", ok, tt.wantOk)
+				return
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("ParseImageVersion() got = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestIsDowngrade(t *testing.T) {
+	tests := []struct {
+		name string
+		from *ServerVersion
+		to   *ServerVersion
+		want bool
+	}{
+		{
+			name: "upgrade",
+			from: &ServerVersion{Flavor: FlavorRedis, Major: 6, Minor: 2},
+			to:   &ServerVersion{Flavor: FlavorRedis, Major: 7, Minor: 0},
+		},
+		{
+			name: "patch downgrade",
+			from: &ServerVersion{Flavor: FlavorRedis, Major: 7, Minor: 2, Patch: 4},
+			to:   &ServerVersion{Flavor: FlavorRedis, Major: 7, Minor: 2, Patch: 1},
+		},
+		{
+			name: "minor downgrade",
+			from: &ServerVersion{Flavor: FlavorRedis, Major: 7, Minor: 2},
+			to:   &ServerVersion{Flavor: FlavorRedis, Major: 7, Minor: 0},
+			want: true,
+		},
+		{
+			name: "major only tag",
+			from: &ServerVersion{Flavor: FlavorRedis, Major: 7, Minor: 2},
+			to:   &ServerVersion{Flavor: FlavorRedis, Major: 7, Minor: -1},
+		},
+		{
+			name: "redis 7.2 to valkey",
+			from: &ServerVersion{Flavor: FlavorRedis, Major: 7, Minor: 2},
+			to:   &ServerVersion{Flavor: FlavorValkey, Major: 8, Minor: 0},
+		},
+		{
+			name: "redis 7.4 to valkey",
+			from: &ServerVersion{Flavor: FlavorRedis, Major: 7, Minor: 4},
+			to:   &ServerVersion{Flavor: FlavorValkey, Major: 8, Minor: 0},
+			want: true,
+		},
+		{
+			name: "valkey 7 to redis 7.2",
+			from: &ServerVersion{Flavor: FlavorValkey, Major: 7, Minor: 2},
+			to:   &ServerVersion{Flavor: FlavorRedis, Major: 7, Minor: 2},
+		},
+		{
+			name: "valkey 8 to redis",
+			from: &ServerVersion{Flavor: FlavorValkey, Major: 8, Minor: 0},
+			to:   &ServerVersion{Flavor: FlavorRedis, Major: 7, Minor: 4},
+			want: true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := IsDowngrade(tt.from, tt.to); got != tt.want {
+				t.Errorf("IsDowngrade() got = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestOlderThan(t *testing.T) {
+	tests := []struct {
+		image string
+		want  bool
+	}{
+		{image: "redis:5.0.4-alpine", want: true},
+		{image: "redis:6.0.9", want: true},
+		{image: "redis:6.2.0"},
+		{image: "redis:7"},
+		{image: "valkey/valkey:7.2"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.image, func(t *testing.T) {
+			v, ok := ParseImageVersion(tt.image)
+			if !ok {
+				t.Fatalf("ParseImageVersion(%s) found no version", tt.image)
+			}
+			if got := v.OlderThan(6, 2); got != tt.want {
+				t.Errorf("OlderThan(6, 2) got = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestConfigName(t *testing.T) {
+	tests := []struct {
+		name    string
+		version *ServerVersion
+		key     string
+		want    string
+	}{
+		{
+			name:    "redis 5",
+			version: &ServerVersion{Flavor: FlavorRedis, Major: 5},
+			key:     "slave-priority",
+			want:    "slave-priority",
+		},
+		{
+			name:    "redis 7",
+			version: &ServerVersion{Flavor: FlavorRedis, Major: 7},
+			key:     "slave-priority",
+			want:    "replica-priority",
+		},
+		{
+			name:    "listpack on redis 6",
+			version: &ServerVersion{Flavor: FlavorRedis, Major: 6},
+			key:     "hash-max-listpack-entries",
+			want:    "hash-max-ziplist-entries",
+		},
+		{
+			name:    "ziplist on valkey 8",
+			version: &ServerVersion{Flavor: FlavorValkey, Major: 8},
+			key:     "zset-max-ziplist-value",
+			want:    "zset-max-listpack-value",
+		},
+		{
+			name:    "unknown version",
+			version: nil,
+			key:     "maxmemory",
+			want:    "maxmemory",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := ConfigName(tt.version, tt.key); got != tt.want {
+				t.Errorf("ConfigName() got = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,142 @@
+package service
+
+import (
+	"fmt"
+
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+
+	rsv1 "redis-sentinel/api/v1"
+	"redis-sentinel/pkg/k8s"
+	"redis-sentinel/pkg/metrics"
+	"redis-sentinel/pkg/util"
+)
+
+// Names of the default alerts, used to disable them in the spec
+const (
+	AlertMasterDown          = "RedisMasterDown"
+	AlertSentinelNoQuorum    = "RedisSentinelNoQuorum"
+	AlertReplicaLag          = "RedisReplicaLag"
+	AlertMemoryNearMax       = "RedisMemoryNearMaxmemory"
+	AlertRejectedConnections = "RedisRejectedConnections"
+	AlertRDBFailing          = "RedisRDBSaveFailing"
+)
+
+const (
+	severityCritical = "critical"
+	severityWarning  = "warning"
+)
+
+// alertRule is a default alert before being rendered in the PrometheusRule
+type alertRule struct {
+	name     string
+	expr     string
+	severity string
+	summary  string
+	// condition is the status condition of the cluster reporting the same problem
+	condition rsv1.ConditionType
+}
+
+// generateAlertRules returns the default alerts of the cluster with the thresholds of the spec
+func generateAlertRules(rs *rsv1.RedisSentinel) []alertRule {
+	alerts := rs.Spec.Monitoring.Alerts
+	redisSelector := fmt.Sprintf(`namespace="%s",service="%s"`, rs.Namespace, util.GetRedisExporterName(rs))
+	operatorSelector := fmt.Sprintf(`kind="%s",namespace="%s",name="%s"`, rsv1.Kind, rs.Namespace, rs.Name)
+	quorumRatio := float64(GetQuorum(rs)) / float64(rs.Spec.Sentinel.Replicas)
+
+	return []alertRule{
+		{
+			name:      AlertMasterDown,
+			expr:      fmt.Sprintf(`(count(redis_instance_info{%s,role="master"}) or vector(0)) < 1`, redisSelector),
+			severity:  severityCritical,
+			summary:   "No redis master is up",
+			condition: rsv1.ConditionAvailable,
+		},
+		{
+			name:      AlertSentinelNoQuorum,
+			expr:      fmt.Sprintf(`%s{%s} < %g`, metrics.MetricName("sentinel_agreement_ratio"), operatorSelector, quorumRatio),
+			severity:  severityCritical,
+			summary:   "Not enough sentinels agree on the master to reach the quorum",
+			condition: rsv1.ConditionSentinelQuorum,
+		},
+		{
+			name:      AlertReplicaLag,
+			expr:      fmt.Sprintf(`max(%s{%s}) > %d`, metrics.MetricName("replica_lag_bytes"), operatorSelector, alerts.ReplicaLagBytes),
+			severity:  severityWarning,
+			summary:   fmt.Sprintf("A replica is more than %d bytes behind the master", alerts.ReplicaLagBytes),
+			condition: rsv1.ConditionReplicationHealthy,
+		},
+		{
+			name: AlertMemoryNearMax,
+			expr: fmt.Sprintf(`redis_memory_used_bytes{%[1]s} * 100 / (redis_memory_max_bytes{%[1]s} > 0) > %[2]d`,
+				redisSelector, alerts.MemoryUsagePercent),
+			severity:  severityWarning,
+			summary:   fmt.Sprintf("Redis uses more than %d%% of its maxmemory", alerts.MemoryUsagePercent),
+			condition: rsv1.ConditionReady,
+		},
+		{
+			name:      AlertRejectedConnections,
+			expr:      fmt.Sprintf(`increase(redis_rejected_connections_total{%s}[5m]) > 0`, redisSelector),
+			severity:  severityWarning,
+			summary:   "Redis rejected connections because maxclients was reached",
+			condition: rsv1.ConditionReady,
+		},
+		{
+			name:      AlertRDBFailing,
+			expr:      fmt.Sprintf(`redis_rdb_last_bgsave_status{%s} == 0`, redisSelector),
+			severity:  severityWarning,
+			summary:   "The last RDB save of redis failed",
+			condition: rsv1.ConditionReady,
+		},
+	}
+}
+
+// generatePrometheusRule creates the PrometheusRule holding the enabled default alerts of the cluster
+func generatePrometheusRule(rs *rsv1.RedisSentinel, labels map[string]string, ownerRefs []metav1.OwnerReference) *unstructured.Unstructured {
+	alerts := rs.Spec.Monitoring.Alerts
+	disabled := make(map[string]bool, len(alerts.Disabled))
+	for _, name := range alerts.Disabled {
+		disabled[name] = true
+	}
+
+	rules := []interface{}{}
+	for _, rule := range generateAlertRules(rs) {
+		if disabled[rule.name] {
+			continue
+		}
+		ruleLabels := map[string]interface{}{
+			"severity": rule.severity,
+		}
+		for key, value := range alerts.AlertLabels {
+			ruleLabels[key] = value
+		}
+		rules = append(rules, map[string]interface{}{
+			"alert":  rule.name,
+			"expr":   rule.expr,
+			"for":    alerts.For,
+			"labels": ruleLabels,
+			"annotations": map[string]interface{}{
+				"summary": rule.summary,
+				"description": fmt.Sprintf("%s on redis cluster %s/%s. Check the %s condition with: kubectl -n %s get redissentinel %s -o jsonpath='{.status.conditions}'",
+					rule.summary, rs.Namespace, rs.Name, rule.condition, rs.Namespace, rs.Name),
+				"status_condition": string(rule.condition),
+			},
+		})
+	}
+
+	pr := &unstructured.Unstructured{}
+	pr.SetGroupVersionKind(k8s.PrometheusRuleGVK)
+	pr.SetName(util.GetRedisName(rs))
+	pr.SetNamespace(rs.Namespace)
+	pr.SetLabels(util.MergeLabels(labels, alerts.Labels))
+	pr.SetOwnerReferences(ownerRefs)
+	pr.Object["spec"] = map[string]interface{}{
+		"groups": []interface{}{
+			map[string]interface{}{
+				"name":  fmt.Sprintf("%s.%s.rules", rs.Namespace, rs.Name),
+				"rules": rules,
+			},
+		},
+	}
+	return pr
+}
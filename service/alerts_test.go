@@ -0,0 +1,102 @@
+package service
+
+import (
+	"strings"
+	"testing"
+
+	rsv1 "redis-sentinel/api/v1"
+)
+
+func newAlertsCluster(t *testing.T, alerts *rsv1.AlertSettings) *rsv1.RedisSentinel {
+	t.Helper()
+	rs := newStorageCluster("1Gi")
+	rs.Spec.Sentinel.Replicas = 3
+	rs.Spec.Exporter.Enabled = true
+	rs.Spec.Monitoring = &rsv1.MonitoringSettings{Alerts: alerts}
+	if err := rs.Validate(); err != nil {
+		t.Fatal(err)
+	}
+	return rs
+}
+
+func TestGenerateAlertRules(t *testing.T) {
+	tests := []struct {
+		name   string
+		alerts *rsv1.AlertSettings
+		// wantExprs are the thresholds expected in the expression of each alert
+		wantExprs map[string]string
+	}{
+		{
+			name:   "default thresholds",
+			alerts: &rsv1.AlertSettings{},
+			wantExprs: map[string]string{
+				AlertMasterDown:       `role="master"`,
+				AlertSentinelNoQuorum: "< 0.666",
+				AlertReplicaLag:       "> 10485760",
+				AlertMemoryNearMax:    "> 90",
+			},
+		},
+		{
+			name:   "thresholds of the spec",
+			alerts: &rsv1.AlertSettings{ReplicaLagBytes: 1024, MemoryUsagePercent: 75},
+			wantExprs: map[string]string{
+				AlertReplicaLag:    "> 1024",
+				AlertMemoryNearMax: "> 75",
+			},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rs := newAlertsCluster(t, tt.alerts)
+
+			rules := map[string]alertRule{}
+			for _, rule := range generateAlertRules(rs) {
+				rules[rule.name] = rule
+				if !strings.Contains(rule.expr, `namespace="`+testNamespace+`"`) {
+					t.Errorf("%s expr = %s, want it limited to the namespace of the cluster", rule.name, rule.expr)
+				}
+				if rule.condition == "" {
+					t.Errorf("%s has no status condition", rule.name)
+				}
+			}
+			for name, want := range tt.wantExprs {
+				rule, ok := rules[name]
+				if !ok {
+					t.Errorf("alert %s missing", name)
+					continue
+				}
+				if !strings.Contains(rule.expr, want) {
+					t.Errorf("%s expr = %s, want %q", name, rule.expr, want)
+				}
+			}
+		})
+	}
+}
+
+func TestGeneratePrometheusRule(t *testing.T) {
+	rs := newAlertsCluster(t, &rsv1.AlertSettings{Disabled: []string{AlertRDBFailing}})
+
+	pr := generatePrometheusRule(rs, nil, nil)
+	groups := pr.Object["spec"].(map[string]interface{})["groups"].([]interface{})
+	rules := groups[0].(map[string]interface{})["rules"].([]interface{})
+	if len(rules) != len(generateAlertRules(rs))-1 {
+		t.Errorf("got %d rules, want all of them but the disabled one", len(rules))
+	}
+	for _, r := range rules {
+		rule := r.(map[string]interface{})
+		if rule["alert"] == AlertRDBFailing {
+			t.Errorf("disabled alert %s rendered", AlertRDBFailing)
+		}
+		if rule["for"] != "5m" {
+			t.Errorf("%s for = %v, want the default 5m", rule["alert"], rule["for"])
+		}
+	}
+}
+
+func TestAlertsNeedExporter(t *testing.T) {
+	rs := newStorageCluster("1Gi")
+	rs.Spec.Monitoring = &rsv1.MonitoringSettings{Alerts: &rsv1.AlertSettings{}}
+	if err := rs.Validate(); err == nil {
+		t.Errorf("Validate() accepted alerts without the exporter")
+	}
+}
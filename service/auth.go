@@ -0,0 +1,89 @@
+package service
+
+import (
+	"fmt"
+	"strings"
+
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+// The secret holding the password of a cluster. The redis include its auth.conf, the password
+// never shows on their command line, and the clients read its password key.
+const (
+	authVolumeName  = "redis-auth"
+	authMountPath   = "/redis-auth"
+	authPasswordKey = "password"
+	authConfigKey   = "auth.conf"
+)
+
+// generateAuthSecret generates the secret holding the password of the redis of a cluster
+func generateAuthSecret(name, namespace, password string, labels map[string]string, ownerRefs []metav1.OwnerReference) *corev1.Secret {
+	return &corev1.Secret{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:            name,
+			Namespace:       namespace,
+			Labels:          labels,
+			OwnerReferences: ownerRefs,
+		},
+		Type: corev1.SecretTypeOpaque,
+		Data: map[string][]byte{
+			authPasswordKey: []byte(password),
+			authConfigKey:   []byte(getAuthConfig(password)),
+		},
+	}
+}
+
+// getAuthConfig returns the redis directives setting the password, none without password
+func getAuthConfig(password string) string {
+	if password == "" {
+		return ""
+	}
+	quoted := quoteConfigValue(password)
+	return fmt.Sprintf("requirepass %s\nmasterauth %s\n", quoted, quoted)
+}
+
+// quoteConfigValue quotes a value of the redis config file, the backslashes and the double
+// quotes are escaped
+func quoteConfigValue(value string) string {
+	return `"` + strings.NewReplacer(`\`, `\\`, `"`, `\"`).Replace(value) + `"`
+}
+
+// getAuthEnv returns the variable reading the password from the secret
+func getAuthEnv(name, secretName string) corev1.EnvVar {
+	return corev1.EnvVar{
+		Name: name,
+		ValueFrom: &corev1.EnvVarSource{
+			SecretKeyRef: &corev1.SecretKeySelector{
+				LocalObjectReference: corev1.LocalObjectReference{Name: secretName},
+				Key:                  authPasswordKey,
+			},
+		},
+	}
+}
+
+// getAuthVolume returns the volume of the secret holding the password
+func getAuthVolume(secretName string) corev1.Volume {
+	return corev1.Volume{
+		Name: authVolumeName,
+		VolumeSource: corev1.VolumeSource{
+			Secret: &corev1.SecretVolumeSource{
+				SecretName: secretName,
+			},
+		},
+	}
+}
+
+// getAuthVolumeMount mounts the secret holding the password read-only
+func getAuthVolumeMount() corev1.VolumeMount {
+	return corev1.VolumeMount{
+		Name:      authVolumeName,
+		MountPath: authMountPath,
+		ReadOnly:  true,
+	}
+}
+
+// getAuthInclude is the redis-server option loading the password from the mounted secret
+func getAuthInclude() string {
+	return fmt.Sprintf("--include %s/%s", authMountPath, authConfigKey)
+}
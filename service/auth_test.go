@@ -0,0 +1,95 @@
+package service
+
+import (
+	"encoding/json"
+	"strings"
+	"testing"
+
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+
+	rsv1 "redis-sentinel/api/v1"
+	"redis-sentinel/pkg/util"
+)
+
+func TestGetAuthConfig(t *testing.T) {
+	tests := []struct {
+		name     string
+		password string
+		want     string
+	}{
+		{
+			name: "no password",
+		},
+		{
+			name:     "plain",
+			password: "secret",
+			want:     "requirepass \"secret\"\nmasterauth \"secret\"\n",
+		},
+		{
+			name:     "quotes and backslashes",
+			password: `a"b\c 'd`,
+			want:     "requirepass \"a\\\"b\\\\c 'd\"\nmasterauth \"a\\\"b\\\\c 'd\"\n",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := getAuthConfig(tt.password); got != tt.want {
+				t.Errorf("getAuthConfig() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestShardPasswordNotOnCommandLine(t *testing.T) {
+	rc := &rsv1.RedisCluster{
+		ObjectMeta: metav1.ObjectMeta{Name: "test", Namespace: testNamespace},
+		Spec:       rsv1.RedisClusterSpec{Shards: 3, Password: "secret"},
+	}
+	ss := generateShardStatefulSet(rc, 0, nil, nil)
+	container := ss.Spec.Template.Spec.Containers[0]
+	if command := strings.Join(container.Command, " "); strings.Contains(command, "secret") {
+		t.Errorf("the command %q holds the password", command)
+	}
+	mounted := false
+	for _, mount := range container.VolumeMounts {
+		mounted = mounted || mount.Name == authVolumeName
+	}
+	if !mounted {
+		t.Errorf("the auth secret is not mounted")
+	}
+
+	secret := generateShardedClusterAuthSecret(rc, nil, nil)
+	if string(secret.Data[authPasswordKey]) != "secret" {
+		t.Errorf("secret password = %q, want %q", secret.Data[authPasswordKey], "secret")
+	}
+}
+
+func TestRedisPasswordNotInStatefulSet(t *testing.T) {
+	rs := newStorageCluster("1Gi")
+	rs.Spec.Password = "p4ssw0rd"
+	rs.Spec.Exporter.Enabled = true
+	ss := generateRedisStatefulSet(rs, nil, nil)
+	spec, err := json.Marshal(ss)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if strings.Contains(string(spec), "p4ssw0rd") {
+		t.Errorf("the statefulset holds the password: %s", spec)
+	}
+
+	for _, container := range ss.Spec.Template.Spec.Containers {
+		for _, env := range container.Env {
+			if env.Name != redisCliAuthEnv && env.Name != redisPasswordEnv {
+				continue
+			}
+			if ref := secretKeyRef(env); ref != util.GetRedisAuthName(rs)+"/"+authPasswordKey {
+				t.Errorf("%s of %s is read from %q, want the auth secret", env.Name, container.Name, ref)
+			}
+		}
+	}
+
+	secret := generateRedisAuthSecret(rs, nil, nil)
+	if string(secret.Data[authPasswordKey]) != "p4ssw0rd" {
+		t.Errorf("secret password = %q, want %q", secret.Data[authPasswordKey], "p4ssw0rd")
+	}
+}
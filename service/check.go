@@ -1,14 +1,12 @@
 package service
 
 import (
+	"context"
 	"errors"
 	"fmt"
-	"net"
 	"time"
 
 	"github.com/go-logr/logr"
-	goredis "github.com/go-redis/redis"
-	corev1 "k8s.io/api/core/v1"
 
 	rsv1 "redis-sentinel/api/v1"
 	"redis-sentinel/pkg/k8s"
@@ -21,16 +19,20 @@ type RedisClusterCheck interface {
 	CheckRedisNumber(redisCluster *rsv1.RedisSentinel) error
 	CheckSentinelNumber(redisCluster *rsv1.RedisSentinel) error
 	CheckSentinelReadyReplicas(redisCluster *rsv1.RedisSentinel) error
-	CheckAllSlavesFromMaster(master string, redisCluster *rsv1.RedisSentinel, auth *util.AuthConfig) error
-	CheckSentinelNumberInMemory(sentinel string, redisCluster *rsv1.RedisSentinel, auth *util.AuthConfig) error
-	CheckSentinelSlavesNumberInMemory(sentinel string, redisCluster *rsv1.RedisSentinel, auth *util.AuthConfig) error
-	CheckSentinelMonitor(sentinel string, monitor string, auth *util.AuthConfig) error
-	GetMasterIP(redisCluster *rsv1.RedisSentinel, auth *util.AuthConfig) (string, error)
-	GetNumberMasters(redisCluster *rsv1.RedisSentinel, auth *util.AuthConfig) (int, error)
-	GetRedisesIPs(redisCluster *rsv1.RedisSentinel, auth *util.AuthConfig) ([]string, error)
-	GetSentinelsIPs(redisCluster *rsv1.RedisSentinel) ([]string, error)
-	GetMinimumRedisPodTime(redisCluster *rsv1.RedisSentinel) (time.Duration, error)
-	CheckRedisConfig(redisCluster *rsv1.RedisSentinel, addr string, auth *util.AuthConfig) error
+	GetTopology(ctx context.Context, redisCluster *rsv1.RedisSentinel, auth *util.AuthConfig) (*Topology, error)
+	GetSentinelNode(ctx context.Context, redisCluster *rsv1.RedisSentinel, sentinel *SentinelNode, auth *util.AuthConfig) (*SentinelNode, error)
+	CheckAllSlavesFromMaster(master *RedisNode, topo *Topology) error
+	CheckSentinelNumberInMemory(sentinel *SentinelNode, redisCluster *rsv1.RedisSentinel) error
+	CheckSentinelSlavesNumberInMemory(sentinel *SentinelNode, redisCluster *rsv1.RedisSentinel) error
+	CheckSentinelMonitor(sentinel *SentinelNode, monitor string, monitorPort string) error
+	GetMaster(topo *Topology) (*RedisNode, error)
+	GetNumberMasters(topo *Topology) int
+	GetMinimumRedisPodTime(topo *Topology) time.Duration
+	CheckRedisConfig(redisCluster *rsv1.RedisSentinel, node *RedisNode) error
+	GetReplicaOfSource(rs *rsv1.RedisSentinel) (*ReplicaOfSource, error)
+	GetStandbyHead(topo *Topology, source *ReplicaOfSource, rs *rsv1.RedisSentinel) *RedisNode
+	GetSourceOffset(ctx context.Context, source *ReplicaOfSource) (int64, error)
+	GetMigrationSource(rs *rsv1.RedisSentinel, source *rsv1.MigrationSource) (*ReplicaOfSource, error)
 }
 
 var parseConfigMap = map[string]int8{
@@ -47,6 +49,10 @@ var parseConfigMap = map[string]int8{
 	"zset-max-ziplist-entries":   0,
 	"zset-max-ziplist-value":     0,
 	"hll-sparse-max-bytes":       0,
+	"hash-max-listpack-entries":  0,
+	"hash-max-listpack-value":    0,
+	"zset-max-listpack-entries":  0,
+	"zset-max-listpack-value":    0,
 	// TODO parse client-output-buffer-limit
 	//"client-output-buffer-limit": 0,
 }
@@ -55,37 +61,35 @@ var parseConfigMap = map[string]int8{
 type RedisClusterChecker struct {
 	k8sService  k8s.Services
 	redisClient redisclient.Client
-	logger      logr.Logger
+	// workers is the maximum number of nodes queried at the same time
+	workers int
+	logger  logr.Logger
 }
 
 // NewRedisClusterChecker creates an object of the RedisClusterChecker struct
-func NewRedisClusterChecker(k8sService k8s.Services, redisClient redisclient.Client, logger logr.Logger) *RedisClusterChecker {
+func NewRedisClusterChecker(k8sService k8s.Services, redisClient redisclient.Client, workers int, logger logr.Logger) *RedisClusterChecker {
 	return &RedisClusterChecker{
 		k8sService:  k8sService,
 		redisClient: redisClient,
+		workers:     workers,
 		logger:      logger,
 	}
 }
 
 // CheckRedisConfig check current redis config is same as custom config
-func (r *RedisClusterChecker) CheckRedisConfig(redisCluster *rsv1.RedisSentinel, addr string, auth *util.AuthConfig) error {
-	client := goredis.NewClient(&goredis.Options{
-		Addr:     net.JoinHostPort(addr, "6379"),
-		Password: auth.Password,
-		DB:       0,
-	})
-	defer client.Close()
-	configs, err := r.redisClient.GetAllRedisConfig(client)
-	if err != nil {
-		return err
-	}
+func (r *RedisClusterChecker) CheckRedisConfig(redisCluster *rsv1.RedisSentinel, node *RedisNode) error {
+	return checkRedisConfig(r.logger, expectedRedisConfig(redisCluster, node), node.Config)
+}
 
-	for key, value := range redisCluster.Spec.Config {
+// checkRedisConfig compares the config of a redis with the expected one, the memory sizes are
+// compared in bytes
+func checkRedisConfig(logger logr.Logger, expected map[string]string, configs map[string]string) error {
+	for key, value := range expected {
 		var err error
 		if _, ok := parseConfigMap[key]; ok {
 			value, err = util.ParseRedisMemConf(value)
 			if err != nil {
-				r.logger.Error(err, "redis config format err", "key", key, "value", value)
+				logger.Error(err, "redis config format err", "key", key, "value", value)
 				continue
 			}
 		}
@@ -136,137 +140,67 @@ func (r *RedisClusterChecker) CheckSentinelReadyReplicas(rc *rsv1.RedisSentinel)
 }
 
 // CheckAllSlavesFromMaster controls that all slaves have the same master (the real one)
-func (r *RedisClusterChecker) CheckAllSlavesFromMaster(master string, rc *rsv1.RedisSentinel, auth *util.AuthConfig) error {
-	rips, err := r.GetRedisesIPs(rc, auth)
-	if err != nil {
-		return err
-	}
-	for _, rip := range rips {
-		slave, err := r.redisClient.GetSlaveMasterIP(rip, auth)
-		if err != nil {
-			return err
+func (r *RedisClusterChecker) CheckAllSlavesFromMaster(master *RedisNode, topo *Topology) error {
+	for _, node := range topo.Redises {
+		if node == master {
+			continue
 		}
-		if slave != "" && slave != master {
-			return fmt.Errorf("slave %s don't have the master %s, has %s", rip, master, slave)
+		if node.IsMaster || node.MasterHost != master.AnnounceHost || node.MasterPort != master.AnnouncePort {
+			return fmt.Errorf("slave %s don't have the master %s:%s, has %s:%s", node.IP, master.AnnounceHost, master.AnnouncePort, node.MasterHost, node.MasterPort)
 		}
 	}
 	return nil
 }
 
 // CheckSentinelNumberInMemory controls that sentinels have only the living sentinels on its memory.
-func (r *RedisClusterChecker) CheckSentinelNumberInMemory(sentinel string, rc *rsv1.RedisSentinel, auth *util.AuthConfig) error {
-	nSentinels, err := r.redisClient.GetNumberSentinelsInMemory(sentinel, auth)
-	if err != nil {
-		return err
-	} else if nSentinels != rc.Spec.Sentinel.Replicas {
+func (r *RedisClusterChecker) CheckSentinelNumberInMemory(sentinel *SentinelNode, rc *rsv1.RedisSentinel) error {
+	if sentinel.NumSentinelsErr != nil {
+		return sentinel.NumSentinelsErr
+	} else if sentinel.NumSentinels != rc.Spec.Sentinel.Replicas {
 		return errors.New("sentinels in memory mismatch")
 	}
 	return nil
 }
 
 // CheckSentinelSlavesNumberInMemory controls that sentinels have only the spected slaves number.
-func (r *RedisClusterChecker) CheckSentinelSlavesNumberInMemory(sentinel string, rc *rsv1.RedisSentinel, auth *util.AuthConfig) error {
-	nSlaves, err := r.redisClient.GetNumberSentinelSlavesInMemory(sentinel, auth)
-	if err != nil {
-		return err
-	} else if nSlaves != rc.Spec.Size-1 {
+func (r *RedisClusterChecker) CheckSentinelSlavesNumberInMemory(sentinel *SentinelNode, rc *rsv1.RedisSentinel) error {
+	if sentinel.NumSlavesErr != nil {
+		return sentinel.NumSlavesErr
+	} else if sentinel.NumSlaves != rc.Spec.Size-1 {
 		return errors.New("sentinel's slaves in memory mismatch")
 	}
 	return nil
 }
 
 // CheckSentinelMonitor controls if the sentinels are monitoring the expected master
-func (r *RedisClusterChecker) CheckSentinelMonitor(sentinel string, monitor string, auth *util.AuthConfig) error {
-	actualMonitorIP, err := r.redisClient.GetSentinelMonitor(sentinel, auth)
-	if err != nil {
-		return err
+func (r *RedisClusterChecker) CheckSentinelMonitor(sentinel *SentinelNode, monitor string, monitorPort string) error {
+	if sentinel.MonitorErr != nil {
+		return sentinel.MonitorErr
 	}
-	if actualMonitorIP != monitor {
+	if sentinel.MonitorHost != monitor || sentinel.MonitorPort != monitorPort {
 		return errors.New("the monitor on the sentinel config does not match with the expected one")
 	}
 	return nil
 }
 
-// GetMasterIP connects to all redis and returns the master of the redis cluster
-func (r *RedisClusterChecker) GetMasterIP(rc *rsv1.RedisSentinel, auth *util.AuthConfig) (string, error) {
-	rips, err := r.GetRedisesIPs(rc, auth)
-	if err != nil {
-		return "", err
-	}
-	masters := []string{}
-	for _, rip := range rips {
-		master, err := r.redisClient.IsMaster(rip, auth)
-		if err != nil {
-			return "", err
-		}
-		if master {
-			masters = append(masters, rip)
-		}
-	}
-
+// GetMaster returns the master of the redis cluster
+func (r *RedisClusterChecker) GetMaster(topo *Topology) (*RedisNode, error) {
+	masters := topo.Masters()
 	if len(masters) != 1 {
-		return "", errors.New("number of redis nodes known as master is different than 1")
+		return nil, errors.New("number of redis nodes known as master is different than 1")
 	}
 	return masters[0], nil
 }
 
 // GetNumberMasters returns the number of redis nodes that are working as a master
-func (r *RedisClusterChecker) GetNumberMasters(rc *rsv1.RedisSentinel, auth *util.AuthConfig) (int, error) {
-	nMasters := 0
-	rips, err := r.GetRedisesIPs(rc, auth)
-	if err != nil {
-		return nMasters, err
-	}
-	for _, rip := range rips {
-		master, err := r.redisClient.IsMaster(rip, auth)
-		if err != nil {
-			return nMasters, err
-		}
-		if master {
-			nMasters++
-		}
-	}
-	return nMasters, nil
-}
-
-// GetRedisesIPs returns the IPs of the Redis nodes
-func (r *RedisClusterChecker) GetRedisesIPs(rc *rsv1.RedisSentinel, auth *util.AuthConfig) ([]string, error) {
-	redises := []string{}
-	rps, err := r.k8sService.GetStatefulSetPods(rc.Namespace, util.GetRedisName(rc))
-	if err != nil {
-		return nil, err
-	}
-	for _, rp := range rps.Items {
-		if rp.Status.Phase == corev1.PodRunning { // Only work with running pods
-			redises = append(redises, rp.Status.PodIP)
-		}
-	}
-	return redises, nil
-}
-
-// GetSentinelsIPs returns the IPs of the Sentinel nodes
-func (r *RedisClusterChecker) GetSentinelsIPs(rc *rsv1.RedisSentinel) ([]string, error) {
-	sentinels := []string{}
-	rps, err := r.k8sService.GetStatefulSetPods(rc.Namespace, util.GetSentinelName(rc))
-	if err != nil {
-		return nil, err
-	}
-	for _, sp := range rps.Items {
-		if sp.Status.Phase == corev1.PodRunning { // Only work with running pods
-			sentinels = append(sentinels, sp.Status.PodIP)
-		}
-	}
-	return sentinels, nil
+func (r *RedisClusterChecker) GetNumberMasters(topo *Topology) int {
+	return len(topo.Masters())
 }
 
 // GetMinimumRedisPodTime returns the minimum time a pod is alive
-func (r *RedisClusterChecker) GetMinimumRedisPodTime(rc *rsv1.RedisSentinel) (time.Duration, error) {
+func (r *RedisClusterChecker) GetMinimumRedisPodTime(topo *Topology) time.Duration {
 	minTime := 100000 * time.Hour // More than ten years
-	rps, err := r.k8sService.GetStatefulSetPods(rc.Namespace, util.GetRedisName(rc))
-	if err != nil {
-		return minTime, err
-	}
-	for _, redisNode := range rps.Items {
+	for _, redisNode := range topo.redisPods {
 		if redisNode.Status.StartTime == nil {
 			continue
 		}
@@ -277,5 +211,5 @@ func (r *RedisClusterChecker) GetMinimumRedisPodTime(rc *rsv1.RedisSentinel) (ti
 			minTime = alive
 		}
 	}
-	return minTime, nil
+	return minTime
 }
@@ -2,13 +2,31 @@ package service
 
 // variables refering to the redis exporter port
 const (
-	exporterPort                 = 9121
-	exporterPortName             = "http-metrics"
-	exporterContainerName        = "redis-exporter"
-	exporterDefaultRequestCPU    = "50m"
-	exporterDefaultLimitCPU      = "100m"
-	exporterDefaultRequestMemory = "50Mi"
-	exporterDefaultLimitMemory   = "200Mi"
+	exporterPort                  = 9121
+	exporterPortName              = "http-metrics"
+	exporterContainerName         = "redis-exporter"
+	sentinelExporterContainerName = "sentinel-exporter"
+	exporterDefaultRequestCPU     = "50m"
+	exporterDefaultLimitCPU       = "100m"
+	exporterDefaultRequestMemory  = "50Mi"
+	exporterDefaultLimitMemory    = "200Mi"
 
 	redisPasswordEnv = "REDIS_PASSWORD"
-)
\ No newline at end of file
+	redisAddrEnv     = "REDIS_ADDR"
+	// redisCliAuthEnv is read by redis-cli, the probes use it to keep the password out of
+	// their command line
+	redisCliAuthEnv   = "REDISCLI_AUTH"
+	redisProbeCommand = "redis-cli -h $(hostname) ping"
+
+	redisPort    = 6379
+	sentinelPort = 26379
+)
+
+// replica priorities set when a master zone is preferred, sentinel promotes the lowest one and
+// never a redis with a priority of 0
+const (
+	replicaPriorityConfig    = "slave-priority"
+	preferredReplicaPriority = "1"
+	otherReplicaPriority     = "100"
+	cordonedReplicaPriority  = "0"
+)
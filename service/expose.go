@@ -0,0 +1,94 @@
+package service
+
+import (
+	"fmt"
+	"strconv"
+
+	corev1 "k8s.io/api/core/v1"
+
+	rsv1 "redis-sentinel/api/v1"
+	"redis-sentinel/pkg/k8s"
+	"redis-sentinel/pkg/util"
+)
+
+// getAnnounceAddr returns the address that must be announced for the given pod.
+// When the cluster is exposed it is the address of the service published for the pod,
+// otherwise it is the pod DNS name when hostnames are used, or the pod ip.
+func getAnnounceAddr(k8sService k8s.Services, rs *rsv1.RedisSentinel, pod *corev1.Pod, port int32) (string, string, error) {
+	if rs.Spec.Expose == nil {
+		if rs.Spec.UseHostnames {
+			return getPodHostname(pod), strconv.Itoa(int(port)), nil
+		}
+		return pod.Status.PodIP, strconv.Itoa(int(port)), nil
+	}
+
+	svc, err := k8sService.GetService(rs.Namespace, pod.Name)
+	if err != nil {
+		return "", "", err
+	}
+	if len(svc.Spec.Ports) == 0 {
+		return "", "", fmt.Errorf("service %s has no ports", svc.Name)
+	}
+
+	switch svc.Spec.Type {
+	case corev1.ServiceTypeLoadBalancer:
+		ingress := svc.Status.LoadBalancer.Ingress
+		if len(ingress) == 0 {
+			return "", "", fmt.Errorf("waiting for load balancer of service %s", svc.Name)
+		}
+		host := ingress[0].IP
+		if host == "" {
+			host = ingress[0].Hostname
+		}
+		return host, strconv.Itoa(int(svc.Spec.Ports[0].Port)), nil
+	case corev1.ServiceTypeNodePort:
+		if pod.Spec.NodeName == "" || svc.Spec.Ports[0].NodePort == 0 {
+			return "", "", fmt.Errorf("waiting for node port of service %s", svc.Name)
+		}
+		host, err := getNodeAddress(k8sService, pod)
+		if err != nil {
+			return "", "", err
+		}
+		return host, strconv.Itoa(int(svc.Spec.Ports[0].NodePort)), nil
+	default:
+		return "", "", fmt.Errorf("service %s type %s can't be announced", svc.Name, svc.Spec.Type)
+	}
+}
+
+// getNodeAddress returns the address of the node running the pod that clients outside the
+// cluster can reach, its external ip or else its internal one. The nodes can't be read when
+// only namespaces are watched, the host ip of the pod is used then
+func getNodeAddress(k8sService k8s.Services, pod *corev1.Pod) (string, error) {
+	if !util.IsClusterScoped() {
+		if pod.Status.HostIP == "" {
+			return "", fmt.Errorf("waiting for the host ip of pod %s", pod.Name)
+		}
+		return pod.Status.HostIP, nil
+	}
+	node, err := k8sService.GetNode(pod.Spec.NodeName)
+	if err != nil {
+		return "", err
+	}
+	for _, addrType := range []corev1.NodeAddressType{corev1.NodeExternalIP, corev1.NodeInternalIP} {
+		for _, addr := range node.Status.Addresses {
+			if addr.Type == addrType && addr.Address != "" {
+				return addr.Address, nil
+			}
+		}
+	}
+	return "", fmt.Errorf("node %s of pod %s has no ip address", node.Name, pod.Name)
+}
+
+// getPodHostname returns the stable DNS name given to a statefulset pod by its headless service
+func getPodHostname(pod *corev1.Pod) string {
+	hostname := pod.Spec.Hostname
+	if hostname == "" {
+		hostname = pod.Name
+	}
+	return util.GetPodFQDN(hostname, pod.Spec.Subdomain, pod.Namespace)
+}
+
+// useAnnounce reports whether redis and sentinels must announce an address other than their pod ip
+func useAnnounce(rs *rsv1.RedisSentinel) bool {
+	return rs.Spec.Expose != nil || rs.Spec.UseHostnames
+}
@@ -8,8 +8,10 @@ import (
 	policyv1beta1 "k8s.io/api/policy/v1beta1"
 	"k8s.io/apimachinery/pkg/api/resource"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
 	"k8s.io/apimachinery/pkg/util/intstr"
 	rsv1 "redis-sentinel/api/v1"
+	"redis-sentinel/pkg/k8s"
 	"redis-sentinel/pkg/util"
 	)
 
@@ -77,6 +79,91 @@ func generateRedisService(rs *rsv1.RedisSentinel, labels map[string]string, owne
 	}
 }
 
+func generateRedisMasterService(rs *rsv1.RedisSentinel, labels map[string]string, ownerRefs []metav1.OwnerReference) *corev1.Service {
+	return generateRedisRoleService(util.GetRedisMasterName(rs), util.RedisRoleLabelMaster, rs, labels, ownerRefs)
+}
+
+func generateRedisReplicaService(rs *rsv1.RedisSentinel, labels map[string]string, ownerRefs []metav1.OwnerReference) *corev1.Service {
+	return generateRedisRoleService(util.GetRedisReplicaName(rs), util.RedisRoleLabelReplica, rs, labels, ownerRefs)
+}
+
+// generateRedisRoleService creates a service selecting only the redis pods labeled with the given role
+func generateRedisRoleService(name, role string, rs *rsv1.RedisSentinel, labels map[string]string, ownerRefs []metav1.OwnerReference) *corev1.Service {
+	namespace := rs.Namespace
+
+	labels = util.MergeLabels(labels, generateSelectorLabels(util.RedisRoleName, rs.Name))
+	selector := util.MergeLabels(labels, map[string]string{
+		util.RedisRoleLabelKey: role,
+	})
+	redisTargetPort := intstr.FromInt(6379)
+	return &corev1.Service{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:            name,
+			Namespace:       namespace,
+			Labels:          labels,
+			OwnerReferences: ownerRefs,
+		},
+		Spec: corev1.ServiceSpec{
+			Type: corev1.ServiceTypeClusterIP,
+			Ports: []corev1.ServicePort{
+				{
+					Port:       6379,
+					Protocol:   corev1.ProtocolTCP,
+					Name:       "redis",
+					TargetPort: redisTargetPort,
+				},
+			},
+			Selector: selector,
+		},
+	}
+}
+
+// generateExposeService creates the service publishing a single redis or sentinel pod outside the cluster
+func generateExposeService(podName, component string, port int32, rs *rsv1.RedisSentinel, labels map[string]string, ownerRefs []metav1.OwnerReference) *corev1.Service {
+	namespace := rs.Namespace
+
+	labels = util.MergeLabels(labels, generateSelectorLabels(component, rs.Name))
+	selector := util.MergeLabels(labels, map[string]string{
+		appsv1.StatefulSetPodNameLabel: podName,
+	})
+	return &corev1.Service{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:            podName,
+			Namespace:       namespace,
+			Labels:          util.MergeLabels(labels, generateExposeLabels(rs.Name)),
+			Annotations:     rs.Spec.Expose.Annotations,
+			OwnerReferences: ownerRefs,
+		},
+		Spec: corev1.ServiceSpec{
+			Type:                     rs.Spec.Expose.Type,
+			LoadBalancerSourceRanges: rs.Spec.Expose.LoadBalancerSourceRanges,
+			Ports: []corev1.ServicePort{
+				{
+					Port:       port,
+					Protocol:   corev1.ProtocolTCP,
+					Name:       component,
+					TargetPort: intstr.FromInt(int(port)),
+				},
+			},
+			Selector: selector,
+		},
+	}
+}
+
+// generateExposeLabels returns the labels of all the services publishing a pod of the cluster
+func generateExposeLabels(name string) map[string]string {
+	return map[string]string{
+		"app.kubernetes.io/part-of": util.AppLabel,
+		"app.kubernetes.io/name":    name,
+		util.ExposeLabelKey:         "true",
+	}
+}
+
+func generateRedisAuthSecret(rs *rsv1.RedisSentinel, labels map[string]string, ownerRefs []metav1.OwnerReference) *corev1.Secret {
+	labels = util.MergeLabels(labels, generateSelectorLabels(util.RedisRoleName, rs.Name))
+	return generateAuthSecret(util.GetRedisAuthName(rs), rs.Namespace, rs.Spec.Password, labels, ownerRefs)
+}
+
 func generateSentinelConfigMap(rs *rsv1.RedisSentinel, labels map[string]string, ownerRefs []metav1.OwnerReference) *corev1.ConfigMap {
 	name := util.GetSentinelName(rs)
 	namespace := rs.Namespace
@@ -87,6 +174,9 @@ sentinel down-after-milliseconds mymaster 1000
 sentinel failover-timeout mymaster 3000
 sentinel parallel-syncs mymaster 2`
 
+	if rs.Spec.UseHostnames {
+		sentinelConfigFileContent = fmt.Sprintf("%s\nsentinel resolve-hostnames yes\nsentinel announce-hostnames yes", sentinelConfigFileContent)
+	}
 	if rs.Spec.Password != "" {
 		sentinelConfigFileContent = fmt.Sprintf("%s\nsentinel auth-pass mymaster %s\n", sentinelConfigFileContent, rs.Spec.Password)
 	}
@@ -147,7 +237,7 @@ while [ "$master" = "" ]; do
 done
 echo "Master is $master, doing redis save..."
 redis-cli SAVE
-if [ $master = $(hostname -i) ]; then
+if [ "$master" = "$(hostname -i)" ] || [ "$master" = "$(hostname -f)" ]; then
 	while [ ! "$response_code" = "OK" ]; do
   		response_code=$(redis-cli -h ${%s} -p ${%s} SENTINEL failover mymaster)
 		echo "after failover with code $response_code"
@@ -173,10 +263,16 @@ func generateSentinelReadinessProbeConfigMap(rs *rsv1.RedisSentinel, labels map[
 	namespace := rs.Namespace
 
 	labels = util.MergeLabels(labels, generateSelectorLabels(util.RedisRoleName, rs.Name))
+	// the sentinels of a standby or migrating cluster monitor no master, they are ready once
+	// they answer
 	checkContent := `#!/usr/bin/env sh
 set -eou pipefail
 redis-cli -h $(hostname) -p 26379 ping
-slaves=$(redis-cli -h $(hostname) -p 26379 info sentinel|grep master0| grep -Eo 'slaves=[0-9]+' | awk -F= '{print $2}')
+masters=$(redis-cli -h $(hostname) -p 26379 info sentinel | grep -Eo 'sentinel_masters:[0-9]+' | awk -F: '{print $2}')
+if [ "$masters" = "0" ]; then
+    exit 0
+fi
+slaves=$(redis-cli -h $(hostname) -p 26379 info sentinel|grep master0| grep -Eo '(slaves|replicas)=[0-9]+' | awk -F= '{print $2}')
 status=$(redis-cli -h $(hostname) -p 26379 info sentinel|grep master0| grep -Eo 'status=\w+' | awk -F= '{print $2}')
 if [ "$status" != "ok" ]; then 
     exit 1
@@ -210,13 +306,6 @@ func generateRedisStatefulSet(rs *rsv1.RedisSentinel, labels map[string]string,
 	volumeMounts := getRedisVolumeMounts(rs)
 	volumes := getRedisVolumes(rs)
 
-	probeArg := "redis-cli -h $(hostname)"
-	if spec.Password != "" {
-		probeArg = fmt.Sprintf("%s -a '%s' ping", probeArg, spec.Password)
-	} else {
-		probeArg = fmt.Sprintf("%s ping", probeArg)
-	}
-
 	ss := &appsv1.StatefulSet{
 		ObjectMeta: metav1.ObjectMeta{
 			Name:            name,
@@ -239,11 +328,12 @@ func generateRedisStatefulSet(rs *rsv1.RedisSentinel, labels map[string]string,
 					Annotations: rs.Spec.Annotations,
 				},
 				Spec: corev1.PodSpec{
-					Affinity:         getAffinity(rs.Spec.Affinity, labels),
-					Tolerations:      rs.Spec.ToleRations,
-					NodeSelector:     rs.Spec.NodeSelector,
-					SecurityContext:  getSecurityContext(rs.Spec.SecurityContext),
-					ImagePullSecrets: rs.Spec.ImagePullSecrets,
+					Affinity:                  getAffinity(rs.Spec.Affinity, rs.Spec.Placement, labels),
+					TopologySpreadConstraints: getTopologySpreadConstraints(rs.Spec.Affinity, rs.Spec.Placement, labels),
+					Tolerations:               rs.Spec.ToleRations,
+					NodeSelector:              rs.Spec.NodeSelector,
+					SecurityContext:           getSecurityContext(rs.Spec.SecurityContext),
+					ImagePullSecrets:          rs.Spec.ImagePullSecrets,
 					Containers: []corev1.Container{
 						{
 							Name:            "redis",
@@ -258,6 +348,7 @@ func generateRedisStatefulSet(rs *rsv1.RedisSentinel, labels map[string]string,
 							},
 							VolumeMounts: volumeMounts,
 							Command:      redisCommand,
+							Env:          getRedisCliAuthEnv(util.GetRedisAuthName(rs), spec.Password),
 							ReadinessProbe: &corev1.Probe{
 								InitialDelaySeconds: graceTime,
 								TimeoutSeconds:      5,
@@ -266,7 +357,7 @@ func generateRedisStatefulSet(rs *rsv1.RedisSentinel, labels map[string]string,
 										Command: []string{
 											"sh",
 											"-c",
-											probeArg,
+											redisProbeCommand,
 										},
 									},
 								},
@@ -279,7 +370,7 @@ func generateRedisStatefulSet(rs *rsv1.RedisSentinel, labels map[string]string,
 										Command: []string{
 											"sh",
 											"-c",
-											probeArg,
+											redisProbeCommand,
 										},
 									},
 								},
@@ -327,7 +418,7 @@ func generateSentinelStatefulSet(rs *rsv1.RedisSentinel, labels map[string]strin
 	sentinelCommand := getSentinelCommand(rs)
 	labels = util.MergeLabels(labels, generateSelectorLabels(util.SentinelRoleName, rs.Name))
 
-	return &appsv1.StatefulSet{
+	ss := &appsv1.StatefulSet{
 		ObjectMeta: metav1.ObjectMeta{
 			Name:            name,
 			Namespace:       namespace,
@@ -346,11 +437,12 @@ func generateSentinelStatefulSet(rs *rsv1.RedisSentinel, labels map[string]strin
 					Annotations: rs.Spec.Sentinel.Annotations,
 				},
 				Spec: corev1.PodSpec{
-					Affinity:         getAffinity(rs.Spec.Sentinel.Affinity, labels),
-					Tolerations:      rs.Spec.Sentinel.ToleRations,
-					NodeSelector:     rs.Spec.Sentinel.NodeSelector,
-					SecurityContext:  getSecurityContext(rs.Spec.Sentinel.SecurityContext),
-					ImagePullSecrets: rs.Spec.Sentinel.ImagePullSecrets,
+					Affinity:                  getAffinity(rs.Spec.Sentinel.Affinity, rs.Spec.Placement, labels),
+					TopologySpreadConstraints: getTopologySpreadConstraints(rs.Spec.Sentinel.Affinity, rs.Spec.Placement, labels),
+					Tolerations:               rs.Spec.Sentinel.ToleRations,
+					NodeSelector:              rs.Spec.Sentinel.NodeSelector,
+					SecurityContext:           getSecurityContext(rs.Spec.Sentinel.SecurityContext),
+					ImagePullSecrets:          rs.Spec.Sentinel.ImagePullSecrets,
 					InitContainers: []corev1.Container{
 						{
 							Name:            "sentinel-config-copy",
@@ -468,9 +560,16 @@ func generateSentinelStatefulSet(rs *rsv1.RedisSentinel, labels map[string]strin
 			},
 		},
 	}
+
+	if rs.Spec.Exporter.Enabled && rs.Spec.Exporter.Sentinel {
+		exporter := createSentinelExporterContainer(rs)
+		ss.Spec.Template.Spec.Containers = append(ss.Spec.Template.Spec.Containers, exporter)
+	}
+
+	return ss
 }
 
-func generatePodDisruptionBudget(name string, namespace string, labels map[string]string, ownerRefs []metav1.OwnerReference, minAvailable intstr.IntOrString) *policyv1beta1.PodDisruptionBudget {
+func generatePodDisruptionBudget(name string, namespace string, labels map[string]string, ownerRefs []metav1.OwnerReference, budget *rsv1.PDBComponentSettings) *policyv1beta1.PodDisruptionBudget {
 	return &policyv1beta1.PodDisruptionBudget{
 		ObjectMeta: metav1.ObjectMeta{
 			Name:            name,
@@ -479,7 +578,8 @@ func generatePodDisruptionBudget(name string, namespace string, labels map[strin
 			OwnerReferences: ownerRefs,
 		},
 		Spec: policyv1beta1.PodDisruptionBudgetSpec{
-			MinAvailable: &minAvailable,
+			MinAvailable:   budget.MinAvailable,
+			MaxUnavailable: budget.MaxUnavailable,
 			Selector: &metav1.LabelSelector{
 				MatchLabels: labels,
 			},
@@ -487,6 +587,25 @@ func generatePodDisruptionBudget(name string, namespace string, labels map[strin
 	}
 }
 
+// getPDBSettings returns the budget of the component, by default one redis can be
+// unavailable and the sentinels keep the quorum
+func getPDBSettings(rs *rsv1.RedisSentinel, component string) *rsv1.PDBComponentSettings {
+	if rs.Spec.PDB != nil {
+		if component == util.RedisRoleName && rs.Spec.PDB.Redis != nil {
+			return rs.Spec.PDB.Redis
+		}
+		if component == util.SentinelRoleName && rs.Spec.PDB.Sentinel != nil {
+			return rs.Spec.PDB.Sentinel
+		}
+	}
+	if component == util.SentinelRoleName {
+		minAvailable := intstr.FromInt(int(GetQuorum(rs)))
+		return &rsv1.PDBComponentSettings{MinAvailable: &minAvailable}
+	}
+	maxUnavailable := intstr.FromInt(1)
+	return &rsv1.PDBComponentSettings{MaxUnavailable: &maxUnavailable}
+}
+
 func generateResourceList(cpu string, memory string) corev1.ResourceList {
 	resources := corev1.ResourceList{}
 	if cpu != "" {
@@ -498,11 +617,51 @@ func generateResourceList(cpu string, memory string) corev1.ResourceList {
 	return resources
 }
 
+// getRedisCliAuthEnv returns the environment giving the password to the redis-cli of the probes,
+// it is read from the secret so it doesn't show in the pod spec
+func getRedisCliAuthEnv(secretName, password string) []corev1.EnvVar {
+	if password == "" {
+		return nil
+	}
+	return []corev1.EnvVar{getAuthEnv(redisCliAuthEnv, secretName)}
+}
+
 func createRedisExporterContainer(rs *rsv1.RedisSentinel) corev1.Container {
-	container := corev1.Container{
-		Name:            exporterContainerName,
+	container := createExporterContainer(exporterContainerName, rs)
+	if rs.Spec.Password != "" {
+		container.Env = append(container.Env, getAuthEnv(redisPasswordEnv, util.GetRedisAuthName(rs)))
+	}
+	return container
+}
+
+func createSentinelExporterContainer(rs *rsv1.RedisSentinel) corev1.Container {
+	container := createExporterContainer(sentinelExporterContainerName, rs)
+	container.Env = append(container.Env, corev1.EnvVar{
+		Name:  redisAddrEnv,
+		Value: fmt.Sprintf("redis://localhost:%d", sentinelPort),
+	})
+	return container
+}
+
+func createExporterContainer(name string, rs *rsv1.RedisSentinel) corev1.Container {
+	resources := rs.Spec.Exporter.Resources
+	if len(resources.Limits) == 0 && len(resources.Requests) == 0 {
+		resources = corev1.ResourceRequirements{
+			Limits: corev1.ResourceList{
+				corev1.ResourceCPU:    resource.MustParse(exporterDefaultLimitCPU),
+				corev1.ResourceMemory: resource.MustParse(exporterDefaultLimitMemory),
+			},
+			Requests: corev1.ResourceList{
+				corev1.ResourceCPU:    resource.MustParse(exporterDefaultRequestCPU),
+				corev1.ResourceMemory: resource.MustParse(exporterDefaultRequestMemory),
+			},
+		}
+	}
+	return corev1.Container{
+		Name:            name,
 		Image:           rs.Spec.Exporter.Image,
 		ImagePullPolicy: pullPolicy(rs.Spec.Exporter.ImagePullPolicy),
+		Args:            rs.Spec.Exporter.Args,
 		Env: []corev1.EnvVar{
 			{
 				Name: "REDIS_ALIAS",
@@ -520,24 +679,104 @@ func createRedisExporterContainer(rs *rsv1.RedisSentinel) corev1.Container {
 				Protocol:      corev1.ProtocolTCP,
 			},
 		},
-		Resources: corev1.ResourceRequirements{
-			Limits: corev1.ResourceList{
-				corev1.ResourceCPU:    resource.MustParse(exporterDefaultLimitCPU),
-				corev1.ResourceMemory: resource.MustParse(exporterDefaultLimitMemory),
-			},
-			Requests: corev1.ResourceList{
-				corev1.ResourceCPU:    resource.MustParse(exporterDefaultRequestCPU),
-				corev1.ResourceMemory: resource.MustParse(exporterDefaultRequestMemory),
+		Resources: resources,
+	}
+}
+
+// generateExporterService creates a service exposing the exporters of the pods of the given component
+func generateExporterService(name, component string, rs *rsv1.RedisSentinel, labels map[string]string, ownerRefs []metav1.OwnerReference) *corev1.Service {
+	selector := util.MergeLabels(labels, generateSelectorLabels(component, rs.Name))
+	labels = util.MergeLabels(selector, map[string]string{
+		util.ExporterLabelKey: "true",
+	})
+	return &corev1.Service{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:            name,
+			Namespace:       rs.Namespace,
+			Labels:          labels,
+			OwnerReferences: ownerRefs,
+		},
+		Spec: corev1.ServiceSpec{
+			Type:      corev1.ServiceTypeClusterIP,
+			ClusterIP: corev1.ClusterIPNone,
+			Ports: []corev1.ServicePort{
+				{
+					Name:       exporterPortName,
+					Port:       exporterPort,
+					Protocol:   corev1.ProtocolTCP,
+					TargetPort: intstr.FromInt(exporterPort),
+				},
 			},
+			Selector: selector,
 		},
 	}
-	if rs.Spec.Password != "" {
-		container.Env = append(container.Env, corev1.EnvVar{
-			Name:  redisPasswordEnv,
-			Value: rs.Spec.Password,
-		})
+}
+
+// generateServiceMonitor creates the ServiceMonitor scraping the exporter services of the cluster
+func generateServiceMonitor(rs *rsv1.RedisSentinel, labels map[string]string, ownerRefs []metav1.OwnerReference) *unstructured.Unstructured {
+	settings := rs.Spec.Exporter.ServiceMonitor
+
+	endpoint := map[string]interface{}{
+		"port": exporterPortName,
+	}
+	if settings.Interval != "" {
+		endpoint["interval"] = settings.Interval
+	}
+	if settings.ScrapeTimeout != "" {
+		endpoint["scrapeTimeout"] = settings.ScrapeTimeout
+	}
+	if len(settings.Relabelings) > 0 {
+		relabelings := make([]interface{}, 0, len(settings.Relabelings))
+		for _, rl := range settings.Relabelings {
+			relabeling := map[string]interface{}{}
+			if len(rl.SourceLabels) > 0 {
+				sourceLabels := make([]interface{}, 0, len(rl.SourceLabels))
+				for _, l := range rl.SourceLabels {
+					sourceLabels = append(sourceLabels, l)
+				}
+				relabeling["sourceLabels"] = sourceLabels
+			}
+			for key, value := range map[string]string{
+				"separator":   rl.Separator,
+				"targetLabel": rl.TargetLabel,
+				"regex":       rl.Regex,
+				"replacement": rl.Replacement,
+				"action":      rl.Action,
+			} {
+				if value != "" {
+					relabeling[key] = value
+				}
+			}
+			if rl.Modulus != 0 {
+				relabeling["modulus"] = int64(rl.Modulus)
+			}
+			relabelings = append(relabelings, relabeling)
+		}
+		endpoint["relabelings"] = relabelings
 	}
-	return container
+
+	matchLabels := map[string]interface{}{
+		"app.kubernetes.io/part-of": util.AppLabel,
+		"app.kubernetes.io/name":    rs.Name,
+		util.ExporterLabelKey:       "true",
+	}
+
+	sm := &unstructured.Unstructured{}
+	sm.SetGroupVersionKind(k8s.ServiceMonitorGVK)
+	sm.SetName(util.GetRedisExporterName(rs))
+	sm.SetNamespace(rs.Namespace)
+	sm.SetLabels(util.MergeLabels(labels, settings.Labels))
+	sm.SetOwnerReferences(ownerRefs)
+	sm.Object["spec"] = map[string]interface{}{
+		"endpoints": []interface{}{endpoint},
+		"selector": map[string]interface{}{
+			"matchLabels": matchLabels,
+		},
+		"namespaceSelector": map[string]interface{}{
+			"matchNames": []interface{}{rs.Namespace},
+		},
+	}
+	return sm
 }
 
 func createPodAntiAffinity(hard bool, labels map[string]string) *corev1.PodAntiAffinity {
@@ -579,7 +818,8 @@ func getSecurityContext(secctx *corev1.PodSecurityContext) *corev1.PodSecurityCo
 	return nil
 }
 
-func getQuorum(rs *rsv1.RedisSentinel) int32 {
+// GetQuorum returns the number of sentinels that need to agree to failover the master
+func GetQuorum(rs *rsv1.RedisSentinel) int32 {
 	return rs.Spec.Sentinel.Replicas/2 + 1
 }
 
@@ -594,10 +834,13 @@ func getRedisVolumeMounts(rs *rsv1.RedisSentinel) []corev1.VolumeMount {
 			MountPath: "/redis-shutdown",
 		},
 		{
-			Name:      getRedisDataVolumeName(rs),
+			Name:      getRedisDataVolumeName(&rs.Spec.Storage),
 			MountPath: "/data",
 		},
 	}
+	if rs.Spec.Password != "" {
+		volumeMounts = append(volumeMounts, getAuthVolumeMount())
+	}
 
 	return volumeMounts
 }
@@ -620,25 +863,28 @@ func getRedisVolumes(rs *rsv1.RedisSentinel) []corev1.Volume {
 		},
 	}
 
-	dataVolume := getRedisDataVolume(rs)
+	dataVolume := getRedisDataVolume(&rs.Spec.Storage)
 	if dataVolume != nil {
 		volumes = append(volumes, *dataVolume)
 	}
+	if rs.Spec.Password != "" {
+		volumes = append(volumes, getAuthVolume(util.GetRedisAuthName(rs)))
+	}
 
 	return volumes
 }
 
-func getRedisDataVolume(rs *rsv1.RedisSentinel) *corev1.Volume {
+func getRedisDataVolume(storage *rsv1.RedisStorage) *corev1.Volume {
 	// This will find the volumed desired by the user. If no volume defined
 	// an EmptyDir will be used by default
 	switch {
-	case rs.Spec.Storage.PersistentVolumeClaim != nil:
+	case storage.PersistentVolumeClaim != nil:
 		return nil
-	case rs.Spec.Storage.EmptyDir != nil:
+	case storage.EmptyDir != nil:
 		return &corev1.Volume{
 			Name: redisStorageVolumeName,
 			VolumeSource: corev1.VolumeSource{
-				EmptyDir: rs.Spec.Storage.EmptyDir,
+				EmptyDir: storage.EmptyDir,
 			},
 		}
 	default:
@@ -651,11 +897,11 @@ func getRedisDataVolume(rs *rsv1.RedisSentinel) *corev1.Volume {
 	}
 }
 
-func getRedisDataVolumeName(rs *rsv1.RedisSentinel) string {
+func getRedisDataVolumeName(storage *rsv1.RedisStorage) string {
 	switch {
-	case rs.Spec.Storage.PersistentVolumeClaim != nil:
-		return rs.Spec.Storage.PersistentVolumeClaim.Name
-	case rs.Spec.Storage.EmptyDir != nil:
+	case storage.PersistentVolumeClaim != nil:
+		return storage.PersistentVolumeClaim.Name
+	case storage.EmptyDir != nil:
 		return redisStorageVolumeName
 	default:
 		return redisStorageVolumeName
@@ -676,8 +922,7 @@ func getRedisCommand(rs *rsv1.RedisSentinel) []string {
 	}
 
 	if rs.Spec.Password != "" {
-		cmds = append(cmds, fmt.Sprintf("--requirepass '%s'", rs.Spec.Password),
-			fmt.Sprintf("--masterauth '%s'", rs.Spec.Password))
+		cmds = append(cmds, getAuthInclude())
 	}
 
 	return cmds
@@ -694,24 +939,30 @@ func getSentinelCommand(rs *rsv1.RedisSentinel) []string {
 	}
 }
 
-func getAffinity(affinity *corev1.Affinity, labels map[string]string) *corev1.Affinity {
+func getAffinity(affinity *corev1.Affinity, placement *rsv1.PlacementSettings, labels map[string]string) *corev1.Affinity {
 	if affinity != nil {
 		return affinity
 	}
 
-	// Return a SOFT anti-affinity
+	hard := placement != nil && placement.HardAntiAffinity
 	return &corev1.Affinity{
-		PodAntiAffinity: &corev1.PodAntiAffinity{
-			PreferredDuringSchedulingIgnoredDuringExecution: []corev1.WeightedPodAffinityTerm{
-				{
-					Weight: 100,
-					PodAffinityTerm: corev1.PodAffinityTerm{
-						TopologyKey: util.HostnameTopologyKey,
-						LabelSelector: &metav1.LabelSelector{
-							MatchLabels: labels,
-						},
-					},
-				},
+		PodAntiAffinity: createPodAntiAffinity(hard, labels),
+	}
+}
+
+// getTopologySpreadConstraints spreads the pods across the zones when asked, unless an explicit affinity is given
+func getTopologySpreadConstraints(affinity *corev1.Affinity, placement *rsv1.PlacementSettings, labels map[string]string) []corev1.TopologySpreadConstraint {
+	if affinity != nil || placement == nil || !placement.ZoneSpread {
+		return nil
+	}
+
+	return []corev1.TopologySpreadConstraint{
+		{
+			MaxSkew:           placement.MaxSkew,
+			TopologyKey:       util.ZoneTopologyKey,
+			WhenUnsatisfiable: placement.WhenUnsatisfiable,
+			LabelSelector: &metav1.LabelSelector{
+				MatchLabels: labels,
 			},
 		},
 	}
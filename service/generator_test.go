@@ -0,0 +1,186 @@
+package service
+
+import (
+	"context"
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"testing"
+
+	policyv1beta1 "k8s.io/api/policy/v1beta1"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/apimachinery/pkg/util/intstr"
+
+	rsv1 "redis-sentinel/api/v1"
+	"redis-sentinel/pkg/util"
+)
+
+// fakeRedisCli answers ping and prints $SENTINEL_INFO for info sentinel
+const fakeRedisCli = `#!/usr/bin/env sh
+case "$*" in
+*info*) printf '%s\n' "$SENTINEL_INFO" ;;
+*) echo PONG ;;
+esac
+`
+
+func TestSentinelReadinessProbe(t *testing.T) {
+	shell, err := exec.LookPath("bash")
+	if err != nil {
+		t.Skip("bash is needed to run the probe")
+	}
+	dir, err := ioutil.TempDir("", "probe")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	if err := ioutil.WriteFile(filepath.Join(dir, "redis-cli"), []byte(fakeRedisCli), 0755); err != nil {
+		t.Fatal(err)
+	}
+	probe := filepath.Join(dir, "readiness.sh")
+	cm := generateSentinelReadinessProbeConfigMap(newStorageCluster("1Gi"), nil, nil)
+	if err := ioutil.WriteFile(probe, []byte(cm.Data["readiness.sh"]), 0755); err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name      string
+		info      string
+		wantReady bool
+	}{
+		{
+			name:      "monitoring a master with replicas",
+			info:      "sentinel_masters:1\nmaster0:name=mymaster,status=ok,address=10.0.0.1:6379,slaves=2,sentinels=3",
+			wantReady: true,
+		},
+		{
+			name: "master down",
+			info: "sentinel_masters:1\nmaster0:name=mymaster,status=odown,address=10.0.0.1:6379,slaves=2,sentinels=3",
+		},
+		{
+			name: "master without replicas",
+			info: "sentinel_masters:1\nmaster0:name=mymaster,status=ok,address=10.0.0.1:6379,slaves=0,sentinels=3",
+		},
+		{
+			name:      "standby monitoring no master",
+			info:      "sentinel_masters:0\nsentinel_tilt:0\nsentinel_running_scripts:0",
+			wantReady: true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cmd := exec.Command(shell, probe)
+			cmd.Env = append(os.Environ(), "PATH="+dir+string(os.PathListSeparator)+os.Getenv("PATH"), "SENTINEL_INFO="+tt.info)
+			out, err := cmd.CombinedOutput()
+			if ready := err == nil; ready != tt.wantReady {
+				t.Errorf("probe ready = %v, want %v, output: %s", ready, tt.wantReady, out)
+			}
+		})
+	}
+}
+
+func TestGetPDBSettings(t *testing.T) {
+	one, two, three := intstr.FromInt(1), intstr.FromInt(2), intstr.FromInt(3)
+	half := intstr.FromString("50%")
+	tests := []struct {
+		name               string
+		sentinels          int32
+		pdb                *rsv1.PDBSettings
+		component          string
+		wantMinAvailable   *intstr.IntOrString
+		wantMaxUnavailable *intstr.IntOrString
+	}{
+		{
+			name:               "default redis budget",
+			component:          util.RedisRoleName,
+			wantMaxUnavailable: &one,
+		},
+		{
+			name:             "default sentinel budget keeps the quorum",
+			sentinels:        5,
+			component:        util.SentinelRoleName,
+			wantMinAvailable: &three,
+		},
+		{
+			name:             "redis budget of the spec",
+			pdb:              &rsv1.PDBSettings{Redis: &rsv1.PDBComponentSettings{MinAvailable: &half}},
+			component:        util.RedisRoleName,
+			wantMinAvailable: &half,
+		},
+		{
+			name:             "sentinel budget defaulted when only the redis one is set",
+			sentinels:        3,
+			pdb:              &rsv1.PDBSettings{Redis: &rsv1.PDBComponentSettings{MinAvailable: &half}},
+			component:        util.SentinelRoleName,
+			wantMinAvailable: &two,
+		},
+		{
+			name:               "sentinel budget of the spec",
+			sentinels:          3,
+			pdb:                &rsv1.PDBSettings{Sentinel: &rsv1.PDBComponentSettings{MaxUnavailable: &one}},
+			component:          util.SentinelRoleName,
+			wantMaxUnavailable: &one,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rs := newStorageCluster("1Gi")
+			rs.Spec.Sentinel.Replicas = tt.sentinels
+			rs.Spec.PDB = tt.pdb
+
+			got := getPDBSettings(rs, tt.component)
+			if !equalIntOrString(got.MinAvailable, tt.wantMinAvailable) {
+				t.Errorf("minAvailable = %v, want %v", got.MinAvailable, tt.wantMinAvailable)
+			}
+			if !equalIntOrString(got.MaxUnavailable, tt.wantMaxUnavailable) {
+				t.Errorf("maxUnavailable = %v, want %v", got.MaxUnavailable, tt.wantMaxUnavailable)
+			}
+		})
+	}
+}
+
+func equalIntOrString(a, b *intstr.IntOrString) bool {
+	if a == nil || b == nil {
+		return a == b
+	}
+	return *a == *b
+}
+
+func TestEnsurePodDisruptionBudget(t *testing.T) {
+	rs := newStorageCluster("1Gi")
+	rs.Spec.Sentinel.Replicas = 3
+	labels := map[string]string{"app": "redis"}
+	r, cli := newFakeKubeClient(t)
+
+	get := func() *policyv1beta1.PodDisruptionBudget {
+		pdb := &policyv1beta1.PodDisruptionBudget{}
+		name := types.NamespacedName{Namespace: testNamespace, Name: util.GetSentinelName(rs)}
+		if err := cli.Get(context.TODO(), name, pdb); err != nil {
+			t.Fatal(err)
+		}
+		return pdb
+	}
+	ensure := func() {
+		if err := r.ensurePodDisruptionBudget(rs, util.SentinelName, util.SentinelRoleName, labels, nil); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	ensure()
+	if pdb := get(); pdb.Spec.MinAvailable == nil || pdb.Spec.MinAvailable.IntValue() != 2 {
+		t.Errorf("default budget = %+v, want minAvailable 2", pdb.Spec)
+	}
+
+	rs.Spec.Sentinel.Replicas = 5
+	ensure()
+	if pdb := get(); pdb.Spec.MinAvailable == nil || pdb.Spec.MinAvailable.IntValue() != 3 {
+		t.Errorf("budget after the scale = %+v, want minAvailable 3", pdb.Spec)
+	}
+
+	maxUnavailable := intstr.FromInt(1)
+	rs.Spec.PDB = &rsv1.PDBSettings{Sentinel: &rsv1.PDBComponentSettings{MaxUnavailable: &maxUnavailable}}
+	ensure()
+	if pdb := get(); pdb.Spec.MinAvailable != nil || pdb.Spec.MaxUnavailable == nil || pdb.Spec.MaxUnavailable.IntValue() != 1 {
+		t.Errorf("budget of the spec = %+v, want maxUnavailable 1", pdb.Spec)
+	}
+}
@@ -2,6 +2,7 @@ package service
 
 
 import (
+	"context"
 	"errors"
 	"fmt"
 	"sort"
@@ -10,66 +11,90 @@ import (
 	rsv1 "redis-sentinel/api/v1"
 	"redis-sentinel/pkg/k8s"
 	"redis-sentinel/controllers/redisclient"
+	"redis-sentinel/pkg/metrics"
 	"redis-sentinel/pkg/util"
+	"redis-sentinel/pkg/version"
 )
 
 // RedisClusterHeal defines the intercace able to fix the problems on the redis clusters
 type RedisClusterHeal interface {
-	MakeMaster(ip string, auth *util.AuthConfig) error
-	SetOldestAsMaster(rs *rsv1.RedisSentinel, auth *util.AuthConfig) error
-	SetMasterOnAll(masterIP string, rs *rsv1.RedisSentinel, auth *util.AuthConfig) error
-	NewSentinelMonitor(ip string, monitor string, rs *rsv1.RedisSentinel, auth *util.AuthConfig) error
-	RestoreSentinel(ip string, auth *util.AuthConfig) error
-	SetSentinelCustomConfig(ip string, rs *rsv1.RedisSentinel, auth *util.AuthConfig) error
-	SetRedisCustomConfig(ip string, rs *rsv1.RedisSentinel, auth *util.AuthConfig) error
+	MakeMaster(ctx context.Context, node *RedisNode, rs *rsv1.RedisSentinel, auth *util.AuthConfig) error
+	SetOldestAsMaster(ctx context.Context, topo *Topology, rs *rsv1.RedisSentinel, auth *util.AuthConfig) error
+	SetMasterOnAll(ctx context.Context, master *RedisNode, topo *Topology, rs *rsv1.RedisSentinel, auth *util.AuthConfig) error
+	NewSentinelMonitor(ctx context.Context, ip string, monitor string, monitorPort string, rs *rsv1.RedisSentinel, auth *util.AuthConfig) error
+	RestoreSentinel(ctx context.Context, ip string, rs *rsv1.RedisSentinel, auth *util.AuthConfig) error
+	SetSentinelCustomConfig(ctx context.Context, ip string, rs *rsv1.RedisSentinel, auth *util.AuthConfig) error
+	SetRedisCustomConfig(ctx context.Context, node *RedisNode, rs *rsv1.RedisSentinel, auth *util.AuthConfig) error
+	SetRedisRoleLabels(master *RedisNode, topo *Topology, rs *rsv1.RedisSentinel) error
+	SetAnnounceAddrs(ctx context.Context, topo *Topology, rs *rsv1.RedisSentinel, auth *util.AuthConfig) error
+	SetReplicaPriorities(ctx context.Context, topo *Topology, rs *rsv1.RedisSentinel, auth *util.AuthConfig) error
+	RemoveSentinelMonitor(ctx context.Context, ip string, rs *rsv1.RedisSentinel, auth *util.AuthConfig) error
+	SaveSnapshot(ctx context.Context, ip string, rs *rsv1.RedisSentinel, auth *util.AuthConfig) error
+	FailoverMaster(ctx context.Context, topo *Topology, rs *rsv1.RedisSentinel, auth *util.AuthConfig) error
+	ReplicateSource(ctx context.Context, head *RedisNode, source *ReplicaOfSource, rs *rsv1.RedisSentinel, auth *util.AuthConfig) error
+	SetStandbyReplicas(ctx context.Context, head *RedisNode, topo *Topology, rs *rsv1.RedisSentinel, auth *util.AuthConfig) error
+	PromoteStandby(ctx context.Context, head *RedisNode, rs *rsv1.RedisSentinel, auth *util.AuthConfig) error
+	SetSourceReadOnly(ctx context.Context, source *ReplicaOfSource, rs *rsv1.RedisSentinel) (*rsv1.SourceWrites, error)
+	RestoreSourceWrites(ctx context.Context, source *ReplicaOfSource, writes *rsv1.SourceWrites, rs *rsv1.RedisSentinel) error
+	RestartPod(name string, rs *rsv1.RedisSentinel) error
+	RewriteAOF(ctx context.Context, ip string, rs *rsv1.RedisSentinel, auth *util.AuthConfig) error
+	ResyncReplica(ctx context.Context, node *RedisNode, master *RedisNode, rs *rsv1.RedisSentinel, auth *util.AuthConfig) error
+	SetMasterAuth(ctx context.Context, ip string, password string, rs *rsv1.RedisSentinel, auth *util.AuthConfig) error
+	SetRedisPassword(ctx context.Context, ip string, password string, rs *rsv1.RedisSentinel, auth *util.AuthConfig) error
+	SetSentinelAuthPass(ctx context.Context, ip string, password string, rs *rsv1.RedisSentinel, auth *util.AuthConfig) error
 }
 
 // RedisClusterHealer is our implementation of RedisClusterCheck intercace
 type RedisClusterHealer struct {
 	k8sService  k8s.Services
 	redisClient redisclient.Client
+	metrics     metrics.Instrumenter
 	logger      logr.Logger
 }
 
 // NewRedisClusterHealer creates an object of the RedisClusterChecker struct
-func NewRedisClusterHealer(k8sService k8s.Services, redisClient redisclient.Client, logger logr.Logger) *RedisClusterHealer {
+func NewRedisClusterHealer(k8sService k8s.Services, redisClient redisclient.Client, metrics metrics.Instrumenter, logger logr.Logger) *RedisClusterHealer {
 	return &RedisClusterHealer{
 		k8sService:  k8sService,
 		redisClient: redisClient,
+		metrics:     metrics,
 		logger:      logger,
 	}
 }
 
-func (r *RedisClusterHealer) MakeMaster(ip string, auth *util.AuthConfig) error {
-	return r.redisClient.MakeMaster(ip, auth)
+func (r *RedisClusterHealer) MakeMaster(ctx context.Context, node *RedisNode, rs *rsv1.RedisSentinel, auth *util.AuthConfig) error {
+	r.metrics.IncHealAction(rs.Namespace, rs.Name, metrics.HealMakeMaster)
+	return r.redisClient.MakeMaster(ctx, node.IP, node.Version, auth)
 }
 
 // SetOldestAsMaster puts all redis to the same master, choosen by order of appearance
-func (r *RedisClusterHealer) SetOldestAsMaster(rs *rsv1.RedisSentinel, auth *util.AuthConfig) error {
-	ssp, err := r.k8sService.GetStatefulSetPods(rs.Namespace, util.GetRedisName(rs))
-	if err != nil {
-		return err
-	}
-	if len(ssp.Items) < 1 {
+func (r *RedisClusterHealer) SetOldestAsMaster(ctx context.Context, topo *Topology, rs *rsv1.RedisSentinel, auth *util.AuthConfig) error {
+	if len(topo.Redises) < 1 {
 		return errors.New("number of redis pods are 0")
 	}
+	r.metrics.IncHealAction(rs.Namespace, rs.Name, metrics.HealSetOldestAsMaster)
 
-	// Order the pods so we start by the oldest one
-	sort.Slice(ssp.Items, func(i, j int) bool {
-		return ssp.Items[i].CreationTimestamp.Before(&ssp.Items[j].CreationTimestamp)
+	// Order the pods so we start by the oldest one, the ones in the preferred zone first
+	nodes := make([]*RedisNode, len(topo.Redises))
+	copy(nodes, topo.Redises)
+	zone := preferredMasterZone(rs)
+	sort.Slice(nodes, func(i, j int) bool {
+		if inZone := nodes[i].Zone == zone; zone != "" && inZone != (nodes[j].Zone == zone) {
+			return inZone
+		}
+		return nodes[i].Pod.CreationTimestamp.Before(&nodes[j].Pod.CreationTimestamp)
 	})
 
-	newMasterIP := ""
-	for _, pod := range ssp.Items {
-		if newMasterIP == "" {
-			newMasterIP = pod.Status.PodIP
-			r.logger.V(2).Info(fmt.Sprintf("new master is %s with ip %s", pod.Name, newMasterIP))
-			if err := r.redisClient.MakeMaster(newMasterIP, auth); err != nil {
+	newMaster := nodes[0]
+	for _, node := range nodes {
+		if node == newMaster {
+			util.LoggerFrom(ctx, r.logger).V(2).Info(fmt.Sprintf("new master is %s with ip %s", node.Pod.Name, node.IP))
+			if err := r.redisClient.MakeMaster(ctx, node.IP, node.Version, auth); err != nil {
 				return err
 			}
 		} else {
-			r.logger.V(2).Info(fmt.Sprintf("making pod %s slave of %s", pod.Name, newMasterIP))
-			if err := r.redisClient.MakeSlaveOf(pod.Status.PodIP, newMasterIP, auth); err != nil {
+			util.LoggerFrom(ctx, r.logger).V(2).Info(fmt.Sprintf("making pod %s slave of %s", node.Pod.Name, newMaster.IP))
+			if err := r.redisClient.MakeSlaveOf(ctx, node.IP, newMaster.AnnounceHost, newMaster.AnnouncePort, node.Version, auth); err != nil {
 				return err
 			}
 		}
@@ -78,20 +103,17 @@ func (r *RedisClusterHealer) SetOldestAsMaster(rs *rsv1.RedisSentinel, auth *uti
 }
 
 // SetMasterOnAll puts all redis nodes as a slave of a given master
-func (r *RedisClusterHealer) SetMasterOnAll(masterIP string, rs *rsv1.RedisSentinel, auth *util.AuthConfig) error {
-	ssp, err := r.k8sService.GetStatefulSetPods(rs.Namespace, util.GetRedisName(rs))
-	if err != nil {
-		return err
-	}
-	for _, pod := range ssp.Items {
-		if pod.Status.PodIP == masterIP {
-			r.logger.V(2).Info(fmt.Sprintf("ensure pod %s is master", pod.Name))
-			if err := r.redisClient.MakeMaster(masterIP, auth); err != nil {
+func (r *RedisClusterHealer) SetMasterOnAll(ctx context.Context, master *RedisNode, topo *Topology, rs *rsv1.RedisSentinel, auth *util.AuthConfig) error {
+	r.metrics.IncHealAction(rs.Namespace, rs.Name, metrics.HealSetMasterOnAll)
+	for _, node := range topo.Redises {
+		if node == master {
+			util.LoggerFrom(ctx, r.logger).V(2).Info(fmt.Sprintf("ensure pod %s is master", node.Pod.Name))
+			if err := r.redisClient.MakeMaster(ctx, node.IP, node.Version, auth); err != nil {
 				return err
 			}
 		} else {
-			r.logger.V(2).Info(fmt.Sprintf("making pod %s slave of %s", pod.Name, masterIP))
-			if err := r.redisClient.MakeSlaveOf(pod.Status.PodIP, masterIP, auth); err != nil {
+			util.LoggerFrom(ctx, r.logger).V(2).Info(fmt.Sprintf("making pod %s slave of %s", node.Pod.Name, master.IP))
+			if err := r.redisClient.MakeSlaveOf(ctx, node.IP, master.AnnounceHost, master.AnnouncePort, node.Version, auth); err != nil {
 				return err
 			}
 		}
@@ -100,29 +122,32 @@ func (r *RedisClusterHealer) SetMasterOnAll(masterIP string, rs *rsv1.RedisSenti
 }
 
 // NewSentinelMonitor changes the master that Sentinel has to monitor
-func (r *RedisClusterHealer) NewSentinelMonitor(ip string, monitor string, rs *rsv1.RedisSentinel, auth *util.AuthConfig) error {
-	r.logger.V(2).Info("sentinel is not monitoring the correct master, changing...")
-	quorum := strconv.Itoa(int(getQuorum(rs)))
-	return r.redisClient.MonitorRedis(ip, monitor, quorum, auth)
+func (r *RedisClusterHealer) NewSentinelMonitor(ctx context.Context, ip string, monitor string, monitorPort string, rs *rsv1.RedisSentinel, auth *util.AuthConfig) error {
+	util.LoggerFrom(ctx, r.logger).V(2).Info("sentinel is not monitoring the correct master, changing...")
+	r.metrics.IncHealAction(rs.Namespace, rs.Name, metrics.HealNewSentinelMonitor)
+	quorum := strconv.Itoa(int(GetQuorum(rs)))
+	return r.redisClient.MonitorRedis(ctx, ip, monitor, monitorPort, quorum, auth)
 }
 
 // RestoreSentinel clear the number of sentinels on memory
-func (r *RedisClusterHealer) RestoreSentinel(ip string, auth *util.AuthConfig) error {
-	r.logger.V(2).Info(fmt.Sprintf("restoring sentinel %s...", ip))
-	return r.redisClient.ResetSentinel(ip, auth)
+func (r *RedisClusterHealer) RestoreSentinel(ctx context.Context, ip string, rs *rsv1.RedisSentinel, auth *util.AuthConfig) error {
+	util.LoggerFrom(ctx, r.logger).V(2).Info(fmt.Sprintf("restoring sentinel %s...", ip))
+	r.metrics.IncHealAction(rs.Namespace, rs.Name, metrics.HealRestoreSentinel)
+	return r.redisClient.ResetSentinel(ctx, ip, auth)
 }
 
 // SetSentinelCustomConfig will call sentinel to set the configuration given in config
-func (r *RedisClusterHealer) SetSentinelCustomConfig(ip string, rs *rsv1.RedisSentinel, auth *util.AuthConfig) error {
+func (r *RedisClusterHealer) SetSentinelCustomConfig(ctx context.Context, ip string, rs *rsv1.RedisSentinel, auth *util.AuthConfig) error {
 	if len(rs.Spec.Sentinel.CustomConfig) == 0 {
 		return nil
 	}
-	r.logger.V(2).Info(fmt.Sprintf(fmt.Sprintf("setting the custom config on sentinel %s: %v", ip, rs.Spec.Sentinel.CustomConfig)))
-	return r.redisClient.SetCustomSentinelConfig(ip, rs.Spec.Sentinel.CustomConfig, auth)
+	util.LoggerFrom(ctx, r.logger).V(2).Info(fmt.Sprintf("setting the custom config on sentinel %s: %v", ip, util.RedactConfigLines(rs.Spec.Sentinel.CustomConfig)))
+	r.metrics.IncHealAction(rs.Namespace, rs.Name, metrics.HealSetSentinelConfig)
+	return r.redisClient.SetCustomSentinelConfig(ctx, ip, rs.Spec.Sentinel.CustomConfig, auth)
 }
 
 // SetRedisCustomConfig will call redis to set the configuration given in config
-func (r *RedisClusterHealer) SetRedisCustomConfig(ip string, rs *rsv1.RedisSentinel, auth *util.AuthConfig) error {
+func (r *RedisClusterHealer) SetRedisCustomConfig(ctx context.Context, node *RedisNode, rs *rsv1.RedisSentinel, auth *util.AuthConfig) error {
 	if len(rs.Spec.Config) == 0 && len(auth.Password) == 0 {
 		return nil
 	}
@@ -132,8 +157,171 @@ func (r *RedisClusterHealer) SetRedisCustomConfig(ip string, rs *rsv1.RedisSenti
 	//	rc.Spec.Config["masterauth"] = auth.Password
 	//}
 
-	r.logger.V(2).Info(fmt.Sprintf("setting the custom config on redis %s: %v", ip, rs.Spec.Config))
+	config := expectedRedisConfig(rs, node)
+	util.LoggerFrom(ctx, r.logger).V(2).Info(fmt.Sprintf("setting the custom config on redis %s: %v", node.IP, util.RedactConfig(config)))
+	r.metrics.IncHealAction(rs.Namespace, rs.Name, metrics.HealSetRedisConfig)
+
+	return r.redisClient.SetCustomRedisConfig(ctx, node.IP, config, node.Version, auth)
+}
+
+// expectedRedisConfig returns the config of the spec the node should run, the replica priority
+// of a redis kept from the promotion on a cordoned node is left to SetReplicaPriorities
+func expectedRedisConfig(rs *rsv1.RedisSentinel, node *RedisNode) map[string]string {
+	if !node.Cordoned || node.Config[replicaPriorityConfig] != cordonedReplicaPriority {
+		return rs.Spec.Config
+	}
+	config := make(map[string]string, len(rs.Spec.Config))
+	for key, value := range rs.Spec.Config {
+		config[key] = value
+	}
+	delete(config, replicaPriorityConfig)
+	for _, alias := range version.ConfigAliases(replicaPriorityConfig) {
+		delete(config, alias)
+	}
+	return config
+}
+
+// SetRedisRoleLabels keeps the role label of every redis pod in sync with the given master.
+// Pods that are no longer master are relabeled before the new master is labeled, so the
+// master service never selects more than one pod.
+func (r *RedisClusterHealer) SetRedisRoleLabels(master *RedisNode, topo *Topology, rs *rsv1.RedisSentinel) error {
+	for i := range topo.redisPods {
+		pod := &topo.redisPods[i]
+		if pod.Name == master.Pod.Name {
+			continue
+		}
+		if pod.Labels[util.RedisRoleLabelKey] != util.RedisRoleLabelReplica {
+			r.logger.V(2).Info(fmt.Sprintf("labeling pod %s as %s", pod.Name, util.RedisRoleLabelReplica))
+			if err := r.k8sService.UpdatePodLabels(rs.Namespace, pod.Name, map[string]string{
+				util.RedisRoleLabelKey: util.RedisRoleLabelReplica,
+			}); err != nil {
+				return err
+			}
+		}
+	}
+
+	if master.Pod.Labels[util.RedisRoleLabelKey] != util.RedisRoleLabelMaster {
+		r.logger.V(2).Info(fmt.Sprintf("labeling pod %s as %s", master.Pod.Name, util.RedisRoleLabelMaster))
+		return r.k8sService.UpdatePodLabels(rs.Namespace, master.Pod.Name, map[string]string{
+			util.RedisRoleLabelKey: util.RedisRoleLabelMaster,
+		})
+	}
+	return nil
+}
+
+// SetAnnounceAddrs makes every redis and sentinel announce the address of its exposed service,
+// or its DNS name when hostnames are used
+func (r *RedisClusterHealer) SetAnnounceAddrs(ctx context.Context, topo *Topology, rs *rsv1.RedisSentinel, auth *util.AuthConfig) error {
+	if !useAnnounce(rs) {
+		return nil
+	}
+
+	for _, node := range topo.Redises {
+		if node.Config["replica-announce-ip"] == node.AnnounceHost && node.Config["replica-announce-port"] == node.AnnouncePort {
+			continue
+		}
+		if err := r.redisClient.SetRedisAnnounce(ctx, node.IP, node.AnnounceHost, node.AnnouncePort, auth); err != nil {
+			return err
+		}
+	}
+
+	for _, node := range topo.Sentinels {
+		if rs.Spec.UseHostnames && (node.Config["resolve-hostnames"] != "yes" || node.Config["announce-hostnames"] != "yes") {
+			// sentinels must resolve the hostnames before they are given one to monitor
+			if err := r.redisClient.EnableSentinelHostnames(ctx, node.IP, auth); err != nil {
+				return err
+			}
+		}
+		if node.Config["announce-ip"] == node.AnnounceHost && node.Config["announce-port"] == node.AnnouncePort {
+			continue
+		}
+		if err := r.redisClient.SetSentinelAnnounce(ctx, node.IP, node.AnnounceHost, node.AnnouncePort, auth); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// RemoveSentinelMonitor makes the sentinel forget the master, so it doesn't failover while the cluster is deleted
+func (r *RedisClusterHealer) RemoveSentinelMonitor(ctx context.Context, ip string, rs *rsv1.RedisSentinel, auth *util.AuthConfig) error {
+	util.LoggerFrom(ctx, r.logger).V(2).Info(fmt.Sprintf("removing the master from sentinel %s...", ip))
+	return r.redisClient.RemoveSentinelMonitor(ctx, ip, auth)
+}
+
+// SaveSnapshot saves the dataset of the given redis on its disk
+func (r *RedisClusterHealer) SaveSnapshot(ctx context.Context, ip string, rs *rsv1.RedisSentinel, auth *util.AuthConfig) error {
+	util.LoggerFrom(ctx, r.logger).V(2).Info(fmt.Sprintf("saving a snapshot of redis %s...", ip))
+	return r.redisClient.SaveSnapshot(ctx, ip, auth)
+}
+
+// FailoverMaster asks the sentinels to promote a replica, the first sentinel accepting it
+// runs the failover
+func (r *RedisClusterHealer) FailoverMaster(ctx context.Context, topo *Topology, rs *rsv1.RedisSentinel, auth *util.AuthConfig) error {
+	r.metrics.IncHealAction(rs.Namespace, rs.Name, metrics.HealFailoverMaster)
+	var err error
+	for _, sentinel := range topo.Sentinels {
+		util.LoggerFrom(ctx, r.logger).V(2).Info(fmt.Sprintf("asking sentinel %s to failover the master...", sentinel.IP))
+		if err = r.redisClient.SentinelFailover(ctx, sentinel.IP, auth); err == nil {
+			return nil
+		}
+	}
+	if err == nil {
+		err = errors.New("no sentinel to failover the master")
+	}
+	return err
+}
+
+// SetReplicaPriorities gives the redis in the preferred master zone a better replica priority,
+// so the sentinels promote one of them on a failover. While the master is drained the redis on
+// cordoned nodes can't be promoted, the failover doesn't pick a pod about to be evicted
+func (r *RedisClusterHealer) SetReplicaPriorities(ctx context.Context, topo *Topology, rs *rsv1.RedisSentinel, auth *util.AuthConfig) error {
+	zone := preferredMasterZone(rs)
+	var draining bool
+	if masters := topo.Masters(); len(masters) == 1 {
+		draining = topo.MasterDraining(masters[0])
+	}
 
-	return r.redisClient.SetCustomRedisConfig(ip, rs.Spec.Config, auth)
+	for _, node := range topo.Redises {
+		priority := replicaPriority(node, zone, draining, rs)
+		if priority == "" || node.Config[replicaPriorityConfig] == priority {
+			continue
+		}
+		util.LoggerFrom(ctx, r.logger).V(2).Info(fmt.Sprintf("setting the replica priority of pod %s in zone %q to %s", node.Pod.Name, node.Zone, priority))
+		r.metrics.IncHealAction(rs.Namespace, rs.Name, metrics.HealSetRedisConfig)
+		if err := r.redisClient.SetCustomRedisConfig(ctx, node.IP, map[string]string{replicaPriorityConfig: priority}, node.Version, auth); err != nil {
+			return err
+		}
+	}
+	return nil
 }
 
+// replicaPriority returns the replica priority the node should have, empty when it is left as
+// configured
+func replicaPriority(node *RedisNode, zone string, draining bool, rs *rsv1.RedisSentinel) string {
+	if draining && node.Cordoned {
+		return cordonedReplicaPriority
+	}
+	if zone != "" {
+		if node.Zone == zone {
+			return preferredReplicaPriority
+		}
+		return otherReplicaPriority
+	}
+	// a redis kept from the promotion during a drain gets back the priority of the spec
+	if node.Config[replicaPriorityConfig] == cordonedReplicaPriority {
+		for _, key := range append([]string{replicaPriorityConfig}, version.ConfigAliases(replicaPriorityConfig)...) {
+			if priority, ok := rs.Spec.Config[key]; ok {
+				return priority
+			}
+		}
+		return otherReplicaPriority
+	}
+	return ""
+}
+
+func preferredMasterZone(rs *rsv1.RedisSentinel) string {
+	if rs.Spec.Placement == nil {
+		return ""
+	}
+	return rs.Spec.Placement.PreferredMasterZone
+}
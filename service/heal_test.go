@@ -0,0 +1,195 @@
+package service
+
+import (
+	"context"
+	"fmt"
+	"testing"
+
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	logf "sigs.k8s.io/controller-runtime/pkg/log"
+
+	rsv1 "redis-sentinel/api/v1"
+	"redis-sentinel/pkg/metrics"
+	"redis-sentinel/pkg/util"
+	"redis-sentinel/pkg/version"
+)
+
+// nopMetrics drops the heal actions counted by the healer
+type nopMetrics struct {
+	metrics.Instrumenter
+}
+
+func (nopMetrics) IncHealAction(namespace string, name string, action string) {}
+
+func (c *fakeRedisClient) SetRedisAnnounce(ctx context.Context, ip string, announceIP string, announcePort string, auth *util.AuthConfig) error {
+	c.calls = append(c.calls, fmt.Sprintf("SetRedisAnnounce %s %s:%s", ip, announceIP, announcePort))
+	return nil
+}
+
+func (c *fakeRedisClient) SetSentinelAnnounce(ctx context.Context, ip string, announceIP string, announcePort string, auth *util.AuthConfig) error {
+	c.calls = append(c.calls, fmt.Sprintf("SetSentinelAnnounce %s %s:%s", ip, announceIP, announcePort))
+	return nil
+}
+
+func (c *fakeRedisClient) EnableSentinelHostnames(ctx context.Context, ip string, auth *util.AuthConfig) error {
+	c.calls = append(c.calls, "EnableSentinelHostnames "+ip)
+	return nil
+}
+
+func (c *fakeRedisClient) SetCustomRedisConfig(ctx context.Context, ip string, configs map[string]string, v *version.ServerVersion, auth *util.AuthConfig) error {
+	for key, value := range configs {
+		c.calls = append(c.calls, fmt.Sprintf("SetCustomRedisConfig %s %s %s", ip, key, value))
+	}
+	return nil
+}
+
+func TestSetAnnounceAddrs(t *testing.T) {
+	announced := map[string]string{
+		"resolve-hostnames":  "yes",
+		"announce-hostnames": "yes",
+		"announce-ip":        "sentinel-test-0.sentinel-test",
+		"announce-port":      "26379",
+	}
+	tests := []struct {
+		name      string
+		config    map[string]string
+		wantCalls []string
+	}{
+		{
+			name:   "not announced yet",
+			config: map[string]string{"resolve-hostnames": "no", "announce-hostnames": "no"},
+			wantCalls: []string{
+				"EnableSentinelHostnames 10.0.1.1",
+				"SetSentinelAnnounce 10.0.1.1 sentinel-test-0.sentinel-test:26379",
+			},
+		},
+		{
+			name:   "announce address changed",
+			config: map[string]string{"resolve-hostnames": "yes", "announce-hostnames": "yes", "announce-ip": "10.0.1.1", "announce-port": "26379"},
+			wantCalls: []string{
+				"SetSentinelAnnounce 10.0.1.1 sentinel-test-0.sentinel-test:26379",
+			},
+		},
+		{
+			name:   "already announced",
+			config: announced,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rs := newStorageCluster("1Gi")
+			rs.Spec.UseHostnames = true
+			topo := &Topology{Sentinels: []*SentinelNode{{
+				IP:           "10.0.1.1",
+				AnnounceHost: "sentinel-test-0.sentinel-test",
+				AnnouncePort: "26379",
+				Config:       tt.config,
+			}}}
+			redisClient := &fakeRedisClient{}
+			healer := &RedisClusterHealer{redisClient: redisClient, logger: logf.NullLogger{}}
+
+			if err := healer.SetAnnounceAddrs(context.TODO(), topo, rs, &util.AuthConfig{}); err != nil {
+				t.Fatalf("SetAnnounceAddrs() error = %v", err)
+			}
+			if len(redisClient.calls) != len(tt.wantCalls) {
+				t.Fatalf("redis commands = %q, want %q", redisClient.calls, tt.wantCalls)
+			}
+			for i, call := range tt.wantCalls {
+				if redisClient.calls[i] != call {
+					t.Errorf("redis command %d = %q, want %q", i, redisClient.calls[i], call)
+				}
+			}
+		})
+	}
+}
+
+func TestSetReplicaPriorities(t *testing.T) {
+	newNode := func(index int, zone string, cordoned bool, priority string) *RedisNode {
+		return &RedisNode{
+			Pod:      &corev1.Pod{ObjectMeta: metav1.ObjectMeta{Name: fmt.Sprintf("redis-test-%d", index), Namespace: testNamespace}},
+			IP:       fmt.Sprintf("10.0.0.%d", index+1),
+			IsMaster: index == 0,
+			Zone:     zone,
+			Cordoned: cordoned,
+			Config:   map[string]string{replicaPriorityConfig: priority},
+		}
+	}
+	tests := []struct {
+		name      string
+		zone      string
+		redises   []*RedisNode
+		wantCalls []string
+	}{
+		{
+			name:    "no preferred zone",
+			redises: []*RedisNode{newNode(0, "", false, "1"), newNode(1, "", false, "1")},
+		},
+		{
+			name:    "preferred zone",
+			zone:    "a",
+			redises: []*RedisNode{newNode(0, "a", false, "1"), newNode(1, "b", false, "1"), newNode(2, "a", false, "100")},
+			wantCalls: []string{
+				"SetCustomRedisConfig 10.0.0.2 slave-priority 100",
+				"SetCustomRedisConfig 10.0.0.3 slave-priority 1",
+			},
+		},
+		{
+			name:    "master drained",
+			redises: []*RedisNode{newNode(0, "", true, "1"), newNode(1, "", true, "1"), newNode(2, "", false, "1")},
+			wantCalls: []string{
+				"SetCustomRedisConfig 10.0.0.1 slave-priority 0",
+				"SetCustomRedisConfig 10.0.0.2 slave-priority 0",
+			},
+		},
+		{
+			name:    "master drained in the preferred zone",
+			zone:    "a",
+			redises: []*RedisNode{newNode(0, "a", true, "1"), newNode(1, "a", true, "1"), newNode(2, "b", false, "100")},
+			wantCalls: []string{
+				"SetCustomRedisConfig 10.0.0.1 slave-priority 0",
+				"SetCustomRedisConfig 10.0.0.2 slave-priority 0",
+			},
+		},
+		{
+			name:    "every replica cordoned",
+			redises: []*RedisNode{newNode(0, "", true, "1"), newNode(1, "", true, "0")},
+			wantCalls: []string{
+				"SetCustomRedisConfig 10.0.0.2 slave-priority 1",
+			},
+		},
+		{
+			name:    "drain over",
+			redises: []*RedisNode{newNode(0, "", false, "1"), newNode(1, "", false, "0")},
+			wantCalls: []string{
+				"SetCustomRedisConfig 10.0.0.2 slave-priority 1",
+			},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rs := newStorageCluster("1Gi")
+			rs.Spec.Config = map[string]string{}
+			if tt.zone != "" {
+				rs.Spec.Placement = &rsv1.PlacementSettings{PreferredMasterZone: tt.zone}
+			}
+			if err := rs.Validate(); err != nil {
+				t.Fatal(err)
+			}
+			redisClient := &fakeRedisClient{}
+			healer := &RedisClusterHealer{redisClient: redisClient, metrics: nopMetrics{}, logger: logf.NullLogger{}}
+
+			if err := healer.SetReplicaPriorities(context.TODO(), &Topology{Redises: tt.redises}, rs, &util.AuthConfig{}); err != nil {
+				t.Fatalf("SetReplicaPriorities() error = %v", err)
+			}
+			if len(redisClient.calls) != len(tt.wantCalls) {
+				t.Fatalf("redis commands = %q, want %q", redisClient.calls, tt.wantCalls)
+			}
+			for i, call := range tt.wantCalls {
+				if redisClient.calls[i] != call {
+					t.Errorf("redis command %d = %q, want %q", i, redisClient.calls[i], call)
+				}
+			}
+		})
+	}
+}
@@ -0,0 +1,40 @@
+package service
+
+import (
+	"fmt"
+	"strings"
+
+	appsv1 "k8s.io/api/apps/v1"
+
+	rsv1 "redis-sentinel/api/v1"
+)
+
+// MaintenancePending is returned when disruptive changes of the cluster wait for its
+// maintenance window, the other changes were applied
+type MaintenancePending struct {
+	Changes []string
+}
+
+func (e *MaintenancePending) Error() string {
+	return fmt.Sprintf("%s waiting for the maintenance window", strings.Join(e.Changes, ", "))
+}
+
+// updateStatefulSet updates the statefulset when its pod template or its replicas changed.
+// A new pod template restarts all the pods, outside of the maintenance window only the
+// replicas are patched and the rest is reported pending. A change of the replicas alone
+// patches them, the fields kubernetes defaulted on the stored statefulset are kept
+func (r *RedisSentinelKubeClient) updateStatefulSet(rs *rsv1.RedisSentinel, old, ss *appsv1.StatefulSet, templateChanged, open bool, component string) error {
+	scaled := *old.Spec.Replicas != *ss.Spec.Replicas
+	if !templateChanged || !open {
+		if scaled {
+			if err := r.K8SService.ScaleStatefulSet(rs.Namespace, old, *ss.Spec.Replicas); err != nil {
+				return err
+			}
+		}
+		if templateChanged {
+			return &MaintenancePending{Changes: []string{fmt.Sprintf("%s rolling restart", component)}}
+		}
+		return nil
+	}
+	return r.K8SService.UpdateStatefulSet(rs.Namespace, ss)
+}
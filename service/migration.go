@@ -0,0 +1,52 @@
+package service
+
+import (
+	"context"
+	"fmt"
+	"strconv"
+
+	rsv1 "redis-sentinel/api/v1"
+	"redis-sentinel/pkg/metrics"
+	"redis-sentinel/pkg/util"
+)
+
+// GetMigrationSource returns the address and the password of the redis migrated into the
+// cluster, the password is read from its Secret
+func (r *RedisClusterChecker) GetMigrationSource(rs *rsv1.RedisSentinel, source *rsv1.MigrationSource) (*ReplicaOfSource, error) {
+	auth := &util.AuthConfig{}
+	if ref := source.PasswordSecret; ref != nil {
+		secret, err := r.k8sService.GetSecret(rs.Namespace, ref.Name)
+		if err != nil {
+			return nil, fmt.Errorf("password of the source %s: %v", source.Host, err)
+		}
+		password, ok := secret.Data[ref.Key]
+		if !ok {
+			return nil, fmt.Errorf("password of the source %s: secret %s has no key %s", source.Host, ref.Name, ref.Key)
+		}
+		auth.Password = string(password)
+	}
+	return &ReplicaOfSource{
+		Host: source.Host,
+		Port: strconv.Itoa(int(source.Port)),
+		Auth: auth,
+	}, nil
+}
+
+// SetSourceReadOnly stops the writes on the source of a migration, what it received before
+// still reaches the cluster. It returns the settings of the source before the change
+func (r *RedisClusterHealer) SetSourceReadOnly(ctx context.Context, source *ReplicaOfSource, rs *rsv1.RedisSentinel) (*rsv1.SourceWrites, error) {
+	r.metrics.IncHealAction(rs.Namespace, rs.Name, metrics.HealSetSourceReadOnly)
+	util.LoggerFrom(ctx, r.logger).V(2).Info(fmt.Sprintf("making the source %s read-only", source))
+	minReplicas, maxLag, err := r.redisClient.SetSourceReadOnly(ctx, source.Host, source.Port, source.Auth)
+	if err != nil {
+		return nil, err
+	}
+	return &rsv1.SourceWrites{MinReplicasToWrite: minReplicas, MinReplicasMaxLag: maxLag}, nil
+}
+
+// RestoreSourceWrites gives back its writes to a source made read-only by a cutover
+func (r *RedisClusterHealer) RestoreSourceWrites(ctx context.Context, source *ReplicaOfSource, writes *rsv1.SourceWrites, rs *rsv1.RedisSentinel) error {
+	r.metrics.IncHealAction(rs.Namespace, rs.Name, metrics.HealRestoreSourceWrites)
+	util.LoggerFrom(ctx, r.logger).V(2).Info(fmt.Sprintf("restoring the writes of the source %s", source))
+	return r.redisClient.RestoreSourceWrites(ctx, source.Host, source.Port, writes.MinReplicasToWrite, writes.MinReplicasMaxLag, source.Auth)
+}
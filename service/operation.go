@@ -0,0 +1,68 @@
+package service
+
+import (
+	"context"
+	"fmt"
+
+	rsv1 "redis-sentinel/api/v1"
+	"redis-sentinel/pkg/util"
+)
+
+// RestartPod deletes a redis or sentinel pod, its statefulset creates it again
+func (r *RedisClusterHealer) RestartPod(name string, rs *rsv1.RedisSentinel) error {
+	r.logger.V(2).Info(fmt.Sprintf("restarting pod %s", name))
+	return r.k8sService.DeletePod(rs.Namespace, name)
+}
+
+// RewriteAOF starts the rewrite of the append only file of the given redis
+func (r *RedisClusterHealer) RewriteAOF(ctx context.Context, ip string, rs *rsv1.RedisSentinel, auth *util.AuthConfig) error {
+	util.LoggerFrom(ctx, r.logger).V(2).Info(fmt.Sprintf("rewriting the append only file of redis %s", ip))
+	return r.redisClient.RewriteAOF(ctx, ip, auth)
+}
+
+// ResyncReplica detaches a replica, removes its keys and makes it replicate the master again,
+// it then loads a full copy of the master. The roles are read again before the replica is
+// detached and before its keys are removed, a failover since the topology was read stops it
+func (r *RedisClusterHealer) ResyncReplica(ctx context.Context, node *RedisNode, master *RedisNode, rs *rsv1.RedisSentinel, auth *util.AuthConfig) error {
+	util.LoggerFrom(ctx, r.logger).V(2).Info(fmt.Sprintf("resyncing replica %s from %s", node.Pod.Name, master.Pod.Name))
+	isMaster, err := r.redisClient.IsMaster(ctx, node.IP, auth)
+	if err != nil {
+		return err
+	}
+	if isMaster {
+		return util.Transient(fmt.Errorf("redis %s is a master, waiting for the sentinels to settle its role", node.Pod.Name))
+	}
+	if err := r.redisClient.MakeMaster(ctx, node.IP, node.Version, auth); err != nil {
+		return err
+	}
+	// the replica is detached, it answers as a master from now on and only the role of the
+	// master tells whether a failover promoted it meanwhile
+	if isMaster, err = r.redisClient.IsMaster(ctx, master.IP, auth); err != nil {
+		return err
+	}
+	if !isMaster {
+		return util.Transient(fmt.Errorf("%s is no longer the master, %s is not flushed", master.Pod.Name, node.Pod.Name))
+	}
+	if err := r.redisClient.FlushAll(ctx, node.IP, auth); err != nil {
+		return err
+	}
+	return r.redisClient.MakeSlaveOf(ctx, node.IP, master.AnnounceHost, master.AnnouncePort, node.Version, auth)
+}
+
+// SetMasterAuth changes the password the given redis authenticates to its master with
+func (r *RedisClusterHealer) SetMasterAuth(ctx context.Context, ip string, password string, rs *rsv1.RedisSentinel, auth *util.AuthConfig) error {
+	util.LoggerFrom(ctx, r.logger).V(2).Info(fmt.Sprintf("setting the master password of redis %s", ip))
+	return r.redisClient.SetMasterAuth(ctx, ip, password, auth)
+}
+
+// SetRedisPassword changes the password of the given redis
+func (r *RedisClusterHealer) SetRedisPassword(ctx context.Context, ip string, password string, rs *rsv1.RedisSentinel, auth *util.AuthConfig) error {
+	util.LoggerFrom(ctx, r.logger).V(2).Info(fmt.Sprintf("setting the password of redis %s", ip))
+	return r.redisClient.SetRedisPassword(ctx, ip, password, auth)
+}
+
+// SetSentinelAuthPass changes the password the given sentinel authenticates to the redis with
+func (r *RedisClusterHealer) SetSentinelAuthPass(ctx context.Context, ip string, password string, rs *rsv1.RedisSentinel, auth *util.AuthConfig) error {
+	util.LoggerFrom(ctx, r.logger).V(2).Info(fmt.Sprintf("setting the redis password of sentinel %s", ip))
+	return r.redisClient.SetSentinelAuthPass(ctx, ip, password, auth)
+}
@@ -0,0 +1,109 @@
+package service
+
+import (
+	"context"
+	"fmt"
+	"testing"
+
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	logf "sigs.k8s.io/controller-runtime/pkg/log"
+
+	"redis-sentinel/controllers/redisclient"
+	"redis-sentinel/pkg/util"
+	"redis-sentinel/pkg/version"
+)
+
+// fakeRedisClient answers the roles from masters and records the commands changing the redis
+type fakeRedisClient struct {
+	redisclient.Client
+	masters map[string][]bool
+	calls   []string
+}
+
+func (c *fakeRedisClient) IsMaster(ctx context.Context, ip string, auth *util.AuthConfig) (bool, error) {
+	roles := c.masters[ip]
+	if len(roles) == 0 {
+		return false, fmt.Errorf("unexpected role check of %s", ip)
+	}
+	c.masters[ip] = roles[1:]
+	return roles[0], nil
+}
+
+func (c *fakeRedisClient) MakeMaster(ctx context.Context, ip string, version *version.ServerVersion, auth *util.AuthConfig) error {
+	c.calls = append(c.calls, "MakeMaster "+ip)
+	return nil
+}
+
+func (c *fakeRedisClient) FlushAll(ctx context.Context, ip string, auth *util.AuthConfig) error {
+	c.calls = append(c.calls, "FlushAll "+ip)
+	return nil
+}
+
+func (c *fakeRedisClient) MakeSlaveOf(ctx context.Context, ip string, masterIP string, masterPort string, version *version.ServerVersion, auth *util.AuthConfig) error {
+	c.calls = append(c.calls, fmt.Sprintf("MakeSlaveOf %s %s:%s", ip, masterIP, masterPort))
+	return nil
+}
+
+func TestResyncReplica(t *testing.T) {
+	newNode := func(name, ip string) *RedisNode {
+		return &RedisNode{
+			Pod:          &corev1.Pod{ObjectMeta: metav1.ObjectMeta{Name: name, Namespace: testNamespace}},
+			IP:           ip,
+			AnnounceHost: ip,
+			AnnouncePort: "6379",
+		}
+	}
+	node := newNode("redis-test-1", "10.0.0.2")
+	master := newNode("redis-test-0", "10.0.0.1")
+
+	tests := []struct {
+		name      string
+		masters   map[string][]bool
+		wantErr   bool
+		wantCalls []string
+	}{
+		{
+			name:    "replica resynced",
+			masters: map[string][]bool{node.IP: {false}, master.IP: {true}},
+			wantCalls: []string{
+				"MakeMaster 10.0.0.2",
+				"FlushAll 10.0.0.2",
+				"MakeSlaveOf 10.0.0.2 10.0.0.1:6379",
+			},
+		},
+		{
+			name:    "replica promoted since the topology was read",
+			masters: map[string][]bool{node.IP: {true}},
+			wantErr: true,
+		},
+		{
+			name:      "master failed over once the replica is detached",
+			masters:   map[string][]bool{node.IP: {false}, master.IP: {false}},
+			wantErr:   true,
+			wantCalls: []string{"MakeMaster 10.0.0.2"},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			redisClient := &fakeRedisClient{masters: tt.masters}
+			healer := &RedisClusterHealer{redisClient: redisClient, logger: logf.NullLogger{}}
+
+			err := healer.ResyncReplica(context.TODO(), node, master, newStorageCluster("1Gi"), &util.AuthConfig{})
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("ResyncReplica() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if err != nil && util.KindOf(err) != util.KindTransient {
+				t.Errorf("ResyncReplica() error = %v, want a transient error", err)
+			}
+			if len(redisClient.calls) != len(tt.wantCalls) {
+				t.Fatalf("redis commands = %q, want %q", redisClient.calls, tt.wantCalls)
+			}
+			for i, call := range tt.wantCalls {
+				if redisClient.calls[i] != call {
+					t.Errorf("redis command %d = %q, want %q", i, redisClient.calls[i], call)
+				}
+			}
+		})
+	}
+}
@@ -1,12 +1,17 @@
 package service
 
 import (
+	"fmt"
+	"reflect"
+	"time"
+
 	"github.com/go-logr/logr"
 	appsv1 "k8s.io/api/apps/v1"
 	corev1 "k8s.io/api/core/v1"
+	policyv1beta1 "k8s.io/api/policy/v1beta1"
 	"k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/api/meta"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
-	"k8s.io/apimachinery/pkg/util/intstr"
 	"redis-sentinel/pkg/k8s"
 
 	rsv1"redis-sentinel/api/v1"
@@ -23,9 +28,18 @@ type RedisSentinelClient interface {
 	EnsureSentinelStatefulset(rs *rsv1.RedisSentinel, labels map[string]string, ownerRefs []metav1.OwnerReference) error
 	EnsureRedisStatefulset(rs *rsv1.RedisSentinel, labels map[string]string, ownerRefs []metav1.OwnerReference) error
 	EnsureRedisService(rs *rsv1.RedisSentinel, labels map[string]string, ownerRefs []metav1.OwnerReference) error
+	EnsureRedisMasterService(rs *rsv1.RedisSentinel, labels map[string]string, ownerRefs []metav1.OwnerReference) error
+	EnsureRedisReplicaService(rs *rsv1.RedisSentinel, labels map[string]string, ownerRefs []metav1.OwnerReference) error
+	EnsureExposeServices(rs *rsv1.RedisSentinel, labels map[string]string, ownerRefs []metav1.OwnerReference) error
 	EnsureRedisShutdownConfigMap(rs *rsv1.RedisSentinel, labels map[string]string, ownerRefs []metav1.OwnerReference) error
 	EnsureRedisConfigMap(rs *rsv1.RedisSentinel, labels map[string]string, ownerRefs []metav1.OwnerReference) error
+	EnsureRedisAuthSecret(rs *rsv1.RedisSentinel, labels map[string]string, ownerRefs []metav1.OwnerReference) error
+	EnsurePassword(rs *rsv1.RedisSentinel, labels map[string]string, ownerRefs []metav1.OwnerReference) error
 	EnsureNotPresentRedisService(rs *rsv1.RedisSentinel) error
+	EnsureExporterServices(rs *rsv1.RedisSentinel, labels map[string]string, ownerRefs []metav1.OwnerReference) error
+	EnsureServiceMonitor(rs *rsv1.RedisSentinel, labels map[string]string, ownerRefs []metav1.OwnerReference) error
+	EnsurePrometheusRule(rs *rsv1.RedisSentinel, labels map[string]string, ownerRefs []metav1.OwnerReference) error
+	ReleasePersistentVolumeClaims(rs *rsv1.RedisSentinel) error
 }
 
 // RedisClusterKubeClient implements the required methods to talk with kubernetes
@@ -62,16 +76,32 @@ func (r *RedisSentinelKubeClient) EnsureSentinelHeadlessService(rs *rsv1.RedisSe
 	return r.K8SService.CreateIfNotExistsService(rs.Namespace, svc)
 }
 
-// EnsureSentinelConfigMap makes sure the sentinel configmap exists
+// EnsureSentinelConfigMap makes sure the sentinel configmap exists and has the password of the spec
 func (r *RedisSentinelKubeClient) EnsureSentinelConfigMap(rs *rsv1.RedisSentinel, labels map[string]string, ownerRefs []metav1.OwnerReference) error {
 	cm := generateSentinelConfigMap(rs, labels, ownerRefs)
-	return r.K8SService.CreateIfNotExistsConfigMap(rs.Namespace, cm)
+	return ensureConfigMap(r.K8SService, cm)
 }
 
 // EnsureSentinelConfigMap makes sure the sentinel configmap exists
 func (r *RedisSentinelKubeClient) EnsureSentinelProbeConfigMap(rs *rsv1.RedisSentinel, labels map[string]string, ownerRefs []metav1.OwnerReference) error {
 	cm := generateSentinelReadinessProbeConfigMap(rs, labels, ownerRefs)
-	return r.K8SService.CreateIfNotExistsConfigMap(rs.Namespace, cm)
+	return ensureConfigMap(r.K8SService, cm)
+}
+
+// ensureConfigMap creates the configmap or updates it when its data changed
+func ensureConfigMap(k8sService k8s.Services, cm *corev1.ConfigMap) error {
+	oldCm, err := k8sService.GetConfigMap(cm.Namespace, cm.Name)
+	if err != nil {
+		if errors.IsNotFound(err) {
+			return k8sService.CreateConfigMap(cm.Namespace, cm)
+		}
+		return err
+	}
+	if reflect.DeepEqual(oldCm.Data, cm.Data) {
+		return nil
+	}
+	cm.ResourceVersion = oldCm.ResourceVersion
+	return k8sService.UpdateConfigMap(cm.Namespace, cm)
 }
 
 // EnsureSentinelStatefulset makes sure the sentinel deployment exists in the desired state
@@ -90,11 +120,20 @@ func (r *RedisSentinelKubeClient) EnsureSentinelStatefulset(rs *rsv1.RedisSentin
 		return err
 	}
 
-	if shouldUpdateRedis(rs.Spec.Sentinel.Resources, oldSs.Spec.Template.Spec.Containers[0].Resources, rs.Spec.Sentinel.Replicas, *oldSs.Spec.Replicas) {
-		ss := generateSentinelStatefulSet(rs, labels, ownerRefs)
-		return r.K8SService.UpdateStatefulSet(rs.Namespace, ss)
+	var exporter *corev1.Container
+	if rs.Spec.Exporter.Enabled && rs.Spec.Exporter.Sentinel {
+		container := createSentinelExporterContainer(rs)
+		exporter = &container
 	}
-	return nil
+	ss := generateSentinelStatefulSet(rs, labels, ownerRefs)
+	templateChanged := resourcesChanged(rs.Spec.Sentinel.Resources, oldSs.Spec.Template.Spec.Containers[0].Resources) ||
+		imageChanged(ss, oldSs) || containerChanged(ss, oldSs) ||
+		exporterChanged(exporter, sentinelExporterContainerName, oldSs) || placementChanged(ss, oldSs)
+	open, err := util.InMaintenanceWindow(rs, time.Now())
+	if err != nil {
+		return err
+	}
+	return r.updateStatefulSet(rs, oldSs, ss, templateChanged, open, "sentinel")
 }
 
 // EnsureRedisStatefulset makes sure the redis statefulset exists in the desired state
@@ -112,38 +151,147 @@ func (r *RedisSentinelKubeClient) EnsureRedisStatefulset(rs *rsv1.RedisSentinel,
 		}
 		return err
 	}
+	if err := recreatingStatefulSet(rs, oldSs); err != nil {
+		return err
+	}
 
-	if shouldUpdateRedis(rs.Spec.Resources, oldSs.Spec.Template.Spec.Containers[0].Resources,
-		rs.Spec.Size, *oldSs.Spec.Replicas) || exporterChanged(rs, oldSs) {
-		ss := generateRedisStatefulSet(rs, labels, ownerRefs)
-		return r.K8SService.UpdateStatefulSet(rs.Namespace, ss)
+	open, err := util.InMaintenanceWindow(rs, time.Now())
+	if err != nil {
+		return err
+	}
+	pending := &MaintenancePending{}
+	if open {
+		if err := r.expandRedisStorage(rs, oldSs); err != nil {
+			return err
+		}
+	} else if storageGrows(rs, oldSs) {
+		pending.Changes = append(pending.Changes, "redis volume resize")
 	}
 
+	var exporter *corev1.Container
+	if rs.Spec.Exporter.Enabled {
+		container := createRedisExporterContainer(rs)
+		exporter = &container
+	}
+	ss := generateRedisStatefulSet(rs, labels, ownerRefs)
+	templateChanged := resourcesChanged(rs.Spec.Resources, oldSs.Spec.Template.Spec.Containers[0].Resources) ||
+		imageChanged(ss, oldSs) || containerChanged(ss, oldSs) ||
+		exporterChanged(exporter, exporterContainerName, oldSs) || placementChanged(ss, oldSs)
+	if err := r.updateStatefulSet(rs, oldSs, ss, templateChanged, open, "redis"); err != nil {
+		other, ok := err.(*MaintenancePending)
+		if !ok {
+			return err
+		}
+		pending.Changes = append(pending.Changes, other.Changes...)
+	}
+	if len(pending.Changes) > 0 {
+		return pending
+	}
 	return nil
 }
 
-func exporterChanged(rs *rsv1.RedisSentinel, sts *appsv1.StatefulSet) bool {
-	if rs.Spec.Exporter.Enabled {
-		for _, container := range sts.Spec.Template.Spec.Containers {
-			if container.Name == exporterContainerName {
-				return false
-			}
+// exporterChanged reports whether the exporter container of the statefulset differs from
+// the expected one, expected is nil when the exporter must not run
+func exporterChanged(expected *corev1.Container, name string, sts *appsv1.StatefulSet) bool {
+	for _, container := range sts.Spec.Template.Spec.Containers {
+		if container.Name != name {
+			continue
+		}
+		if expected == nil {
+			return true
 		}
+		return container.Image != expected.Image ||
+			!stringsEqual(container.Args, expected.Args) ||
+			envChanged(expected.Env, container.Env) ||
+			!resourcesEqual(container.Resources, expected.Resources)
+	}
+	return expected != nil
+}
+
+// imageChanged reports whether the main container runs another image than the expected one,
+// an upgrade restarts every pod
+func imageChanged(expected, sts *appsv1.StatefulSet) bool {
+	return expected.Spec.Template.Spec.Containers[0].Image != sts.Spec.Template.Spec.Containers[0].Image
+}
+
+// containerChanged reports whether the command, the environment or the probes of the main
+// container differ from the expected ones. Only the fields set by the operator are compared,
+// the ones defaulted by the api server would always differ
+func containerChanged(expected, sts *appsv1.StatefulSet) bool {
+	container, oldContainer := expected.Spec.Template.Spec.Containers[0], sts.Spec.Template.Spec.Containers[0]
+	return !stringsEqual(container.Command, oldContainer.Command) ||
+		envChanged(container.Env, oldContainer.Env) ||
+		probeChanged(container.ReadinessProbe, oldContainer.ReadinessProbe) ||
+		probeChanged(container.LivenessProbe, oldContainer.LivenessProbe)
+}
+
+// envChanged reports whether the variables differ by their value or the secret they are read from
+func envChanged(expected, env []corev1.EnvVar) bool {
+	if len(expected) != len(env) {
 		return true
-	} else {
-		for _, container := range sts.Spec.Template.Spec.Containers {
-			if container.Name == exporterContainerName {
-				return true
-			}
+	}
+	for i := range expected {
+		if expected[i].Name != env[i].Name || expected[i].Value != env[i].Value {
+			return true
+		}
+		if ref, oldRef := secretKeyRef(expected[i]), secretKeyRef(env[i]); ref != oldRef {
+			return true
 		}
-		return false
 	}
+	return false
+}
+
+// secretKeyRef returns the secret and the key a variable is read from, empty when it isn't
+func secretKeyRef(env corev1.EnvVar) string {
+	if env.ValueFrom == nil || env.ValueFrom.SecretKeyRef == nil {
+		return ""
+	}
+	return env.ValueFrom.SecretKeyRef.Name + "/" + env.ValueFrom.SecretKeyRef.Key
 }
 
-func shouldUpdateRedis(expectResource, containterResource corev1.ResourceRequirements, expectSize, replicas int32) bool {
-	if expectSize != replicas {
+// probeChanged reports whether the probes run another command
+func probeChanged(expected, probe *corev1.Probe) bool {
+	if expected == nil || probe == nil {
+		return (expected == nil) != (probe == nil)
+	}
+	if expected.Exec == nil || probe.Exec == nil {
+		return (expected.Exec == nil) != (probe.Exec == nil)
+	}
+	return !stringsEqual(expected.Exec.Command, probe.Exec.Command)
+}
+
+// placementChanged reports whether the affinity or the topology spread of the pods differ
+func placementChanged(expected, sts *appsv1.StatefulSet) bool {
+	expectedSpec, spec := expected.Spec.Template.Spec, sts.Spec.Template.Spec
+	if len(expectedSpec.TopologySpreadConstraints) != len(spec.TopologySpreadConstraints) ||
+		(len(spec.TopologySpreadConstraints) > 0 &&
+			!reflect.DeepEqual(expectedSpec.TopologySpreadConstraints, spec.TopologySpreadConstraints)) {
 		return true
 	}
+	return !reflect.DeepEqual(expectedSpec.Affinity, spec.Affinity)
+}
+
+func stringsEqual(a, b []string) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for i := range a {
+		if a[i] != b[i] {
+			return false
+		}
+	}
+	return true
+}
+
+func resourcesEqual(a, b corev1.ResourceRequirements) bool {
+	return a.Requests.Cpu().Cmp(*b.Requests.Cpu()) == 0 &&
+		a.Requests.Memory().Cmp(*b.Requests.Memory()) == 0 &&
+		a.Limits.Cpu().Cmp(*b.Limits.Cpu()) == 0 &&
+		a.Limits.Memory().Cmp(*b.Limits.Memory()) == 0
+}
+
+// resourcesChanged reports whether the resources of the container differ from the expected ones
+func resourcesChanged(expectResource, containterResource corev1.ResourceRequirements) bool {
 	if result := containterResource.Requests.Cpu().Cmp(*expectResource.Requests.Cpu()); result != 0 {
 		return true
 	}
@@ -159,10 +307,33 @@ func shouldUpdateRedis(expectResource, containterResource corev1.ResourceRequire
 	return false
 }
 
-// EnsureRedisConfigMap makes sure the sentinel configmap exists
+// EnsureRedisAuthSecret makes sure the secret holding the password has the one of the spec
+func (r *RedisSentinelKubeClient) EnsureRedisAuthSecret(rs *rsv1.RedisSentinel, labels map[string]string, ownerRefs []metav1.OwnerReference) error {
+	return r.K8SService.CreateOrUpdateSecret(rs.Namespace, generateRedisAuthSecret(rs, labels, ownerRefs))
+}
+
+// EnsureRedisConfigMap makes sure the redis configmap exists and has the password of the spec
 func (r *RedisSentinelKubeClient) EnsureRedisConfigMap(rs *rsv1.RedisSentinel, labels map[string]string, ownerRefs []metav1.OwnerReference) error {
 	cm := generateRedisConfigMap(rs, labels, ownerRefs)
-	return r.K8SService.CreateIfNotExistsConfigMap(rs.Namespace, cm)
+	return ensureConfigMap(r.K8SService, cm)
+}
+
+// EnsurePassword writes the password of the spec to every object holding it: the secret read by
+// the redis and their probes, the sentinel configmap and the redis configmap of the older clusters
+func (r *RedisSentinelKubeClient) EnsurePassword(rs *rsv1.RedisSentinel, labels map[string]string, ownerRefs []metav1.OwnerReference) error {
+	if err := r.EnsureRedisAuthSecret(rs, labels, ownerRefs); err != nil {
+		return err
+	}
+	if err := r.EnsureSentinelConfigMap(rs, labels, ownerRefs); err != nil {
+		return err
+	}
+	if _, err := r.K8SService.GetConfigMap(rs.Namespace, util.GetRedisName(rs)); err != nil {
+		if errors.IsNotFound(err) {
+			return nil
+		}
+		return err
+	}
+	return r.EnsureRedisConfigMap(rs, labels, ownerRefs)
 }
 
 // EnsureRedisShutdownConfigMap makes sure the redis configmap with shutdown script exists
@@ -184,6 +355,102 @@ func (r *RedisSentinelKubeClient) EnsureRedisService(rs *rsv1.RedisSentinel, lab
 	return r.K8SService.CreateIfNotExistsService(rs.Namespace, svc)
 }
 
+// EnsureRedisMasterService makes sure the service pointing to the redis master exists
+func (r *RedisSentinelKubeClient) EnsureRedisMasterService(rs *rsv1.RedisSentinel, labels map[string]string, ownerRefs []metav1.OwnerReference) error {
+	svc := generateRedisMasterService(rs, labels, ownerRefs)
+	return r.K8SService.CreateIfNotExistsService(rs.Namespace, svc)
+}
+
+// EnsureRedisReplicaService makes sure the service pointing to the redis replicas exists
+func (r *RedisSentinelKubeClient) EnsureRedisReplicaService(rs *rsv1.RedisSentinel, labels map[string]string, ownerRefs []metav1.OwnerReference) error {
+	svc := generateRedisReplicaService(rs, labels, ownerRefs)
+	return r.K8SService.CreateIfNotExistsService(rs.Namespace, svc)
+}
+
+// EnsureExposeServices makes sure every redis and sentinel pod has its own service in the desired
+// state when the cluster is exposed, and removes the services of the pods that no longer exist
+func (r *RedisSentinelKubeClient) EnsureExposeServices(rs *rsv1.RedisSentinel, labels map[string]string, ownerRefs []metav1.OwnerReference) error {
+	wanted := map[string]bool{}
+	if rs.Spec.Expose != nil {
+		for i := int32(0); i < rs.Spec.Size; i++ {
+			podName := fmt.Sprintf("%s-%d", util.GetRedisName(rs), i)
+			svc := generateExposeService(podName, util.RedisRoleName, redisPort, rs, labels, ownerRefs)
+			if err := r.ensureExposeService(rs.Namespace, svc); err != nil {
+				return err
+			}
+			wanted[podName] = true
+		}
+		for i := int32(0); i < rs.Spec.Sentinel.Replicas; i++ {
+			podName := fmt.Sprintf("%s-%d", util.GetSentinelName(rs), i)
+			svc := generateExposeService(podName, util.SentinelRoleName, sentinelPort, rs, labels, ownerRefs)
+			if err := r.ensureExposeService(rs.Namespace, svc); err != nil {
+				return err
+			}
+			wanted[podName] = true
+		}
+	}
+
+	services, err := r.K8SService.ListServicesByLabels(rs.Namespace, generateExposeLabels(rs.Name))
+	if err != nil {
+		return err
+	}
+	for _, svc := range services.Items {
+		if wanted[svc.Name] {
+			continue
+		}
+		if err := r.deleteServiceIfExists(rs.Namespace, svc.Name); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// ensureExposeService creates the service publishing a pod, or updates it when the expose
+// settings changed. The cluster ip and the node ports allocated to it are kept
+func (r *RedisSentinelKubeClient) ensureExposeService(namespace string, svc *corev1.Service) error {
+	stored, err := r.K8SService.GetService(namespace, svc.Name)
+	if errors.IsNotFound(err) {
+		return r.K8SService.CreateService(namespace, svc)
+	}
+	if err != nil {
+		return err
+	}
+	if !exposeServiceChanged(stored, svc) {
+		return nil
+	}
+	svc.ResourceVersion = stored.ResourceVersion
+	svc.Spec.ClusterIP = stored.Spec.ClusterIP
+	if svc.Spec.Type != corev1.ServiceTypeClusterIP {
+		for i := range svc.Spec.Ports {
+			for _, port := range stored.Spec.Ports {
+				if port.Name == svc.Spec.Ports[i].Name {
+					svc.Spec.Ports[i].NodePort = port.NodePort
+				}
+			}
+		}
+	}
+	return r.K8SService.UpdateService(namespace, svc)
+}
+
+// exposeServiceChanged reports whether the stored service differs from the generated one in the
+// fields set by the expose settings
+func exposeServiceChanged(stored, svc *corev1.Service) bool {
+	if stored.Spec.Type != svc.Spec.Type ||
+		!reflect.DeepEqual(stored.Spec.LoadBalancerSourceRanges, svc.Spec.LoadBalancerSourceRanges) ||
+		!reflect.DeepEqual(stored.Spec.Selector, svc.Spec.Selector) {
+		return true
+	}
+	if len(stored.Spec.Ports) != len(svc.Spec.Ports) {
+		return true
+	}
+	for i, port := range svc.Spec.Ports {
+		if stored.Spec.Ports[i].Port != port.Port || stored.Spec.Ports[i].TargetPort != port.TargetPort {
+			return true
+		}
+	}
+	return !util.MapContains(stored.Labels, svc.Labels) || !util.MapContains(stored.Annotations, svc.Annotations)
+}
+
 // EnsureNotPresentRedisService makes sure the redis service is not present
 func (r *RedisSentinelKubeClient) EnsureNotPresentRedisService(rs *rsv1.RedisSentinel) error {
 	name := util.GetRedisName(rs)
@@ -195,15 +462,144 @@ func (r *RedisSentinelKubeClient) EnsureNotPresentRedisService(rs *rsv1.RedisSen
 	return nil
 }
 
-// EnsureRedisStatefulset makes sure the pdb exists in the desired state
+// EnsureExporterServices makes sure the services exposing the exporters exist when the exporter is enabled,
+// and are removed when it is disabled
+func (r *RedisSentinelKubeClient) EnsureExporterServices(rs *rsv1.RedisSentinel, labels map[string]string, ownerRefs []metav1.OwnerReference) error {
+	if !rs.Spec.Exporter.Enabled {
+		if err := r.deleteServiceIfExists(rs.Namespace, util.GetRedisExporterName(rs)); err != nil {
+			return err
+		}
+		return r.deleteServiceIfExists(rs.Namespace, util.GetSentinelExporterName(rs))
+	}
+	svc := generateExporterService(util.GetRedisExporterName(rs), util.RedisRoleName, rs, labels, ownerRefs)
+	if err := r.K8SService.CreateIfNotExistsService(rs.Namespace, svc); err != nil {
+		return err
+	}
+	if !rs.Spec.Exporter.Sentinel {
+		return r.deleteServiceIfExists(rs.Namespace, util.GetSentinelExporterName(rs))
+	}
+	svc = generateExporterService(util.GetSentinelExporterName(rs), util.SentinelRoleName, rs, labels, ownerRefs)
+	return r.K8SService.CreateIfNotExistsService(rs.Namespace, svc)
+}
+
+// deleteServiceIfExists deletes the service, nothing is done when it doesn't exist
+func (r *RedisSentinelKubeClient) deleteServiceIfExists(namespace, name string) error {
+	if err := r.K8SService.DeleteService(namespace, name); err != nil && !errors.IsNotFound(err) {
+		return err
+	}
+	return nil
+}
+
+// EnsureServiceMonitor makes sure the ServiceMonitor scraping the exporters exists in the desired state,
+// or is removed when it isn't wanted anymore. Nothing is done when the prometheus-operator CRDs are not installed.
+func (r *RedisSentinelKubeClient) EnsureServiceMonitor(rs *rsv1.RedisSentinel, labels map[string]string, ownerRefs []metav1.OwnerReference) error {
+	var err error
+	if rs.Spec.Exporter.Enabled && rs.Spec.Exporter.ServiceMonitor != nil {
+		sm := generateServiceMonitor(rs, labels, ownerRefs)
+		err = r.K8SService.CreateOrUpdateServiceMonitor(rs.Namespace, sm)
+	} else {
+		err = r.K8SService.DeleteServiceMonitor(rs.Namespace, util.GetRedisExporterName(rs))
+		if errors.IsNotFound(err) {
+			return nil
+		}
+	}
+	if meta.IsNoMatchError(err) {
+		if rs.Spec.Exporter.ServiceMonitor != nil {
+			r.logger.WithValues("namespace", rs.Namespace, "name", rs.Name).
+				Info("ServiceMonitor CRD is not installed, skipping the ServiceMonitor")
+		}
+		return nil
+	}
+	return err
+}
+
+// EnsurePrometheusRule makes sure the PrometheusRule with the alerts of the cluster exists in the desired state,
+// or is removed when it isn't wanted anymore. Nothing is done when the prometheus-operator CRDs are not installed.
+func (r *RedisSentinelKubeClient) EnsurePrometheusRule(rs *rsv1.RedisSentinel, labels map[string]string, ownerRefs []metav1.OwnerReference) error {
+	wanted := rs.Spec.Monitoring != nil && rs.Spec.Monitoring.Alerts != nil
+	var err error
+	if wanted {
+		pr := generatePrometheusRule(rs, labels, ownerRefs)
+		err = r.K8SService.CreateOrUpdatePrometheusRule(rs.Namespace, pr)
+	} else {
+		err = r.K8SService.DeletePrometheusRule(rs.Namespace, util.GetRedisName(rs))
+		if errors.IsNotFound(err) {
+			return nil
+		}
+	}
+	if meta.IsNoMatchError(err) {
+		if wanted {
+			r.logger.WithValues("namespace", rs.Namespace, "name", rs.Name).
+				Info("PrometheusRule CRD is not installed, skipping the alerts")
+		}
+		return nil
+	}
+	return err
+}
+
+// ReleasePersistentVolumeClaims deletes the persistent volume claims of the redis, or removes
+// the owner reference of the cluster from them when they have to be kept after the deletion
+func (r *RedisSentinelKubeClient) ReleasePersistentVolumeClaims(rs *rsv1.RedisSentinel) error {
+	pvcs, err := r.K8SService.ListPersistentVolumeClaims(rs.Namespace, generateSelectorLabels(util.RedisRoleName, rs.Name))
+	if err != nil {
+		return err
+	}
+	for i := range pvcs.Items {
+		pvc := &pvcs.Items[i]
+		if !rs.Spec.Storage.KeepAfterDeletion {
+			if err := r.K8SService.DeletePersistentVolumeClaim(rs.Namespace, pvc.Name); err != nil && !errors.IsNotFound(err) {
+				return err
+			}
+			continue
+		}
+		// the claims created while KeepAfterDeletion was false are owned by the cluster
+		ownerRefs := make([]metav1.OwnerReference, 0, len(pvc.OwnerReferences))
+		for _, ref := range pvc.OwnerReferences {
+			if ref.UID != rs.UID {
+				ownerRefs = append(ownerRefs, ref)
+			}
+		}
+		if len(ownerRefs) == len(pvc.OwnerReferences) {
+			continue
+		}
+		pvc.OwnerReferences = ownerRefs
+		if err := r.K8SService.UpdatePersistentVolumeClaim(rs.Namespace, pvc); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// ensurePodDisruptionBudget makes sure the pdb exists in the desired state
 func (r *RedisSentinelKubeClient) ensurePodDisruptionBudget(rs *rsv1.RedisSentinel, name string, component string, labels map[string]string, ownerRefs []metav1.OwnerReference) error {
 	name = util.GenerateName(name, rs.Name)
 	namespace := rs.Namespace
 
-	minAvailable := intstr.FromInt(2)
 	labels = util.MergeLabels(labels, generateSelectorLabels(component, rs.Name))
 
-	pdb := generatePodDisruptionBudget(name, namespace, labels, ownerRefs, minAvailable)
+	pdb := generatePodDisruptionBudget(name, namespace, labels, ownerRefs, getPDBSettings(rs, component))
+	return ensurePodDisruptionBudget(r.K8SService, pdb)
+}
 
-	return r.K8SService.CreateIfNotExistsPodDisruptionBudget(namespace, pdb)
+// ensurePodDisruptionBudget creates the budget or updates it when it changed. The selector of a
+// budget is immutable before kubernetes 1.15, the budget is created again when it changes
+func ensurePodDisruptionBudget(k8sService k8s.Services, pdb *policyv1beta1.PodDisruptionBudget) error {
+	oldPdb, err := k8sService.GetPodDisruptionBudget(pdb.Namespace, pdb.Name)
+	if err != nil {
+		if errors.IsNotFound(err) {
+			return k8sService.CreatePodDisruptionBudget(pdb.Namespace, pdb)
+		}
+		return err
+	}
+	if !reflect.DeepEqual(oldPdb.Spec.Selector, pdb.Spec.Selector) {
+		if err := k8sService.DeletePodDisruptionBudget(pdb.Namespace, pdb.Name); err != nil && !errors.IsNotFound(err) {
+			return err
+		}
+		return k8sService.CreatePodDisruptionBudget(pdb.Namespace, pdb)
+	}
+	if reflect.DeepEqual(oldPdb.Spec.MinAvailable, pdb.Spec.MinAvailable) &&
+		reflect.DeepEqual(oldPdb.Spec.MaxUnavailable, pdb.Spec.MaxUnavailable) {
+		return nil
+	}
+	return k8sService.CreateOrUpdatePodDisruptionBudget(pdb.Namespace, pdb)
 }
@@ -0,0 +1,104 @@
+package service
+
+import (
+	"context"
+	"testing"
+
+	appsv1 "k8s.io/api/apps/v1"
+	"k8s.io/apimachinery/pkg/types"
+
+	"redis-sentinel/pkg/util"
+)
+
+func TestEnsureRedisStatefulsetUpdatesContainer(t *testing.T) {
+	tests := []struct {
+		name       string
+		change     func(ss *appsv1.StatefulSet)
+		wantUpdate bool
+	}{
+		{
+			name:   "unchanged",
+			change: func(ss *appsv1.StatefulSet) {},
+		},
+		{
+			name: "probe",
+			change: func(ss *appsv1.StatefulSet) {
+				ss.Spec.Template.Spec.Containers[0].LivenessProbe.Exec.Command = []string{"sh", "-c", "redis-cli -a secret ping"}
+			},
+			wantUpdate: true,
+		},
+		{
+			name: "password in the environment",
+			change: func(ss *appsv1.StatefulSet) {
+				env := &ss.Spec.Template.Spec.Containers[0].Env[0]
+				env.ValueFrom = nil
+				env.Value = "secret"
+			},
+			wantUpdate: true,
+		},
+		{
+			name: "password on the command line",
+			change: func(ss *appsv1.StatefulSet) {
+				container := &ss.Spec.Template.Spec.Containers[0]
+				container.Command = append(container.Command[:len(container.Command)-1], "--requirepass 'secret'")
+			},
+			wantUpdate: true,
+		},
+		{
+			name: "probe period defaulted",
+			change: func(ss *appsv1.StatefulSet) {
+				ss.Spec.Template.Spec.Containers[0].ReadinessProbe.PeriodSeconds = 10
+			},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rs := newStorageCluster("1Gi")
+			rs.Spec.Storage.PersistentVolumeClaim = nil
+			rs.Spec.Size = 3
+			rs.Spec.Password = "secret"
+			old := generateRedisStatefulSet(rs, nil, nil)
+			tt.change(old)
+			r, cli := newFakeKubeClient(t, old)
+
+			if err := r.EnsureRedisStatefulset(rs, nil, nil); err != nil {
+				t.Fatalf("EnsureRedisStatefulset() error = %v", err)
+			}
+			ss := &appsv1.StatefulSet{}
+			if err := cli.Get(context.TODO(), types.NamespacedName{Namespace: testNamespace, Name: util.GetRedisName(rs)}, ss); err != nil {
+				t.Fatal(err)
+			}
+			if updated := containerChanged(ss, old); updated != tt.wantUpdate {
+				t.Errorf("statefulset updated = %v, want %v", updated, tt.wantUpdate)
+			}
+			if containerChanged(generateRedisStatefulSet(rs, nil, nil), ss) {
+				t.Errorf("statefulset not updated to the expected container")
+			}
+		})
+	}
+}
+
+func TestEnsureRedisStatefulsetScaleOnly(t *testing.T) {
+	rs := newStorageCluster("1Gi")
+	rs.Spec.Storage.PersistentVolumeClaim = nil
+	rs.Spec.Size = 3
+	old := generateRedisStatefulSet(rs, nil, nil)
+	// set by kubectl rollout restart, a full update of the statefulset would drop it
+	old.Spec.Template.Annotations = map[string]string{"kubectl.kubernetes.io/restartedAt": "2020-01-01T00:00:00Z"}
+	r, cli := newFakeKubeClient(t, old)
+
+	rs.Spec.Size = 4
+	if err := r.EnsureRedisStatefulset(rs, nil, nil); err != nil {
+		t.Fatalf("EnsureRedisStatefulset() error = %v", err)
+	}
+	ss := &appsv1.StatefulSet{}
+	if err := cli.Get(context.TODO(), types.NamespacedName{Namespace: testNamespace, Name: util.GetRedisName(rs)}, ss); err != nil {
+		t.Fatal(err)
+	}
+	if *ss.Spec.Replicas != 4 {
+		t.Errorf("replicas = %d, want 4", *ss.Spec.Replicas)
+	}
+	if _, ok := ss.Spec.Template.Annotations["kubectl.kubernetes.io/restartedAt"]; !ok {
+		t.Errorf("pod template = %v, want it kept on a scale", ss.Spec.Template.Annotations)
+	}
+}
@@ -0,0 +1,97 @@
+package service
+
+import (
+	"github.com/go-logr/logr"
+	appsv1 "k8s.io/api/apps/v1"
+	"k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+
+	rsv1 "redis-sentinel/api/v1"
+	"redis-sentinel/pkg/k8s"
+	"redis-sentinel/pkg/util"
+)
+
+// ShardedClusterClient has the methods a sharded RedisCluster controller needs to talk with K8s
+type ShardedClusterClient interface {
+	EnsureShardedClusterServices(rc *rsv1.RedisCluster, labels map[string]string, ownerRefs []metav1.OwnerReference) error
+	EnsureShardedClusterAuthSecret(rc *rsv1.RedisCluster, labels map[string]string, ownerRefs []metav1.OwnerReference) error
+	EnsureShardStatefulSets(rc *rsv1.RedisCluster, labels map[string]string, ownerRefs []metav1.OwnerReference) error
+	DeleteShard(rc *rsv1.RedisCluster, shard int32) error
+}
+
+// ShardedClusterKubeClient implements the required methods to talk with kubernetes
+type ShardedClusterKubeClient struct {
+	K8SService k8s.Services
+	logger     logr.Logger
+}
+
+// NewShardedClusterKubeClient creates a new ShardedClusterKubeClient
+func NewShardedClusterKubeClient(k8sService k8s.Services, logger logr.Logger) *ShardedClusterKubeClient {
+	return &ShardedClusterKubeClient{
+		K8SService: k8sService,
+		logger:     logger,
+	}
+}
+
+// EnsureShardedClusterServices makes sure the client and the headless services exist
+func (r *ShardedClusterKubeClient) EnsureShardedClusterServices(rc *rsv1.RedisCluster, labels map[string]string, ownerRefs []metav1.OwnerReference) error {
+	if err := r.K8SService.CreateIfNotExistsService(rc.Namespace, generateShardedClusterService(rc, labels, ownerRefs)); err != nil {
+		return err
+	}
+	return r.K8SService.CreateIfNotExistsService(rc.Namespace, generateShardedClusterHeadlessService(rc, labels, ownerRefs))
+}
+
+// EnsureShardedClusterAuthSecret makes sure the secret holding the password has the one of the spec
+func (r *ShardedClusterKubeClient) EnsureShardedClusterAuthSecret(rc *rsv1.RedisCluster, labels map[string]string, ownerRefs []metav1.OwnerReference) error {
+	return r.K8SService.CreateOrUpdateSecret(rc.Namespace, generateShardedClusterAuthSecret(rc, labels, ownerRefs))
+}
+
+// EnsureShardStatefulSets makes sure every shard has its statefulset and pod disruption budget
+func (r *ShardedClusterKubeClient) EnsureShardStatefulSets(rc *rsv1.RedisCluster, labels map[string]string, ownerRefs []metav1.OwnerReference) error {
+	for shard := int32(0); shard < rc.Spec.Shards; shard++ {
+		if err := ensurePodDisruptionBudget(r.K8SService, generateShardPodDisruptionBudget(rc, shard, labels, ownerRefs)); err != nil {
+			return err
+		}
+		if err := r.ensureShardStatefulSet(rc, shard, labels, ownerRefs); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (r *ShardedClusterKubeClient) ensureShardStatefulSet(rc *rsv1.RedisCluster, shard int32, labels map[string]string, ownerRefs []metav1.OwnerReference) error {
+	ss := generateShardStatefulSet(rc, shard, labels, ownerRefs)
+	oldSs, err := r.K8SService.GetStatefulSet(rc.Namespace, ss.Name)
+	if err != nil {
+		if errors.IsNotFound(err) {
+			return r.K8SService.CreateStatefulSet(rc.Namespace, ss)
+		}
+		return err
+	}
+	if shardChanged(ss, oldSs) {
+		return r.K8SService.UpdateStatefulSet(rc.Namespace, ss)
+	}
+	return nil
+}
+
+// shardChanged reports whether the replicas, image, container or resources of the shard differ from the expected ones
+func shardChanged(expected, sts *appsv1.StatefulSet) bool {
+	container, oldContainer := expected.Spec.Template.Spec.Containers[0], sts.Spec.Template.Spec.Containers[0]
+	return *expected.Spec.Replicas != *sts.Spec.Replicas ||
+		container.Image != oldContainer.Image ||
+		containerChanged(expected, sts) ||
+		!resourcesEqual(container.Resources, oldContainer.Resources) ||
+		placementChanged(expected, sts)
+}
+
+// DeleteShard removes the statefulset and the pod disruption budget of a drained shard
+func (r *ShardedClusterKubeClient) DeleteShard(rc *rsv1.RedisCluster, shard int32) error {
+	name := util.GetShardName(rc, shard)
+	if err := r.K8SService.DeleteStatefulSet(rc.Namespace, name); err != nil && !errors.IsNotFound(err) {
+		return err
+	}
+	if err := r.K8SService.DeletePodDisruptionBudget(rc.Namespace, name); err != nil && !errors.IsNotFound(err) {
+		return err
+	}
+	return nil
+}
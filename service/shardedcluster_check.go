@@ -0,0 +1,319 @@
+package service
+
+import (
+	"context"
+	"fmt"
+	"sort"
+
+	"github.com/go-logr/logr"
+	corev1 "k8s.io/api/core/v1"
+
+	rsv1 "redis-sentinel/api/v1"
+	"redis-sentinel/controllers/redisclient"
+	"redis-sentinel/pkg/k8s"
+	"redis-sentinel/pkg/util"
+	"redis-sentinel/pkg/version"
+)
+
+// ShardNode is the state of a running redis pod of a sharded cluster when the topology was taken
+type ShardNode struct {
+	Pod   *corev1.Pod
+	IP    string
+	Shard int32
+	// Self is the node as reported by itself, Known are all the nodes it knows, itself included
+	Self    *redisclient.ClusterNode
+	Known   []*redisclient.ClusterNode
+	Config  map[string]string
+	Version *version.ServerVersion
+}
+
+// Knows returns true if the node knows the node with the given id
+func (n *ShardNode) Knows(id string) bool {
+	for _, known := range n.Known {
+		if known.ID == id {
+			return true
+		}
+	}
+	return false
+}
+
+// ShardedTopology is a snapshot of the running nodes of a sharded cluster, taken once per
+// reconcile. The nodes of every shard are sorted by pod name.
+type ShardedTopology struct {
+	Nodes  []*ShardNode
+	Shards [][]*ShardNode
+}
+
+// ShardMaster returns the node serving the slots of the shard, nil if there isn't any
+func (t *ShardedTopology) ShardMaster(shard int32) *ShardNode {
+	for _, node := range t.Shards[shard] {
+		if node.Self.Master && len(node.Self.Slots) > 0 {
+			return node
+		}
+	}
+	return nil
+}
+
+// ShardPrimary returns the master of the shard, the one serving its slots or, for a shard
+// serving none yet, its first master. Nil if there isn't any
+func (t *ShardedTopology) ShardPrimary(shard int32) *ShardNode {
+	if master := t.ShardMaster(shard); master != nil {
+		return master
+	}
+	for _, node := range t.Shards[shard] {
+		if node.Self.Master {
+			return node
+		}
+	}
+	return nil
+}
+
+// ShardedClusterCheck defines the interface able to check the status of a sharded redis cluster
+type ShardedClusterCheck interface {
+	CheckShardsReady(rc *rsv1.RedisCluster) error
+	GetShardedTopology(ctx context.Context, rc *rsv1.RedisCluster, auth *util.AuthConfig) (*ShardedTopology, error)
+	GetUnknownNodes(topo *ShardedTopology) []*ShardNode
+	GetRemovedNodeIDs(topo *ShardedTopology) []string
+	GetMissingSlots(topo *ShardedTopology) ([]int, error)
+	CheckShardReplicas(rc *rsv1.RedisCluster, topo *ShardedTopology) error
+	CheckShardConfig(rc *rsv1.RedisCluster, node *ShardNode) error
+	GetClusterState(ctx context.Context, topo *ShardedTopology, auth *util.AuthConfig) (string, error)
+	NeedResharding(rc *rsv1.RedisCluster, topo *ShardedTopology) bool
+	PlanResharding(ctx context.Context, rc *rsv1.RedisCluster, topo *ShardedTopology, auth *util.AuthConfig) (*rsv1.ReshardingStatus, error)
+}
+
+// ShardedClusterChecker is our implementation of ShardedClusterCheck interface
+type ShardedClusterChecker struct {
+	k8sService  k8s.Services
+	redisClient redisclient.Client
+	// workers is the maximum number of nodes queried at the same time
+	workers int
+	logger  logr.Logger
+}
+
+// NewShardedClusterChecker creates an object of the ShardedClusterChecker struct
+func NewShardedClusterChecker(k8sService k8s.Services, redisClient redisclient.Client, workers int, logger logr.Logger) *ShardedClusterChecker {
+	return &ShardedClusterChecker{
+		k8sService:  k8sService,
+		redisClient: redisClient,
+		workers:     workers,
+		logger:      logger,
+	}
+}
+
+// CheckShardsReady controls that every pod of every shard is ready
+func (r *ShardedClusterChecker) CheckShardsReady(rc *rsv1.RedisCluster) error {
+	for shard := int32(0); shard < rc.ShardCount(); shard++ {
+		ss, err := r.k8sService.GetStatefulSet(rc.Namespace, util.GetShardName(rc, shard))
+		if err != nil {
+			return err
+		}
+		if ss.Status.ReadyReplicas != rc.Spec.ReplicasPerShard+1 {
+			return fmt.Errorf("shard %d has %d of %d redis ready", shard, ss.Status.ReadyReplicas, rc.Spec.ReplicasPerShard+1)
+		}
+	}
+	return nil
+}
+
+// GetShardedTopology queries all the running redis of the cluster concurrently
+func (r *ShardedClusterChecker) GetShardedTopology(ctx context.Context, rc *rsv1.RedisCluster, auth *util.AuthConfig) (*ShardedTopology, error) {
+	topo := &ShardedTopology{Shards: make([][]*ShardNode, rc.ShardCount())}
+	for shard := int32(0); shard < rc.ShardCount(); shard++ {
+		pods, err := r.k8sService.GetStatefulSetPods(rc.Namespace, util.GetShardName(rc, shard))
+		if err != nil {
+			return nil, err
+		}
+		sort.Slice(pods.Items, func(i, j int) bool { return pods.Items[i].Name < pods.Items[j].Name })
+		for i := range pods.Items {
+			if pods.Items[i].Status.Phase != corev1.PodRunning {
+				continue
+			}
+			node := &ShardNode{Pod: &pods.Items[i], IP: pods.Items[i].Status.PodIP, Shard: shard}
+			topo.Shards[shard] = append(topo.Shards[shard], node)
+			topo.Nodes = append(topo.Nodes, node)
+		}
+	}
+
+	tasks := make([]func() error, 0, len(topo.Nodes))
+	for _, node := range topo.Nodes {
+		node := node
+		tasks = append(tasks, func() error {
+			return r.fillShardNode(ctx, node, auth)
+		})
+	}
+	if err := runBounded(r.workers, tasks); err != nil {
+		return nil, err
+	}
+	return topo, nil
+}
+
+func (r *ShardedClusterChecker) fillShardNode(ctx context.Context, node *ShardNode, auth *util.AuthConfig) error {
+	var err error
+	if node.Version, err = r.redisClient.GetRedisVersion(ctx, node.IP, auth); err != nil {
+		return err
+	}
+	if err := node.Version.CheckSupported(); err != nil {
+		return fmt.Errorf("redis pod %s: %v", node.Pod.Name, err)
+	}
+	if node.Known, err = r.redisClient.GetClusterNodes(ctx, node.IP, auth); err != nil {
+		return err
+	}
+	for _, known := range node.Known {
+		if known.Myself {
+			node.Self = known
+		}
+	}
+	if node.Self == nil {
+		return fmt.Errorf("redis pod %s doesn't report itself in the cluster nodes", node.Pod.Name)
+	}
+	node.Config, err = r.redisClient.GetAllRedisConfig(ctx, node.IP, auth)
+	return err
+}
+
+// GetUnknownNodes returns the nodes the first node doesn't know, they have to meet the cluster
+func (r *ShardedClusterChecker) GetUnknownNodes(topo *ShardedTopology) []*ShardNode {
+	unknown := []*ShardNode{}
+	if len(topo.Nodes) == 0 {
+		return unknown
+	}
+	first := topo.Nodes[0]
+	for _, node := range topo.Nodes[1:] {
+		if !first.Knows(node.Self.ID) {
+			unknown = append(unknown, node)
+		}
+	}
+	return unknown
+}
+
+// GetRemovedNodeIDs returns the failed nodes known by the cluster that are not any of its pods,
+// a pod restarted without its data joined again with a new id. It has to be called once all the
+// pods are running.
+func (r *ShardedClusterChecker) GetRemovedNodeIDs(topo *ShardedTopology) []string {
+	running := map[string]bool{}
+	for _, node := range topo.Nodes {
+		running[node.Self.ID] = true
+	}
+	removed := map[string]bool{}
+	ids := []string{}
+	for _, node := range topo.Nodes {
+		for _, known := range node.Known {
+			if known.Failed && !running[known.ID] && !removed[known.ID] {
+				removed[known.ID] = true
+				ids = append(ids, known.ID)
+			}
+		}
+	}
+	return ids
+}
+
+// GetMissingSlots returns the slots not served by any running master
+func (r *ShardedClusterChecker) GetMissingSlots(topo *ShardedTopology) ([]int, error) {
+	served := make([]bool, util.ClusterSlots)
+	for _, node := range topo.Nodes {
+		if !node.Self.Master {
+			continue
+		}
+		slots, err := util.ExpandSlotRanges(node.Self.Slots)
+		if err != nil {
+			return nil, err
+		}
+		for _, slot := range slots {
+			served[slot] = true
+		}
+	}
+	missing := []int{}
+	for slot, ok := range served {
+		if !ok {
+			missing = append(missing, slot)
+		}
+	}
+	return missing, nil
+}
+
+// CheckShardReplicas controls that every shard has a master followed by all the other nodes of the shard
+func (r *ShardedClusterChecker) CheckShardReplicas(rc *rsv1.RedisCluster, topo *ShardedTopology) error {
+	for shard := int32(0); shard < rc.ShardCount(); shard++ {
+		master := topo.ShardPrimary(shard)
+		if master == nil {
+			return fmt.Errorf("shard %d has no master", shard)
+		}
+		replicas := 0
+		for _, node := range topo.Shards[shard] {
+			if node.Self.MasterID == master.Self.ID {
+				replicas++
+			}
+		}
+		if replicas != int(rc.Spec.ReplicasPerShard) {
+			return fmt.Errorf("shard %d has %d of %d replicas following its master", shard, replicas, rc.Spec.ReplicasPerShard)
+		}
+	}
+	return nil
+}
+
+// CheckShardConfig check current redis config is same as custom config
+func (r *ShardedClusterChecker) CheckShardConfig(rc *rsv1.RedisCluster, node *ShardNode) error {
+	return checkRedisConfig(r.logger, rc.Spec.Config, node.Config)
+}
+
+// GetClusterState returns the state of the cluster as seen by its first node
+func (r *ShardedClusterChecker) GetClusterState(ctx context.Context, topo *ShardedTopology, auth *util.AuthConfig) (string, error) {
+	if len(topo.Nodes) == 0 {
+		return "", fmt.Errorf("no redis running")
+	}
+	return r.redisClient.GetClusterState(ctx, topo.Nodes[0].IP, auth)
+}
+
+// NeedResharding returns true when a shard of the spec serves no slot or a removed shard still
+// serves some
+func (r *ShardedClusterChecker) NeedResharding(rc *rsv1.RedisCluster, topo *ShardedTopology) bool {
+	for shard := int32(0); shard < rc.ShardCount(); shard++ {
+		served := topo.ShardMaster(shard) != nil
+		if served != (shard < rc.Spec.Shards) {
+			return true
+		}
+	}
+	return false
+}
+
+// PlanResharding returns the slot migrations spreading the slots on the shards of the spec,
+// balanced on the strategy of the spec
+func (r *ShardedClusterChecker) PlanResharding(ctx context.Context, rc *rsv1.RedisCluster, topo *ShardedTopology, auth *util.AuthConfig) (*rsv1.ReshardingStatus, error) {
+	owned := make([][]int, rc.ShardCount())
+	loads := make([]int64, rc.ShardCount())
+	for shard := int32(0); shard < rc.ShardCount(); shard++ {
+		owned[shard] = []int{}
+		master := topo.ShardMaster(shard)
+		if master == nil {
+			continue
+		}
+		slots, err := util.ExpandSlotRanges(master.Self.Slots)
+		if err != nil {
+			return nil, err
+		}
+		sort.Ints(slots)
+		owned[shard] = slots
+
+		switch rc.Spec.Rebalance.Strategy {
+		case rsv1.RebalanceKeys:
+			loads[shard], err = r.redisClient.GetDBSize(ctx, master.IP, auth)
+		case rsv1.RebalanceMemory:
+			loads[shard], err = r.redisClient.GetUsedMemory(ctx, master.IP, auth)
+		default:
+			loads[shard] = int64(len(slots))
+		}
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	plan := &rsv1.ReshardingStatus{Shards: rc.Spec.Shards}
+	for _, move := range util.PlanSlotMoves(owned, loads, rc.Spec.Shards) {
+		plan.Migrations = append(plan.Migrations, rsv1.SlotMigration{
+			Source: move.Source,
+			Target: move.Target,
+			Slots:  util.FormatSlotRanges(move.Slots),
+			Total:  int32(len(move.Slots)),
+		})
+	}
+	return plan, nil
+}
@@ -0,0 +1,125 @@
+package service
+
+import (
+	"reflect"
+	"testing"
+
+	"redis-sentinel/controllers/redisclient"
+	"redis-sentinel/pkg/util"
+)
+
+func newShardNode(self *redisclient.ClusterNode, known ...*redisclient.ClusterNode) *ShardNode {
+	return &ShardNode{Self: self, Known: append([]*redisclient.ClusterNode{self}, known...)}
+}
+
+func TestGetMissingSlots(t *testing.T) {
+	tests := []struct {
+		name    string
+		nodes   []*ShardNode
+		want    []int
+		wantErr bool
+	}{
+		{
+			name: "all slots served",
+			nodes: []*ShardNode{
+				newShardNode(&redisclient.ClusterNode{ID: "a", Master: true, Slots: []string{"0-8191"}}),
+				newShardNode(&redisclient.ClusterNode{ID: "b", Master: true, Slots: []string{"8192-16383"}}),
+			},
+			want: []int{},
+		},
+		{
+			name: "the slots of replicas are ignored",
+			nodes: []*ShardNode{
+				newShardNode(&redisclient.ClusterNode{ID: "a", Master: true, Slots: []string{"0-16380"}}),
+				newShardNode(&redisclient.ClusterNode{ID: "b", MasterID: "a", Slots: []string{"16381-16383"}}),
+			},
+			want: []int{16381, 16382, 16383},
+		},
+		{
+			name: "single slots and ranges",
+			nodes: []*ShardNode{
+				newShardNode(&redisclient.ClusterNode{ID: "a", Master: true, Slots: []string{"1-9", "11"}}),
+				newShardNode(&redisclient.ClusterNode{ID: "b", Master: true, Slots: []string{"13-16383"}}),
+			},
+			want: []int{0, 10, 12},
+		},
+		{
+			name: "invalid range",
+			nodes: []*ShardNode{
+				newShardNode(&redisclient.ClusterNode{ID: "a", Master: true, Slots: []string{"9-x"}}),
+			},
+			wantErr: true,
+		},
+	}
+	r := &ShardedClusterChecker{}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := r.GetMissingSlots(&ShardedTopology{Nodes: tt.nodes})
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("GetMissingSlots() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if !tt.wantErr && !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("GetMissingSlots() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestGetMissingSlotsNoMaster(t *testing.T) {
+	r := &ShardedClusterChecker{}
+	got, err := r.GetMissingSlots(&ShardedTopology{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(got) != util.ClusterSlots {
+		t.Errorf("GetMissingSlots() returned %d slots, want %d", len(got), util.ClusterSlots)
+	}
+}
+
+func TestGetRemovedNodeIDs(t *testing.T) {
+	a := &redisclient.ClusterNode{ID: "a", Master: true}
+	b := &redisclient.ClusterNode{ID: "b", MasterID: "a"}
+	tests := []struct {
+		name  string
+		nodes []*ShardNode
+		want  []string
+	}{
+		{
+			name:  "nothing removed",
+			nodes: []*ShardNode{newShardNode(a, b), newShardNode(b, a)},
+			want:  []string{},
+		},
+		{
+			name: "failed nodes not running are removed once",
+			nodes: []*ShardNode{
+				newShardNode(a, b, &redisclient.ClusterNode{ID: "old", Failed: true}),
+				newShardNode(b, a, &redisclient.ClusterNode{ID: "old", Failed: true}),
+			},
+			want: []string{"old"},
+		},
+		{
+			name: "nodes not failed are kept",
+			nodes: []*ShardNode{
+				newShardNode(a, b, &redisclient.ClusterNode{ID: "starting"}),
+			},
+			want: []string{},
+		},
+		{
+			name: "a running node seen failed is kept",
+			nodes: []*ShardNode{
+				newShardNode(a, &redisclient.ClusterNode{ID: "b", Failed: true}),
+				newShardNode(b, a),
+			},
+			want: []string{},
+		},
+	}
+	r := &ShardedClusterChecker{}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := r.GetRemovedNodeIDs(&ShardedTopology{Nodes: tt.nodes})
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("GetRemovedNodeIDs() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
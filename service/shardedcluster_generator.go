@@ -0,0 +1,211 @@
+package service
+
+import (
+	"fmt"
+	"strconv"
+
+	appsv1 "k8s.io/api/apps/v1"
+	corev1 "k8s.io/api/core/v1"
+	policyv1beta1 "k8s.io/api/policy/v1beta1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/util/intstr"
+
+	rsv1 "redis-sentinel/api/v1"
+	"redis-sentinel/pkg/util"
+)
+
+const (
+	clusterBusPortName = "cluster-bus"
+	clusterBusPort     = 16379
+	clusterNodeTimeout = "5000"
+)
+
+// generateShardLabels returns the labels selecting the pods of the given shard
+func generateShardLabels(rc *rsv1.RedisCluster, shard int32) map[string]string {
+	return util.MergeLabels(generateSelectorLabels(util.ShardRoleName, rc.Name), map[string]string{
+		util.ShardLabelKey: strconv.Itoa(int(shard)),
+	})
+}
+
+func generateShardedClusterService(rc *rsv1.RedisCluster, labels map[string]string, ownerRefs []metav1.OwnerReference) *corev1.Service {
+	labels = util.MergeLabels(labels, generateSelectorLabels(util.ShardRoleName, rc.Name))
+	return &corev1.Service{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:            util.GetShardedClusterName(rc),
+			Namespace:       rc.Namespace,
+			Labels:          labels,
+			OwnerReferences: ownerRefs,
+		},
+		Spec: corev1.ServiceSpec{
+			Type: corev1.ServiceTypeClusterIP,
+			Ports: []corev1.ServicePort{
+				{
+					Name:       "redis",
+					Port:       redisPort,
+					Protocol:   corev1.ProtocolTCP,
+					TargetPort: intstr.FromInt(redisPort),
+				},
+			},
+			Selector: labels,
+		},
+	}
+}
+
+func generateShardedClusterHeadlessService(rc *rsv1.RedisCluster, labels map[string]string, ownerRefs []metav1.OwnerReference) *corev1.Service {
+	labels = util.MergeLabels(labels, generateSelectorLabels(util.ShardRoleName, rc.Name))
+	return &corev1.Service{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:            util.GetShardedClusterHeadlessSvc(rc),
+			Namespace:       rc.Namespace,
+			Labels:          labels,
+			OwnerReferences: ownerRefs,
+		},
+		Spec: corev1.ServiceSpec{
+			Ports: []corev1.ServicePort{
+				{Name: "redis", Port: redisPort},
+				{Name: clusterBusPortName, Port: clusterBusPort},
+			},
+			Selector:                 labels,
+			ClusterIP:                corev1.ClusterIPNone,
+			PublishNotReadyAddresses: true,
+		},
+	}
+}
+
+// generateShardStatefulSet generates the statefulset of a shard, its first pod is the master
+// when the cluster is created and the others its replicas
+func generateShardStatefulSet(rc *rsv1.RedisCluster, shard int32, labels map[string]string, ownerRefs []metav1.OwnerReference) *appsv1.StatefulSet {
+	name := util.GetShardName(rc, shard)
+	labels = util.MergeLabels(labels, generateShardLabels(rc, shard))
+	replicas := rc.Spec.ReplicasPerShard + 1
+
+	probe := &corev1.Probe{
+		InitialDelaySeconds: graceTime,
+		TimeoutSeconds:      5,
+		Handler: corev1.Handler{
+			Exec: &corev1.ExecAction{
+				Command: []string{"sh", "-c", redisProbeCommand},
+			},
+		},
+	}
+
+	affinity := rc.Spec.Affinity
+	if affinity == nil {
+		// the replicas of a shard avoid the node of its master
+		affinity = &corev1.Affinity{
+			PodAntiAffinity: createPodAntiAffinity(rc.Spec.HardAntiAffinity, generateShardLabels(rc, shard)),
+		}
+	}
+
+	volumes := []corev1.Volume{getAuthVolume(util.GetShardedClusterAuthName(rc))}
+	if dataVolume := getRedisDataVolume(&rc.Spec.Storage); dataVolume != nil {
+		volumes = append(volumes, *dataVolume)
+	}
+
+	ss := &appsv1.StatefulSet{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:            name,
+			Namespace:       rc.Namespace,
+			Labels:          labels,
+			OwnerReferences: ownerRefs,
+		},
+		Spec: appsv1.StatefulSetSpec{
+			ServiceName: util.GetShardedClusterHeadlessSvc(rc),
+			Replicas:    &replicas,
+			UpdateStrategy: appsv1.StatefulSetUpdateStrategy{
+				Type: "RollingUpdate",
+			},
+			Selector: &metav1.LabelSelector{
+				MatchLabels: labels,
+			},
+			Template: corev1.PodTemplateSpec{
+				ObjectMeta: metav1.ObjectMeta{
+					Labels:      labels,
+					Annotations: rc.Spec.Annotations,
+				},
+				Spec: corev1.PodSpec{
+					Affinity:         affinity,
+					Tolerations:      rc.Spec.ToleRations,
+					NodeSelector:     rc.Spec.NodeSelector,
+					SecurityContext:  getSecurityContext(rc.Spec.SecurityContext),
+					ImagePullSecrets: rc.Spec.ImagePullSecrets,
+					Containers: []corev1.Container{
+						{
+							Name:            "redis",
+							Image:           rc.Spec.Image,
+							ImagePullPolicy: pullPolicy(rc.Spec.ImagePullPolicy),
+							Ports: []corev1.ContainerPort{
+								{
+									Name:          "redis",
+									ContainerPort: redisPort,
+									Protocol:      corev1.ProtocolTCP,
+								},
+								{
+									Name:          clusterBusPortName,
+									ContainerPort: clusterBusPort,
+									Protocol:      corev1.ProtocolTCP,
+								},
+							},
+							VolumeMounts: []corev1.VolumeMount{
+								{
+									Name:      getRedisDataVolumeName(&rc.Spec.Storage),
+									MountPath: "/data",
+								},
+								getAuthVolumeMount(),
+							},
+							Command:        getShardCommand(rc),
+							Env:            getRedisCliAuthEnv(util.GetShardedClusterAuthName(rc), rc.Spec.Password),
+							ReadinessProbe: probe,
+							LivenessProbe:  probe,
+							Resources:      rc.Spec.Resources,
+						},
+					},
+					Volumes: volumes,
+				},
+			},
+		},
+	}
+
+	if rc.Spec.Storage.PersistentVolumeClaim != nil {
+		pvc := rc.Spec.Storage.PersistentVolumeClaim.DeepCopy()
+		if !rc.Spec.Storage.KeepAfterDeletion {
+			// Set an owner reference so the persistent volumes are deleted when the rc is
+			pvc.OwnerReferences = ownerRefs
+		}
+		ss.Spec.VolumeClaimTemplates = []corev1.PersistentVolumeClaim{*pvc}
+	}
+
+	return ss
+}
+
+// generateShardPodDisruptionBudget generates the budget of a shard, by default a single pod of
+// every shard can be evicted at a time
+func generateShardPodDisruptionBudget(rc *rsv1.RedisCluster, shard int32, labels map[string]string, ownerRefs []metav1.OwnerReference) *policyv1beta1.PodDisruptionBudget {
+	budget := rc.Spec.PDB
+	if budget == nil {
+		maxUnavailable := intstr.FromInt(1)
+		budget = &rsv1.PDBComponentSettings{MaxUnavailable: &maxUnavailable}
+	}
+	labels = util.MergeLabels(labels, generateShardLabels(rc, shard))
+	return generatePodDisruptionBudget(util.GetShardName(rc, shard), rc.Namespace, labels, ownerRefs, budget)
+}
+
+// getShardCommand runs redis in cluster mode, the node id is kept in the data volume so a
+// restarted pod with a persistent volume rejoins the cluster as the same node. The password
+// is included from the auth secret
+func getShardCommand(rc *rsv1.RedisCluster) []string {
+	return []string{
+		"redis-server",
+		"--cluster-enabled yes",
+		"--cluster-config-file /data/nodes.conf",
+		fmt.Sprintf("--cluster-node-timeout %s", clusterNodeTimeout),
+		"--tcp-keepalive 60",
+		getAuthInclude(),
+	}
+}
+
+// generateShardedClusterAuthSecret generates the secret holding the password of the cluster
+func generateShardedClusterAuthSecret(rc *rsv1.RedisCluster, labels map[string]string, ownerRefs []metav1.OwnerReference) *corev1.Secret {
+	labels = util.MergeLabels(labels, generateSelectorLabels(util.ShardRoleName, rc.Name))
+	return generateAuthSecret(util.GetShardedClusterAuthName(rc), rc.Namespace, rc.Spec.Password, labels, ownerRefs)
+}
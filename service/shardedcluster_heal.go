@@ -0,0 +1,167 @@
+package service
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/go-logr/logr"
+
+	rsv1 "redis-sentinel/api/v1"
+	"redis-sentinel/controllers/redisclient"
+	"redis-sentinel/pkg/k8s"
+	"redis-sentinel/pkg/metrics"
+	"redis-sentinel/pkg/util"
+)
+
+// ShardedClusterHeal defines the interface able to fix the problems on the sharded redis clusters
+type ShardedClusterHeal interface {
+	ForgetNodes(ctx context.Context, ids []string, topo *ShardedTopology, rc *rsv1.RedisCluster, auth *util.AuthConfig) error
+	MeetNodes(ctx context.Context, nodes []*ShardNode, topo *ShardedTopology, rc *rsv1.RedisCluster, auth *util.AuthConfig) error
+	AssignSlots(ctx context.Context, shard int32, slots []int, topo *ShardedTopology, rc *rsv1.RedisCluster, auth *util.AuthConfig) error
+	ReplicateShard(ctx context.Context, shard int32, topo *ShardedTopology, rc *rsv1.RedisCluster, auth *util.AuthConfig) error
+	SetShardConfig(ctx context.Context, node *ShardNode, rc *rsv1.RedisCluster, auth *util.AuthConfig) error
+	MigrateSlot(ctx context.Context, slot int, source *ShardNode, target *ShardNode, rc *rsv1.RedisCluster, auth *util.AuthConfig) error
+}
+
+// migrateTimeout is the time the target of a MIGRATE has to store the keys
+const migrateTimeout = 5 * time.Second
+
+// ShardedClusterHealer is our implementation of ShardedClusterHeal interface
+type ShardedClusterHealer struct {
+	k8sService  k8s.Services
+	redisClient redisclient.Client
+	metrics     metrics.Instrumenter
+	logger      logr.Logger
+}
+
+// NewShardedClusterHealer creates an object of the ShardedClusterHealer struct
+func NewShardedClusterHealer(k8sService k8s.Services, redisClient redisclient.Client, metrics metrics.Instrumenter, logger logr.Logger) *ShardedClusterHealer {
+	return &ShardedClusterHealer{
+		k8sService:  k8sService,
+		redisClient: redisClient,
+		metrics:     metrics,
+		logger:      logger,
+	}
+}
+
+// ForgetNodes makes every node knowing them forget the failed nodes that are no pod anymore
+func (r *ShardedClusterHealer) ForgetNodes(ctx context.Context, ids []string, topo *ShardedTopology, rc *rsv1.RedisCluster, auth *util.AuthConfig) error {
+	r.metrics.IncHealAction(rc.Namespace, rc.Name, metrics.HealClusterForget)
+	for _, id := range ids {
+		for _, node := range topo.Nodes {
+			if !node.Knows(id) {
+				continue
+			}
+			util.LoggerFrom(ctx, r.logger).V(2).Info(fmt.Sprintf("redis %s forgets the removed node %s", node.Pod.Name, id))
+			if err := r.redisClient.ClusterForget(ctx, node.IP, id, auth); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// MeetNodes makes the first node of the cluster meet the given nodes, the others learn about
+// them through the cluster bus
+func (r *ShardedClusterHealer) MeetNodes(ctx context.Context, nodes []*ShardNode, topo *ShardedTopology, rc *rsv1.RedisCluster, auth *util.AuthConfig) error {
+	if len(topo.Nodes) == 0 {
+		return fmt.Errorf("no redis running")
+	}
+	r.metrics.IncHealAction(rc.Namespace, rc.Name, metrics.HealClusterMeet)
+	first := topo.Nodes[0]
+	for _, node := range nodes {
+		util.LoggerFrom(ctx, r.logger).V(2).Info(fmt.Sprintf("redis %s meets %s with ip %s", first.Pod.Name, node.Pod.Name, node.IP))
+		if err := r.redisClient.ClusterMeet(ctx, first.IP, node.IP, auth); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// AssignSlots makes the master of the shard serve the slots no one serves
+func (r *ShardedClusterHealer) AssignSlots(ctx context.Context, shard int32, slots []int, topo *ShardedTopology, rc *rsv1.RedisCluster, auth *util.AuthConfig) error {
+	if len(slots) == 0 {
+		return nil
+	}
+	master := topo.ShardPrimary(shard)
+	if master == nil {
+		return fmt.Errorf("shard %d has no master able to serve its slots", shard)
+	}
+	r.metrics.IncHealAction(rc.Namespace, rc.Name, metrics.HealClusterAddSlots)
+	util.LoggerFrom(ctx, r.logger).V(2).Info(fmt.Sprintf("redis %s serves the slots %s of shard %d", master.Pod.Name, util.FormatSlotRanges(slots), shard))
+	return r.redisClient.ClusterAddSlots(ctx, master.IP, slots, auth)
+}
+
+// ReplicateShard makes the nodes of the shard without slots follow the master of the shard.
+// Nodes not knowing the master yet are left for the next reconcile
+func (r *ShardedClusterHealer) ReplicateShard(ctx context.Context, shard int32, topo *ShardedTopology, rc *rsv1.RedisCluster, auth *util.AuthConfig) error {
+	master := topo.ShardPrimary(shard)
+	if master == nil {
+		return fmt.Errorf("shard %d has no master", shard)
+	}
+	for _, node := range topo.Shards[shard] {
+		if node == master || node.Self.MasterID == master.Self.ID || len(node.Self.Slots) > 0 || !node.Knows(master.Self.ID) {
+			continue
+		}
+		r.metrics.IncHealAction(rc.Namespace, rc.Name, metrics.HealClusterReplicate)
+		util.LoggerFrom(ctx, r.logger).V(2).Info(fmt.Sprintf("redis %s replicates %s", node.Pod.Name, master.Pod.Name))
+		if err := r.redisClient.ClusterReplicate(ctx, node.IP, master.Self.ID, auth); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// SetShardConfig sets the custom config on the node
+func (r *ShardedClusterHealer) SetShardConfig(ctx context.Context, node *ShardNode, rc *rsv1.RedisCluster, auth *util.AuthConfig) error {
+	if len(rc.Spec.Config) == 0 {
+		return nil
+	}
+	util.LoggerFrom(ctx, r.logger).V(2).Info(fmt.Sprintf("setting the custom config on redis %s: %v", node.IP, util.RedactConfig(rc.Spec.Config)))
+	r.metrics.IncHealAction(rc.Namespace, rc.Name, metrics.HealSetRedisConfig)
+	return r.redisClient.SetCustomRedisConfig(ctx, node.IP, rc.Spec.Config, node.Version, auth)
+}
+
+// MigrateSlot moves the slot and its keys from the source master to the target one. It can be
+// run again on a slot whose migration was interrupted, a slot already owned by the target is
+// only assigned to it on the source
+func (r *ShardedClusterHealer) MigrateSlot(ctx context.Context, slot int, source *ShardNode, target *ShardNode, rc *rsv1.RedisCluster, auth *util.AuthConfig) error {
+	r.metrics.IncHealAction(rc.Namespace, rc.Name, metrics.HealClusterMigrateSlot)
+	err := r.redisClient.ClusterSetSlot(ctx, target.IP, slot, redisclient.SlotImporting, source.Self.ID, auth)
+	if err != nil && !strings.Contains(err.Error(), "already the owner") {
+		return err
+	}
+	if err == nil {
+		err = r.redisClient.ClusterSetSlot(ctx, source.IP, slot, redisclient.SlotMigrating, target.Self.ID, auth)
+		if err != nil && !strings.Contains(err.Error(), "not the owner") {
+			return err
+		}
+		if err == nil {
+			if err := r.migrateKeys(ctx, slot, source, target, rc, auth); err != nil {
+				return err
+			}
+		}
+	}
+	if err := r.redisClient.ClusterSetSlot(ctx, target.IP, slot, redisclient.SlotNode, target.Self.ID, auth); err != nil {
+		return err
+	}
+	return r.redisClient.ClusterSetSlot(ctx, source.IP, slot, redisclient.SlotNode, target.Self.ID, auth)
+}
+
+// migrateKeys moves the keys of the slot in batches until the source has none left
+func (r *ShardedClusterHealer) migrateKeys(ctx context.Context, slot int, source *ShardNode, target *ShardNode, rc *rsv1.RedisCluster, auth *util.AuthConfig) error {
+	for {
+		keys, err := r.redisClient.ClusterGetKeysInSlot(ctx, source.IP, slot, int(rc.Spec.Rebalance.KeysPerMigrate), auth)
+		if err != nil {
+			return err
+		}
+		if len(keys) == 0 {
+			return nil
+		}
+		if err := r.redisClient.MigrateKeys(ctx, source.IP, target.IP, keys, migrateTimeout, auth); err != nil {
+			return err
+		}
+	}
+}
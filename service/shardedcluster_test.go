@@ -0,0 +1,55 @@
+package service
+
+import (
+	"context"
+	"testing"
+
+	policyv1beta1 "k8s.io/api/policy/v1beta1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/apimachinery/pkg/util/intstr"
+
+	rsv1 "redis-sentinel/api/v1"
+)
+
+func TestEnsureShardPodDisruptionBudget(t *testing.T) {
+	rc := &rsv1.RedisCluster{
+		ObjectMeta: metav1.ObjectMeta{Name: "test", Namespace: testNamespace},
+		Spec:       rsv1.RedisClusterSpec{Shards: 3, ReplicasPerShard: 1},
+	}
+	labels := map[string]string{"app": "redis"}
+	r, cli := newFakeKubeClient(t)
+
+	get := func() *policyv1beta1.PodDisruptionBudget {
+		pdb := &policyv1beta1.PodDisruptionBudget{}
+		name := types.NamespacedName{Namespace: testNamespace, Name: "redis-shard-test-0"}
+		if err := cli.Get(context.TODO(), name, pdb); err != nil {
+			t.Fatal(err)
+		}
+		return pdb
+	}
+
+	if err := ensurePodDisruptionBudget(r.K8SService, generateShardPodDisruptionBudget(rc, 0, labels, nil)); err != nil {
+		t.Fatal(err)
+	}
+	if pdb := get(); pdb.Spec.MaxUnavailable == nil || pdb.Spec.MaxUnavailable.IntValue() != 1 {
+		t.Errorf("default budget = %+v, want maxUnavailable 1", pdb.Spec)
+	}
+
+	minAvailable := intstr.FromInt(1)
+	rc.Spec.PDB = &rsv1.PDBComponentSettings{MinAvailable: &minAvailable}
+	if err := ensurePodDisruptionBudget(r.K8SService, generateShardPodDisruptionBudget(rc, 0, labels, nil)); err != nil {
+		t.Fatal(err)
+	}
+	if pdb := get(); pdb.Spec.MaxUnavailable != nil || pdb.Spec.MinAvailable == nil || pdb.Spec.MinAvailable.IntValue() != 1 {
+		t.Errorf("budget of the spec = %+v, want minAvailable 1", pdb.Spec)
+	}
+
+	labels["team"] = "cache"
+	if err := ensurePodDisruptionBudget(r.K8SService, generateShardPodDisruptionBudget(rc, 0, labels, nil)); err != nil {
+		t.Fatal(err)
+	}
+	if pdb := get(); pdb.Spec.Selector.MatchLabels["team"] != "cache" {
+		t.Errorf("selector = %v, want the new labels", pdb.Spec.Selector.MatchLabels)
+	}
+}
@@ -0,0 +1,132 @@
+package service
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"sort"
+	"strconv"
+
+	rsv1 "redis-sentinel/api/v1"
+	"redis-sentinel/pkg/metrics"
+	"redis-sentinel/pkg/util"
+)
+
+// ReplicaOfSource is the master replicated by a standby cluster
+type ReplicaOfSource struct {
+	Host string
+	Port string
+	Auth *util.AuthConfig
+}
+
+func (s *ReplicaOfSource) String() string {
+	return net.JoinHostPort(s.Host, s.Port)
+}
+
+// GetReplicaOfSource returns the address and the password of the source of a standby cluster,
+// a source RedisSentinel is reached through its master service
+func (r *RedisClusterChecker) GetReplicaOfSource(rs *rsv1.RedisSentinel) (*ReplicaOfSource, error) {
+	replicaOf := rs.Spec.ReplicaOf
+	if replicaOf.Name == "" {
+		password := replicaOf.Password
+		if password == "" {
+			password = rs.Spec.Password
+		}
+		return &ReplicaOfSource{
+			Host: replicaOf.Host,
+			Port: strconv.Itoa(int(replicaOf.Port)),
+			Auth: &util.AuthConfig{Password: password},
+		}, nil
+	}
+
+	source, err := r.k8sService.GetCluster(replicaOf.Namespace, replicaOf.Name)
+	if err != nil {
+		return nil, fmt.Errorf("source %s/%s: %v", replicaOf.Namespace, replicaOf.Name, err)
+	}
+	if source.Spec.ReplicaOf != nil {
+		return nil, fmt.Errorf("source %s/%s is a standby itself", replicaOf.Namespace, replicaOf.Name)
+	}
+	password := replicaOf.Password
+	if password == "" {
+		password = source.Spec.Password
+	}
+	return &ReplicaOfSource{
+		Host: util.GetServiceFQDN(util.GetRedisMasterName(source), source.Namespace),
+		Port: strconv.Itoa(redisPort),
+		Auth: &util.AuthConfig{Password: password},
+	}, nil
+}
+
+// GetStandbyHead returns the redis replicating the source: the one already doing it, the head
+// recorded on the status, or the oldest master or redis when the cluster becomes a standby
+func (r *RedisClusterChecker) GetStandbyHead(topo *Topology, source *ReplicaOfSource, rs *rsv1.RedisSentinel) *RedisNode {
+	for _, node := range topo.Redises {
+		if node.MasterHost == source.Host && node.MasterPort == source.Port {
+			return node
+		}
+	}
+	if rs.Status.Replication != nil {
+		for _, node := range topo.Redises {
+			if node.Pod.Name == rs.Status.Replication.Head {
+				return node
+			}
+		}
+	}
+	nodes := make([]*RedisNode, len(topo.Redises))
+	copy(nodes, topo.Redises)
+	sort.SliceStable(nodes, func(i, j int) bool {
+		if nodes[i].IsMaster != nodes[j].IsMaster {
+			return nodes[i].IsMaster
+		}
+		return nodes[i].Pod.CreationTimestamp.Before(&nodes[j].Pod.CreationTimestamp)
+	})
+	if len(nodes) == 0 {
+		return nil
+	}
+	return nodes[0]
+}
+
+// GetSourceOffset returns the replication offset of the source
+func (r *RedisClusterChecker) GetSourceOffset(ctx context.Context, source *ReplicaOfSource) (int64, error) {
+	repl, err := r.redisClient.GetSourceReplicationInfo(ctx, source.Host, source.Port, source.Auth)
+	if err != nil {
+		return 0, err
+	}
+	return repl.Offset, nil
+}
+
+// ReplicateSource makes the head of a standby replicate the source, authenticating with the
+// password of the source
+func (r *RedisClusterHealer) ReplicateSource(ctx context.Context, head *RedisNode, source *ReplicaOfSource, rs *rsv1.RedisSentinel, auth *util.AuthConfig) error {
+	r.metrics.IncHealAction(rs.Namespace, rs.Name, metrics.HealReplicateSource)
+	util.LoggerFrom(ctx, r.logger).V(2).Info(fmt.Sprintf("making pod %s replica of the source %s", head.Pod.Name, source))
+	if err := r.redisClient.SetCustomRedisConfig(ctx, head.IP, map[string]string{"masterauth": source.Auth.Password}, head.Version, auth); err != nil {
+		return err
+	}
+	return r.redisClient.MakeSlaveOf(ctx, head.IP, source.Host, source.Port, head.Version, auth)
+}
+
+// SetStandbyReplicas makes all the other redis replicate the head of the standby
+func (r *RedisClusterHealer) SetStandbyReplicas(ctx context.Context, head *RedisNode, topo *Topology, rs *rsv1.RedisSentinel, auth *util.AuthConfig) error {
+	r.metrics.IncHealAction(rs.Namespace, rs.Name, metrics.HealSetMasterOnAll)
+	for _, node := range topo.Redises {
+		if node == head {
+			continue
+		}
+		util.LoggerFrom(ctx, r.logger).V(2).Info(fmt.Sprintf("making pod %s slave of %s", node.Pod.Name, head.IP))
+		if err := r.redisClient.MakeSlaveOf(ctx, node.IP, head.AnnounceHost, head.AnnouncePort, node.Version, auth); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// PromoteStandby detaches the head of the standby from the source, it becomes the master
+func (r *RedisClusterHealer) PromoteStandby(ctx context.Context, head *RedisNode, rs *rsv1.RedisSentinel, auth *util.AuthConfig) error {
+	r.metrics.IncHealAction(rs.Namespace, rs.Name, metrics.HealPromoteStandby)
+	util.LoggerFrom(ctx, r.logger).V(2).Info(fmt.Sprintf("promoting pod %s", head.Pod.Name))
+	if err := r.redisClient.MakeMaster(ctx, head.IP, head.Version, auth); err != nil {
+		return err
+	}
+	return r.redisClient.SetCustomRedisConfig(ctx, head.IP, map[string]string{"masterauth": auth.Password}, head.Version, auth)
+}
@@ -0,0 +1,154 @@
+package service
+
+import (
+	"fmt"
+
+	appsv1 "k8s.io/api/apps/v1"
+	corev1 "k8s.io/api/core/v1"
+	storagev1 "k8s.io/api/storage/v1"
+	"k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/api/resource"
+
+	rsv1 "redis-sentinel/api/v1"
+	"redis-sentinel/pkg/util"
+)
+
+// StorageResizing is returned while the persistent volume claims of the redis are expanded,
+// the reconcile has to be retried until the statefulset is recreated with the new size
+type StorageResizing struct {
+	Size    string
+	Resized int
+	Total   int
+	// Recreating is true once all the claims are resized and the statefulset is being recreated
+	Recreating bool
+}
+
+func (e *StorageResizing) Error() string {
+	if e.Recreating {
+		return fmt.Sprintf("persistent volume claims resized to %s, recreating the redis statefulset", e.Size)
+	}
+	return fmt.Sprintf("resized %d of %d persistent volume claims to %s", e.Resized, e.Total, e.Size)
+}
+
+// storageGrows is true when the requested size of the redis volumes is above the one of the
+// statefulset
+func storageGrows(rs *rsv1.RedisSentinel, ss *appsv1.StatefulSet) bool {
+	claim := rs.Spec.Storage.PersistentVolumeClaim
+	if claim == nil || len(ss.Spec.VolumeClaimTemplates) == 0 {
+		return false
+	}
+	desired := claim.Spec.Resources.Requests[corev1.ResourceStorage]
+	current := ss.Spec.VolumeClaimTemplates[0].Spec.Resources.Requests[corev1.ResourceStorage]
+	return desired.Cmp(current) > 0
+}
+
+// recreatingStatefulSet returns the StorageResizing error while the statefulset deleted by
+// expandRedisStorage is still terminating, it must not be updated nor deleted again. It is
+// created with the new claim size once it is gone, on the next reconcile.
+func recreatingStatefulSet(rs *rsv1.RedisSentinel, ss *appsv1.StatefulSet) error {
+	if ss.DeletionTimestamp == nil {
+		return nil
+	}
+	resizing := &StorageResizing{Recreating: true}
+	if claim := rs.Spec.Storage.PersistentVolumeClaim; claim != nil {
+		size := claim.Spec.Resources.Requests[corev1.ResourceStorage]
+		resizing.Size = size.String()
+	}
+	return resizing
+}
+
+// expandRedisStorage resizes the persistent volume claims of the redis when the requested size
+// grew. The volumeClaimTemplates of a statefulset are immutable, once all the claims are resized
+// the statefulset is deleted leaving its pods running, and created again on the next reconcile.
+func (r *RedisSentinelKubeClient) expandRedisStorage(rs *rsv1.RedisSentinel, ss *appsv1.StatefulSet) error {
+	claim := rs.Spec.Storage.PersistentVolumeClaim
+	if claim == nil || len(ss.Spec.VolumeClaimTemplates) == 0 {
+		return nil
+	}
+	desired := claim.Spec.Resources.Requests[corev1.ResourceStorage]
+	current := ss.Spec.VolumeClaimTemplates[0].Spec.Resources.Requests[corev1.ResourceStorage]
+	switch desired.Cmp(current) {
+	case 0:
+		return nil
+	case -1:
+		return util.InvalidSpec(fmt.Errorf("redis storage can't shrink from %s to %s", current.String(), desired.String()))
+	}
+
+	if err := r.checkVolumeExpansion(claim); err != nil {
+		return err
+	}
+
+	pvcs, err := r.K8SService.ListPersistentVolumeClaims(rs.Namespace, generateSelectorLabels(util.RedisRoleName, rs.Name))
+	if err != nil {
+		return err
+	}
+	resizing := &StorageResizing{Size: desired.String(), Total: len(pvcs.Items)}
+	for i := range pvcs.Items {
+		pvc := &pvcs.Items[i]
+		requested := pvc.Spec.Resources.Requests[corev1.ResourceStorage]
+		if requested.Cmp(desired) < 0 {
+			if pvc.Spec.Resources.Requests == nil {
+				pvc.Spec.Resources.Requests = corev1.ResourceList{}
+			}
+			pvc.Spec.Resources.Requests[corev1.ResourceStorage] = desired
+			if err := r.K8SService.UpdatePersistentVolumeClaim(rs.Namespace, pvc); err != nil {
+				return err
+			}
+			continue
+		}
+		if isVolumeResized(pvc, desired) {
+			resizing.Resized++
+		}
+	}
+	if resizing.Resized < resizing.Total {
+		return resizing
+	}
+
+	if err := r.K8SService.DeleteStatefulSetOrphan(rs.Namespace, ss.Name); err != nil && !errors.IsNotFound(err) {
+		return err
+	}
+	resizing.Recreating = true
+	return resizing
+}
+
+// checkVolumeExpansion returns an error if the StorageClass of the claim doesn't allow expanding it.
+// A namespace scoped operator can't read the StorageClasses, the resize of the claims fails instead
+func (r *RedisSentinelKubeClient) checkVolumeExpansion(claim *corev1.PersistentVolumeClaim) error {
+	if !util.IsClusterScoped() {
+		return nil
+	}
+	var (
+		sc  *storagev1.StorageClass
+		err error
+	)
+	if claim.Spec.StorageClassName != nil && *claim.Spec.StorageClassName != "" {
+		sc, err = r.K8SService.GetStorageClass(*claim.Spec.StorageClassName)
+	} else {
+		sc, err = r.K8SService.GetDefaultStorageClass()
+	}
+	if err != nil {
+		return err
+	}
+	if sc == nil {
+		return util.NeedsHuman(fmt.Errorf("redis storage has no StorageClass, it can't be expanded"))
+	}
+	if sc.AllowVolumeExpansion == nil || !*sc.AllowVolumeExpansion {
+		return util.NeedsHuman(fmt.Errorf("StorageClass %s doesn't allow volume expansion", sc.Name))
+	}
+	return nil
+}
+
+// isVolumeResized returns true when the volume of the claim has the given size and its filesystem was resized
+func isVolumeResized(pvc *corev1.PersistentVolumeClaim, size resource.Quantity) bool {
+	capacity := pvc.Status.Capacity[corev1.ResourceStorage]
+	if capacity.Cmp(size) < 0 {
+		return false
+	}
+	for _, c := range pvc.Status.Conditions {
+		if (c.Type == corev1.PersistentVolumeClaimResizing || c.Type == corev1.PersistentVolumeClaimFileSystemResizePending) &&
+			c.Status == corev1.ConditionTrue {
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,236 @@
+package service
+
+import (
+	"context"
+	"testing"
+
+	"github.com/go-logr/logr"
+	appsv1 "k8s.io/api/apps/v1"
+	corev1 "k8s.io/api/core/v1"
+	storagev1 "k8s.io/api/storage/v1"
+	"k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/api/resource"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/types"
+	clientgoscheme "k8s.io/client-go/kubernetes/scheme"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+	logf "sigs.k8s.io/controller-runtime/pkg/log"
+
+	rsv1 "redis-sentinel/api/v1"
+	"redis-sentinel/pkg/k8s"
+	"redis-sentinel/pkg/util"
+)
+
+const testNamespace = "testns"
+
+var storageClasses = []runtime.Object{
+	newStorageClass("expandable", true),
+	newStorageClass("fixed", false),
+}
+
+func newStorageClass(name string, expandable bool) *storagev1.StorageClass {
+	return &storagev1.StorageClass{
+		ObjectMeta:           metav1.ObjectMeta{Name: name},
+		AllowVolumeExpansion: &expandable,
+	}
+}
+
+func newStorageCluster(size string) *rsv1.RedisSentinel {
+	className := "expandable"
+	rs := &rsv1.RedisSentinel{
+		ObjectMeta: metav1.ObjectMeta{Name: "test", Namespace: testNamespace},
+	}
+	rs.Spec.Storage.PersistentVolumeClaim = &corev1.PersistentVolumeClaim{
+		ObjectMeta: metav1.ObjectMeta{Name: "data"},
+		Spec: corev1.PersistentVolumeClaimSpec{
+			StorageClassName: &className,
+			Resources: corev1.ResourceRequirements{
+				Requests: corev1.ResourceList{corev1.ResourceStorage: resource.MustParse(size)},
+			},
+		},
+	}
+	return rs
+}
+
+func newStorageStatefulSet(rs *rsv1.RedisSentinel, size string) *appsv1.StatefulSet {
+	claim := newStorageCluster(size).Spec.Storage.PersistentVolumeClaim
+	return &appsv1.StatefulSet{
+		ObjectMeta: metav1.ObjectMeta{Name: util.GetRedisName(rs), Namespace: testNamespace},
+		Spec: appsv1.StatefulSetSpec{
+			VolumeClaimTemplates: []corev1.PersistentVolumeClaim{*claim},
+		},
+	}
+}
+
+// newClaim returns a claim of the redis of the named cluster, capacity is empty while the
+// volume is not resized
+func newClaim(name, cluster, requested, capacity string) *corev1.PersistentVolumeClaim {
+	pvc := &corev1.PersistentVolumeClaim{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      name,
+			Namespace: testNamespace,
+			Labels:    generateSelectorLabels(util.RedisRoleName, cluster),
+		},
+		Spec: corev1.PersistentVolumeClaimSpec{
+			Resources: corev1.ResourceRequirements{
+				Requests: corev1.ResourceList{corev1.ResourceStorage: resource.MustParse(requested)},
+			},
+		},
+	}
+	if capacity != "" {
+		pvc.Status.Capacity = corev1.ResourceList{corev1.ResourceStorage: resource.MustParse(capacity)}
+	}
+	return pvc
+}
+
+func newFakeKubeClient(t *testing.T, objs ...runtime.Object) (*RedisSentinelKubeClient, client.Client) {
+	scheme := runtime.NewScheme()
+	if err := clientgoscheme.AddToScheme(scheme); err != nil {
+		t.Fatal(err)
+	}
+	if err := rsv1.AddToScheme(scheme); err != nil {
+		t.Fatal(err)
+	}
+	cli := fake.NewFakeClientWithScheme(scheme, objs...)
+	var logger logr.Logger = logf.NullLogger{}
+	return NewRedisClusterKubeClient(k8s.New(cli, logger), logger), cli
+}
+
+func TestExpandRedisStorage(t *testing.T) {
+	tests := []struct {
+		name        string
+		class       string
+		desired     string
+		current     string
+		claims      []*corev1.PersistentVolumeClaim
+		wantKind    util.ErrorKind
+		wantResize  *StorageResizing
+		wantClaims  map[string]string
+		wantDeleted bool
+	}{
+		{
+			name:    "same size",
+			desired: "1Gi",
+			current: "1Gi",
+			claims:  []*corev1.PersistentVolumeClaim{newClaim("data-redis-test-0", "test", "1Gi", "1Gi")},
+		},
+		{
+			name:     "shrink",
+			desired:  "1Gi",
+			current:  "2Gi",
+			claims:   []*corev1.PersistentVolumeClaim{newClaim("data-redis-test-0", "test", "2Gi", "2Gi")},
+			wantKind: util.KindInvalidSpec,
+		},
+		{
+			name:     "storage class not expandable",
+			class:    "fixed",
+			desired:  "2Gi",
+			current:  "1Gi",
+			claims:   []*corev1.PersistentVolumeClaim{newClaim("data-redis-test-0", "test", "1Gi", "1Gi")},
+			wantKind: util.KindNeedsHuman,
+		},
+		{
+			name:    "claims of the cluster are resized",
+			desired: "2Gi",
+			current: "1Gi",
+			claims: []*corev1.PersistentVolumeClaim{
+				newClaim("data-redis-test-0", "test", "1Gi", "1Gi"),
+				newClaim("data-redis-test-1", "test", "1Gi", "1Gi"),
+				newClaim("data-redis-other-0", "other", "1Gi", "1Gi"),
+			},
+			wantResize: &StorageResizing{Size: "2Gi", Total: 2},
+			wantClaims: map[string]string{
+				"data-redis-test-0":  "2Gi",
+				"data-redis-test-1":  "2Gi",
+				"data-redis-other-0": "1Gi",
+			},
+		},
+		{
+			name:    "waiting for the volumes",
+			desired: "2Gi",
+			current: "1Gi",
+			claims: []*corev1.PersistentVolumeClaim{
+				newClaim("data-redis-test-0", "test", "2Gi", "2Gi"),
+				newClaim("data-redis-test-1", "test", "2Gi", "1Gi"),
+			},
+			wantResize: &StorageResizing{Size: "2Gi", Resized: 1, Total: 2},
+		},
+		{
+			name:    "all volumes resized",
+			desired: "2Gi",
+			current: "1Gi",
+			claims: []*corev1.PersistentVolumeClaim{
+				newClaim("data-redis-test-0", "test", "2Gi", "2Gi"),
+				newClaim("data-redis-test-1", "test", "2Gi", "2Gi"),
+			},
+			wantResize:  &StorageResizing{Size: "2Gi", Resized: 2, Total: 2, Recreating: true},
+			wantDeleted: true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rs := newStorageCluster(tt.desired)
+			if tt.class != "" {
+				rs.Spec.Storage.PersistentVolumeClaim.Spec.StorageClassName = &tt.class
+			}
+			ss := newStorageStatefulSet(rs, tt.current)
+			objs := append([]runtime.Object{ss}, storageClasses...)
+			for _, pvc := range tt.claims {
+				objs = append(objs, pvc)
+			}
+			r, cli := newFakeKubeClient(t, objs...)
+
+			err := r.expandRedisStorage(rs, ss)
+			switch {
+			case tt.wantResize != nil:
+				resizing, ok := err.(*StorageResizing)
+				if !ok {
+					t.Fatalf("expandRedisStorage() error = %v, want %v", err, tt.wantResize)
+				}
+				if *resizing != *tt.wantResize {
+					t.Errorf("expandRedisStorage() = %+v, want %+v", *resizing, *tt.wantResize)
+				}
+			case tt.wantKind != "":
+				if kind := util.KindOf(err); kind != tt.wantKind {
+					t.Errorf("expandRedisStorage() error kind = %q, want %q", kind, tt.wantKind)
+				}
+			case err != nil:
+				t.Fatalf("expandRedisStorage() error = %v", err)
+			}
+
+			for name, want := range tt.wantClaims {
+				pvc := &corev1.PersistentVolumeClaim{}
+				if err := cli.Get(context.TODO(), types.NamespacedName{Namespace: testNamespace, Name: name}, pvc); err != nil {
+					t.Fatal(err)
+				}
+				requested := pvc.Spec.Resources.Requests[corev1.ResourceStorage]
+				if requested.Cmp(resource.MustParse(want)) != 0 {
+					t.Errorf("claim %s requests %s, want %s", name, requested.String(), want)
+				}
+			}
+
+			err = cli.Get(context.TODO(), types.NamespacedName{Namespace: testNamespace, Name: ss.Name}, &appsv1.StatefulSet{})
+			if deleted := errors.IsNotFound(err); deleted != tt.wantDeleted {
+				t.Errorf("statefulset deleted = %v, want %v", deleted, tt.wantDeleted)
+			}
+		})
+	}
+}
+
+func TestRecreatingStatefulSet(t *testing.T) {
+	rs := newStorageCluster("2Gi")
+
+	ss := newStorageStatefulSet(rs, "1Gi")
+	if err := recreatingStatefulSet(rs, ss); err != nil {
+		t.Errorf("recreatingStatefulSet() = %v, want nil", err)
+	}
+
+	now := metav1.Now()
+	ss.DeletionTimestamp = &now
+	resizing, ok := recreatingStatefulSet(rs, ss).(*StorageResizing)
+	if !ok || !resizing.Recreating || resizing.Size != "2Gi" {
+		t.Errorf("recreatingStatefulSet() = %v, want a recreating resize to 2Gi", resizing)
+	}
+}
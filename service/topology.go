@@ -0,0 +1,274 @@
+package service
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"sync"
+
+	corev1 "k8s.io/api/core/v1"
+
+	rsv1 "redis-sentinel/api/v1"
+	"redis-sentinel/pkg/util"
+	"redis-sentinel/pkg/version"
+)
+
+// RedisNode is the state of a running redis pod when the topology was taken
+type RedisNode struct {
+	Pod *corev1.Pod
+	IP  string
+	// AnnounceHost and AnnouncePort are the address replicas and sentinels use to reach this redis
+	AnnounceHost string
+	AnnouncePort string
+	IsMaster     bool
+	// MasterHost and MasterPort are the master this redis replicates from, empty for a master
+	MasterHost string
+	MasterPort string
+	// MasterLinkUp, MasterLastIO and MasterSyncing are the state of the link of a replica to
+	// its master
+	MasterLinkUp  bool
+	MasterLastIO  int64
+	MasterSyncing bool
+	ReplOffset    int64
+	Config        map[string]string
+	// Zone is the zone of the node running the pod, only filled when a master zone is preferred
+	Zone string
+	// Cordoned is true when the node running the pod is unschedulable, its pod is about to be evicted
+	Cordoned bool
+	// Version is the flavor and version of the running server
+	Version *version.ServerVersion
+	// Err is why the redis couldn't be queried, the node is then in Topology.Unreachable
+	Err error
+}
+
+// SentinelNode is the view of a running sentinel pod when the topology was taken.
+// A sentinel that can't answer a query is not an error, the matching error field is set so
+// the sentinel is healed like one reporting a wrong value.
+type SentinelNode struct {
+	Pod          *corev1.Pod
+	IP           string
+	AnnounceHost string
+	AnnouncePort string
+	Version      *version.ServerVersion
+	// Config holds the announce parameters of the sentinel, only filled when they are managed
+	Config map[string]string
+
+	MonitorHost string
+	MonitorPort string
+	MonitorErr  error
+
+	NumSentinels    int32
+	NumSentinelsErr error
+
+	NumSlaves    int32
+	NumSlavesErr error
+}
+
+// Topology is a snapshot of the redis and sentinel nodes of a cluster. It is taken once
+// per reconcile and every check and heal decision is made from it.
+type Topology struct {
+	Redises   []*RedisNode
+	Sentinels []*SentinelNode
+	// Unreachable are the running redis that couldn't be queried, only their pod is known.
+	// The decisions are made without them, the ones they could change wait for them
+	Unreachable []*RedisNode
+	// redisPods holds all the redis pods, running or not
+	redisPods []corev1.Pod
+}
+
+// Masters returns the redis nodes working as a master
+func (t *Topology) Masters() []*RedisNode {
+	masters := []*RedisNode{}
+	for _, node := range t.Redises {
+		if node.IsMaster {
+			masters = append(masters, node)
+		}
+	}
+	return masters
+}
+
+// MasterDraining returns true when the node of the master is cordoned, so its pod is about
+// to be evicted, and a replica runs on a node that isn't
+func (t *Topology) MasterDraining(master *RedisNode) bool {
+	if !master.Cordoned {
+		return false
+	}
+	for _, node := range t.Redises {
+		if !node.IsMaster && !node.Cordoned {
+			return true
+		}
+	}
+	return false
+}
+
+// UnreachableError returns an error naming the unreachable redis, nil when all of them answered
+func (t *Topology) UnreachableError() error {
+	if len(t.Unreachable) == 0 {
+		return nil
+	}
+	names := make([]string, 0, len(t.Unreachable))
+	for _, node := range t.Unreachable {
+		names = append(names, node.Pod.Name)
+	}
+	return util.WaitingForPods(fmt.Errorf("redis %s unreachable: %v", strings.Join(names, ", "), t.Unreachable[0].Err))
+}
+
+// GetTopology queries all the running redis and sentinel pods of the cluster concurrently,
+// running at most the configured number of workers at the same time. A redis that can't be
+// queried doesn't fail the snapshot, it is recorded as unreachable
+func (r *RedisClusterChecker) GetTopology(ctx context.Context, rc *rsv1.RedisSentinel, auth *util.AuthConfig) (*Topology, error) {
+	rps, err := r.k8sService.GetStatefulSetPods(rc.Namespace, util.GetRedisName(rc))
+	if err != nil {
+		return nil, err
+	}
+	sps, err := r.k8sService.GetStatefulSetPods(rc.Namespace, util.GetSentinelName(rc))
+	if err != nil {
+		return nil, err
+	}
+
+	topo := &Topology{redisPods: rps.Items}
+	for i := range rps.Items {
+		if rps.Items[i].Status.Phase == corev1.PodRunning { // Only work with running pods
+			topo.Redises = append(topo.Redises, &RedisNode{Pod: &rps.Items[i], IP: rps.Items[i].Status.PodIP})
+		}
+	}
+	for i := range sps.Items {
+		if sps.Items[i].Status.Phase == corev1.PodRunning {
+			topo.Sentinels = append(topo.Sentinels, &SentinelNode{Pod: &sps.Items[i], IP: sps.Items[i].Status.PodIP})
+		}
+	}
+
+	tasks := make([]func() error, 0, len(topo.Redises)+len(topo.Sentinels))
+	for _, node := range topo.Redises {
+		node := node
+		tasks = append(tasks, func() error {
+			if node.Err = r.fillRedisNode(ctx, rc, node, auth); node.Err != nil {
+				// a cancelled reconcile must not be taken as an unreachable redis
+				return ctx.Err()
+			}
+			return nil
+		})
+	}
+	for _, node := range topo.Sentinels {
+		node := node
+		tasks = append(tasks, func() error {
+			return r.fillSentinelNode(ctx, rc, node, auth)
+		})
+	}
+	if err := runBounded(r.workers, tasks); err != nil {
+		return nil, err
+	}
+
+	reachable := topo.Redises[:0]
+	for _, node := range topo.Redises {
+		if node.Err != nil {
+			util.LoggerFrom(ctx, r.logger).Info("redis unreachable", "pod", node.Pod.Name, "error", node.Err.Error())
+			topo.Unreachable = append(topo.Unreachable, node)
+			continue
+		}
+		reachable = append(reachable, node)
+	}
+	topo.Redises = reachable
+	return topo, nil
+}
+
+// GetSentinelNode queries again the view of the given sentinel
+func (r *RedisClusterChecker) GetSentinelNode(ctx context.Context, rc *rsv1.RedisSentinel, sentinel *SentinelNode, auth *util.AuthConfig) (*SentinelNode, error) {
+	node := &SentinelNode{Pod: sentinel.Pod, IP: sentinel.IP}
+	if err := r.fillSentinelNode(ctx, rc, node, auth); err != nil {
+		return nil, err
+	}
+	return node, nil
+}
+
+func (r *RedisClusterChecker) fillRedisNode(ctx context.Context, rc *rsv1.RedisSentinel, node *RedisNode, auth *util.AuthConfig) error {
+	var err error
+	node.AnnounceHost, node.AnnouncePort, err = getAnnounceAddr(r.k8sService, rc, node.Pod, redisPort)
+	if err != nil {
+		return err
+	}
+	if node.Version, err = r.redisClient.GetRedisVersion(ctx, node.IP, auth); err != nil {
+		return err
+	}
+	if err := node.Version.CheckSupported(); err != nil {
+		return fmt.Errorf("redis pod %s: %v", node.Pod.Name, err)
+	}
+	repl, err := r.redisClient.GetReplicationInfo(ctx, node.IP, auth)
+	if err != nil {
+		return err
+	}
+	node.IsMaster = repl.IsMaster
+	node.MasterHost = repl.MasterHost
+	node.MasterPort = repl.MasterPort
+	node.ReplOffset = repl.Offset
+	node.MasterLinkUp = repl.LinkUp
+	node.MasterLastIO = repl.LastIOSecondsAgo
+	node.MasterSyncing = repl.SyncInProgress
+	node.Config, err = r.redisClient.GetAllRedisConfig(ctx, node.IP, auth)
+	if err != nil {
+		return err
+	}
+	if node.Pod.Spec.NodeName == "" || !util.IsClusterScoped() {
+		return nil
+	}
+	k8sNode, err := r.k8sService.GetNode(node.Pod.Spec.NodeName)
+	if err != nil {
+		return err
+	}
+	if rc.Spec.Placement != nil && rc.Spec.Placement.PreferredMasterZone != "" {
+		node.Zone = k8sNode.Labels[util.ZoneTopologyKey]
+	}
+	node.Cordoned = k8sNode.Spec.Unschedulable
+	return nil
+}
+
+func (r *RedisClusterChecker) fillSentinelNode(ctx context.Context, rc *rsv1.RedisSentinel, node *SentinelNode, auth *util.AuthConfig) error {
+	var err error
+	node.AnnounceHost, node.AnnouncePort, err = getAnnounceAddr(r.k8sService, rc, node.Pod, sentinelPort)
+	if err != nil {
+		return err
+	}
+	if node.Version, err = r.redisClient.GetSentinelVersion(ctx, node.IP, auth); err != nil {
+		return err
+	}
+	if err := node.Version.CheckSupported(); err != nil {
+		return fmt.Errorf("sentinel pod %s: %v", node.Pod.Name, err)
+	}
+	if useAnnounce(rc) {
+		if node.Config, err = r.redisClient.GetSentinelConfig(ctx, node.IP, auth); err != nil {
+			return err
+		}
+	}
+	node.MonitorHost, node.MonitorPort, node.MonitorErr = r.redisClient.GetSentinelMonitor(ctx, node.IP, auth)
+	node.NumSentinels, node.NumSentinelsErr = r.redisClient.GetNumberSentinelsInMemory(ctx, node.IP, auth)
+	node.NumSlaves, node.NumSlavesErr = r.redisClient.GetNumberSentinelSlavesInMemory(ctx, node.IP, node.Version, auth)
+	// a cancelled reconcile must not be taken as a sentinel to heal
+	return ctx.Err()
+}
+
+// runBounded runs the tasks with at most workers of them at the same time and returns the first error
+func runBounded(workers int, tasks []func() error) error {
+	if workers < 1 {
+		workers = 1
+	}
+	var (
+		wg       sync.WaitGroup
+		once     sync.Once
+		firstErr error
+	)
+	sem := make(chan struct{}, workers)
+	for _, task := range tasks {
+		task := task
+		wg.Add(1)
+		sem <- struct{}{}
+		go func() {
+			defer wg.Done()
+			defer func() { <-sem }()
+			if err := task(); err != nil {
+				once.Do(func() { firstErr = err })
+			}
+		}()
+	}
+	wg.Wait()
+	return firstErr
+}
@@ -0,0 +1,174 @@
+package service
+
+import (
+	"errors"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+
+	"redis-sentinel/pkg/util"
+)
+
+func TestRunBounded(t *testing.T) {
+	errFailed := errors.New("failed")
+	tests := []struct {
+		name    string
+		workers int
+		tasks   int
+		failing map[int]bool
+		wantErr error
+	}{
+		{
+			name:    "no task",
+			workers: 2,
+		},
+		{
+			name:    "all succeed",
+			workers: 3,
+			tasks:   10,
+		},
+		{
+			name:    "workers below one run one at a time",
+			workers: 0,
+			tasks:   4,
+		},
+		{
+			name:    "a task fails",
+			workers: 2,
+			tasks:   6,
+			failing: map[int]bool{3: true},
+			wantErr: errFailed,
+		},
+		{
+			name:    "several tasks fail",
+			workers: 4,
+			tasks:   8,
+			failing: map[int]bool{1: true, 5: true},
+			wantErr: errFailed,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var (
+				mu      sync.Mutex
+				running int
+				peak    int
+				ran     int32
+			)
+			limit := tt.workers
+			if limit < 1 {
+				limit = 1
+			}
+			tasks := make([]func() error, 0, tt.tasks)
+			for i := 0; i < tt.tasks; i++ {
+				i := i
+				tasks = append(tasks, func() error {
+					mu.Lock()
+					running++
+					if running > peak {
+						peak = running
+					}
+					mu.Unlock()
+					time.Sleep(time.Millisecond)
+					mu.Lock()
+					running--
+					mu.Unlock()
+					atomic.AddInt32(&ran, 1)
+					if tt.failing[i] {
+						return errFailed
+					}
+					return nil
+				})
+			}
+
+			if err := runBounded(tt.workers, tasks); err != tt.wantErr {
+				t.Errorf("runBounded() error = %v, want %v", err, tt.wantErr)
+			}
+			if int(ran) != tt.tasks {
+				t.Errorf("runBounded() ran %d tasks, want %d", ran, tt.tasks)
+			}
+			if peak > limit {
+				t.Errorf("runBounded() ran %d tasks at the same time, want at most %d", peak, limit)
+			}
+		})
+	}
+}
+
+func TestTopologyUnreachableError(t *testing.T) {
+	unreachable := &RedisNode{
+		Pod: &corev1.Pod{ObjectMeta: metav1.ObjectMeta{Name: "redis-cluster-foo-1"}},
+		Err: errors.New("connection refused"),
+	}
+	tests := []struct {
+		name    string
+		topo    *Topology
+		wantErr bool
+	}{
+		{
+			name: "all reachable",
+			topo: &Topology{Redises: []*RedisNode{{}}},
+		},
+		{
+			name:    "one unreachable",
+			topo:    &Topology{Redises: []*RedisNode{{}}, Unreachable: []*RedisNode{unreachable}},
+			wantErr: true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := tt.topo.UnreachableError()
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("UnreachableError() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if err != nil && util.KindOf(err) != util.KindWaitingForPods {
+				t.Errorf("UnreachableError() kind = %v, want %v", util.KindOf(err), util.KindWaitingForPods)
+			}
+		})
+	}
+}
+
+func TestTopologyMasterDraining(t *testing.T) {
+	tests := []struct {
+		name     string
+		cordoned []bool
+		want     bool
+	}{
+		{
+			name:     "no node cordoned",
+			cordoned: []bool{false, false, false},
+		},
+		{
+			name:     "node of the master cordoned",
+			cordoned: []bool{true, false, false},
+			want:     true,
+		},
+		{
+			name:     "nodes of the master and a replica cordoned",
+			cordoned: []bool{true, true, false},
+			want:     true,
+		},
+		{
+			name:     "every node cordoned",
+			cordoned: []bool{true, true, true},
+		},
+		{
+			name:     "node of a replica cordoned",
+			cordoned: []bool{false, true, false},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			topo := &Topology{}
+			for i, cordoned := range tt.cordoned {
+				topo.Redises = append(topo.Redises, &RedisNode{IsMaster: i == 0, Cordoned: cordoned})
+			}
+			if got := topo.MasterDraining(topo.Redises[0]); got != tt.want {
+				t.Errorf("MasterDraining() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
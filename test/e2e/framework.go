@@ -161,8 +161,8 @@ package e2e
 //				time.Sleep(time.Second * 5)
 //				continue
 //			}
-//			f.Logf("check redis cluster status, expecting Healthy, current %s", result.Status.Conditions[0].Type)
-//			if result.Status.Conditions[0].Type == rsv1.ClusterConditionHealthy {
+//			f.Logf("check redis cluster status, expecting Running, current %s", result.Status.Phase)
+//			if result.Status.Phase == rsv1.PhaseRunning {
 //				return
 //			}
 //			time.Sleep(time.Second * 5)